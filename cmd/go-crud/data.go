@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+
+	"go-crud/config"
+	"go-crud/fixtures"
+	"go-crud/models"
+)
+
+// runSeed writes a fixture file, or the built-in sample data, to a database without users
+// and prints the accounts it created. It refuses to run when APP_ENV is production.
+func runSeed(args []string) int {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	file := fs.String("file", "", "YAML or JSON fixture file (default: the built-in sample data)")
+	seed := fs.Int64("seed", 0, "seed for generated data (default: the file's seed, or 1)")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if config.AppConfig.IsProduction() {
+		fmt.Fprintln(os.Stderr, "seed:", fixtures.ErrProduction)
+		return exitForbidden
+	}
+
+	var set *fixtures.Set
+	var err error
+	if *file == "" {
+		set, err = fixtures.Sample()
+	} else {
+		set, err = fixtures.Load(*file)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "seed:", err)
+		return exitUsage
+	}
+	if *seed == 0 {
+		*seed = set.Seed
+	}
+	if *seed == 0 {
+		*seed = 1
+	}
+
+	if code, ok := openDatabase(); !ok {
+		return code
+	}
+	defer models.DB.Close()
+	if code, ok := requireSchema(); !ok {
+		return code
+	}
+
+	// Fixtures refer to users by email, so they only go into a database without users
+	users, err := models.GetUsers(1)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "seed:", err)
+		return exitFailure
+	}
+	if len(users) > 0 {
+		fmt.Fprintln(os.Stderr, "seed: database already has users; seed only fills an empty database")
+		return exitConflict
+	}
+
+	result, err := fixtures.Seed(set, *seed)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "seed:", err)
+		return exitFailure
+	}
+
+	fmt.Printf("seeded %d users, %d roles, %d products, %d addresses and %d orders (seed %d)\n",
+		len(result.Users), result.Roles, result.Products, result.Addresses, result.Orders, *seed)
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "EMAIL\tPASSWORD")
+	for _, u := range result.Users {
+		fmt.Fprintf(w, "%s\t%s\n", u.Email, u.Password)
+	}
+	w.Flush()
+	return exitOK
+}
+
+// runExport writes every table as JSON to the named file, or to stdout
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, "usage: go-crud export [file]") }
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	if code, ok := openDatabase(); !ok {
+		return code
+	}
+	defer models.DB.Close()
+
+	path := fs.Arg(0)
+	var w io.Writer = os.Stdout
+	if path != "" && path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "export:", err)
+			return exitFailure
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := models.ExportData(w); err != nil {
+		fmt.Fprintln(os.Stderr, "export:", err)
+		if w != os.Stdout {
+			os.Remove(path)
+		}
+		return exitFailure
+	}
+	return exitOK
+}
+
+// runImport loads a file written by export, or stdin, into an empty database at the
+// export's schema version
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.Usage = func() { fmt.Fprintln(os.Stderr, "usage: go-crud import [file]") }
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	var r io.Reader = os.Stdin
+	if path := fs.Arg(0); path != "" && path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "import:", err)
+			return exitFailure
+		}
+		defer f.Close()
+		r = f
+	}
+
+	if code, ok := openDatabase(); !ok {
+		return code
+	}
+	defer models.DB.Close()
+
+	err := models.ImportData(r)
+	switch {
+	case errors.Is(err, models.ErrImportSchemaVersion):
+		fmt.Fprintln(os.Stderr, "import:", err)
+		return exitSchema
+	case errors.Is(err, models.ErrImportNotEmpty):
+		fmt.Fprintln(os.Stderr, "import:", err)
+		return exitConflict
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "import:", err)
+		return exitFailure
+	}
+	fmt.Println("data imported")
+	return exitOK
+}
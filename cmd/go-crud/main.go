@@ -0,0 +1,142 @@
+// Command go-crud runs the API server and its operational tasks:
+//
+//	go-crud serve
+//	go-crud migrate up|down|status|redo
+//	go-crud seed [-file fixtures.yaml] [-seed n]
+//	go-crud create-admin [-email address] [-password secret | -password-stdin]
+//	go-crud reset-password -email address [-password secret | -password-stdin]
+//	go-crud list-users [-limit n] [-json]
+//	go-crud export [file]
+//	go-crud import [file]
+//	go-crud openapi [-version n] [-check]
+//
+// Every command reads the same environment and .env file as the server.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"go-crud/config"
+	"go-crud/models"
+)
+
+// Exit codes, so deployment scripts can tell failures apart
+const (
+	exitOK        = 0
+	exitFailure   = 1 // the command failed
+	exitUsage     = 2 // unknown command or invalid arguments
+	exitDatabase  = 3 // the database could not be opened or reached
+	exitSchema    = 4 // migrations are pending, or applied ones do not match this build
+	exitConflict  = 5 // the user or data the command expects is missing or already exists
+	exitForbidden = 6 // the command is not allowed in this environment (APP_ENV=production)
+)
+
+const usage = `usage: go-crud <command> [arguments]
+
+commands:
+  serve           run the API server
+  migrate         apply, revert or list schema migrations
+  seed            add fixture or sample data to an empty database
+  create-admin    create the admin account
+  reset-password  set a user's password
+  list-users      list user accounts
+  export          write all data as JSON
+  import          load data written by export into an empty database
+  openapi         print the OpenAPI document, or check that every route is in it
+
+Run "go-crud <command> -h" for a command's arguments.`
+
+type command func(args []string) int
+
+var commands = map[string]command{
+	"serve":          runServe,
+	"migrate":        runMigrate,
+	"seed":           runSeed,
+	"create-admin":   runCreateAdmin,
+	"reset-password": runResetPassword,
+	"list-users":     runListUsers,
+	"export":         runExport,
+	"import":         runImport,
+	"openapi":        runOpenAPI,
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, usage)
+		os.Exit(exitUsage)
+	}
+
+	name := os.Args[1]
+	if name == "-h" || name == "-help" || name == "help" {
+		fmt.Println(usage)
+		os.Exit(exitOK)
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s\n", name, usage)
+		os.Exit(exitUsage)
+	}
+
+	config.Initialize()
+	os.Exit(cmd(os.Args[2:]))
+}
+
+// parseFlags parses a command's flags; ok is false with the exit code when the command
+// should stop, after -h or an invalid flag
+func parseFlags(fs *flag.FlagSet, args []string) (code int, ok bool) {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return exitOK, false
+		}
+		return exitUsage, false
+	}
+	return exitOK, true
+}
+
+// openDatabase connects to the configured database and sets models.DB
+func openDatabase() (code int, ok bool) {
+	dsn := config.AppConfig.DBDSN
+	if dsn == "" {
+		dsn = config.AppConfig.DBPath
+	}
+
+	var err error
+	models.DB, err = models.Open(config.AppConfig.DBDriver, dsn)
+	if err != nil {
+		log.Println("Failed to connect to database:", err)
+		return exitDatabase, false
+	}
+
+	if err := models.DB.Ping(); err != nil {
+		models.DB.Close()
+		log.Println("Database unreachable:", err)
+		return exitDatabase, false
+	}
+	return exitOK, true
+}
+
+// requireSchema checks that the database has every migration applied
+func requireSchema() (code int, ok bool) {
+	pending, err := models.PendingMigrations()
+	if err != nil {
+		log.Println("Failed to check schema migrations:", err)
+		return schemaErrorCode(err), false
+	}
+	if len(pending) > 0 {
+		log.Printf("Database has %d pending migrations; run \"go-crud migrate up\" first", len(pending))
+		return exitSchema, false
+	}
+	return exitOK, true
+}
+
+// schemaErrorCode returns exitSchema for migrations that do not match this build
+func schemaErrorCode(err error) int {
+	if errors.Is(err, models.ErrMigrationModified) || errors.Is(err, models.ErrMigrationUnknown) {
+		return exitSchema
+	}
+	return exitFailure
+}
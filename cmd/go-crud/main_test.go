@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-crud/models"
+)
+
+// runMainEnv makes the test binary run main instead of the tests, so the tests can check
+// the exit codes main reports
+const runMainEnv = "GO_CRUD_TEST_RUN_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) == "1" {
+		main()
+		return
+	}
+	os.Exit(m.Run())
+}
+
+// cli runs go-crud commands against one SQLite database
+type cli struct {
+	t   *testing.T
+	db  string
+	env []string
+}
+
+func newCLI(t *testing.T) *cli {
+	return &cli{t: t, db: filepath.Join(t.TempDir(), "cli.db")}
+}
+
+// run runs go-crud with args and returns its exit code and output
+func (c *cli) run(stdin string, args ...string) (code int, stdout, stderr string) {
+	c.t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(),
+		runMainEnv+"=1",
+		"APP_ENV=development",
+		"DB_DRIVER=sqlite3",
+		"DB_DSN=",
+		"DB_PATH="+c.db,
+		"DEFAULT_ADMIN_EMAIL=admin@example.com",
+		"DEFAULT_ADMIN_PASSWORD=admin123",
+	)
+	cmd.Env = append(cmd.Env, c.env...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var out, errOut bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &out, &errOut
+
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	switch {
+	case errors.As(err, &exitErr):
+		code = exitErr.ExitCode()
+	case err != nil:
+		c.t.Fatalf("running go-crud %s: %v", strings.Join(args, " "), err)
+	}
+	return code, out.String(), errOut.String()
+}
+
+// expect runs go-crud and fails the test unless it exits with code
+func (c *cli) expect(code int, args ...string) string {
+	c.t.Helper()
+	got, stdout, stderr := c.run("", args...)
+	if got != code {
+		c.t.Fatalf("go-crud %s exited %d, want %d\nstdout: %s\nstderr: %s", strings.Join(args, " "), got, code, stdout, stderr)
+	}
+	return stdout
+}
+
+func TestUsage(t *testing.T) {
+	c := newCLI(t)
+	c.expect(exitUsage)
+	c.expect(exitUsage, "frobnicate")
+	if out := c.expect(exitOK, "help"); !strings.Contains(out, "create-admin") {
+		t.Errorf("help does not list the commands:\n%s", out)
+	}
+	c.expect(exitOK, "list-users", "-h")
+	c.expect(exitUsage, "list-users", "-nope")
+	c.expect(exitUsage, "list-users", "-limit", "0")
+}
+
+func TestMigrateCommand(t *testing.T) {
+	c := newCLI(t)
+	for _, args := range [][]string{{"migrate"}, {"migrate", "sideways"}, {"migrate", "up", "0"}, {"migrate", "status", "2"}, {"migrate", "up", "1", "2"}} {
+		c.expect(exitUsage, args...)
+	}
+
+	if out := c.expect(exitOK, "migrate", "status"); !strings.Contains(out, "0001_") || strings.Contains(out, "applied") {
+		t.Errorf("status of a new database:\n%s", out)
+	}
+	c.expect(exitSchema, "list-users")
+
+	if out := c.expect(exitOK, "migrate", "up", "2"); strings.Count(out, "applied") != 2 {
+		t.Errorf("migrate up 2:\n%s", out)
+	}
+	c.expect(exitOK, "migrate", "up")
+	if out := c.expect(exitOK, "migrate", "up"); !strings.Contains(out, "up to date") {
+		t.Errorf("migrate up on an up-to-date database:\n%s", out)
+	}
+	c.expect(exitOK, "list-users")
+
+	if out := c.expect(exitOK, "migrate", "down", "2"); strings.Count(out, "reverted") != 2 {
+		t.Errorf("migrate down 2:\n%s", out)
+	}
+	c.expect(exitSchema, "list-users")
+	c.expect(exitOK, "migrate", "up")
+	if out := c.expect(exitOK, "migrate", "redo"); !strings.Contains(out, "redone") {
+		t.Errorf("migrate redo:\n%s", out)
+	}
+
+	// An applied migration edited after it ran stops every command that needs the schema
+	db, err := models.Open(models.DriverSQLite, c.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec("UPDATE schema_migrations SET checksum = 'edited' WHERE version = 1")
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out := c.expect(exitSchema, "migrate", "status"); !strings.Contains(out, "checksum mismatch") {
+		t.Errorf("status with an edited migration:\n%s", out)
+	}
+	c.expect(exitSchema, "migrate", "up")
+	c.expect(exitSchema, "list-users")
+}
+
+func TestUserCommands(t *testing.T) {
+	c := newCLI(t)
+	c.expect(exitOK, "migrate", "up")
+
+	if code, out, errOut := c.run("s3cret-pass\n", "create-admin", "-password-stdin"); code != exitOK {
+		t.Fatalf("create-admin exited %d: %s%s", code, out, errOut)
+	}
+	c.expect(exitConflict, "create-admin")
+	c.expect(exitUsage, "create-admin", "-email", "ops@example.com", "-password", "short")
+	if code, _, _ := c.run("x\n", "create-admin", "-password", "abcdefg", "-password-stdin"); code != exitUsage {
+		t.Errorf("create-admin with both password flags exited %d", code)
+	}
+	if out := c.expect(exitOK, "create-admin", "-email", "ops@example.com", "-password", "opspass"); !strings.Contains(out, "DEFAULT_ADMIN_EMAIL") {
+		t.Errorf("creating an admin other than DEFAULT_ADMIN_EMAIL does not say how to use it:\n%s", out)
+	}
+
+	c.expect(exitUsage, "reset-password", "-email", "admin@example.com")
+	c.expect(exitConflict, "reset-password", "-email", "nobody@example.com", "-password", "newpass")
+	c.expect(exitOK, "reset-password", "-email", "admin@example.com", "-password", "newpass")
+
+	db, err := models.Open(models.DriverSQLite, c.db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	prev := models.DB
+	models.DB = db
+	_, err = models.LoginUser("admin@example.com", "newpass")
+	models.DB = prev
+	db.Close()
+	if err != nil {
+		t.Errorf("logging in with the reset password: %v", err)
+	}
+
+	var users []models.User
+	if err := json.Unmarshal([]byte(c.expect(exitOK, "list-users", "-json")), &users); err != nil {
+		t.Fatal(err)
+	}
+	if len(users) != 2 || users[0].Email != "admin@example.com" || users[0].Password != "" {
+		t.Errorf("list-users -json = %+v", users)
+	}
+	if out := c.expect(exitOK, "list-users", "-limit", "1"); strings.Contains(out, "ops@example.com") || !strings.Contains(out, "yes") {
+		t.Errorf("list-users -limit 1:\n%s", out)
+	}
+}
+
+func TestSeedExportAndImport(t *testing.T) {
+	c := newCLI(t)
+	c.expect(exitOK, "migrate", "up")
+
+	c.env = []string{"APP_ENV=production"}
+	c.expect(exitForbidden, "seed")
+	c.env = nil
+
+	if out := c.expect(exitOK, "seed", "-seed", "7"); !strings.Contains(out, "(seed 7)") {
+		t.Errorf("seed:\n%s", out)
+	}
+	c.expect(exitConflict, "seed")
+	c.expect(exitUsage, "seed", "-file", filepath.Join(t.TempDir(), "missing.yaml"))
+
+	export := filepath.Join(t.TempDir(), "export.json")
+	c.expect(exitOK, "export", export)
+	seeded := c.expect(exitOK, "list-users", "-json")
+
+	target := newCLI(t)
+	target.expect(exitOK, "migrate", "up")
+	target.expect(exitOK, "import", export)
+	if imported := target.expect(exitOK, "list-users", "-json"); imported != seeded {
+		t.Errorf("users after import differ:\n%s\nwant\n%s", imported, seeded)
+	}
+	target.expect(exitConflict, "import", export)
+
+	// An export only loads into a database at its schema version
+	older := newCLI(t)
+	older.expect(exitOK, "migrate", "up")
+	older.expect(exitOK, "migrate", "down")
+	older.expect(exitSchema, "import", export)
+}
+
+func TestDatabaseErrors(t *testing.T) {
+	c := newCLI(t)
+	c.env = []string{"DB_DRIVER=postgres", "DB_DSN=postgres://nobody@127.0.0.1:1/none?sslmode=disable&connect_timeout=1"}
+	c.expect(exitDatabase, "migrate", "status")
+	c.expect(exitDatabase, "list-users")
+
+	c = newCLI(t)
+	c.env = []string{"DB_AUTO_MIGRATE=false", "SCHEDULER_ENABLED=false"}
+	c.expect(exitSchema, "serve")
+}
+
+func TestServeRefusesMockPaymentsInProduction(t *testing.T) {
+	c := newCLI(t)
+	c.env = []string{"APP_ENV=production", "PAYMENT_PROVIDER=mock"}
+	if _, _, stderr := c.run("", "serve"); !strings.Contains(stderr, "cannot be used in production") {
+		t.Errorf("serve did not refuse the mock provider:\n%s", stderr)
+	}
+	c.expect(exitFailure, "serve")
+
+	c.env = []string{"PAYMENT_PROVIDER=stripe"}
+	c.expect(exitFailure, "serve")
+}
+
+func TestOpenAPICheck(t *testing.T) {
+	c := newCLI(t)
+	c.expect(exitOK, "openapi", "-check")
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(c.expect(exitOK, "openapi")), &doc); err != nil || doc["paths"] == nil {
+		t.Errorf("openapi printed no document: %v", err)
+	}
+}
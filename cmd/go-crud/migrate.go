@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"go-crud/models"
+)
+
+const migrateUsage = `usage: go-crud migrate <command>
+
+commands:
+  up [n]     apply all pending migrations, or the next n
+  down [n]   revert the last applied migration, or the last n
+  status     list migrations and whether they have been applied
+  redo       revert and reapply the last applied migration`
+
+// runMigrate applies, reverts or lists schema migrations
+func runMigrate(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return exitUsage
+	}
+
+	steps := 0
+	switch {
+	case len(args) > 2:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return exitUsage
+	case len(args) == 2:
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 || (args[0] != "up" && args[0] != "down") {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return exitUsage
+		}
+		steps = n
+	}
+
+	switch args[0] {
+	case "up", "down", "redo", "status":
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return exitUsage
+	}
+
+	if code, ok := openDatabase(); !ok {
+		return code
+	}
+	defer models.DB.Close()
+
+	switch args[0] {
+	case "up":
+		applied, err := models.MigrateUp(steps)
+		for _, m := range applied {
+			fmt.Println("applied ", m)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate up:", err)
+			return schemaErrorCode(err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+	case "down":
+		if steps == 0 {
+			steps = 1
+		}
+		reverted, err := models.MigrateDown(steps)
+		for _, m := range reverted {
+			fmt.Println("reverted", m)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate down:", err)
+			return schemaErrorCode(err)
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no migrations to revert")
+		}
+	case "redo":
+		m, err := models.RedoMigration()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate redo:", err)
+			return schemaErrorCode(err)
+		}
+		fmt.Println("redone  ", m)
+	case "status":
+		return printMigrationStatus()
+	}
+	return exitOK
+}
+
+// printMigrationStatus lists every migration; it returns exitSchema when an applied
+// migration has been modified or is missing from this build
+func printMigrationStatus() int {
+	statuses, err := models.MigrationStatuses()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate status:", err)
+		return exitFailure
+	}
+
+	code := exitOK
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "MIGRATION\tSTATUS\tAPPLIED AT")
+	for _, s := range statuses {
+		state, appliedAt := "pending", ""
+		if s.Applied {
+			state, appliedAt = "applied", s.AppliedAt.Local().Format("2006-01-02 15:04:05")
+		}
+		switch {
+		case s.Unknown:
+			state, code = "applied, not in this build", exitSchema
+		case s.Modified:
+			state, code = "applied, checksum mismatch", exitSchema
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.Migration, state, appliedAt)
+	}
+	w.Flush()
+	return code
+}
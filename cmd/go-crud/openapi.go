@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"go-crud/routes"
+)
+
+// runOpenAPI prints the OpenAPI document of an API version, or with -check only verifies
+// that every registered route is documented, so CI can fail on an undocumented route
+func runOpenAPI(args []string) int {
+	fs := flag.NewFlagSet("openapi", flag.ContinueOnError)
+	version := fs.Int("version", 1, "API version to describe")
+	check := fs.Bool("check", false, "only check that every route has an OpenAPI entry")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	routes.RegisterRoutes()
+	if *check {
+		if err := routes.CheckSpec(); err != nil {
+			log.Println(err)
+			return exitFailure
+		}
+		fmt.Println("Every route has an OpenAPI entry")
+		return exitOK
+	}
+
+	doc, err := routes.Spec(*version)
+	if err != nil {
+		log.Println(err)
+		return exitFailure
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		log.Println("Failed to write OpenAPI document:", err)
+		return exitFailure
+	}
+	return exitOK
+}
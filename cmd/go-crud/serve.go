@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	
+	"go-crud/models"
+	"go-crud/payments"
+	"go-crud/routes"
+	"go-crud/config"
+	"go-crud/scheduler"
+)
+
+// runServe migrates the database when DB_AUTO_MIGRATE allows it, seeds a new one and
+// runs the API server until it fails
+func runServe(args []string) int {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	
+	// Log admin credentials for development purposes
+	log.Printf("Admin credentials set to - Email: %s, Password: %s", 
+		config.AppConfig.DefaultAdminEmail, 
+		config.AppConfig.DefaultAdminPassword)
+	log.Println("IMPORTANT: Change these credentials in production using environment variables!")
+	
+	// Refuse to take fake payments in production
+	if err := payments.Setup(config.AppConfig.PaymentProvider, config.AppConfig.IsProduction()); err != nil {
+		log.Println("Invalid PAYMENT_PROVIDER:", err)
+		return exitFailure
+	}
+	
+	if code, ok := openDatabase(); !ok {
+		return code
+	}
+	defer models.DB.Close()
+	
+	pending, err := models.PendingMigrations()
+	if err != nil {
+		log.Println("Failed to check schema migrations:", err)
+		return schemaErrorCode(err)
+	}
+	
+	if len(pending) > 0 {
+		if !config.AppConfig.DBAutoMigrate {
+			log.Printf("Database has %d pending migrations; run \"go-crud migrate up\" or set DB_AUTO_MIGRATE=true", len(pending))
+			return exitSchema
+		}
+		if _, err := models.MigrateUp(0); err != nil {
+			log.Println("Failed to migrate database:", err)
+			return exitFailure
+		}
+	}
+	
+	// Seeding is explicit; point a new database at the commands that fill it
+	users, err := models.GetUsers(1)
+	if err != nil {
+		log.Println("Failed to inspect database:", err)
+		return exitFailure
+	}
+	
+	if len(users) == 0 {
+		log.Println(`Database has no users; run "go-crud create-admin", or "go-crud seed" for sample data`)
+	}
+	
+	if models.Driver == models.DriverSQLite {
+		log.Println("Connected to SQLite DB at", config.AppConfig.DBPath)
+	} else {
+		log.Println("Connected to PostgreSQL database")
+	}
+	
+	// Start background jobs
+	if config.AppConfig.SchedulerEnabled {
+		if err := scheduler.RegisterJobs(); err != nil {
+			log.Println("Failed to register background jobs:", err)
+			return exitFailure
+		}
+		scheduler.Default.Start(context.Background())
+	}
+	
+	// Register API routes
+	routes.RegisterRoutes()
+	if err := routes.CheckSpec(); err != nil {
+		log.Println("OpenAPI document is incomplete:", err)
+	}
+	
+	// Start HTTP server
+	serverAddr := ":" + config.AppConfig.ServerPort
+	fmt.Printf("\n✓ Server is running!\n")
+	fmt.Printf("✓ Local:   http://localhost%s\n\n", serverAddr)
+	fmt.Println("Authentication required for all endpoints:")
+	fmt.Printf("✓ Username: %s\n", config.AppConfig.DefaultAdminEmail)
+	fmt.Printf("✓ Password: %s\n\n", config.AppConfig.DefaultAdminPassword)
+	log.Println(http.ListenAndServe(serverAddr, routes.Handler()))
+	return exitFailure
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"go-crud/config"
+	"go-crud/models"
+)
+
+// minPasswordLength matches the API's registration rule
+const minPasswordLength = 6
+
+// passwordFlags adds -password and -password-stdin to a command
+func passwordFlags(fs *flag.FlagSet) (password *string, fromStdin *bool) {
+	password = fs.String("password", "", "the new password")
+	fromStdin = fs.Bool("password-stdin", false, "read the password from the first line of stdin")
+	return password, fromStdin
+}
+
+// readPassword returns the password given by -password or -password-stdin, or fallback
+// when neither is set
+func readPassword(password string, fromStdin bool, fallback string) (string, error) {
+	if fromStdin {
+		if password != "" {
+			return "", errors.New("use either -password or -password-stdin")
+		}
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("reading password from stdin: %w", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if password == "" {
+		password = fallback
+	}
+	if len(password) < minPasswordLength {
+		return "", fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	return password, nil
+}
+
+// runCreateAdmin creates the account the API treats as admin, DEFAULT_ADMIN_EMAIL, with
+// DEFAULT_ADMIN_PASSWORD unless a password is given
+func runCreateAdmin(args []string) int {
+	fs := flag.NewFlagSet("create-admin", flag.ContinueOnError)
+	email := fs.String("email", config.AppConfig.DefaultAdminEmail, "email of the admin account")
+	password, fromStdin := passwordFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 || *email == "" {
+		fs.Usage()
+		return exitUsage
+	}
+
+	pw, err := readPassword(*password, *fromStdin, config.AppConfig.DefaultAdminPassword)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "create-admin:", err)
+		return exitUsage
+	}
+
+	if code, ok := openDatabase(); !ok {
+		return code
+	}
+	defer models.DB.Close()
+	if code, ok := requireSchema(); !ok {
+		return code
+	}
+
+	id, err := models.RegisterUser(*email, pw)
+	if err == models.ErrUserExists {
+		fmt.Fprintf(os.Stderr, "create-admin: %s already exists; use reset-password to change its password\n", *email)
+		return exitConflict
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "create-admin:", err)
+		return exitFailure
+	}
+
+	fmt.Printf("created admin %s (ID: %d)\n", *email, id)
+	if !strings.EqualFold(*email, config.AppConfig.DefaultAdminEmail) {
+		fmt.Printf("note: set DEFAULT_ADMIN_EMAIL=%s for the API to treat this account as admin\n", *email)
+	}
+	return exitOK
+}
+
+// runResetPassword sets the password of an existing user
+func runResetPassword(args []string) int {
+	fs := flag.NewFlagSet("reset-password", flag.ContinueOnError)
+	email := fs.String("email", "", "email of the user (required)")
+	password, fromStdin := passwordFlags(fs)
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 || *email == "" || (*password == "" && !*fromStdin) {
+		fs.Usage()
+		return exitUsage
+	}
+
+	pw, err := readPassword(*password, *fromStdin, "")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "reset-password:", err)
+		return exitUsage
+	}
+
+	if code, ok := openDatabase(); !ok {
+		return code
+	}
+	defer models.DB.Close()
+	if code, ok := requireSchema(); !ok {
+		return code
+	}
+
+	user, err := models.GetUserByEmail(*email)
+	if err == sql.ErrNoRows {
+		fmt.Fprintf(os.Stderr, "reset-password: no user with email %s\n", *email)
+		return exitConflict
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "reset-password:", err)
+		return exitFailure
+	}
+
+	if err := models.UpdateUserPassword(user.ID, pw); err != nil {
+		fmt.Fprintln(os.Stderr, "reset-password:", err)
+		return exitFailure
+	}
+	fmt.Printf("password reset for %s (ID: %d)\n", user.Email, user.ID)
+	return exitOK
+}
+
+// runListUsers prints user accounts as a table, or as JSON with -json
+func runListUsers(args []string) int {
+	fs := flag.NewFlagSet("list-users", flag.ContinueOnError)
+	limit := fs.Int("limit", 100, "maximum number of users to list")
+	asJSON := fs.Bool("json", false, "print the users as JSON")
+	if code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	if fs.NArg() > 0 || *limit < 1 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	if code, ok := openDatabase(); !ok {
+		return code
+	}
+	defer models.DB.Close()
+	if code, ok := requireSchema(); !ok {
+		return code
+	}
+
+	users, err := models.GetUsers(*limit)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "list-users:", err)
+		return exitFailure
+	}
+
+	if *asJSON {
+		if users == nil {
+			users = []models.User{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(users); err != nil {
+			fmt.Fprintln(os.Stderr, "list-users:", err)
+			return exitFailure
+		}
+		return exitOK
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tEMAIL\tCREATED AT\tADMIN")
+	for _, u := range users {
+		admin := ""
+		if strings.EqualFold(u.Email, config.AppConfig.DefaultAdminEmail) {
+			admin = "yes"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", u.ID, u.Email, u.CreatedAt.Local().Format("2006-01-02 15:04:05"), admin)
+	}
+	w.Flush()
+	return exitOK
+}
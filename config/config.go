@@ -5,6 +5,7 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 	
 	"github.com/joho/godotenv"
@@ -14,9 +15,18 @@ import (
 type Config struct {
 	// Server configuration
 	ServerPort string
+	AppEnv     string // "development", "test", "staging" or "production"
+	
+	// When the legacy routes were superseded by the resource routes, and the date (YYYY-MM-DD)
+	// after which they may be removed
+	LegacyRoutesDeprecated time.Time
+	LegacyRoutesSunset     string
 	
 	// Database configuration
-	DBPath string
+	DBDriver      string // "sqlite3" or "postgres"
+	DBDSN         string // connection string; defaults to DBPath for SQLite
+	DBPath        string
+	DBAutoMigrate bool // apply pending migrations at startup instead of refusing to start
 	
 	// JWT configuration
 	JWTSecret       string
@@ -25,6 +35,29 @@ type Config struct {
 	// Default admin account
 	DefaultAdminEmail    string
 	DefaultAdminPassword string
+	
+	// Shipping configuration
+	ShippingMode          string  // "flat", "weight" or "none"
+	ShippingBaseRate      float64 // flat rate, or base rate for weight-based shipping
+	ShippingPerKg         float64 // rate per kg for weight-based shipping
+	FreeShippingThreshold float64 // order value above which shipping is free, 0 to disable
+	
+	// How long stored Idempotency-Key responses are replayed
+	IdempotencyTTL time.Duration
+	
+	// Payment configuration
+	PaymentProvider      string // name of the registered payment provider, e.g. "mock"; empty disables payments
+	PaymentCurrency      string
+	PaymentWebhookSecret string // shared secret used to sign provider webhooks
+	
+	// Seller details printed on invoices; address lines are separated by "|"
+	InvoiceSellerName    string
+	InvoiceSellerAddress string
+	
+	// Background jobs
+	SchedulerEnabled     bool
+	PendingOrderTTL      time.Duration // pending orders older than this are cancelled
+	ExpireOrdersSchedule string        // cron schedule of the expire-pending-orders job
 }
 
 // Global application configuration
@@ -41,16 +74,40 @@ func Initialize() {
 	// Initialize with defaults
 	AppConfig = Config{
 		ServerPort:          getEnv("SERVER_PORT", "8080"),
+		AppEnv:              getEnv("APP_ENV", "development"),
+		LegacyRoutesDeprecated: getEnvAsDate("LEGACY_ROUTES_DEPRECATED", "2026-10-19"),
+		LegacyRoutesSunset:  getEnv("LEGACY_ROUTES_SUNSET", "2027-04-30"),
+		DBDriver:            getEnv("DB_DRIVER", "sqlite3"),
+		DBDSN:               getEnv("DB_DSN", ""),
 		DBPath:              getEnv("DB_PATH", "./sqlite_db.db"),
+		DBAutoMigrate:       getEnvAsBool("DB_AUTO_MIGRATE", true),
 		JWTSecret:           getEnv("JWT_SECRET", "your-default-secret-key-for-development-only"),
 		JWTExpiration:       time.Duration(getEnvAsInt("JWT_EXPIRATION_HOURS", 24)) * time.Hour,
 		DefaultAdminEmail:   getEnv("DEFAULT_ADMIN_EMAIL", "admin@example.com"),
 		DefaultAdminPassword: getEnv("DEFAULT_ADMIN_PASSWORD", "admin123"),
+		ShippingMode:          getEnv("SHIPPING_MODE", "flat"),
+		ShippingBaseRate:      getEnvAsFloat("SHIPPING_BASE_RATE", 0),
+		ShippingPerKg:         getEnvAsFloat("SHIPPING_PER_KG", 0),
+		FreeShippingThreshold: getEnvAsFloat("FREE_SHIPPING_THRESHOLD", 0),
+		IdempotencyTTL:        time.Duration(getEnvAsInt("IDEMPOTENCY_TTL_HOURS", 24)) * time.Hour,
+		PaymentProvider:       getEnv("PAYMENT_PROVIDER", ""),
+		PaymentCurrency:       getEnv("PAYMENT_CURRENCY", "USD"),
+		PaymentWebhookSecret:  getEnv("PAYMENT_WEBHOOK_SECRET", "your-default-webhook-secret-for-development-only"),
+		InvoiceSellerName:     getEnv("INVOICE_SELLER_NAME", "Go CRUD Store"),
+		InvoiceSellerAddress:  getEnv("INVOICE_SELLER_ADDRESS", ""),
+		SchedulerEnabled:      getEnvAsBool("SCHEDULER_ENABLED", true),
+		PendingOrderTTL:       time.Duration(getEnvAsInt("PENDING_ORDER_TTL_HOURS", 72)) * time.Hour,
+		ExpireOrdersSchedule:  getEnv("EXPIRE_ORDERS_SCHEDULE", "*/15 * * * *"),
 	}
 	
 	log.Println("Configuration loaded successfully")
 }
 
+// IsProduction reports whether APP_ENV is production
+func (c Config) IsProduction() bool {
+	return strings.EqualFold(c.AppEnv, "production")
+}
+
 // Helper function to get an environment variable or a default value
 func getEnv(key, defaultValue string) string {
 	value := os.Getenv(key)
@@ -74,4 +131,47 @@ func getEnvAsInt(key string, defaultValue int) int {
 	}
 	
 	return value
-}
\ No newline at end of file
+}
+
+// Helper function to get an environment variable as a float
+func getEnvAsFloat(key string, defaultValue float64) float64 {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+	
+	value, err := strconv.ParseFloat(valueStr, 64)
+	if err != nil {
+		log.Printf("Warning: Invalid number value for %s, using default: %g\n", key, defaultValue)
+		return defaultValue
+	}
+	
+	return value
+}
+
+// Helper function to get an environment variable as a boolean
+func getEnvAsBool(key string, defaultValue bool) bool {
+	valueStr := getEnv(key, "")
+	if valueStr == "" {
+		return defaultValue
+	}
+	
+	value, err := strconv.ParseBool(valueStr)
+	if err != nil {
+		log.Printf("Warning: Invalid boolean value for %s, using default: %t\n", key, defaultValue)
+		return defaultValue
+	}
+	
+	return value
+}
+
+// Helper function to get an environment variable as a date (YYYY-MM-DD), midnight UTC
+func getEnvAsDate(key string, defaultValue string) time.Time {
+	value, err := time.Parse("2006-01-02", getEnv(key, defaultValue))
+	if err != nil {
+		log.Printf("Warning: Invalid date value for %s, using default: %s\n", key, defaultValue)
+		value, _ = time.Parse("2006-01-02", defaultValue)
+	}
+	
+	return value
+}
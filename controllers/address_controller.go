@@ -1,39 +1,127 @@
 package controllers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
+	"go-crud/middlewares"
 	"go-crud/models"
+	"go-crud/problem"
 )
 
+// addressRequest only bounds the length of its fields; which fields are required and the rules
+// of each country are checked by models.NormalizeAddress, which also normalizes them
 type addressRequest struct {
-	ID          int    `json:"id,omitempty"`
-	UserID      int    `json:"user_id"`
-	StreetLine1 string `json:"street_line1"`
-	StreetLine2 string `json:"street_line2"`
-	City        string `json:"city"`
-	State       string `json:"state"`
-	PostalCode  string `json:"postal_code"`
-	Country     string `json:"country"`
-	IsDefault   bool   `json:"is_default"`
+	ID                int    `json:"id,omitempty"`
+	UserID            int    `json:"user_id"`
+	Type              string `json:"type"` // shipping, billing or both (default)
+	StreetLine1       string `json:"street_line1" validate:"max=200"`
+	StreetLine2       string `json:"street_line2" validate:"max=200"`
+	City              string `json:"city" validate:"max=100"`
+	State             string `json:"state" validate:"max=100"`
+	PostalCode        string `json:"postal_code" validate:"max=20"`
+	Country           string `json:"country" validate:"max=100"`
+	IsDefault         bool   `json:"is_default"` // default for every type the address has
+	IsDefaultShipping bool   `json:"is_default_shipping"`
+	IsDefaultBilling  bool   `json:"is_default_billing"`
+}
+
+// address converts the request to a models.Address
+func (req addressRequest) address() models.Address {
+	return models.Address{
+		ID:                req.ID,
+		UserID:            req.UserID,
+		Type:              req.Type,
+		StreetLine1:       req.StreetLine1,
+		StreetLine2:       req.StreetLine2,
+		City:              req.City,
+		State:             req.State,
+		PostalCode:        req.PostalCode,
+		Country:           req.Country,
+		IsDefault:         req.IsDefault,
+		IsDefaultShipping: req.IsDefaultShipping,
+		IsDefaultBilling:  req.IsDefaultBilling,
+	}
 }
 
 type addressResponse struct {
-	Message string `json:"message"`
-	ID      int    `json:"id,omitempty"`
+	Message string          `json:"message"`
+	ID      int             `json:"id,omitempty"`
+	Address *models.Address `json:"address,omitempty"` // the address as stored, after normalization
 }
 
 type assignAddressRequest struct {
-	OrderID   int `json:"order_id"`
-	AddressID int `json:"address_id"`
+	OrderID   int    `json:"order_id"`
+	AddressID int    `json:"address_id" validate:"required"`
+	Type      string `json:"type,omitempty" validate:"omitempty,oneof=shipping billing"` // empty assigns both
+}
+
+// authorizeOwner checks that the authenticated user may act on data owned by ownerID: users may
+// only act on their own, the admin on anyone's. Other attempts are logged and answered with 403.
+func authorizeOwner(w http.ResponseWriter, r *http.Request, ownerID int, action string) bool {
+	userID, ok := middlewares.GetUserID(r)
+	if !ok {
+		problem.Write(w, http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized")
+		return false
+	}
+	if ownerID == userID || middlewares.IsAdmin(r) {
+		return true
+	}
+	
+	log.Printf("Rejected %s by user %d: owned by user %d", action, userID, ownerID)
+	problem.Write(w, http.StatusForbidden, problem.CodeForbidden, "You can only access your own addresses and orders")
+	return false
+}
+
+// addressOwner returns the ID of the user an address belongs to, answering 404 if there is no such address
+func addressOwner(w http.ResponseWriter, id int) (int, bool) {
+	address, err := repos.Addresses.GetByID(id)
+	if err == sql.ErrNoRows {
+		problem.Write(w, http.StatusNotFound, problem.CodeNotFound, "Address not found")
+		return 0, false
+	}
+	if err != nil {
+		problem.Error(w, fmt.Errorf("fetching address: %w", err))
+		return 0, false
+	}
+	return address.UserID, true
 }
 
-// GetAddresses handles retrieving all addresses
+// GetAddresses handles retrieving addresses: the user's own, or every user's for the admin
+// (optionally filtered by ?user_id=)
 func GetAddresses(w http.ResponseWriter, r *http.Request) {
-	addresses, err := models.GetAddresses(100)
+	userID, ok := middlewares.GetUserID(r)
+	if !ok {
+		problem.Write(w, http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized")
+		return
+	}
+	
+	if idStr := r.URL.Query().Get("user_id"); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid user ID")
+			return
+		}
+		if !authorizeOwner(w, r, id, "listing addresses") {
+			return
+		}
+		userID = id
+	} else if middlewares.IsAdmin(r) {
+		userID = 0
+	}
+	
+	var addresses []models.Address
+	var err error
+	if userID == 0 {
+		addresses, err = repos.Addresses.List(100)
+	} else {
+		addresses, err = repos.Addresses.ListByUser(userID)
+	}
 	if err != nil {
-		http.Error(w, "Error fetching addresses: "+err.Error(), http.StatusInternalServerError)
+		problem.Error(w, fmt.Errorf("fetching addresses: %w", err))
 		return
 	}
 	
@@ -43,21 +131,29 @@ func GetAddresses(w http.ResponseWriter, r *http.Request) {
 
 // GetAddressByID handles retrieving a specific address
 func GetAddressByID(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
+	idStr := idParam(r)
 	if idStr == "" {
-		http.Error(w, "Missing address ID", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, "Missing address ID")
 		return
 	}
 	
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid address ID", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid address ID")
 		return
 	}
 	
-	address, err := models.GetAddressByID(id)
+	address, err := repos.Addresses.GetByID(id)
+	if err == sql.ErrNoRows {
+		problem.Write(w, http.StatusNotFound, problem.CodeNotFound, "Address not found")
+		return
+	}
 	if err != nil {
-		http.Error(w, "Error fetching address: "+err.Error(), http.StatusInternalServerError)
+		problem.Error(w, fmt.Errorf("fetching address: %w", err))
+		return
+	}
+	
+	if !authorizeOwner(w, r, address.UserID, fmt.Sprintf("read of address %d", id)) {
 		return
 	}
 	
@@ -68,229 +164,91 @@ func GetAddressByID(w http.ResponseWriter, r *http.Request) {
 // CreateAddress handles creating a new address
 func CreateAddress(w http.ResponseWriter, r *http.Request) {
 	var req addressRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+	if !decodeBody(w, r, &req) {
 		return
 	}
 	
-	// Validate request
+	// Addresses belong to the authenticated user unless the admin names another one
 	if req.UserID == 0 {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
-		return
+		req.UserID, _ = middlewares.GetUserID(r)
 	}
-	
-	if req.StreetLine1 == "" {
-		http.Error(w, "Street address is required", http.StatusBadRequest)
-		return
-	}
-	
-	if req.City == "" {
-		http.Error(w, "City is required", http.StatusBadRequest)
-		return
-	}
-	
-	if req.State == "" {
-		http.Error(w, "State is required", http.StatusBadRequest)
-		return
-	}
-	
-	if req.PostalCode == "" {
-		http.Error(w, "Postal code is required", http.StatusBadRequest)
-		return
-	}
-	
-	if req.Country == "" {
-		http.Error(w, "Country is required", http.StatusBadRequest)
+	if !authorizeOwner(w, r, req.UserID, "address creation") {
 		return
 	}
 	
 	// Create the address
-	id, err := models.CreateAddress(
-		req.UserID,
-		req.StreetLine1,
-		req.StreetLine2,
-		req.City,
-		req.State,
-		req.PostalCode,
-		req.Country,
-		req.IsDefault,
-	)
+	id, err := repos.Addresses.Create(req.address())
 	
 	if err != nil {
-		http.Error(w, "Error creating address: "+err.Error(), http.StatusInternalServerError)
+		problem.Error(w, fmt.Errorf("creating address: %w", err))
 		return
 	}
 	
-	// Update pending orders status to processing for this user
-	// Get all pending orders for this user
-	rows, err := models.DB.Query(`
-		SELECT id FROM orders 
-		WHERE user_id = ? AND status = 'pending'`, req.UserID)
+	address, err := repos.Addresses.GetByID(id)
 	if err != nil {
-		http.Error(w, "Error fetching pending orders: "+err.Error(), http.StatusInternalServerError)
+		problem.Error(w, fmt.Errorf("fetching address: %w", err))
 		return
 	}
-	defer rows.Close()
-	
-	// Update each order's status to 'processing'
-	updatedCount := 0
-	for rows.Next() {
-		var orderID int
-		if err := rows.Scan(&orderID); err != nil {
-			http.Error(w, "Error processing orders: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		
-		if err := models.UpdateOrderStatus(orderID, "processing"); err != nil {
-			http.Error(w, "Error updating order status: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		updatedCount++
-	}
-	
-	// Add info about updated orders to the response
-	responseMsg := "Address created successfully"
-	if updatedCount > 0 {
-		responseMsg += ". " + strconv.Itoa(updatedCount) + " pending orders updated to processing"
-	}
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(addressResponse{
-		Message: responseMsg,
+		Message: "Address created successfully",
 		ID:      id,
+		Address: &address,
 	})
 }
 
 // UpdateAddress handles updating an existing address
 func UpdateAddress(w http.ResponseWriter, r *http.Request) {
 	var req addressRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeRequest(w, r, &req, &req.ID) {
 		return
 	}
 	
-	if req.ID == 0 {
-		http.Error(w, "Address ID is required", http.StatusBadRequest)
+	// The owner comes from the stored address, never from the request body
+	owner, ok := addressOwner(w, req.ID)
+	if !ok || !authorizeOwner(w, r, owner, fmt.Sprintf("update of address %d", req.ID)) {
 		return
 	}
-	
-	if req.UserID == 0 {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
-		return
-	}
-	
-	if req.StreetLine1 == "" {
-		http.Error(w, "Street address is required", http.StatusBadRequest)
-		return
-	}
-	
-	if req.City == "" {
-		http.Error(w, "City is required", http.StatusBadRequest)
-		return
-	}
-	
-	if req.State == "" {
-		http.Error(w, "State is required", http.StatusBadRequest)
-		return
-	}
-	
-	if req.PostalCode == "" {
-		http.Error(w, "Postal code is required", http.StatusBadRequest)
-		return
-	}
-	
-	if req.Country == "" {
-		http.Error(w, "Country is required", http.StatusBadRequest)
+	if req.UserID != 0 && req.UserID != owner {
+		problem.Write(w, http.StatusBadRequest, problem.CodeValidation, "An address cannot be moved to another user")
 		return
 	}
+	req.UserID = owner
 	
 	// Update the address
-	err := models.UpdateAddress(
-		req.ID,
-		req.UserID,
-		req.StreetLine1,
-		req.StreetLine2,
-		req.City,
-		req.State,
-		req.PostalCode,
-		req.Country,
-		req.IsDefault,
-	)
-	
-	if err != nil {
-		http.Error(w, "Error updating address: "+err.Error(), http.StatusInternalServerError)
+	err := repos.Addresses.Update(req.address())
+	if err == sql.ErrNoRows {
+		problem.Write(w, http.StatusNotFound, problem.CodeNotFound, "Address not found")
 		return
 	}
-	
-	// Update pending orders status to processing for this user
-	// Get all pending orders for this user
-	rows, err := models.DB.Query(`
-		SELECT id FROM orders 
-		WHERE user_id = ? AND status = 'pending'`, req.UserID)
 	if err != nil {
-		http.Error(w, "Error fetching pending orders: "+err.Error(), http.StatusInternalServerError)
+		problem.Error(w, fmt.Errorf("updating address: %w", err))
 		return
 	}
-	defer rows.Close()
-	
-	// Update each order's status to 'processing'
-	updatedCount := 0
-	for rows.Next() {
-		var orderID int
-		if err := rows.Scan(&orderID); err != nil {
-			http.Error(w, "Error processing orders: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		
-		if err := models.UpdateOrderStatus(orderID, "processing"); err != nil {
-			http.Error(w, "Error updating order status: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		updatedCount++
-	}
-	
-	// Add info about updated orders to the response
-	responseMsg := "Address updated successfully"
-	if updatedCount > 0 {
-		responseMsg += ". " + strconv.Itoa(updatedCount) + " pending orders updated to processing"
-	}
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(addressResponse{
-		Message: responseMsg,
+		Message: "Address updated successfully",
 	})
 }
 
 // DeleteAddress handles deleting an address
 func DeleteAddress(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		ID     int `json:"id"`
-		UserID int `json:"user_id"`
-	}
-	
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var req idRequest
+	if !decodeRequest(w, r, &req, &req.ID) {
 		return
 	}
 	
-	if req.ID == 0 {
-		http.Error(w, "Address ID is required", http.StatusBadRequest)
-		return
-	}
-	
-	if req.UserID == 0 {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
+	owner, ok := addressOwner(w, req.ID)
+	if !ok || !authorizeOwner(w, r, owner, fmt.Sprintf("deletion of address %d", req.ID)) {
 		return
 	}
 	
 	// Delete the address
-	err := models.DeleteAddress(req.ID, req.UserID)
+	err := repos.Addresses.Delete(req.ID, owner)
 	if err != nil {
-		if err == models.ErrAddressInUse {
-			http.Error(w, "Address cannot be deleted because it is being used by one or more orders", http.StatusBadRequest)
-			return
-		}
-		http.Error(w, "Error deleting address: "+err.Error(), http.StatusInternalServerError)
+		problem.Error(w, fmt.Errorf("deleting address: %w", err))
 		return
 	}
 	
@@ -303,49 +261,49 @@ func DeleteAddress(w http.ResponseWriter, r *http.Request) {
 // AssignAddressToOrder handles assigning an address to an order
 func AssignAddressToOrder(w http.ResponseWriter, r *http.Request) {
 	var req assignAddressRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeRequest(w, r, &req, &req.OrderID) {
 		return
 	}
 	
-	if req.OrderID == 0 {
-		http.Error(w, "Order ID is required", http.StatusBadRequest)
+	orderOwner, err := repos.Orders.GetUserID(req.OrderID)
+	if err == sql.ErrNoRows {
+		problem.Write(w, http.StatusNotFound, problem.CodeNotFound, "Order not found")
 		return
 	}
-	
-	if req.AddressID == 0 {
-		http.Error(w, "Address ID is required", http.StatusBadRequest)
+	if err != nil {
+		problem.Error(w, fmt.Errorf("fetching order: %w", err))
 		return
 	}
-	
-	// Get order status first
-	var orderStatus string
-	err := models.DB.QueryRow("SELECT status FROM orders WHERE id = ?", req.OrderID).Scan(&orderStatus)
-	if err != nil {
-		http.Error(w, "Error fetching order status: "+err.Error(), http.StatusInternalServerError)
+	if !authorizeOwner(w, r, orderOwner, fmt.Sprintf("address change of order %d", req.OrderID)) {
 		return
 	}
 	
-	// Update the order with address
-	err = models.UpdateOrderAddress(req.OrderID, req.AddressID)
-	if err != nil {
-		http.Error(w, "Error assigning address to order: "+err.Error(), http.StatusInternalServerError)
+	// An order may only use its own user's addresses, even when the admin assigns them
+	addressUserID, ok := addressOwner(w, req.AddressID)
+	if !ok {
+		return
+	}
+	if addressUserID != orderOwner {
+		actor, _ := middlewares.GetUserID(r)
+		log.Printf("Rejected assigning address %d of user %d to order %d of user %d by user %d",
+			req.AddressID, addressUserID, req.OrderID, orderOwner, actor)
+		problem.Write(w, http.StatusForbidden, problem.CodeForbidden, "Address belongs to another user")
 		return
 	}
 	
-	// If the order is 'pending', change it to 'processing'
-	responseMsg := "Address assigned to order successfully"
-	if orderStatus == "pending" {
-		err = models.UpdateOrderStatus(req.OrderID, "processing")
-		if err != nil {
-			http.Error(w, "Warning: Address assigned but failed to update order status: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-		responseMsg += ". Order status updated from 'pending' to 'processing'"
+	// Update the order with address. Order status is driven by payments and shipments.
+	err = repos.Orders.UpdateAddress(req.OrderID, req.Type, req.AddressID)
+	if err == sql.ErrNoRows {
+		problem.Write(w, http.StatusNotFound, problem.CodeNotFound, "Order not found")
+		return
+	}
+	if err != nil {
+		problem.Error(w, fmt.Errorf("assigning address to order: %w", err))
+		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(addressResponse{
-		Message: responseMsg,
+		Message: "Address assigned to order successfully",
 	})
 }
\ No newline at end of file
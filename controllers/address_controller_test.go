@@ -0,0 +1,105 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"go-crud/config"
+	"go-crud/models"
+	"go-crud/problem"
+)
+
+const testAddressBody = `{"street_line1": "1 Main St", "city": "Berlin", "country": "DE", "postal_code": "10115", "is_default": true}`
+
+// racingAddresses fails every write as if a concurrent request had made another address the default first
+type racingAddresses struct {
+	models.AddressRepository
+}
+
+func (racingAddresses) Create(models.Address) (int, error) {
+	return 0, models.ErrAddressDefaultConflict
+}
+func (racingAddresses) Update(models.Address) error { return models.ErrAddressDefaultConflict }
+
+func TestAddressDefaultConflict(t *testing.T) {
+	r := useMemoryRepositories(t)
+	userID, err := r.Users.Create("buyer@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, err := r.Addresses.Create(models.Address{UserID: userID, StreetLine1: "1 Main St", City: "Berlin",
+		Country: "DE", PostalCode: "10115"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Addresses = racingAddresses{r.Addresses}
+	UseRepositories(r)
+
+	w := serveAs(userID, "POST /addresses", CreateAddress, "POST", "/addresses", testAddressBody)
+	checkProblem(t, w, http.StatusConflict, problem.CodeConflict)
+
+	w = serveAs(userID, "PUT /addresses/{id}", UpdateAddress, "PUT", fmt.Sprintf("/addresses/%d", id), testAddressBody)
+	checkProblem(t, w, http.StatusConflict, problem.CodeConflict)
+}
+
+func TestAddressesOfOtherUsers(t *testing.T) {
+	r := useMemoryRepositories(t)
+	prevAdmin := config.AppConfig.DefaultAdminEmail
+	config.AppConfig.DefaultAdminEmail = "admin@example.com"
+	t.Cleanup(func() { config.AppConfig.DefaultAdminEmail = prevAdmin })
+
+	var ids []int
+	for _, email := range []string{"owner@example.com", "other@example.com", "admin@example.com"} {
+		id, err := r.Users.Create(email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, id)
+	}
+	ownerID, otherID, adminID := ids[0], ids[1], ids[2]
+	addressID, err := r.Addresses.Create(models.Address{UserID: ownerID, StreetLine1: "1 Main St", City: "Berlin",
+		Country: "DE", PostalCode: "10115"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := fmt.Sprintf("/addresses/%d", addressID)
+
+	// Another user can neither read, change nor delete the address
+	w := serveAs(otherID, "GET /addresses/{id}", GetAddressByID, "GET", target, "")
+	checkProblem(t, w, http.StatusForbidden, problem.CodeForbidden)
+	w = serveAs(otherID, "PUT /addresses/{id}", UpdateAddress, "PUT", target, `{"street_line1": "2 Stolen St", "city": "Berlin", "country": "DE", "postal_code": "10115"}`)
+	checkProblem(t, w, http.StatusForbidden, problem.CodeForbidden)
+	w = serveAs(otherID, "DELETE /addresses/{id}", DeleteAddress, "DELETE", target, "")
+	checkProblem(t, w, http.StatusForbidden, problem.CodeForbidden)
+	w = serveAs(otherID, "POST /addresses", CreateAddress, "POST", "/addresses",
+		fmt.Sprintf(`{"user_id": %d, "street_line1": "3 Planted St", "city": "Berlin", "country": "DE", "postal_code": "10115"}`, ownerID))
+	checkProblem(t, w, http.StatusForbidden, problem.CodeForbidden)
+	w = serveAs(otherID, "GET /addresses", GetAddresses, "GET", fmt.Sprintf("/addresses?user_id=%d", ownerID), "")
+	checkProblem(t, w, http.StatusForbidden, problem.CodeForbidden)
+
+	addresses, _ := r.Addresses.ListByUser(ownerID)
+	if len(addresses) != 1 || addresses[0].StreetLine1 != "1 Main St" {
+		t.Fatalf("the owner's addresses changed: %+v", addresses)
+	}
+
+	// Without a user the request is unauthorized
+	w = serve("GET /addresses/{id}", GetAddressByID, "GET", target, "")
+	checkProblem(t, w, http.StatusUnauthorized, problem.CodeUnauthorized)
+
+	// The owner and the admin can
+	var address models.Address
+	decodeResponse(t, serveAs(ownerID, "GET /addresses/{id}", GetAddressByID, "GET", target, ""), http.StatusOK, &address)
+	if address.ID != addressID {
+		t.Errorf("read address %d", address.ID)
+	}
+	w = serveAs(adminID, "PUT /addresses/{id}", UpdateAddress, "PUT", target, `{"street_line1": "4 Moved St", "city": "Berlin", "country": "DE", "postal_code": "10115"}`)
+	decodeResponse(t, w, http.StatusOK, nil)
+	if a, _ := r.Addresses.GetByID(addressID); a.StreetLine1 != "4 Moved St" || a.UserID != ownerID {
+		t.Errorf("after the admin's update: %+v", a)
+	}
+	decodeResponse(t, serveAs(ownerID, "DELETE /addresses/{id}", DeleteAddress, "DELETE", target, ""), http.StatusOK, nil)
+	if _, err := r.Addresses.GetByID(addressID); err == nil {
+		t.Error("the owner could not delete the address")
+	}
+}
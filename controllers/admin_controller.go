@@ -1,9 +1,11 @@
 package controllers
 
 import (
+	"fmt"
 	"html/template"
 	"net/http"
 	"go-crud/models"
+	"go-crud/problem"
 )
 
 // Multiply is a helper function for the template
@@ -189,30 +191,30 @@ var adminTmpl = template.Must(template.New("admin").Funcs(template.FuncMap{
 // AdminDashboard renders an admin dashboard to view database tables
 func AdminDashboard(w http.ResponseWriter, r *http.Request) {
 	// Get users
-	users, err := models.GetUsers(100)
+	users, err := repos.Users.List(100)
 	if err != nil {
-		http.Error(w, "Error fetching users: "+err.Error(), http.StatusInternalServerError)
+		problem.Error(w, fmt.Errorf("fetching users: %w", err))
 		return
 	}
 	
 	// Get products
-	products, err := models.GetProducts(100)
+	products, err := repos.Products.List(100)
 	if err != nil {
-		http.Error(w, "Error fetching products: "+err.Error(), http.StatusInternalServerError)
+		problem.Error(w, fmt.Errorf("fetching products: %w", err))
 		return
 	}
 	
 	// Get roles
-	roles, err := models.GetRoles(100)
+	roles, err := repos.Roles.List(100)
 	if err != nil {
-		http.Error(w, "Error fetching roles: "+err.Error(), http.StatusInternalServerError)
+		problem.Error(w, fmt.Errorf("fetching roles: %w", err))
 		return
 	}
 	
 	// Get orders
-	orders, err := models.GetOrders(100)
+	orders, err := repos.Orders.List(100)
 	if err != nil {
-		http.Error(w, "Error fetching orders: "+err.Error(), http.StatusInternalServerError)
+		problem.Error(w, fmt.Errorf("fetching orders: %w", err))
 		return
 	}
 	
@@ -225,9 +227,9 @@ func AdminDashboard(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	// Get addresses
-	addresses, err := models.GetAddresses(100)
+	addresses, err := repos.Addresses.List(100)
 	if err != nil {
-		http.Error(w, "Error fetching addresses: "+err.Error(), http.StatusInternalServerError)
+		problem.Error(w, fmt.Errorf("fetching addresses: %w", err))
 		return
 	}
 	
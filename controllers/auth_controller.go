@@ -4,9 +4,12 @@ package controllers
 import (
     "encoding/base64"
     "encoding/json"
+    "fmt"
     "go-crud/auth"
     "go-crud/models"
     "go-crud/middlewares"
+    "go-crud/problem"
+    "go-crud/validate"
     "net/http"
     "strings"
     "time"
@@ -19,7 +22,6 @@ const TokenExpiration = 24 * time.Hour
 // RegisterUser handles user registration with both body and Basic Auth support
 func RegisterUser(w http.ResponseWriter, r *http.Request) {
     var userSignup models.UserSignup
-    var email, password string
     
     // First try to get credentials from Authorization header
     authHeader := r.Header.Get("Authorization")
@@ -29,61 +31,44 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
         if err == nil {
             credParts := strings.SplitN(string(credentials), ":", 2)
             if len(credParts) == 2 {
-                email = credParts[0]
-                password = credParts[1]
+                userSignup.Email = credParts[0]
+                userSignup.Password = credParts[1]
             }
         }
     }
     
     // If not found in header, try to get from request body (backward compatibility)
-    if email == "" || password == "" {
-        if err := json.NewDecoder(r.Body).Decode(&userSignup); err != nil {
-            http.Error(w, "Invalid request body or authorization header: "+err.Error(), http.StatusBadRequest)
+    if userSignup.Email == "" || userSignup.Password == "" {
+        if err := validate.Decode(w, r, &userSignup); err != nil {
+            problem.Error(w, err)
             return
         }
-        email = userSignup.Email
-        password = userSignup.Password
     }
 
     // Validate input
-    if email == "" {
-        http.Error(w, "Email is required", http.StatusBadRequest)
-        return
-    }
-
-    if password == "" {
-        http.Error(w, "Password is required", http.StatusBadRequest)
-        return
-    }
-
-    // Minimum password length validation
-    if len(password) < 6 {
-        http.Error(w, "Password must be at least 6 characters long", http.StatusBadRequest)
+    if err := validate.Struct(userSignup); err != nil {
+        problem.Error(w, err)
         return
     }
 
     // Register the user
-    userID, err := models.RegisterUser(email, password)
+    userID, err := repos.Users.Register(userSignup.Email, userSignup.Password)
     if err != nil {
-        if err == models.ErrUserExists {
-            http.Error(w, "User with this email already exists", http.StatusConflict)
-            return
-        }
-        http.Error(w, "Error registering user: "+err.Error(), http.StatusInternalServerError)
+        problem.Error(w, fmt.Errorf("registering user: %w", err))
         return
     }
 
     // Get the user object (without password)
-    user, err := models.GetUserByID(userID)
+    user, err := repos.Users.GetByID(userID)
     if err != nil {
-        http.Error(w, "Error fetching user data: "+err.Error(), http.StatusInternalServerError)
+        problem.Error(w, fmt.Errorf("fetching user data: %w", err))
         return
     }
 
     // Generate JWT token
     token, err := auth.GenerateToken(user.ID, user.Email, TokenExpiration)
     if err != nil {
-        http.Error(w, "Error generating auth token: "+err.Error(), http.StatusInternalServerError)
+        problem.Error(w, fmt.Errorf("generating auth token: %w", err))
         return
     }
 
@@ -98,7 +83,6 @@ func RegisterUser(w http.ResponseWriter, r *http.Request) {
 // LoginUser handles user login with both body and Basic Auth support
 func LoginUser(w http.ResponseWriter, r *http.Request) {
     var userLogin models.UserLogin
-    var email, password string
     
     // First try to get credentials from Authorization header
     authHeader := r.Header.Get("Authorization")
@@ -108,48 +92,37 @@ func LoginUser(w http.ResponseWriter, r *http.Request) {
         if err == nil {
             credParts := strings.SplitN(string(credentials), ":", 2)
             if len(credParts) == 2 {
-                email = credParts[0]
-                password = credParts[1]
+                userLogin.Email = credParts[0]
+                userLogin.Password = credParts[1]
             }
         }
     }
     
     // If not found in header, try to get from request body (backward compatibility)
-    if email == "" || password == "" {
-        if err := json.NewDecoder(r.Body).Decode(&userLogin); err != nil {
-            http.Error(w, "Invalid request body or authorization header: "+err.Error(), http.StatusBadRequest)
+    if userLogin.Email == "" || userLogin.Password == "" {
+        if err := validate.Decode(w, r, &userLogin); err != nil {
+            problem.Error(w, err)
             return
         }
-        email = userLogin.Email
-        password = userLogin.Password
     }
 
     // Validate input
-    if email == "" {
-        http.Error(w, "Email is required", http.StatusBadRequest)
-        return
-    }
-
-    if password == "" {
-        http.Error(w, "Password is required", http.StatusBadRequest)
+    if err := validate.Struct(userLogin); err != nil {
+        problem.Error(w, err)
         return
     }
 
     // Authenticate the user
-    user, err := models.LoginUser(email, password)
+    user, err := repos.Users.Login(userLogin.Email, userLogin.Password)
     if err != nil {
-        if err == models.ErrInvalidLogin {
-            http.Error(w, "Invalid email or password", http.StatusUnauthorized)
-            return
-        }
-        http.Error(w, "Error during login: "+err.Error(), http.StatusInternalServerError)
+        problem.Error(w, fmt.Errorf("logging in: %w", err))
         return
     }
 
     // Generate JWT token
     token, err := auth.GenerateToken(user.ID, user.Email, TokenExpiration)
     if err != nil {
-        http.Error(w, "Error generating auth token: "+err.Error(), http.StatusInternalServerError)
+        problem.Error(w, fmt.Errorf("generating auth token: %w", err))
         return
     }
 
@@ -166,14 +139,14 @@ func GetCurrentUser(w http.ResponseWriter, r *http.Request) {
     // Extract user ID from context (set by AuthMiddleware)
     userID, ok := middlewares.GetUserID(r)
     if !ok {
-        http.Error(w, "User not authenticated", http.StatusUnauthorized)
+        problem.Write(w, http.StatusUnauthorized, problem.CodeUnauthorized, "User not authenticated")
         return
     }
 
     // Get user information
-    user, err := models.GetUserByID(userID)
+    user, err := repos.Users.GetByID(userID)
     if err != nil {
-        http.Error(w, "Error fetching user data: "+err.Error(), http.StatusInternalServerError)
+        problem.Error(w, fmt.Errorf("fetching user data: %w", err))
         return
     }
 
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-crud/middlewares"
+	"go-crud/models"
+	"go-crud/models/memory"
+)
+
+// useMemoryRepositories points the handlers, and the middlewares they call, at empty in-memory
+// repositories until the test ends
+func useMemoryRepositories(t *testing.T) models.Repositories {
+	t.Helper()
+	r := memory.NewRepositories()
+	UseRepositories(r)
+	middlewares.UseRepositories(r)
+	t.Cleanup(func() {
+		UseRepositories(models.SQLRepositories())
+		middlewares.UseRepositories(models.SQLRepositories())
+	})
+	return r
+}
+
+// serve sends one request to h, registered under pattern so path values are set
+func serve(pattern string, h http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	mux := http.NewServeMux()
+	mux.HandleFunc(pattern, h)
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, req)
+	return w
+}
+
+// serveAs is serve for a request authenticated as userID
+func serveAs(userID int, pattern string, h http.HandlerFunc, method, target, body string) *httptest.ResponseRecorder {
+	return serve(pattern, func(w http.ResponseWriter, r *http.Request) {
+		h(w, r.WithContext(context.WithValue(r.Context(), middlewares.UserIDKey, userID)))
+	}, method, target, body)
+}
+
+// decodeResponse checks the status of a response and decodes its JSON body into v, if given
+func decodeResponse(t *testing.T, w *httptest.ResponseRecorder, status int, v interface{}) {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status = %d, want %d; body: %s", w.Code, status, w.Body)
+	}
+	if v != nil {
+		if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+			t.Fatalf("decoding %s: %v", w.Body, err)
+		}
+	}
+}
+
+// checkProblem checks the status and code of a problem response
+func checkProblem(t *testing.T, w *httptest.ResponseRecorder, status int, code string) {
+	t.Helper()
+	var p struct {
+		Code string `json:"code"`
+	}
+	decodeResponse(t, w, status, &p)
+	if p.Code != code {
+		t.Errorf("code = %q, want %q", p.Code, code)
+	}
+}
+
+// placeOrder stores an order of quantity units of a new product and walks it to status
+func placeOrder(t *testing.T, r models.Repositories, price float64, quantity int, status string) models.Order {
+	t.Helper()
+	users, _ := r.Users.List(-1)
+	userID, err := r.Users.Create(fmt.Sprintf("buyer%d@example.com", len(users)+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	productID := r.Products.(*memory.Products).Add(models.Product{Name: "Widget", Status: "active", Price: price})
+	id, err := r.Orders.Place(models.OrderRequest{UserID: userID, Items: []models.ItemRequest{{ProductID: productID, Quantity: quantity}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, next := range models.OrderStatusPath(models.OrderStatusPending, status) {
+		if err := r.Orders.UpdateStatus(id, next); err != nil {
+			t.Fatal(err)
+		}
+	}
+	order, err := r.Orders.GetByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
@@ -0,0 +1,188 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-crud/models"
+	"go-crud/problem"
+)
+
+type couponRequest struct {
+	ID            int        `json:"id,omitempty"`
+	Code          string     `json:"code" validate:"required,max=64"`
+	Type          string     `json:"type" validate:"required,oneof=percent fixed free_shipping"`
+	Value         float64    `json:"value" validate:"min=0"`
+	StartsAt      *time.Time `json:"starts_at,omitempty"`
+	EndsAt        *time.Time `json:"ends_at,omitempty"`
+	MinOrderValue float64    `json:"min_order_value" validate:"min=0"`
+	UsageLimit    int        `json:"usage_limit" validate:"min=0"`
+	PerUserLimit  int        `json:"per_user_limit" validate:"min=0"`
+	Active        *bool      `json:"active,omitempty"`
+	ProductIDs    []int      `json:"product_ids,omitempty"`
+	Categories    []string   `json:"categories,omitempty"`
+}
+
+type couponResponse struct {
+	Message string `json:"message"`
+	ID      int    `json:"id,omitempty"`
+}
+
+// Validate checks the value against the coupon type and the validity window
+func (req couponRequest) Validate() []models.FieldError {
+	var fields []models.FieldError
+	switch {
+	case req.Type == models.CouponPercent && (req.Value <= 0 || req.Value > 100):
+		fields = append(fields, models.FieldError{Field: "value", Code: models.FieldInvalid, Message: "value must be between 0 and 100 for percent coupons"})
+	case req.Type == models.CouponFixed && req.Value <= 0:
+		fields = append(fields, models.FieldError{Field: "value", Code: models.FieldInvalid, Message: "value must be positive for fixed coupons"})
+	}
+	if req.StartsAt != nil && req.EndsAt != nil && !req.EndsAt.After(*req.StartsAt) {
+		fields = append(fields, models.FieldError{Field: "ends_at", Code: models.FieldInvalid, Message: "ends_at must be after starts_at"})
+	}
+	return fields
+}
+
+// toCoupon converts a validated request to a coupon
+func (req couponRequest) toCoupon() models.Coupon {
+	active := true
+	if req.Active != nil {
+		active = *req.Active
+	}
+
+	return models.Coupon{
+		ID:            req.ID,
+		Code:          req.Code,
+		Type:          req.Type,
+		Value:         req.Value,
+		StartsAt:      req.StartsAt,
+		EndsAt:        req.EndsAt,
+		MinOrderValue: req.MinOrderValue,
+		UsageLimit:    req.UsageLimit,
+		PerUserLimit:  req.PerUserLimit,
+		Active:        active,
+		ProductIDs:    req.ProductIDs,
+		Categories:    req.Categories,
+	}
+}
+
+// GetCoupons handles retrieving all coupons
+func GetCoupons(w http.ResponseWriter, r *http.Request) {
+	coupons, err := repos.Coupons.List(100)
+	if err != nil {
+		problem.Error(w, fmt.Errorf("fetching coupons: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(coupons)
+}
+
+// GetCouponByID handles retrieving a specific coupon
+func GetCouponByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid coupon ID")
+		return
+	}
+
+	coupon, err := repos.Coupons.GetByID(id)
+	if err == models.ErrCouponNotFound {
+		problem.Write(w, http.StatusNotFound, problem.CodeNotFound, "Coupon not found")
+		return
+	}
+	if err != nil {
+		problem.Error(w, fmt.Errorf("fetching coupon: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(coupon)
+}
+
+// CreateCoupon handles creating a new coupon
+func CreateCoupon(w http.ResponseWriter, r *http.Request) {
+	var req couponRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	id, err := repos.Coupons.Create(req.toCoupon())
+	if err != nil {
+		problem.Error(w, fmt.Errorf("creating coupon: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(couponResponse{Message: "Coupon created successfully", ID: id})
+}
+
+// UpdateCoupon handles updating an existing coupon
+func UpdateCoupon(w http.ResponseWriter, r *http.Request) {
+	var req couponRequest
+	if !decodeRequest(w, r, &req, &req.ID) {
+		return
+	}
+
+	if err := repos.Coupons.Update(req.toCoupon()); err != nil {
+		if err == models.ErrCouponNotFound {
+			problem.Write(w, http.StatusNotFound, problem.CodeNotFound, "Coupon not found")
+			return
+		}
+		problem.Error(w, fmt.Errorf("updating coupon: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(couponResponse{Message: "Coupon updated successfully"})
+}
+
+// DeleteCoupon handles deleting a coupon. Coupons that were already redeemed are deactivated instead.
+func DeleteCoupon(w http.ResponseWriter, r *http.Request) {
+	var req idRequest
+	if !decodeRequest(w, r, &req, &req.ID) {
+		return
+	}
+
+	if err := repos.Coupons.Delete(req.ID); err != nil {
+		problem.Error(w, fmt.Errorf("deleting coupon: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(couponResponse{Message: "Coupon deleted successfully"})
+}
+
+// GetCouponRedemptions handles the redemption report. For GET /coupons/{id}/redemptions
+// (or ?id=) it lists the redemptions of one coupon, otherwise it summarises all coupons.
+func GetCouponRedemptions(w http.ResponseWriter, r *http.Request) {
+	if idStr := idParam(r); idStr != "" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid coupon ID")
+			return
+		}
+
+		redemptions, err := repos.Coupons.Redemptions(id, 100)
+		if err != nil {
+			problem.Error(w, fmt.Errorf("fetching redemptions: %w", err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(redemptions)
+		return
+	}
+
+	report, err := repos.Coupons.Report()
+	if err != nil {
+		problem.Error(w, fmt.Errorf("building coupon report: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
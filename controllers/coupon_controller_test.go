@@ -0,0 +1,74 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+
+	"go-crud/models"
+	"go-crud/models/memory"
+	"go-crud/problem"
+)
+
+func TestCouponHandlers(t *testing.T) {
+	r := useMemoryRepositories(t)
+
+	var created couponResponse
+	w := serve("POST /coupons", CreateCoupon, "POST", "/coupons", `{"code": " save10 ", "type": "percent", "value": 10}`)
+	decodeResponse(t, w, http.StatusOK, &created)
+
+	w = serve("POST /coupons", CreateCoupon, "POST", "/coupons", `{"code": "SAVE10", "type": "fixed", "value": 5}`)
+	checkProblem(t, w, http.StatusConflict, problem.CodeCouponExists)
+
+	w = serve("POST /coupons", CreateCoupon, "POST", "/coupons", `{"code": "HALF", "type": "percent", "value": 150}`)
+	checkProblem(t, w, http.StatusUnprocessableEntity, problem.CodeValidation)
+
+	var coupon models.Coupon
+	w = serve("GET /coupons/{id}", GetCouponByID, "GET", "/coupons/1", "")
+	decodeResponse(t, w, http.StatusOK, &coupon)
+	if coupon.ID != created.ID || coupon.Code != "SAVE10" || !coupon.Active {
+		t.Errorf("got %+v", coupon)
+	}
+
+	w = serve("GET /coupons/{id}", GetCouponByID, "GET", "/coupons/9", "")
+	checkProblem(t, w, http.StatusNotFound, problem.CodeNotFound)
+
+	w = serve("PUT /coupons/{id}", UpdateCoupon, "PUT", "/coupons/1", `{"code": "SAVE15", "type": "percent", "value": 15}`)
+	decodeResponse(t, w, http.StatusOK, nil)
+	if coupon, _ = r.Coupons.GetByID(1); coupon.Code != "SAVE15" || coupon.Value != 15 {
+		t.Errorf("after update got %+v", coupon)
+	}
+
+	w = serve("PUT /coupons/{id}", UpdateCoupon, "PUT", "/coupons/9", `{"code": "NONE", "type": "percent", "value": 15}`)
+	checkProblem(t, w, http.StatusNotFound, problem.CodeNotFound)
+
+	if err := r.Coupons.(*memory.Coupons).Redeem(models.CouponRedemption{CouponID: 1, UserID: 3, OrderID: 4, Amount: 2.5}); err != nil {
+		t.Fatal(err)
+	}
+	var redemptions []models.CouponRedemption
+	w = serve("GET /coupons/{id}/redemptions", GetCouponRedemptions, "GET", "/coupons/1/redemptions", "")
+	decodeResponse(t, w, http.StatusOK, &redemptions)
+	if len(redemptions) != 1 || redemptions[0].OrderID != 4 || redemptions[0].Code != "SAVE15" {
+		t.Errorf("redemptions = %+v", redemptions)
+	}
+
+	var report []models.CouponReport
+	w = serve("GET /coupons/redemptions", GetCouponRedemptions, "GET", "/coupons/redemptions", "")
+	decodeResponse(t, w, http.StatusOK, &report)
+	if len(report) != 1 || report[0].Redemptions != 1 || report[0].TotalDiscount != 2.5 {
+		t.Errorf("report = %+v", report)
+	}
+
+	// A redeemed coupon is deactivated rather than deleted
+	w = serve("DELETE /coupons/{id}", DeleteCoupon, "DELETE", "/coupons/1", "")
+	decodeResponse(t, w, http.StatusOK, nil)
+	if coupon, err := r.Coupons.GetByID(1); err != nil || coupon.Active {
+		t.Errorf("after delete got %+v, %v", coupon, err)
+	}
+
+	var list []models.Coupon
+	w = serve("GET /coupons", GetCoupons, "GET", "/coupons", "")
+	decodeResponse(t, w, http.StatusOK, &list)
+	if len(list) != 1 {
+		t.Errorf("listed %d coupons, want 1", len(list))
+	}
+}
@@ -0,0 +1,51 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go-crud/problem"
+	"go-crud/scheduler"
+)
+
+// GetJobs lists the scheduled background jobs with their next run and the result of their last run
+func GetJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := scheduler.Default.Jobs()
+	if err != nil {
+		problem.Error(w, fmt.Errorf("fetching jobs: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(jobs)
+}
+
+// GetJobRuns returns the run history of a job, newest first
+func GetJobRuns(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, "Job name is required")
+		return
+	}
+
+	limit := 20
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 || n > 100 {
+			problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid limit (1-100)")
+			return
+		}
+		limit = n
+	}
+
+	runs, err := repos.JobRuns.List(name, limit)
+	if err != nil {
+		problem.Error(w, fmt.Errorf("fetching job runs: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(runs)
+}
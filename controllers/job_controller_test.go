@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+
+	"go-crud/models"
+	"go-crud/models/memory"
+	"go-crud/problem"
+)
+
+func TestGetJobRuns(t *testing.T) {
+	r := useMemoryRepositories(t)
+	runs := r.JobRuns.(*memory.JobRuns)
+	runs.Add(models.JobRun{JobName: "expire_orders", Status: models.JobRunFailed})
+	runs.Add(models.JobRun{JobName: "other", Status: models.JobRunSucceeded})
+	latest := runs.Add(models.JobRun{JobName: "expire_orders", Status: models.JobRunSucceeded})
+
+	var got []models.JobRun
+	w := serve("GET /admin/jobs/runs", GetJobRuns, "GET", "/admin/jobs/runs?name=expire_orders", "")
+	decodeResponse(t, w, http.StatusOK, &got)
+	if len(got) != 2 || got[0].ID != latest {
+		t.Errorf("runs = %+v, want 2 newest first", got)
+	}
+
+	w = serve("GET /admin/jobs/runs", GetJobRuns, "GET", "/admin/jobs/runs?name=expire_orders&limit=1", "")
+	decodeResponse(t, w, http.StatusOK, &got)
+	if len(got) != 1 || got[0].ID != latest {
+		t.Errorf("limited runs = %+v", got)
+	}
+
+	w = serve("GET /admin/jobs/runs", GetJobRuns, "GET", "/admin/jobs/runs?name=never_ran", "")
+	decodeResponse(t, w, http.StatusOK, &got)
+	if len(got) != 0 {
+		t.Errorf("runs of a job that never ran = %+v", got)
+	}
+
+	for _, target := range []string{"/admin/jobs/runs", "/admin/jobs/runs?name=expire_orders&limit=0", "/admin/jobs/runs?name=expire_orders&limit=500"} {
+		w = serve("GET /admin/jobs/runs", GetJobRuns, "GET", target, "")
+		checkProblem(t, w, http.StatusBadRequest, problem.CodeInvalidParameter)
+	}
+}
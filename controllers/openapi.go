@@ -0,0 +1,145 @@
+package controllers
+
+import (
+	"net/http"
+
+	"go-crud/middlewares"
+	"go-crud/models"
+	"go-crud/openapi"
+	"go-crud/scheduler"
+)
+
+// pageParams are the pagination query parameters of the list routes
+var pageParams = []openapi.Param{
+	{Name: "page", Type: "integer", Description: "Page number, from 1"},
+	{Name: "per_page", Type: "integer", Description: "Items per page"},
+}
+
+var orderListParams = append(append([]openapi.Param{}, pageParams...),
+	openapi.Param{Name: "user_id", Type: "integer"},
+	openapi.Param{Name: "status", Description: "Order status; repeat or separate with commas for several"},
+	openapi.Param{Name: "created_from", Description: "YYYY-MM-DD or RFC 3339"},
+	openapi.Param{Name: "created_to", Description: "YYYY-MM-DD (inclusive) or RFC 3339"},
+	openapi.Param{Name: "min_total", Type: "number"},
+	openapi.Param{Name: "max_total", Type: "number"},
+	openapi.Param{Name: "sort", Description: "Column to sort by, prefixed with - for descending"},
+)
+
+// Endpoints documents the routes served by this package's handlers for the OpenAPI document,
+// keyed by their unprefixed route pattern. Every route registered in the routes package needs
+// an entry; `go-crud openapi -check` fails otherwise.
+var Endpoints = map[string]openapi.Endpoint{
+	// Auth
+	"POST /auth/register": {Summary: "Register a user from Basic credentials or a JSON body", Tag: "Auth", Auth: openapi.AuthAdmin,
+		Request: models.UserSignup{}, Response: models.AuthResponse{}, Status: http.StatusCreated},
+	"POST /auth/login": {Summary: "Log in and get a JWT", Tag: "Auth", Auth: openapi.AuthAdmin,
+		Request: models.UserLogin{}, Response: models.AuthResponse{}},
+	"GET /auth/me": {Summary: "Get the authenticated user", Tag: "Auth", Auth: openapi.AuthUser, Response: models.User{}},
+	"GET /admin":   {Summary: "Admin dashboard", Tag: "Admin", Auth: openapi.AuthAdmin, ContentType: "text/html"},
+
+	// Users
+	"GET /users":           {Summary: "List users", Tag: "Users", Auth: openapi.AuthAdmin, Response: []models.User{}},
+	"POST /users":          {Summary: "Create a user", Tag: "Users", Auth: openapi.AuthAdmin, Request: createUserRequest{}, Response: userResponse{}},
+	"GET /users/me":        {Summary: "Get the profile of the authenticated user", Tag: "Users", Auth: openapi.AuthAdmin, Response: models.User{}},
+	"GET /users/me/orders": {Summary: "List the authenticated user's orders", Tag: "Users", Auth: openapi.AuthUser, Query: orderListParams, Response: models.PaginatedOrders{}},
+	"PUT /users/{id}":      {Summary: "Update a user", Tag: "Users", Auth: openapi.AuthAdmin, Request: userRequest{}, Response: userResponse{}},
+	"PATCH /users/{id}":    {Summary: "Update a user", Tag: "Users", Auth: openapi.AuthAdmin, Request: userRequest{}, Response: userResponse{}},
+	"DELETE /users/{id}":   {Summary: "Delete a user", Tag: "Users", Auth: openapi.AuthAdmin, Response: userResponse{}},
+
+	// Products
+	"GET /products": {Summary: "List products with filters and pagination", Tag: "Products", Auth: openapi.AuthAdmin,
+		Query: append(append([]openapi.Param{}, pageParams...),
+			openapi.Param{Name: "name", Description: "Name contains"},
+			openapi.Param{Name: "status"},
+			openapi.Param{Name: "min_id", Type: "integer"},
+			openapi.Param{Name: "max_id", Type: "integer"}),
+		Response:  middlewares.PaginatedProducts{},
+		ByVersion: map[int]interface{}{2: middlewares.PaginatedProductsV2{}}},
+
+	// Roles
+	"GET /roles":         {Summary: "List roles", Tag: "Roles", Auth: openapi.AuthAdmin, Response: []models.Role{}},
+	"POST /roles":        {Summary: "Create a role", Tag: "Roles", Auth: openapi.AuthAdmin, Request: roleRequest{}, Response: roleResponse{}},
+	"GET /roles/{id}":    {Summary: "Get a role", Tag: "Roles", Auth: openapi.AuthAdmin, Response: models.Role{}},
+	"PUT /roles/{id}":    {Summary: "Update a role", Tag: "Roles", Auth: openapi.AuthAdmin, Request: roleRequest{}, Response: roleResponse{}},
+	"DELETE /roles/{id}": {Summary: "Delete a role", Tag: "Roles", Auth: openapi.AuthAdmin, Response: roleResponse{}},
+
+	// Orders
+	"GET /orders":      {Summary: "List orders with filters and pagination", Tag: "Orders", Auth: openapi.AuthAdmin, Query: orderListParams, Response: models.PaginatedOrders{}},
+	"POST /orders":     {Summary: "Place an order", Tag: "Orders", Auth: openapi.AuthAdmin, Request: models.OrderRequest{}, Response: orderResponse{}},
+	"PATCH /orders":    {Summary: "Change the status of many orders", Tag: "Orders", Auth: openapi.AuthAdmin, Request: batchStatusRequest{}, Response: batchStatusResponse{}},
+	"GET /orders/{id}": {Summary: "Get an order", Tag: "Orders", Auth: openapi.AuthAdmin, Response: models.Order{}},
+	"PUT /orders/{id}": {Summary: "Change the status of an order", Tag: "Orders", Auth: openapi.AuthAdmin,
+		Request: orderStatusRequest{}, Response: orderResponse{}},
+	"PATCH /orders/{id}": {Summary: "Change the status of an order", Tag: "Orders", Auth: openapi.AuthAdmin,
+		Request: orderStatusRequest{}, Response: orderResponse{}},
+	"DELETE /orders/{id}": {Summary: "Delete an order", Tag: "Orders", Auth: openapi.AuthAdmin, Response: orderResponse{}},
+	"GET /orders/{id}/invoice": {Summary: "Download the invoice or packing slip", Tag: "Orders", Auth: openapi.AuthAdmin,
+		Query:       []openapi.Param{{Name: "document", Description: "invoice (default) or packing_slip"}},
+		ContentType: "application/pdf"},
+	"POST /orders/{id}/pay": {Summary: "Pay for an order", Tag: "Payments", Auth: openapi.AuthAdmin,
+		Request: payOrderRequest{}, Response: paymentResponse{}, Status: http.StatusCreated},
+	"PUT /orders/{id}/address": {Summary: "Assign an address to an order", Tag: "Addresses", Auth: openapi.AuthUser,
+		Request: assignAddressRequest{}, Response: addressResponse{}},
+
+	// Addresses
+	"GET /addresses": {Summary: "List addresses", Tag: "Addresses", Auth: openapi.AuthUser,
+		Query: []openapi.Param{{Name: "user_id", Type: "integer", Description: "Admin only: the addresses of one user"}}, Response: []models.Address{}},
+	"POST /addresses":        {Summary: "Create an address", Tag: "Addresses", Auth: openapi.AuthUser, Request: addressRequest{}, Response: addressResponse{}},
+	"GET /addresses/{id}":    {Summary: "Get an address", Tag: "Addresses", Auth: openapi.AuthUser, Response: models.Address{}},
+	"PUT /addresses/{id}":    {Summary: "Update an address", Tag: "Addresses", Auth: openapi.AuthUser, Request: addressRequest{}, Response: addressResponse{}},
+	"DELETE /addresses/{id}": {Summary: "Delete an address", Tag: "Addresses", Auth: openapi.AuthUser, Response: addressResponse{}},
+
+	// Pricing
+	"GET /tax-rates": {Summary: "List tax rates", Tag: "Pricing", Auth: openapi.AuthAdmin, Response: []models.TaxRate{}},
+	"PUT /tax-rates": {Summary: "Set the tax rate of a country or state", Tag: "Pricing", Auth: openapi.AuthAdmin, Request: taxRateRequest{}, Response: taxRateResponse{}},
+
+	// Coupons
+	"GET /coupons":             {Summary: "List coupons", Tag: "Coupons", Auth: openapi.AuthAdmin, Response: []models.Coupon{}},
+	"POST /coupons":            {Summary: "Create a coupon", Tag: "Coupons", Auth: openapi.AuthAdmin, Request: couponRequest{}, Response: couponResponse{}},
+	"GET /coupons/redemptions": {Summary: "Redemption report of all coupons", Tag: "Coupons", Auth: openapi.AuthAdmin, Response: []models.CouponReport{}},
+	"GET /coupons/{id}":        {Summary: "Get a coupon", Tag: "Coupons", Auth: openapi.AuthAdmin, Response: models.Coupon{}},
+	"PUT /coupons/{id}":        {Summary: "Update a coupon", Tag: "Coupons", Auth: openapi.AuthAdmin, Request: couponRequest{}, Response: couponResponse{}},
+	"DELETE /coupons/{id}":     {Summary: "Delete a coupon", Tag: "Coupons", Auth: openapi.AuthAdmin, Response: couponResponse{}},
+	"GET /coupons/{id}/redemptions": {Summary: "List the redemptions of a coupon", Tag: "Coupons", Auth: openapi.AuthAdmin,
+		Response: []models.CouponRedemption{}},
+
+	// Payments
+	"GET /payments": {Summary: "List the payments of an order", Tag: "Payments", Auth: openapi.AuthAdmin,
+		Query: []openapi.Param{{Name: "order_id", Type: "integer", Required: true}}, Response: []models.Payment{}},
+	"POST /payments/{id}/capture": {Summary: "Capture an authorized payment", Tag: "Payments", Auth: openapi.AuthAdmin,
+		Request: paymentActionRequest{}, Response: paymentResponse{}},
+	"POST /payments/{id}/void": {Summary: "Void an authorized payment", Tag: "Payments", Auth: openapi.AuthAdmin,
+		Request: paymentActionRequest{}, Response: paymentResponse{}},
+	"POST /payments/webhook": {Summary: "Payment provider events", Tag: "Payments", Auth: openapi.AuthSignature,
+		Request: webhookEvent{}, Response: paymentResponse{}},
+
+	// Shipments
+	"GET /shipments": {Summary: "List the shipments of an order", Tag: "Shipments", Auth: openapi.AuthAdmin,
+		Query: []openapi.Param{{Name: "order_id", Type: "integer", Required: true}}, Response: []models.Shipment{}},
+	"POST /shipments": {Summary: "Create a shipment", Tag: "Shipments", Auth: openapi.AuthAdmin,
+		Request: createShipmentRequest{}, Response: shipmentResponse{}, Status: http.StatusCreated},
+	"GET /shipments/{id}": {Summary: "Get a shipment", Tag: "Shipments", Auth: openapi.AuthAdmin, Response: models.Shipment{}},
+	"POST /shipments/{id}/ship": {Summary: "Mark a shipment shipped", Tag: "Shipments", Auth: openapi.AuthAdmin,
+		Request: shipShipmentRequest{}, Response: shipmentResponse{}},
+	"POST /shipments/{id}/deliver": {Summary: "Mark a shipment delivered", Tag: "Shipments", Auth: openapi.AuthAdmin,
+		Request: deliverShipmentRequest{}, Response: shipmentResponse{}},
+
+	// Returns
+	"GET /returns": {Summary: "List returns", Tag: "Returns", Auth: openapi.AuthAdmin,
+		Query: []openapi.Param{{Name: "order_id", Type: "integer"}, {Name: "status"}}, Response: []models.OrderReturn{}},
+	"POST /returns": {Summary: "Request a return", Tag: "Returns", Auth: openapi.AuthAdmin,
+		Request: createReturnRequest{}, Response: returnResponse{}, Status: http.StatusCreated},
+	"GET /returns/{id}": {Summary: "Get a return", Tag: "Returns", Auth: openapi.AuthAdmin, Response: models.OrderReturn{}},
+	"POST /returns/{id}/approve": {Summary: "Approve a return", Tag: "Returns", Auth: openapi.AuthAdmin,
+		Request: reviewReturnRequest{}, Response: returnResponse{}},
+	"POST /returns/{id}/reject": {Summary: "Reject a return", Tag: "Returns", Auth: openapi.AuthAdmin,
+		Request: reviewReturnRequest{}, Response: returnResponse{}},
+	"POST /returns/{id}/receive": {Summary: "Receive returned items and refund", Tag: "Returns", Auth: openapi.AuthAdmin,
+		Request: receiveReturnRequest{}, Response: returnResponse{}},
+
+	// Background jobs
+	"GET /admin/jobs": {Summary: "List scheduled jobs", Tag: "Jobs", Auth: openapi.AuthAdmin, Response: []scheduler.JobInfo{}},
+	"GET /admin/jobs/runs": {Summary: "Run history of a job", Tag: "Jobs", Auth: openapi.AuthAdmin,
+		Query:    []openapi.Param{{Name: "name", Required: true}, {Name: "limit", Type: "integer", Description: "1-100, default 20"}},
+		Response: []models.JobRun{}},
+}
@@ -1,10 +1,16 @@
 package controllers
 
 import (
+	"database/sql"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+	"go-crud/middlewares"
 	"go-crud/models"
+	"go-crud/problem"
 )
 
 type orderResponse struct {
@@ -13,35 +19,178 @@ type orderResponse struct {
 	Order   interface{} `json:"order,omitempty"`
 }
 
-// GetOrders handles retrieving all orders
+// GetOrders handles listing orders with filters, sorting and pagination
+//
+// Query parameters: user_id, status (repeatable or comma-separated), created_from, created_to
+// (YYYY-MM-DD or RFC 3339), min_total, max_total, sort (e.g. "-created_at"), page and per_page.
 func GetOrders(w http.ResponseWriter, r *http.Request) {
-	orders, err := models.GetOrders(100)
+	filter, filtersMap, page, perPage, msg := parseOrderQuery(r)
+	if msg != "" {
+		problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, msg)
+		return
+	}
+	
+	listOrders(w, filter, filtersMap, page, perPage)
+}
+
+// GetMyOrders handles listing the authenticated user's own orders
+func GetMyOrders(w http.ResponseWriter, r *http.Request) {
+	userID, ok := middlewares.GetUserID(r)
+	if !ok {
+		problem.Write(w, http.StatusUnauthorized, problem.CodeUnauthorized, "User not authenticated")
+		return
+	}
+	
+	filter, filtersMap, page, perPage, msg := parseOrderQuery(r)
+	if msg != "" {
+		problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, msg)
+		return
+	}
+	
+	// Always restrict to the caller, whatever user_id was passed
+	filter.UserID = userID
+	delete(filtersMap, "user_id")
+	
+	listOrders(w, filter, filtersMap, page, perPage)
+}
+
+func listOrders(w http.ResponseWriter, filter models.OrderFilter, filtersMap map[string]string, page, perPage int) {
+	orders, err := repos.Orders.Filter(filter, page, perPage)
 	if err != nil {
-		http.Error(w, "Error fetching orders: "+err.Error(), http.StatusInternalServerError)
+		problem.Error(w, fmt.Errorf("fetching orders: %w", err))
 		return
 	}
+	orders.Filters = filtersMap
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(orders)
 }
 
+// parseOrderQuery reads the order list filters and pagination from the query string.
+// It returns a non-empty message when a parameter is invalid.
+func parseOrderQuery(r *http.Request) (models.OrderFilter, map[string]string, int, int, string) {
+	query := r.URL.Query()
+	filter := models.OrderFilter{SortBy: "created_at", SortDesc: true}
+	filtersMap := make(map[string]string)
+	page, perPage := 1, 20
+	
+	if v := query.Get("page"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 {
+			return filter, nil, 0, 0, "Invalid page"
+		}
+		page = parsed
+	}
+	
+	if v := query.Get("per_page"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 || parsed > 100 {
+			return filter, nil, 0, 0, "per_page must be between 1 and 100"
+		}
+		perPage = parsed
+	}
+	
+	if v := query.Get("user_id"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil || parsed < 1 {
+			return filter, nil, 0, 0, "Invalid user_id"
+		}
+		filter.UserID = parsed
+		filtersMap["user_id"] = v
+	}
+	
+	// status may be repeated (?status=a&status=b) or comma-separated (?status=a,b)
+	for _, v := range query["status"] {
+		for _, status := range strings.Split(v, ",") {
+			if status = strings.TrimSpace(status); status != "" {
+				filter.Statuses = append(filter.Statuses, status)
+			}
+		}
+	}
+	if len(filter.Statuses) > 0 {
+		filtersMap["status"] = strings.Join(filter.Statuses, ",")
+	}
+	
+	if v := query.Get("created_from"); v != "" {
+		from, _, err := parseDateParam(v)
+		if err != nil {
+			return filter, nil, 0, 0, "Invalid created_from, use YYYY-MM-DD or RFC 3339"
+		}
+		filter.CreatedFrom = from
+		filtersMap["created_from"] = v
+	}
+	
+	if v := query.Get("created_to"); v != "" {
+		to, dateOnly, err := parseDateParam(v)
+		if err != nil {
+			return filter, nil, 0, 0, "Invalid created_to, use YYYY-MM-DD or RFC 3339"
+		}
+		// A plain date includes the whole day
+		if dateOnly {
+			to = to.AddDate(0, 0, 1)
+		}
+		filter.CreatedTo = to
+		filtersMap["created_to"] = v
+	}
+	
+	if v := query.Get("min_total"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return filter, nil, 0, 0, "Invalid min_total"
+		}
+		filter.MinTotal = &parsed
+		filtersMap["min_total"] = v
+	}
+	
+	if v := query.Get("max_total"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return filter, nil, 0, 0, "Invalid max_total"
+		}
+		filter.MaxTotal = &parsed
+		filtersMap["max_total"] = v
+	}
+	
+	// sort=column for ascending, sort=-column for descending
+	if v := query.Get("sort"); v != "" {
+		column := strings.TrimPrefix(v, "-")
+		if !models.OrderSortColumns[column] {
+			return filter, nil, 0, 0, "Invalid sort column: " + column
+		}
+		filter.SortBy = column
+		filter.SortDesc = strings.HasPrefix(v, "-")
+		filtersMap["sort"] = v
+	}
+	
+	return filter, filtersMap, page, perPage, ""
+}
+
+// parseDateParam accepts either a date (YYYY-MM-DD) or an RFC 3339 timestamp
+func parseDateParam(v string) (time.Time, bool, error) {
+	if t, err := time.Parse("2006-01-02", v); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	return t, false, err
+}
+
 // GetOrderByID handles retrieving a specific order
 func GetOrderByID(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
+	idStr := idParam(r)
 	if idStr == "" {
-		http.Error(w, "Missing order ID", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, "Missing order ID")
 		return
 	}
 	
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid order ID")
 		return
 	}
 	
-	order, err := models.GetOrderByID(id)
+	order, err := repos.Orders.GetByID(id)
 	if err != nil {
-		http.Error(w, "Error fetching order: "+err.Error(), http.StatusInternalServerError)
+		problem.Error(w, fmt.Errorf("fetching order: %w", err))
 		return
 	}
 	
@@ -52,41 +201,19 @@ func GetOrderByID(w http.ResponseWriter, r *http.Request) {
 // PlaceOrder handles creating a new order
 func PlaceOrder(w http.ResponseWriter, r *http.Request) {
 	var req models.OrderRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
-		return
-	}
-	
-	// Validate request
-	if req.UserID == 0 {
-		http.Error(w, "User ID is required", http.StatusBadRequest)
+	if !decodeBody(w, r, &req) {
 		return
 	}
 	
-	if len(req.Items) == 0 {
-		http.Error(w, "Order must contain at least one item", http.StatusBadRequest)
-		return
-	}
-	
-	// Create the order
-	var orderID int
-	var err error
-	
-	if req.AddressID > 0 {
-		// Create order with address
-		orderID, err = models.CreateOrder(req.UserID, req.Items, req.AddressID)
-	} else {
-		// Create order without address
-		orderID, err = models.CreateOrder(req.UserID, req.Items)
-	}
-	
+	// Create the order, redeeming the coupon if one was given
+	orderID, err := repos.Orders.Place(req)
 	if err != nil {
-		http.Error(w, "Error creating order: "+err.Error(), http.StatusInternalServerError)
+		problem.Error(w, fmt.Errorf("creating order: %w", err))
 		return
 	}
 	
 	// Get the created order details
-	order, err := models.GetOrderByID(orderID)
+	order, err := repos.Orders.GetByID(orderID)
 	if err != nil {
 		// Still report success even if we can't fetch the order details
 		w.Header().Set("Content-Type", "application/json")
@@ -106,66 +233,221 @@ func PlaceOrder(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+type orderStatusRequest struct {
+	ID     int    `json:"id"`
+	Status string `json:"status" validate:"required,oneof=pending paid processing shipped delivered completed cancelled refunded partially_refunded"`
+}
+
 // UpdateOrderStatus handles updating an order's status
 func UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
-	type updateRequest struct {
-		ID     int    `json:"id"`
-		Status string `json:"status"`
-	}
-	
-	var req updateRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var req orderStatusRequest
+	if !decodeRequest(w, r, &req, &req.ID) {
 		return
 	}
 	
-	if req.ID == 0 {
-		http.Error(w, "Order ID is required", http.StatusBadRequest)
+	// Update the order status
+	if err := repos.Orders.UpdateStatus(req.ID, req.Status); err != nil {
+		problem.Error(w, fmt.Errorf("updating order status: %w", err))
 		return
 	}
 	
-	if req.Status == "" {
-		http.Error(w, "Status is required", http.StatusBadRequest)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orderResponse{
+		Message: "Order status updated successfully",
+	})
+}
+
+// DeleteOrder handles deleting an order
+func DeleteOrder(w http.ResponseWriter, r *http.Request) {
+	var req idRequest
+	if !decodeRequest(w, r, &req, &req.ID) {
 		return
 	}
 	
-	// Update the order status
-	if err := models.UpdateOrderStatus(req.ID, req.Status); err != nil {
-		http.Error(w, "Error updating order status: "+err.Error(), http.StatusInternalServerError)
+	// Delete the order
+	if err := repos.Orders.Delete(req.ID); err != nil {
+		problem.Error(w, fmt.Errorf("deleting order: %w", err))
 		return
 	}
 	
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(orderResponse{
-		Message: "Order status updated successfully",
+		Message: "Order deleted successfully",
 	})
 }
+// maxBatchOrders caps how many orders one batch status update may touch; the max rule of
+// batchStatusRequest.IDs repeats it
+const maxBatchOrders = 1000
 
-// DeleteOrder handles deleting an order
-func DeleteOrder(w http.ResponseWriter, r *http.Request) {
-	type deleteRequest struct {
-		ID int `json:"id"`
+type batchStatusFilter struct {
+	UserID        int        `json:"user_id,omitempty"`
+	Status        []string   `json:"status,omitempty" validate:"oneof=pending paid processing shipped delivered completed cancelled refunded partially_refunded"`
+	CreatedAfter  *time.Time `json:"created_after,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+	OlderThanDays int        `json:"older_than_days,omitempty" validate:"min=0"`
+}
+
+type batchStatusRequest struct {
+	IDs    []int              `json:"ids,omitempty" validate:"max=1000"`
+	Filter *batchStatusFilter `json:"filter,omitempty"`
+	Status string             `json:"status" validate:"required,oneof=pending paid processing shipped delivered completed cancelled refunded partially_refunded"`
+	Mode   string             `json:"mode,omitempty" validate:"omitempty,oneof=best_effort atomic"` // "best_effort" (default)
+}
+
+// Validate requires exactly one way of selecting orders
+func (req batchStatusRequest) Validate() []models.FieldError {
+	if (len(req.IDs) == 0) == (req.Filter == nil) {
+		return []models.FieldError{{Field: "ids", Code: models.FieldInvalid, Message: "provide either ids or filter"}}
 	}
-	
-	var req deleteRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if req.Filter != nil && req.Filter.empty() {
+		return []models.FieldError{{Field: "filter", Code: models.FieldRequired, Message: "filter must set at least one criterion"}}
+	}
+	return nil
+}
+
+// empty reports whether the filter has no criteria, which would select every order
+func (f batchStatusFilter) empty() bool {
+	return f.UserID == 0 && len(f.Status) == 0 && f.CreatedAfter == nil && f.CreatedBefore == nil && f.OlderThanDays == 0
+}
+
+type batchStatusResponse struct {
+	Message   string                     `json:"message"`
+	Mode      string                     `json:"mode"`
+	Status    string                     `json:"status"`
+	Updated   int                        `json:"updated"`
+	Unchanged int                        `json:"unchanged"`
+	NotFound  int                        `json:"not_found"`
+	Illegal   int                        `json:"illegal_transition"`
+	Results   []models.OrderStatusResult `json:"results"`
+}
+
+// BatchUpdateOrderStatus handles changing the status of many orders at once.
+// Orders are selected by explicit IDs or by a filter such as
+// {"status": ["processing"], "older_than_days": 3}.
+func BatchUpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	var req batchStatusRequest
+	if !decodeBody(w, r, &req) {
 		return
 	}
 	
-	if req.ID == 0 {
-		http.Error(w, "Order ID is required", http.StatusBadRequest)
+	if req.Mode == "" {
+		req.Mode = "best_effort"
+	}
+	
+	ids := req.IDs
+	if req.Filter != nil {
+		filter := models.OrderFilter{
+			UserID:   req.Filter.UserID,
+			Statuses: req.Filter.Status,
+		}
+		if req.Filter.CreatedAfter != nil {
+			filter.CreatedFrom = *req.Filter.CreatedAfter
+		}
+		if req.Filter.CreatedBefore != nil {
+			filter.CreatedTo = *req.Filter.CreatedBefore
+		}
+		if req.Filter.OlderThanDays > 0 {
+			cutoff := time.Now().AddDate(0, 0, -req.Filter.OlderThanDays)
+			if filter.CreatedTo.IsZero() || cutoff.Before(filter.CreatedTo) {
+				filter.CreatedTo = cutoff
+			}
+		}
+		
+		var err error
+		ids, err = repos.Orders.FilterIDs(filter, maxBatchOrders+1)
+		if err != nil {
+			problem.Error(w, fmt.Errorf("selecting orders: %w", err))
+			return
+		}
+	}
+	
+	if len(ids) > maxBatchOrders {
+		problem.Write(w, http.StatusBadRequest, problem.CodeValidation, "Too many orders in one batch, the limit is "+strconv.Itoa(maxBatchOrders))
 		return
 	}
 	
-	// Delete the order
-	if err := models.DeleteOrder(req.ID); err != nil {
-		http.Error(w, "Error deleting order: "+err.Error(), http.StatusInternalServerError)
+	results, err := repos.Orders.BatchUpdateStatus(ids, req.Status, req.Mode == "atomic")
+	if err != nil && err != models.ErrBatchRejected {
+		problem.Error(w, fmt.Errorf("updating order statuses: %w", err))
 		return
 	}
 	
+	resp := batchStatusResponse{
+		Message: "Order statuses updated",
+		Mode:    req.Mode,
+		Status:  req.Status,
+		Results: results,
+	}
+	if resp.Results == nil {
+		resp.Results = []models.OrderStatusResult{}
+	}
+	for _, result := range results {
+		switch result.Result {
+		case models.BatchResultUpdated:
+			resp.Updated++
+		case models.BatchResultUnchanged:
+			resp.Unchanged++
+		case models.BatchResultNotFound:
+			resp.NotFound++
+		case models.BatchResultIllegal:
+			resp.Illegal++
+		}
+	}
+	
+	status := http.StatusOK
+	if err == models.ErrBatchRejected {
+		// Nothing was written; report what would have happened to each order
+		resp.Message = "No orders updated: " + err.Error()
+		status = http.StatusConflict
+	}
+	
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(orderResponse{
-		Message: "Order deleted successfully",
-	})
-}
\ No newline at end of file
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GetOrderInvoice handles downloading the invoice or packing slip of an order as a PDF.
+// The invoice is issued with the next invoice number on first download and stored, so
+// later downloads return the same document.
+//
+// The order ID is the {id} path value (the id query parameter on the legacy route). Query
+// parameter: document ("invoice", the default, or "packing_slip").
+func GetOrderInvoice(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid order ID")
+		return
+	}
+	
+	document := r.URL.Query().Get("document")
+	if document == "" {
+		document = models.DocumentInvoice
+	}
+	// Checked before issuing, so a bad request does not invoice the order
+	if document != models.DocumentInvoice && document != models.DocumentPackingSlip {
+		problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, "Document must be invoice or packing_slip")
+		return
+	}
+	
+	invoice, err := repos.Invoices.Issue(id)
+	if err == sql.ErrNoRows {
+		problem.Write(w, http.StatusNotFound, problem.CodeNotFound, "Order not found")
+		return
+	} else if err != nil {
+		problem.Error(w, fmt.Errorf("issuing invoice: %w", err))
+		return
+	}
+	
+	body, _ := invoice.Document(document)
+	
+	filename := invoice.Number + ".pdf"
+	if document == models.DocumentPackingSlip {
+		filename = invoice.Number + "-packing-slip.pdf"
+	}
+	
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("X-Invoice-Number", invoice.Number)
+	w.Write(body)
+}
@@ -0,0 +1,85 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"go-crud/models"
+	"go-crud/problem"
+)
+
+func TestGetOrderInvoice(t *testing.T) {
+	r := useMemoryRepositories(t)
+	order := placeOrder(t, r, 30, 1, models.OrderStatusPaid)
+	target := fmt.Sprintf("/orders/%d/invoice", order.ID)
+
+	for _, tt := range []struct{ query, filename string }{
+		{"", "INV-000001.pdf"},
+		{"?document=packing_slip", "INV-000001-packing-slip.pdf"},
+		{"?document=invoice", "INV-000001.pdf"}, // issued once, numbered once
+	} {
+		w := serve("GET /orders/{id}/invoice", GetOrderInvoice, "GET", target+tt.query, "")
+		decodeResponse(t, w, http.StatusOK, nil)
+		if got := w.Header().Get("Content-Type"); got != "application/pdf" {
+			t.Errorf("%s: content type %q", tt.query, got)
+		}
+		if got := w.Header().Get("Content-Disposition"); !strings.Contains(got, tt.filename) {
+			t.Errorf("%s: content disposition %q, want %s", tt.query, got, tt.filename)
+		}
+		if got := w.Header().Get("X-Invoice-Number"); got != "INV-000001" {
+			t.Errorf("%s: invoice number %q", tt.query, got)
+		}
+	}
+
+	w := serve("GET /orders/{id}/invoice", GetOrderInvoice, "GET", target+"?document=receipt", "")
+	checkProblem(t, w, http.StatusBadRequest, problem.CodeInvalidParameter)
+
+	w = serve("GET /orders/{id}/invoice", GetOrderInvoice, "GET", "/orders/99/invoice", "")
+	checkProblem(t, w, http.StatusNotFound, problem.CodeNotFound)
+
+	for _, status := range []string{models.OrderStatusPending, models.OrderStatusCancelled} {
+		o := placeOrder(t, r, 30, 1, status)
+		w = serve("GET /orders/{id}/invoice", GetOrderInvoice, "GET", fmt.Sprintf("/orders/%d/invoice", o.ID), "")
+		checkProblem(t, w, http.StatusConflict, problem.CodeInvoiceNotAllowed)
+	}
+
+	// Rejected requests issue no invoice and consume no number
+	next := fmt.Sprintf("/orders/%d/invoice", placeOrder(t, r, 30, 1, models.OrderStatusShipped).ID)
+	w = serve("GET /orders/{id}/invoice", GetOrderInvoice, "GET", next+"?document=receipt", "")
+	checkProblem(t, w, http.StatusBadRequest, problem.CodeInvalidParameter)
+	w = serve("GET /orders/{id}/invoice", GetOrderInvoice, "GET", next, "")
+	decodeResponse(t, w, http.StatusOK, nil)
+	if got := w.Header().Get("X-Invoice-Number"); got != "INV-000002" {
+		t.Errorf("next invoice number %q, want INV-000002", got)
+	}
+}
+
+func TestBatchUpdateOrderStatusNeedsCriteria(t *testing.T) {
+	r := useMemoryRepositories(t)
+	pending := placeOrder(t, r, 10, 1, models.OrderStatusPending)
+	paid := placeOrder(t, r, 10, 1, models.OrderStatusPaid)
+
+	for _, body := range []string{
+		`{"status": "cancelled", "filter": {}}`,
+		`{"status": "cancelled", "filter": {"status": []}}`,
+		`{"status": "cancelled"}`,
+		fmt.Sprintf(`{"status": "cancelled", "ids": [%d], "filter": {"user_id": 1}}`, pending.ID),
+	} {
+		w := serve("PATCH /orders", BatchUpdateOrderStatus, "PATCH", "/orders", body)
+		checkProblem(t, w, http.StatusUnprocessableEntity, problem.CodeValidation)
+	}
+	for _, o := range []models.Order{pending, paid} {
+		if got, _ := r.Orders.GetByID(o.ID); got.Status != o.Status {
+			t.Errorf("order %d is %s after rejected batches, want %s", o.ID, got.Status, o.Status)
+		}
+	}
+
+	var resp batchStatusResponse
+	w := serve("PATCH /orders", BatchUpdateOrderStatus, "PATCH", "/orders", `{"status": "cancelled", "filter": {"status": ["pending"]}}`)
+	decodeResponse(t, w, http.StatusOK, &resp)
+	if resp.Updated != 1 || len(resp.Results) != 1 || resp.Results[0].OrderID != pending.ID {
+		t.Errorf("batch by status %+v", resp)
+	}
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+
+	"go-crud/models"
+	"go-crud/problem"
+	"go-crud/validate"
+)
+
+// idRequest is the body of requests that only name a resource, such as the legacy
+// POST /roles/delete alias
+type idRequest struct {
+	ID int `json:"id"`
+}
+
+// idParam returns the {id} path value of a resource route such as GET /orders/{id}, or the
+// id query parameter of its legacy alias
+func idParam(r *http.Request) string {
+	if id := r.PathValue("id"); id != "" {
+		return id
+	}
+	return r.URL.Query().Get("id")
+}
+
+// decodeBody decodes a JSON request body into v and checks it against its validate tags. It
+// answers with a problem and returns false if the body is malformed, too large, has unknown
+// fields or fails validation; every invalid field is listed at once.
+func decodeBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	if err := validate.Decode(w, r, v); err != nil {
+		problem.Error(w, err)
+		return false
+	}
+	if err := validate.Struct(v); err != nil {
+		problem.Error(w, err)
+		return false
+	}
+	return true
+}
+
+// decodeRequest is decodeBody for requests about one resource. On a resource route *id is set
+// from the {id} path value, which takes precedence over an ID in the body, and the body may be
+// empty, as in DELETE /orders/{id}. On a legacy alias the ID comes from the body. Either way it
+// is required.
+func decodeRequest(w http.ResponseWriter, r *http.Request, v interface{}, id *int) bool {
+	return decodeWithID(w, r, v, id, true)
+}
+
+// decodeOptionalID is decodeRequest for routes where the ID may be left out, such as
+// PUT /users, which updates the caller's own account
+func decodeOptionalID(w http.ResponseWriter, r *http.Request, v interface{}, id *int) bool {
+	return decodeWithID(w, r, v, id, false)
+}
+
+func decodeWithID(w http.ResponseWriter, r *http.Request, v interface{}, id *int, required bool) bool {
+	pathID := r.PathValue("id")
+	err := validate.Decode(w, r, v)
+	if err != nil && !(pathID != "" && errors.Is(err, validate.ErrEmptyBody)) {
+		problem.Error(w, err)
+		return false
+	}
+
+	if pathID != "" {
+		n, err := strconv.Atoi(pathID)
+		if err != nil || n < 1 {
+			problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid ID in path")
+			return false
+		}
+		*id = n
+	}
+
+	var fields []models.FieldError
+	if required && *id == 0 {
+		name := idField(v, id)
+		fields = append(fields, models.FieldError{Field: name, Code: models.FieldRequired, Message: name + " is required"})
+	}
+	fields = append(fields, validate.Fields(v)...)
+	if len(fields) > 0 {
+		problem.Fields(w, "Validation failed", fields)
+		return false
+	}
+	return true
+}
+
+// idField returns the JSON name of the field of v that id points to, such as "order_id"
+func idField(v interface{}, id *int) string {
+	s := reflect.ValueOf(v).Elem()
+	for i := 0; i < s.NumField(); i++ {
+		if f := s.Field(i); f.CanAddr() && f.Addr().CanInterface() && f.Addr().Interface() == id {
+			if name := validate.FieldName(s.Type().Field(i)); name != "" {
+				return name
+			}
+		}
+	}
+	return "id"
+}
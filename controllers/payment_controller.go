@@ -0,0 +1,339 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"go-crud/config"
+	"go-crud/models"
+	"go-crud/payments"
+	"go-crud/problem"
+	"go-crud/validate"
+)
+
+// PaymentSignatureHeader carries the HMAC signature of webhook payloads
+const PaymentSignatureHeader = "X-Payment-Signature"
+
+type payOrderRequest struct {
+	OrderID      int    `json:"order_id"`
+	PaymentToken string `json:"payment_token" validate:"required"`
+	Capture      *bool  `json:"capture,omitempty"` // defaults to true; false only authorizes
+}
+
+type paymentActionRequest struct {
+	PaymentID int     `json:"payment_id"`
+	Amount    float64 `json:"amount,omitempty" validate:"min=0"` // capture only; 0 captures the full authorization
+}
+
+type paymentResponse struct {
+	Message     string          `json:"message"`
+	Payment     *models.Payment `json:"payment,omitempty"`
+	OrderStatus string          `json:"order_status,omitempty"`
+}
+
+// webhookEvent is the payload providers post to /payments/webhook
+type webhookEvent struct {
+	ID        string  `json:"id"`
+	Type      string  `json:"type"` // payment.captured, payment.refunded, payment.voided or payment.failed
+	Provider  string  `json:"provider"`
+	Reference string  `json:"reference"`
+	Amount    float64 `json:"amount"`
+	Reason    string  `json:"reason,omitempty"`
+}
+
+// paymentProvider returns the configured payment provider
+func paymentProvider() (payments.Provider, error) {
+	return payments.Get(config.AppConfig.PaymentProvider)
+}
+
+// writePaymentResponse syncs the order status and writes the payment as JSON
+func writePaymentResponse(w http.ResponseWriter, status int, message string, payment models.Payment) {
+	orderStatus, err := repos.Payments.SyncOrderStatus(payment.OrderID)
+	if err != nil {
+		problem.Error(w, fmt.Errorf("updating order status: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(paymentResponse{
+		Message:     message,
+		Payment:     &payment,
+		OrderStatus: orderStatus,
+	})
+}
+
+// PayOrder handles paying for an order through the configured payment provider. The provider
+// is called with the order locked, so concurrent requests charge an order at most once.
+func PayOrder(w http.ResponseWriter, r *http.Request) {
+	var req payOrderRequest
+	if !decodeRequest(w, r, &req, &req.OrderID) {
+		return
+	}
+
+	provider, err := paymentProvider()
+	if err != nil {
+		problem.Error(w, fmt.Errorf("payments are not configured: %w", err))
+		return
+	}
+
+	message := "Payment authorized"
+	payment, err := repos.Payments.ChargeOrder(req.OrderID, func(total float64, attempt int) (models.Payment, error) {
+		payment := models.Payment{Provider: provider.Name(), Amount: total}
+		merchantRef := fmt.Sprintf("order_%d_attempt_%d", req.OrderID, attempt)
+		result, err := provider.Authorize(payments.AuthorizeRequest{
+			OrderID:           req.OrderID,
+			Amount:            total,
+			Currency:          config.AppConfig.PaymentCurrency,
+			Token:             req.PaymentToken,
+			MerchantReference: merchantRef,
+		})
+		if errors.Is(err, payments.ErrDeclined) {
+			// Declines are recorded so the attempt history is complete
+			payment.ProviderRef = result.Reference
+			if payment.ProviderRef == "" {
+				payment.ProviderRef = merchantRef
+			}
+			payment.Status = payments.StatusFailed
+			payment.FailureReason = err.Error()
+			return payment, err
+		} else if err != nil {
+			return payment, fmt.Errorf("authorizing payment: %w", err)
+		}
+
+		payment.ProviderRef = result.Reference
+		payment.Status = result.Status
+		if req.Capture == nil || *req.Capture {
+			captured, err := provider.Capture(result.Reference, 0)
+			if err != nil {
+				// The authorization is recorded so it can be captured or voided later
+				return payment, fmt.Errorf("capturing payment: %w", err)
+			}
+			result = captured
+			message = "Payment captured"
+		}
+		payment.Status, payment.CapturedAmount, payment.RefundedAmount = result.Status, result.CapturedAmount, result.RefundedAmount
+		return payment, nil
+	})
+
+	status := http.StatusCreated
+	switch {
+	case errors.Is(err, payments.ErrDeclined):
+		status, message = http.StatusPaymentRequired, "Payment declined"
+	case errors.Is(err, sql.ErrNoRows):
+		problem.Write(w, http.StatusNotFound, problem.CodeNotFound, "Order not found")
+		return
+	case errors.Is(err, models.ErrOrderNotPayable), errors.Is(err, models.ErrOrderPaymentActive):
+		problem.Error(w, err)
+		return
+	case err != nil && payment.ProviderRef != "":
+		problem.Upstream(w, "Error capturing payment", err)
+		return
+	case err != nil:
+		problem.Upstream(w, "Error authorizing payment", err)
+		return
+	}
+
+	payment, err = repos.Payments.GetByID(payment.ID)
+	if err != nil {
+		problem.Error(w, fmt.Errorf("fetching payment: %w", err))
+		return
+	}
+
+	writePaymentResponse(w, status, message, payment)
+}
+
+// GetPayments handles listing the payments of an order
+func GetPayments(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(r.URL.Query().Get("order_id"))
+	if err != nil {
+		problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid order ID")
+		return
+	}
+
+	list, err := repos.Payments.ListByOrder(orderID)
+	if err != nil {
+		problem.Error(w, fmt.Errorf("fetching payments: %w", err))
+		return
+	}
+
+	if list == nil {
+		list = []models.Payment{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// decodePaymentAction reads a payment action request and loads the payment and its provider
+func decodePaymentAction(w http.ResponseWriter, r *http.Request) (paymentActionRequest, models.Payment, payments.Provider, bool) {
+	var req paymentActionRequest
+	if !decodeRequest(w, r, &req, &req.PaymentID) {
+		return req, models.Payment{}, nil, false
+	}
+
+	payment, err := repos.Payments.GetByID(req.PaymentID)
+	if errors.Is(err, models.ErrPaymentNotFound) {
+		problem.Write(w, http.StatusNotFound, problem.CodeNotFound, "Payment not found")
+		return req, payment, nil, false
+	} else if err != nil {
+		problem.Error(w, fmt.Errorf("fetching payment: %w", err))
+		return req, payment, nil, false
+	}
+
+	provider, err := payments.Get(payment.Provider)
+	if err != nil {
+		problem.Error(w, fmt.Errorf("payments are not configured: %w", err))
+		return req, payment, nil, false
+	}
+
+	return req, payment, provider, true
+}
+
+// applyPaymentResult stores a provider result, mapping provider errors to HTTP errors
+func applyPaymentResult(w http.ResponseWriter, payment models.Payment, result payments.Result, err error, message string) {
+	switch {
+	case errors.Is(err, payments.ErrInvalidState), errors.Is(err, payments.ErrAmountTooLarge),
+		errors.Is(err, payments.ErrUnknownPayment):
+		problem.Error(w, err)
+		return
+	case err != nil:
+		problem.Upstream(w, "Payment provider error", err)
+		return
+	}
+
+	if err := repos.Payments.UpdateFromProvider(payment.ID, result, payment.FailureReason); err != nil {
+		problem.Error(w, fmt.Errorf("updating payment: %w", err))
+		return
+	}
+
+	payment, err = repos.Payments.GetByID(payment.ID)
+	if err != nil {
+		problem.Error(w, fmt.Errorf("fetching payment: %w", err))
+		return
+	}
+
+	writePaymentResponse(w, http.StatusOK, message, payment)
+}
+
+// CapturePayment handles capturing a previously authorized payment
+func CapturePayment(w http.ResponseWriter, r *http.Request) {
+	req, payment, provider, ok := decodePaymentAction(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := provider.Capture(payment.ProviderRef, req.Amount)
+	applyPaymentResult(w, payment, result, err, "Payment captured")
+}
+
+// VoidPayment handles cancelling an authorization before it is captured
+func VoidPayment(w http.ResponseWriter, r *http.Request) {
+	_, payment, provider, ok := decodePaymentAction(w, r)
+	if !ok {
+		return
+	}
+
+	result, err := provider.Void(payment.ProviderRef)
+	applyPaymentResult(w, payment, result, err, "Payment voided")
+}
+
+// PaymentWebhook handles settlement notifications from the payment provider.
+// Payloads must be signed with the shared webhook secret; repeated event IDs are acknowledged
+// without being applied again.
+func PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := validate.ReadBody(w, r)
+	if err != nil {
+		problem.Error(w, err)
+		return
+	}
+
+	if err := payments.VerifySignature(config.AppConfig.PaymentWebhookSecret, body, r.Header.Get(PaymentSignatureHeader)); err != nil {
+		log.Printf("Rejected payment webhook from %s: %v", r.RemoteAddr, err)
+		problem.Write(w, http.StatusUnauthorized, problem.CodeInvalidSignature, "Invalid signature")
+		return
+	}
+
+	// Unlike requests, provider events may carry fields we do not know
+	var event webhookEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		problem.Write(w, http.StatusBadRequest, problem.CodeInvalidBody, "Invalid request body")
+		return
+	}
+
+	if event.ID == "" || event.Reference == "" {
+		problem.Write(w, http.StatusBadRequest, problem.CodeValidation, "Event ID and reference are required")
+		return
+	}
+
+	if event.Provider == "" {
+		event.Provider = config.AppConfig.PaymentProvider
+	}
+
+	payment, err := repos.Payments.GetByProviderRef(event.Provider, event.Reference)
+	if errors.Is(err, models.ErrPaymentNotFound) {
+		problem.Write(w, http.StatusNotFound, problem.CodeNotFound, "Payment not found")
+		return
+	} else if err != nil {
+		problem.Error(w, fmt.Errorf("fetching payment: %w", err))
+		return
+	}
+
+	result := payments.Result{
+		Reference:      payment.ProviderRef,
+		Status:         payment.Status,
+		Amount:         payment.Amount,
+		CapturedAmount: payment.CapturedAmount,
+		RefundedAmount: payment.RefundedAmount,
+	}
+	failureReason := payment.FailureReason
+
+	switch event.Type {
+	case "payment.captured":
+		result.Status = payments.StatusCaptured
+		result.CapturedAmount = event.Amount
+	case "payment.refunded":
+		result.RefundedAmount = event.Amount
+		if result.RefundedAmount > payment.CapturedAmount {
+			result.RefundedAmount = payment.CapturedAmount
+		}
+		result.Status = payments.StatusPartiallyRefunded
+		if result.RefundedAmount >= payment.CapturedAmount {
+			result.Status = payments.StatusRefunded
+		}
+	case "payment.voided":
+		result.Status = payments.StatusVoided
+	case "payment.failed":
+		result.Status = payments.StatusFailed
+		failureReason = event.Reason
+	default:
+		problem.Write(w, http.StatusBadRequest, problem.CodeValidation, "Unsupported event type: "+event.Type)
+		return
+	}
+
+	// The event is recorded together with the update, so a failed update can be redelivered
+	isNew, err := repos.Payments.ApplyWebhookEvent(event.Provider, event.ID, event.Type, payment.ID, result, failureReason)
+	if err != nil {
+		problem.Error(w, fmt.Errorf("applying event: %w", err))
+		return
+	}
+
+	if !isNew {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(paymentResponse{Message: "Event already processed"})
+		return
+	}
+
+	payment, err = repos.Payments.GetByID(payment.ID)
+	if err != nil {
+		problem.Error(w, fmt.Errorf("fetching payment: %w", err))
+		return
+	}
+
+	writePaymentResponse(w, http.StatusOK, "Event processed", payment)
+}
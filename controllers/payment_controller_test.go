@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-crud/config"
+	"go-crud/models"
+	"go-crud/payments"
+	"go-crud/problem"
+)
+
+// useMockPayments configures a fresh mock provider and a webhook secret until the test ends
+func useMockPayments(t *testing.T) string {
+	t.Helper()
+	payments.Register(payments.NewMockProvider())
+	prev := config.AppConfig
+	config.AppConfig.PaymentProvider = "mock"
+	config.AppConfig.PaymentWebhookSecret = "test-secret"
+	t.Cleanup(func() { config.AppConfig = prev })
+	return config.AppConfig.PaymentWebhookSecret
+}
+
+func TestPayOrder(t *testing.T) {
+	r := useMemoryRepositories(t)
+	useMockPayments(t)
+	order := placeOrder(t, r, 12.5, 2, models.OrderStatusPending)
+	target := fmt.Sprintf("/orders/%d/pay", order.ID)
+
+	var declined paymentResponse
+	w := serve("POST /orders/{id}/pay", PayOrder, "POST", target, `{"payment_token": "tok_decline"}`)
+	decodeResponse(t, w, http.StatusPaymentRequired, &declined)
+	if declined.Payment.Status != payments.StatusFailed || declined.OrderStatus != models.OrderStatusPending {
+		t.Errorf("declined payment: %+v, order %s", declined.Payment, declined.OrderStatus)
+	}
+
+	var paid paymentResponse
+	w = serve("POST /orders/{id}/pay", PayOrder, "POST", target, `{"payment_token": "tok_visa"}`)
+	decodeResponse(t, w, http.StatusCreated, &paid)
+	if paid.Payment.Status != payments.StatusCaptured || paid.Payment.CapturedAmount != 25 {
+		t.Errorf("payment = %+v", paid.Payment)
+	}
+	if paid.OrderStatus != models.OrderStatusPaid {
+		t.Errorf("order status = %s, want paid", paid.OrderStatus)
+	}
+
+	var list []models.Payment
+	w = serve("GET /payments", GetPayments, "GET", fmt.Sprintf("/payments?order_id=%d", order.ID), "")
+	decodeResponse(t, w, http.StatusOK, &list)
+	if len(list) != 2 {
+		t.Errorf("listed %d payments, want 2", len(list))
+	}
+
+	w = serve("POST /orders/{id}/pay", PayOrder, "POST", target, `{"payment_token": "tok_visa"}`)
+	checkProblem(t, w, http.StatusConflict, problem.CodeOrderState)
+
+	w = serve("POST /orders/{id}/pay", PayOrder, "POST", "/orders/99/pay", `{"payment_token": "tok_visa"}`)
+	checkProblem(t, w, http.StatusNotFound, problem.CodeNotFound)
+}
+
+// slowProvider is the mock provider taking a while to authorize, and counting authorizations
+type slowProvider struct {
+	*payments.MockProvider
+	authorizations atomic.Int32
+}
+
+func (p *slowProvider) Authorize(req payments.AuthorizeRequest) (payments.Result, error) {
+	p.authorizations.Add(1)
+	time.Sleep(10 * time.Millisecond)
+	return p.MockProvider.Authorize(req)
+}
+
+func TestPayOrderConcurrently(t *testing.T) {
+	r := useMemoryRepositories(t)
+	useMockPayments(t)
+	provider := &slowProvider{MockProvider: payments.NewMockProvider()}
+	payments.Register(provider)
+	order := placeOrder(t, r, 10, 1, models.OrderStatusPending)
+
+	const attempts = 8
+	codes := make([]int, attempts)
+	var wg sync.WaitGroup
+	for i := range codes {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			w := serve("POST /orders/{id}/pay", PayOrder, "POST", fmt.Sprintf("/orders/%d/pay", order.ID), `{"payment_token": "tok_visa"}`)
+			codes[i] = w.Code
+		}(i)
+	}
+	wg.Wait()
+
+	created := 0
+	for _, code := range codes {
+		switch code {
+		case http.StatusCreated:
+			created++
+		case http.StatusConflict:
+		default:
+			t.Errorf("concurrent payment answered %d", code)
+		}
+	}
+	if n := provider.authorizations.Load(); created != 1 || n != 1 {
+		t.Errorf("%d payments created and %d authorized, want 1", created, n)
+	}
+}
+
+func TestPayOrderWithOpenAuthorization(t *testing.T) {
+	r := useMemoryRepositories(t)
+	useMockPayments(t)
+	order := placeOrder(t, r, 10, 1, models.OrderStatusPending)
+	target := fmt.Sprintf("/orders/%d/pay", order.ID)
+
+	w := serve("POST /orders/{id}/pay", PayOrder, "POST", target, `{"payment_token": "tok_visa", "capture": false}`)
+	decodeResponse(t, w, http.StatusCreated, nil)
+	w = serve("POST /orders/{id}/pay", PayOrder, "POST", target, `{"payment_token": "tok_visa"}`)
+	checkProblem(t, w, http.StatusConflict, problem.CodeOrderState)
+
+	// Once voided, the order can be paid again
+	w = serve("POST /payments/{id}/void", VoidPayment, "POST", "/payments/1/void", "")
+	decodeResponse(t, w, http.StatusOK, nil)
+	w = serve("POST /orders/{id}/pay", PayOrder, "POST", target, `{"payment_token": "tok_visa"}`)
+	decodeResponse(t, w, http.StatusCreated, nil)
+}
+
+func TestAuthorizeCaptureAndVoid(t *testing.T) {
+	r := useMemoryRepositories(t)
+	useMockPayments(t)
+	first := placeOrder(t, r, 10, 1, models.OrderStatusPending)
+	second := placeOrder(t, r, 10, 1, models.OrderStatusPending)
+
+	var resp paymentResponse
+	for _, id := range []int{first.ID, second.ID} {
+		w := serve("POST /orders/{id}/pay", PayOrder, "POST", fmt.Sprintf("/orders/%d/pay", id), `{"payment_token": "tok_visa", "capture": false}`)
+		decodeResponse(t, w, http.StatusCreated, &resp)
+		if resp.Payment.Status != payments.StatusAuthorized || resp.OrderStatus != models.OrderStatusPending {
+			t.Fatalf("authorized payment: %+v, order %s", resp.Payment, resp.OrderStatus)
+		}
+	}
+
+	w := serve("POST /payments/{id}/capture", CapturePayment, "POST", "/payments/1/capture", "")
+	decodeResponse(t, w, http.StatusOK, &resp)
+	if resp.Payment.Status != payments.StatusCaptured || resp.OrderStatus != models.OrderStatusPaid {
+		t.Errorf("captured payment: %+v, order %s", resp.Payment, resp.OrderStatus)
+	}
+
+	w = serve("POST /payments/{id}/void", VoidPayment, "POST", "/payments/2/void", "")
+	decodeResponse(t, w, http.StatusOK, &resp)
+	if resp.Payment.Status != payments.StatusVoided || resp.OrderStatus != models.OrderStatusPending {
+		t.Errorf("voided payment: %+v, order %s", resp.Payment, resp.OrderStatus)
+	}
+
+	w = serve("POST /payments/{id}/void", VoidPayment, "POST", "/payments/1/void", "")
+	checkProblem(t, w, http.StatusConflict, problem.CodePaymentState)
+
+	w = serve("POST /payments/{id}/capture", CapturePayment, "POST", "/payments/9/capture", "")
+	checkProblem(t, w, http.StatusNotFound, problem.CodeNotFound)
+}
+
+func TestPaymentWebhook(t *testing.T) {
+	r := useMemoryRepositories(t)
+	secret := useMockPayments(t)
+	order := placeOrder(t, r, 20, 1, models.OrderStatusPending)
+	w := serve("POST /orders/{id}/pay", PayOrder, "POST", fmt.Sprintf("/orders/%d/pay", order.ID), `{"payment_token": "tok_visa"}`)
+	var paid paymentResponse
+	decodeResponse(t, w, http.StatusCreated, &paid)
+
+	webhook := func(body, signature string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/payments/webhook", strings.NewReader(body))
+		req.Header.Set(PaymentSignatureHeader, signature)
+		w := httptest.NewRecorder()
+		PaymentWebhook(w, req)
+		return w
+	}
+	body := fmt.Sprintf(`{"id": "evt_1", "type": "payment.refunded", "reference": %q, "amount": 20}`, paid.Payment.ProviderRef)
+
+	checkProblem(t, webhook(body, "sha256=00"), http.StatusUnauthorized, problem.CodeInvalidSignature)
+
+	var resp paymentResponse
+	decodeResponse(t, webhook(body, payments.Sign(secret, []byte(body))), http.StatusOK, &resp)
+	if resp.Payment.Status != payments.StatusRefunded || resp.OrderStatus != models.OrderStatusRefunded {
+		t.Errorf("refunded payment: %+v, order %s", resp.Payment, resp.OrderStatus)
+	}
+
+	decodeResponse(t, webhook(body, payments.Sign(secret, []byte(body))), http.StatusOK, &resp)
+	if resp.Message != "Event already processed" {
+		t.Errorf("redelivered event: %q", resp.Message)
+	}
+
+	unknown := `{"id": "evt_2", "type": "payment.captured", "reference": "mock_nothing", "amount": 1}`
+	checkProblem(t, webhook(unknown, payments.Sign(secret, []byte(unknown))), http.StatusNotFound, problem.CodeNotFound)
+}
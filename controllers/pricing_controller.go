@@ -0,0 +1,49 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"go-crud/problem"
+)
+
+type taxRateRequest struct {
+	Country string  `json:"country" validate:"required,country"`
+	State   string  `json:"state" validate:"max=100"`
+	Rate    float64 `json:"rate" validate:"min=0,lt=1"` // a fraction, 0.0825 for 8.25%
+	Name    string  `json:"name" validate:"max=100"`
+}
+
+type taxRateResponse struct {
+	Message string `json:"message"`
+}
+
+// GetTaxRates handles retrieving all tax rates
+func GetTaxRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := repos.TaxRates.List()
+	if err != nil {
+		problem.Error(w, fmt.Errorf("fetching tax rates: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rates)
+}
+
+// SetTaxRate handles creating or replacing the tax rate for a country and state
+func SetTaxRate(w http.ResponseWriter, r *http.Request) {
+	var req taxRateRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	err := repos.TaxRates.Set(req.Country, req.State, req.Rate, req.Name)
+	if err != nil {
+		problem.Error(w, fmt.Errorf("saving tax rate: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(taxRateResponse{Message: "Tax rate saved successfully"})
+}
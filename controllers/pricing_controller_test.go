@@ -0,0 +1,35 @@
+package controllers
+
+import (
+	"net/http"
+	"testing"
+
+	"go-crud/models"
+	"go-crud/problem"
+)
+
+func TestTaxRateHandlers(t *testing.T) {
+	useMemoryRepositories(t)
+
+	for _, body := range []string{
+		`{"country": "US", "state": "ca", "rate": 0.0725, "name": "California"}`,
+		`{"country": "US", "state": "CA", "rate": 0.08, "name": "California"}`, // replaces the rate
+		`{"country": "CA", "rate": 0.05}`,
+	} {
+		w := serve("PUT /tax-rates", SetTaxRate, "PUT", "/tax-rates", body)
+		decodeResponse(t, w, http.StatusOK, nil)
+	}
+
+	w := serve("PUT /tax-rates", SetTaxRate, "PUT", "/tax-rates", `{"country": "US", "rate": 1.5}`)
+	checkProblem(t, w, http.StatusUnprocessableEntity, problem.CodeValidation)
+
+	w = serve("PUT /tax-rates", SetTaxRate, "PUT", "/tax-rates", `{"country": "Atlantis", "rate": 0.1}`)
+	checkProblem(t, w, http.StatusUnprocessableEntity, problem.CodeValidation)
+
+	var rates []models.TaxRate
+	w = serve("GET /tax-rates", GetTaxRates, "GET", "/tax-rates", "")
+	decodeResponse(t, w, http.StatusOK, &rates)
+	if len(rates) != 2 || rates[0].Code() != "CA" || rates[1].Code() != "US-CA" || rates[1].Rate != 0.08 {
+		t.Errorf("rates = %+v", rates)
+	}
+}
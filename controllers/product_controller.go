@@ -2,14 +2,15 @@ package controllers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"go-crud/middlewares"
-	"go-crud/models"
+	"go-crud/problem"
 )
 
 type productRequest struct {
 	ID      int    `json:"id,omitempty"`
-	Product string `json:"product,omitempty"`
+	Product string `json:"product,omitempty" validate:"required,max=200"`
 }
 
 type productResponse struct {
@@ -22,15 +23,22 @@ func GetProducts(w http.ResponseWriter, r *http.Request) {
 	paginatedProducts, ok := r.Context().Value("paginatedProducts").(middlewares.PaginatedProducts)
 	if !ok {
 		// Fallback to direct DB query if middleware didn't work
-		products, err := models.GetProducts(100)
+		products, err := repos.Products.List(100)
 		if err != nil {
-			http.Error(w, "Error fetching products: "+err.Error(), http.StatusInternalServerError)
+			problem.Error(w, fmt.Errorf("fetching products: %w", err))
 			return
 		}
 		json.NewEncoder(w).Encode(products)
 		return
 	}
 
+	// Version 2 keeps each product's price, weight, category and stock
+	if middlewares.GetAPIVersion(r) >= 2 {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(paginatedProducts.V2())
+		return
+	}
+
 	// Check if we have any products
 	if len(paginatedProducts.Products) == 0 {
 		// We still return the pagination structure with empty products array
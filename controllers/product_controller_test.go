@@ -0,0 +1,62 @@
+package controllers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-crud/middlewares"
+	"go-crud/models"
+	"go-crud/models/memory"
+	"go-crud/problem"
+)
+
+func TestGetProductsVersions(t *testing.T) {
+	r := useMemoryRepositories(t)
+	r.Products.(*memory.Products).Add(models.Product{Name: "Widget", Price: 19.99, Weight: 1.5, Category: "tools", Stock: 3})
+	h := middlewares.APIVersionMiddleware(middlewares.ProductMiddleware(GetProducts))
+	get := func(target, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		req.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		h(w, req)
+		return w
+	}
+
+	// Version 1 lists the id, name and status of each product, without its price
+	var v1 struct {
+		Products   []map[string]interface{} `json:"products"`
+		TotalCount int                      `json:"total_count"`
+	}
+	decodeResponse(t, get("/products", ""), http.StatusOK, &v1)
+	if len(v1.Products) != 1 || v1.TotalCount != 1 || len(v1.Products[0]) != 3 || v1.Products[0]["name"] != "Widget" {
+		t.Fatalf("version 1 page %+v", v1)
+	}
+	if _, ok := v1.Products[0]["price"]; ok {
+		t.Error("version 1 lists the price")
+	}
+
+	// Version 2 returns whole products, by path or Accept header
+	for _, tt := range []struct{ target, accept string }{
+		{"/v2/products", ""},
+		{"/products", "application/vnd.go-crud.v2+json"},
+		{"/products", "application/json; version=2"},
+	} {
+		var v2 middlewares.PaginatedProductsV2
+		w := get(tt.target, tt.accept)
+		decodeResponse(t, w, http.StatusOK, &v2)
+		if w.Header().Get(middlewares.APIVersionHeader) != "2" {
+			t.Errorf("%s with Accept %q: %s %q", tt.target, tt.accept, middlewares.APIVersionHeader,
+				w.Header().Get(middlewares.APIVersionHeader))
+		}
+		if len(v2.Products) != 1 {
+			t.Fatalf("%s with Accept %q: page %+v", tt.target, tt.accept, v2)
+		}
+		p := v2.Products[0]
+		if p.Name != "Widget" || p.Price != 19.99 || p.Weight != 1.5 || p.Category != "tools" || p.Stock != 3 {
+			t.Errorf("%s with Accept %q: product %+v", tt.target, tt.accept, p)
+		}
+	}
+
+	checkProblem(t, get("/products", "application/vnd.go-crud.v3+json"), http.StatusNotAcceptable, problem.CodeNotAcceptable)
+}
@@ -0,0 +1,12 @@
+package controllers
+
+import "go-crud/models"
+
+// repos holds the repositories the handlers read and write through
+var repos = models.SQLRepositories()
+
+// UseRepositories replaces the repositories the handlers use, e.g. with the in-memory
+// fakes of package memory in tests
+func UseRepositories(r models.Repositories) {
+	repos = r
+}
@@ -0,0 +1,176 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go-crud/models"
+	"go-crud/payments"
+	"go-crud/problem"
+)
+
+type createReturnRequest struct {
+	OrderID int                 `json:"order_id" validate:"required"`
+	Reason  string              `json:"reason" validate:"max=500"`
+	Items   []models.ReturnLine `json:"items" validate:"required"`
+}
+
+type reviewReturnRequest struct {
+	ID   int    `json:"id"`
+	Note string `json:"note,omitempty" validate:"max=500"`
+}
+
+type receiveReturnRequest struct {
+	ID      int  `json:"id"`
+	Restock bool `json:"restock"`
+}
+
+type returnResponse struct {
+	Message string              `json:"message"`
+	Return  *models.OrderReturn `json:"return,omitempty"`
+}
+
+// writeReturnError reports a return error; problem.Error maps the return sentinels. The only
+// sql.ErrNoRows here is a missing order, and provider errors mean the refund failed.
+func writeReturnError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		problem.Write(w, http.StatusNotFound, problem.CodeNotFound, "Order not found")
+	case errors.Is(err, payments.ErrInvalidState), errors.Is(err, payments.ErrAmountTooLarge),
+		errors.Is(err, payments.ErrUnknownPayment):
+		problem.Upstream(w, "Refund failed, retry by receiving the return again", err)
+	default:
+		problem.Error(w, fmt.Errorf("processing return: %w", err))
+	}
+}
+
+func writeReturn(w http.ResponseWriter, status int, message string, ret models.OrderReturn) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(returnResponse{
+		Message: message,
+		Return:  &ret,
+	})
+}
+
+// GetReturns handles listing returns, optionally filtered by order_id and status
+func GetReturns(w http.ResponseWriter, r *http.Request) {
+	orderID := 0
+	if v := r.URL.Query().Get("order_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil {
+			problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid order ID")
+			return
+		}
+		orderID = id
+	}
+
+	list, err := repos.Returns.List(orderID, r.URL.Query().Get("status"))
+	if err != nil {
+		problem.Error(w, fmt.Errorf("fetching returns: %w", err))
+		return
+	}
+
+	if list == nil {
+		list = []models.OrderReturn{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// GetReturnByID handles fetching a return with its items
+func GetReturnByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid return ID")
+		return
+	}
+
+	ret, err := repos.Returns.GetByID(id)
+	if err != nil {
+		writeReturnError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ret)
+}
+
+// CreateReturn handles a return request for items of an order
+func CreateReturn(w http.ResponseWriter, r *http.Request) {
+	var req createReturnRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	ret, err := repos.Returns.Create(req.OrderID, req.Reason, req.Items)
+	if err != nil {
+		writeReturnError(w, err)
+		return
+	}
+
+	writeReturn(w, http.StatusCreated, "Return requested successfully", ret)
+}
+
+// decodeReviewReturn reads an approve/reject request
+func decodeReviewReturn(w http.ResponseWriter, r *http.Request) (reviewReturnRequest, bool) {
+	var req reviewReturnRequest
+	if !decodeRequest(w, r, &req, &req.ID) {
+		return req, false
+	}
+
+	return req, true
+}
+
+// ApproveReturn handles accepting a requested return
+func ApproveReturn(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeReviewReturn(w, r)
+	if !ok {
+		return
+	}
+
+	ret, err := repos.Returns.Approve(req.ID, req.Note)
+	if err != nil {
+		writeReturnError(w, err)
+		return
+	}
+
+	writeReturn(w, http.StatusOK, "Return approved", ret)
+}
+
+// RejectReturn handles declining a requested return
+func RejectReturn(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeReviewReturn(w, r)
+	if !ok {
+		return
+	}
+
+	ret, err := repos.Returns.Reject(req.ID, req.Note)
+	if err != nil {
+		writeReturnError(w, err)
+		return
+	}
+
+	writeReturn(w, http.StatusOK, "Return rejected", ret)
+}
+
+// ReceiveReturn handles the arrival of returned goods, which restocks them if asked and issues the refund
+func ReceiveReturn(w http.ResponseWriter, r *http.Request) {
+	var req receiveReturnRequest
+	if !decodeRequest(w, r, &req, &req.ID) {
+		return
+	}
+
+	ret, err := repos.Returns.Receive(req.ID, req.Restock)
+	if err != nil {
+		writeReturnError(w, err)
+		return
+	}
+
+	writeReturn(w, http.StatusOK, "Return received and refunded", ret)
+}
@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"go-crud/models"
+	"go-crud/problem"
+)
+
+func TestReturnHandlers(t *testing.T) {
+	r := useMemoryRepositories(t)
+	order := placeOrder(t, r, 8, 3, models.OrderStatusDelivered)
+	itemID := order.Items[0].ID
+	create := func(quantity int) string {
+		return fmt.Sprintf(`{"order_id": %d, "reason": "too small", "items": [{"order_item_id": %d, "quantity": %d}]}`,
+			order.ID, itemID, quantity)
+	}
+
+	var created returnResponse
+	w := serve("POST /returns", CreateReturn, "POST", "/returns", create(2))
+	decodeResponse(t, w, http.StatusCreated, &created)
+	ret := created.Return
+	if ret.Status != models.ReturnStatusRequested || ret.RefundAmount != 16 || len(ret.Items) != 1 {
+		t.Fatalf("created return %+v", ret)
+	}
+
+	// One unit is left to return while the first return is open
+	w = serve("POST /returns", CreateReturn, "POST", "/returns", create(2))
+	checkProblem(t, w, http.StatusBadRequest, problem.CodeReturnItem)
+
+	w = serve("POST /returns", CreateReturn, "POST", "/returns", `{"order_id": 99, "items": [{"order_item_id": 1, "quantity": 1}]}`)
+	checkProblem(t, w, http.StatusNotFound, problem.CodeNotFound)
+
+	pending := placeOrder(t, r, 8, 1, models.OrderStatusPending)
+	w = serve("POST /returns", CreateReturn, "POST", "/returns",
+		fmt.Sprintf(`{"order_id": %d, "items": [{"order_item_id": %d, "quantity": 1}]}`, pending.ID, pending.Items[0].ID))
+	checkProblem(t, w, http.StatusConflict, problem.CodeReturnNotAllowed)
+
+	path := fmt.Sprintf("/returns/%d", ret.ID)
+	w = serve("POST /returns/{id}/receive", ReceiveReturn, "POST", path+"/receive", `{"restock": true}`)
+	checkProblem(t, w, http.StatusConflict, problem.CodeReturnState)
+
+	var resp returnResponse
+	w = serve("POST /returns/{id}/approve", ApproveReturn, "POST", path+"/approve", `{"note": "ok"}`)
+	decodeResponse(t, w, http.StatusOK, &resp)
+	if resp.Return.Status != models.ReturnStatusApproved || resp.Return.Note != "ok" {
+		t.Errorf("approved return %+v", resp.Return)
+	}
+
+	w = serve("POST /returns/{id}/reject", RejectReturn, "POST", path+"/reject", "")
+	checkProblem(t, w, http.StatusConflict, problem.CodeReturnState)
+
+	w = serve("POST /returns/{id}/receive", ReceiveReturn, "POST", path+"/receive", `{"restock": true}`)
+	decodeResponse(t, w, http.StatusOK, &resp)
+	if resp.Return.Status != models.ReturnStatusRefunded || resp.Return.RefundedAmount != 16 || resp.Return.Items[0].Restocked != 2 {
+		t.Errorf("received return %+v", resp.Return)
+	}
+
+	var fetched models.OrderReturn
+	w = serve("GET /returns/{id}", GetReturnByID, "GET", path, "")
+	decodeResponse(t, w, http.StatusOK, &fetched)
+	if fetched.ID != ret.ID || fetched.Status != models.ReturnStatusRefunded {
+		t.Errorf("fetched return %+v", fetched)
+	}
+
+	w = serve("GET /returns/{id}", GetReturnByID, "GET", "/returns/99", "")
+	checkProblem(t, w, http.StatusNotFound, problem.CodeNotFound)
+
+	var list []models.OrderReturn
+	w = serve("GET /returns", GetReturns, "GET", fmt.Sprintf("/returns?order_id=%d&status=refunded", order.ID), "")
+	decodeResponse(t, w, http.StatusOK, &list)
+	if len(list) != 1 || list[0].ID != ret.ID {
+		t.Errorf("listed %+v", list)
+	}
+
+	w = serve("GET /returns", GetReturns, "GET", "/returns?order_id=x", "")
+	checkProblem(t, w, http.StatusBadRequest, problem.CodeInvalidParameter)
+}
@@ -2,15 +2,17 @@ package controllers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
-	"go-crud/models"
+
+	"go-crud/problem"
 )
 
 type roleRequest struct {
 	ID          int    `json:"id,omitempty"`
-	Name        string `json:"name,omitempty"`
-	Description string `json:"description,omitempty"`
+	Name        string `json:"name,omitempty" validate:"required,max=50"`
+	Description string `json:"description,omitempty" validate:"max=500"`
 }
 
 type roleResponse struct {
@@ -18,9 +20,9 @@ type roleResponse struct {
 }
 
 func GetRoles(w http.ResponseWriter, r *http.Request) {
-	roles, err := models.GetRoles(100)
+	roles, err := repos.Roles.List(100)
 	if err != nil {
-		http.Error(w, "Error fetching roles: "+err.Error(), http.StatusInternalServerError)
+		problem.Error(w, fmt.Errorf("fetching roles: %w", err))
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -28,21 +30,21 @@ func GetRoles(w http.ResponseWriter, r *http.Request) {
 }
 
 func GetRoleByID(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Query().Get("id")
+	idStr := idParam(r)
 	if idStr == "" {
-		http.Error(w, "Missing role ID", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, "Missing role ID")
 		return
 	}
 	
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		http.Error(w, "Invalid role ID", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid role ID")
 		return
 	}
 	
-	role, err := models.GetRoleByID(id)
+	role, err := repos.Roles.GetByID(id)
 	if err != nil {
-		http.Error(w, "Error fetching role: "+err.Error(), http.StatusInternalServerError)
+		problem.Error(w, fmt.Errorf("fetching role: %w", err))
 		return
 	}
 	
@@ -52,19 +54,13 @@ func GetRoleByID(w http.ResponseWriter, r *http.Request) {
 
 func CreateRole(w http.ResponseWriter, r *http.Request) {
 	var req roleRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-	
-	if req.Name == "" {
-		http.Error(w, "Role name is required", http.StatusBadRequest)
+	if !decodeBody(w, r, &req) {
 		return
 	}
 	
-	id, err := models.CreateRole(req.Name, req.Description)
+	id, err := repos.Roles.Create(req.Name, req.Description)
 	if err != nil {
-		http.Error(w, "Error creating role: "+err.Error(), http.StatusInternalServerError)
+		problem.Error(w, fmt.Errorf("creating role: %w", err))
 		return
 	}
 	
@@ -74,23 +70,12 @@ func CreateRole(w http.ResponseWriter, r *http.Request) {
 
 func UpdateRole(w http.ResponseWriter, r *http.Request) {
 	var req roleRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-	
-	if req.ID == 0 {
-		http.Error(w, "Role ID is required", http.StatusBadRequest)
+	if !decodeRequest(w, r, &req, &req.ID) {
 		return
 	}
 	
-	if req.Name == "" {
-		http.Error(w, "Role name is required", http.StatusBadRequest)
-		return
-	}
-	
-	if err := models.UpdateRole(req.ID, req.Name, req.Description); err != nil {
-		http.Error(w, "Error updating role: "+err.Error(), http.StatusInternalServerError)
+	if err := repos.Roles.Update(req.ID, req.Name, req.Description); err != nil {
+		problem.Error(w, fmt.Errorf("updating role: %w", err))
 		return
 	}
 	
@@ -99,19 +84,13 @@ func UpdateRole(w http.ResponseWriter, r *http.Request) {
 }
 
 func DeleteRole(w http.ResponseWriter, r *http.Request) {
-	var req roleRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-	
-	if req.ID == 0 {
-		http.Error(w, "Role ID is required", http.StatusBadRequest)
+	var req idRequest
+	if !decodeRequest(w, r, &req, &req.ID) {
 		return
 	}
 	
-	if err := models.DeleteRole(req.ID); err != nil {
-		http.Error(w, "Error deleting role: "+err.Error(), http.StatusInternalServerError)
+	if err := repos.Roles.Delete(req.ID); err != nil {
+		problem.Error(w, fmt.Errorf("deleting role: %w", err))
 		return
 	}
 	
@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"go-crud/models"
+	"go-crud/problem"
+)
+
+type createShipmentRequest struct {
+	OrderID        int                   `json:"order_id" validate:"required"`
+	Carrier        string                `json:"carrier" validate:"max=100"`
+	TrackingNumber string                `json:"tracking_number" validate:"max=100"`
+	Items          []models.ShipmentLine `json:"items,omitempty"` // empty ships everything not yet shipped
+}
+
+type shipShipmentRequest struct {
+	ID             int        `json:"id"`
+	Carrier        string     `json:"carrier,omitempty" validate:"max=100"`
+	TrackingNumber string     `json:"tracking_number,omitempty" validate:"max=100"`
+	ShippedAt      *time.Time `json:"shipped_at,omitempty"` // defaults to now
+}
+
+type deliverShipmentRequest struct {
+	ID          int        `json:"id"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"` // defaults to now
+}
+
+type shipmentResponse struct {
+	Message  string           `json:"message"`
+	Shipment *models.Shipment `json:"shipment,omitempty"`
+}
+
+// writeShipmentError reports a shipment error; problem.Error maps the shipment sentinels. The
+// only sql.ErrNoRows here is a missing order.
+func writeShipmentError(w http.ResponseWriter, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		problem.Write(w, http.StatusNotFound, problem.CodeNotFound, "Order not found")
+		return
+	}
+	problem.Error(w, fmt.Errorf("processing shipment: %w", err))
+}
+
+func writeShipment(w http.ResponseWriter, status int, message string, shipment models.Shipment) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(shipmentResponse{
+		Message:  message,
+		Shipment: &shipment,
+	})
+}
+
+// GetShipments handles listing the shipments of an order
+func GetShipments(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(r.URL.Query().Get("order_id"))
+	if err != nil {
+		problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid order ID")
+		return
+	}
+
+	list, err := repos.Shipments.ListByOrder(orderID)
+	if err != nil {
+		problem.Error(w, fmt.Errorf("fetching shipments: %w", err))
+		return
+	}
+
+	if list == nil {
+		list = []models.Shipment{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(list)
+}
+
+// GetShipmentByID handles fetching a shipment with its items
+func GetShipmentByID(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(idParam(r))
+	if err != nil {
+		problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid shipment ID")
+		return
+	}
+
+	shipment, err := repos.Shipments.GetByID(id)
+	if err != nil {
+		writeShipmentError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(shipment)
+}
+
+// CreateShipment handles packing order items into a shipment
+func CreateShipment(w http.ResponseWriter, r *http.Request) {
+	var req createShipmentRequest
+	if !decodeBody(w, r, &req) {
+		return
+	}
+
+	shipment, err := repos.Shipments.Create(req.OrderID, req.Carrier, req.TrackingNumber, req.Items)
+	if err != nil {
+		writeShipmentError(w, err)
+		return
+	}
+
+	writeShipment(w, http.StatusCreated, "Shipment created successfully", shipment)
+}
+
+// ShipShipment handles the hand-over of a shipment to the carrier
+func ShipShipment(w http.ResponseWriter, r *http.Request) {
+	var req shipShipmentRequest
+	if !decodeRequest(w, r, &req, &req.ID) {
+		return
+	}
+
+	shippedAt := time.Now()
+	if req.ShippedAt != nil {
+		shippedAt = *req.ShippedAt
+	}
+
+	shipment, err := repos.Shipments.MarkShipped(req.ID, req.Carrier, req.TrackingNumber, shippedAt)
+	if err != nil {
+		writeShipmentError(w, err)
+		return
+	}
+
+	writeShipment(w, http.StatusOK, "Shipment marked as shipped", shipment)
+}
+
+// DeliverShipment handles the confirmation that a shipment was delivered
+func DeliverShipment(w http.ResponseWriter, r *http.Request) {
+	var req deliverShipmentRequest
+	if !decodeRequest(w, r, &req, &req.ID) {
+		return
+	}
+
+	deliveredAt := time.Now()
+	if req.DeliveredAt != nil {
+		deliveredAt = *req.DeliveredAt
+	}
+
+	shipment, err := repos.Shipments.MarkDelivered(req.ID, deliveredAt)
+	if err != nil {
+		writeShipmentError(w, err)
+		return
+	}
+
+	writeShipment(w, http.StatusOK, "Shipment marked as delivered", shipment)
+}
@@ -0,0 +1,93 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"go-crud/models"
+	"go-crud/problem"
+)
+
+func TestShipmentHandlers(t *testing.T) {
+	r := useMemoryRepositories(t)
+	order := placeOrder(t, r, 5, 4, models.OrderStatusPaid)
+	itemID := order.Items[0].ID
+
+	orderStatus := func() string {
+		t.Helper()
+		o, err := r.Orders.GetByID(order.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return o.Status
+	}
+
+	var first shipmentResponse
+	w := serve("POST /shipments", CreateShipment, "POST", "/shipments",
+		fmt.Sprintf(`{"order_id": %d, "carrier": "UPS", "items": [{"order_item_id": %d, "quantity": 3}]}`, order.ID, itemID))
+	decodeResponse(t, w, http.StatusCreated, &first)
+	if first.Shipment.Status != models.ShipmentStatusPending || first.Shipment.Items[0].Quantity != 3 {
+		t.Fatalf("created shipment %+v", first.Shipment)
+	}
+	if got := orderStatus(); got != models.OrderStatusProcessing {
+		t.Errorf("order status = %s, want processing", got)
+	}
+
+	w = serve("POST /shipments", CreateShipment, "POST", "/shipments",
+		fmt.Sprintf(`{"order_id": %d, "items": [{"order_item_id": %d, "quantity": 2}]}`, order.ID, itemID))
+	checkProblem(t, w, http.StatusBadRequest, problem.CodeShipmentItem)
+
+	// Without items the rest of the order is shipped
+	var second shipmentResponse
+	w = serve("POST /shipments", CreateShipment, "POST", "/shipments", fmt.Sprintf(`{"order_id": %d}`, order.ID))
+	decodeResponse(t, w, http.StatusCreated, &second)
+	if len(second.Shipment.Items) != 1 || second.Shipment.Items[0].Quantity != 1 {
+		t.Errorf("second shipment %+v", second.Shipment)
+	}
+
+	w = serve("POST /shipments", CreateShipment, "POST", "/shipments", fmt.Sprintf(`{"order_id": %d}`, order.ID))
+	checkProblem(t, w, http.StatusConflict, problem.CodeShipmentNothingToAdd)
+
+	w = serve("POST /shipments", CreateShipment, "POST", "/shipments", `{"order_id": 99}`)
+	checkProblem(t, w, http.StatusNotFound, problem.CodeNotFound)
+
+	for _, id := range []int{first.Shipment.ID, second.Shipment.ID} {
+		var resp shipmentResponse
+		w = serve("POST /shipments/{id}/ship", ShipShipment, "POST", fmt.Sprintf("/shipments/%d/ship", id), `{"tracking_number": "1Z999"}`)
+		decodeResponse(t, w, http.StatusOK, &resp)
+		if resp.Shipment.Status != models.ShipmentStatusShipped || resp.Shipment.ShippedAt == nil || resp.Shipment.TrackingNumber != "1Z999" {
+			t.Errorf("shipped shipment %+v", resp.Shipment)
+		}
+	}
+	if got := orderStatus(); got != models.OrderStatusShipped {
+		t.Errorf("order status = %s, want shipped", got)
+	}
+
+	path := fmt.Sprintf("/shipments/%d", first.Shipment.ID)
+	w = serve("POST /shipments/{id}/ship", ShipShipment, "POST", path+"/ship", "")
+	checkProblem(t, w, http.StatusConflict, problem.CodeShipmentState)
+
+	w = serve("POST /shipments/{id}/deliver", DeliverShipment, "POST", path+"/deliver", `{"delivered_at": "2026-10-01T12:00:00Z"}`)
+	decodeResponse(t, w, http.StatusOK, nil)
+	if got := orderStatus(); got != models.OrderStatusShipped {
+		t.Errorf("order status = %s with one shipment delivered, want shipped", got)
+	}
+
+	var fetched models.Shipment
+	w = serve("GET /shipments/{id}", GetShipmentByID, "GET", path, "")
+	decodeResponse(t, w, http.StatusOK, &fetched)
+	if fetched.Status != models.ShipmentStatusDelivered || fetched.DeliveredAt == nil || fetched.DeliveredAt.Day() != 1 {
+		t.Errorf("fetched shipment %+v", fetched)
+	}
+
+	w = serve("GET /shipments/{id}", GetShipmentByID, "GET", "/shipments/99", "")
+	checkProblem(t, w, http.StatusNotFound, problem.CodeNotFound)
+
+	var list []models.Shipment
+	w = serve("GET /shipments", GetShipments, "GET", fmt.Sprintf("/shipments?order_id=%d", order.ID), "")
+	decodeResponse(t, w, http.StatusOK, &list)
+	if len(list) != 2 {
+		t.Errorf("listed %d shipments, want 2", len(list))
+	}
+}
@@ -2,16 +2,22 @@ package controllers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
-	"go-crud/models"
 	"go-crud/middlewares"
+	"go-crud/problem"
 )
 
 type userRequest struct {
 	ID       int    `json:"id,omitempty"`
-	Email    string `json:"email,omitempty"`
-	Password string `json:"password,omitempty"` // Added password field
+	Email    string `json:"email,omitempty" validate:"omitempty,email"`
+	Password string `json:"password,omitempty" validate:"omitempty,min=6"` // Added password field
+}
+
+// createUserRequest creates a user without a password, which the user sets later
+type createUserRequest struct {
+	Email string `json:"email" validate:"required,email"`
 }
 
 type userResponse struct {
@@ -19,9 +25,9 @@ type userResponse struct {
 }
 
 func GetUsers(w http.ResponseWriter, r *http.Request) {
-	users, err := models.GetUsers(100)
+	users, err := repos.Users.List(100)
 	if err != nil {
-		http.Error(w, "Error fetching users: "+err.Error(), http.StatusInternalServerError)
+		problem.Error(w, fmt.Errorf("fetching users: %w", err))
 		return
 	}
 	w.Header().Set("Content-Type", "application/json")
@@ -33,13 +39,13 @@ func GetUserProfile(w http.ResponseWriter, r *http.Request) {
 	// Get user ID from context (set by AuthMiddleware)
 	userID, ok := middlewares.GetUserID(r)
 	if !ok {
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		problem.Write(w, http.StatusUnauthorized, problem.CodeUnauthorized, "User not authenticated")
 		return
 	}
 
-	user, err := models.GetUserByID(userID)
+	user, err := repos.Users.GetByID(userID)
 	if err != nil {
-		http.Error(w, "Error fetching user: "+err.Error(), http.StatusInternalServerError)
+		problem.Error(w, fmt.Errorf("fetching user: %w", err))
 		return
 	}
 
@@ -48,9 +54,8 @@ func GetUserProfile(w http.ResponseWriter, r *http.Request) {
 }
 
 func CreateUser(w http.ResponseWriter, r *http.Request) {
-	var req userRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	var req createUserRequest
+	if !decodeBody(w, r, &req) {
 		return
 	}
 
@@ -58,21 +63,15 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 	// This is just a placeholder. In a real app, you'd check user roles
 	_, ok := middlewares.GetUserID(r)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
-		return
-	}
-
-	// Validate email
-	if req.Email == "" {
-		http.Error(w, "Email is required", http.StatusBadRequest)
+		problem.Write(w, http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized")
 		return
 	}
 
 	// Create user with email only (for admin creation)
 	// Password can be set later by the user
-	id, err := models.CreateUser(req.Email)
+	id, err := repos.Users.Create(req.Email)
 	if err != nil {
-		http.Error(w, "Error creating user: "+err.Error(), http.StatusInternalServerError)
+		problem.Error(w, fmt.Errorf("creating user: %w", err))
 		return
 	}
 
@@ -82,15 +81,14 @@ func CreateUser(w http.ResponseWriter, r *http.Request) {
 
 func UpdateUser(w http.ResponseWriter, r *http.Request) {
 	var req userRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeOptionalID(w, r, &req, &req.ID) {
 		return
 	}
 
 	// Get user ID from token
 	userID, ok := middlewares.GetUserID(r)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		problem.Write(w, http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -98,7 +96,7 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 	// or implement admin check here
 	if req.ID != 0 && req.ID != userID {
 		// In a real app, check if user is admin before allowing this
-		http.Error(w, "You can only update your own account", http.StatusForbidden)
+		problem.Write(w, http.StatusForbidden, problem.CodeForbidden, "You can only update your own account")
 		return
 	}
 
@@ -109,21 +107,16 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 
 	// Update email if provided
 	if req.Email != "" {
-		if err := models.UpdateUser(req.ID, req.Email); err != nil {
-			http.Error(w, "Error updating user: "+err.Error(), http.StatusInternalServerError)
+		if err := repos.Users.UpdateEmail(req.ID, req.Email); err != nil {
+			problem.Error(w, fmt.Errorf("updating user: %w", err))
 			return
 		}
 	}
 
 	// Update password if provided
 	if req.Password != "" {
-		if len(req.Password) < 6 {
-			http.Error(w, "Password must be at least 6 characters long", http.StatusBadRequest)
-			return
-		}
-
-		if err := models.UpdateUserPassword(req.ID, req.Password); err != nil {
-			http.Error(w, "Error updating password: "+err.Error(), http.StatusInternalServerError)
+		if err := repos.Users.UpdatePassword(req.ID, req.Password); err != nil {
+			problem.Error(w, fmt.Errorf("updating password: %w", err))
 			return
 		}
 	}
@@ -134,15 +127,14 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 
 func DeleteUser(w http.ResponseWriter, r *http.Request) {
 	var req userRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeOptionalID(w, r, &req, &req.ID) {
 		return
 	}
 
 	// Get user ID from token
 	userID, ok := middlewares.GetUserID(r)
 	if !ok {
-		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		problem.Write(w, http.StatusUnauthorized, problem.CodeUnauthorized, "Unauthorized")
 		return
 	}
 
@@ -150,7 +142,7 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 	// or implement admin check here
 	if req.ID != 0 && req.ID != userID {
 		// In a real app, check if user is admin before allowing this
-		http.Error(w, "You can only delete your own account", http.StatusForbidden)
+		problem.Write(w, http.StatusForbidden, problem.CodeForbidden, "You can only delete your own account")
 		return
 	}
 
@@ -159,8 +151,8 @@ func DeleteUser(w http.ResponseWriter, r *http.Request) {
 		req.ID = userID
 	}
 
-	if err := models.DeleteUser(req.ID); err != nil {
-		http.Error(w, "Error deleting user: "+err.Error(), http.StatusInternalServerError)
+	if err := repos.Users.Delete(req.ID); err != nil {
+		problem.Error(w, fmt.Errorf("deleting user: %w", err))
 		return
 	}
 
@@ -0,0 +1,249 @@
+// Package fixtures loads declarative seed data from YAML or JSON files and generates
+// further sample data reproducibly from a random seed.
+package fixtures
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go-crud/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed sample.yaml
+var sample []byte
+
+// AdminRef refers to the DEFAULT_ADMIN_EMAIL account in an address or order
+const AdminRef = "admin"
+
+// Set is the content of a fixture file. Users are referred to by email (or AdminRef) and
+// products by name, so a set does not depend on the IDs the database assigns.
+type Set struct {
+	Seed      int64     `json:"seed" yaml:"seed"` // seed for generated data unless one is given
+	Users     []User    `json:"users" yaml:"users"`
+	Roles     []Role    `json:"roles" yaml:"roles"`
+	Products  []Product `json:"products" yaml:"products"`
+	Addresses []Address `json:"addresses" yaml:"addresses"`
+	Orders    []Order   `json:"orders" yaml:"orders"`
+	Generate  Generate  `json:"generate" yaml:"generate"`
+}
+
+// User is an account; Admin marks the DEFAULT_ADMIN_EMAIL account, which takes its email
+// and, unless Password is set, its password from the configuration
+type User struct {
+	Email    string `json:"email" yaml:"email"`
+	Password string `json:"password" yaml:"password"` // generated from the seed when empty
+	Admin    bool   `json:"admin" yaml:"admin"`
+}
+
+type Role struct {
+	Name        string `json:"name" yaml:"name"`
+	Description string `json:"description" yaml:"description"`
+}
+
+type Product struct {
+	Name     string  `json:"name" yaml:"name"`
+	Status   string  `json:"status" yaml:"status"` // active (default) or inactive
+	Price    float64 `json:"price" yaml:"price"`
+	Weight   float64 `json:"weight" yaml:"weight"`
+	Category string  `json:"category" yaml:"category"`
+	Stock    int     `json:"stock" yaml:"stock"`
+}
+
+type Address struct {
+	User        string `json:"user" yaml:"user"`
+	Type        string `json:"type" yaml:"type"` // shipping, billing or both (default)
+	StreetLine1 string `json:"street_line1" yaml:"street_line1"`
+	StreetLine2 string `json:"street_line2" yaml:"street_line2"`
+	City        string `json:"city" yaml:"city"`
+	State       string `json:"state" yaml:"state"`
+	PostalCode  string `json:"postal_code" yaml:"postal_code"`
+	Country     string `json:"country" yaml:"country"`
+	Default     bool   `json:"default" yaml:"default"`
+}
+
+// Order is placed like an API order, priced and shipped to the user's default address,
+// then moved to Status
+type Order struct {
+	User   string `json:"user" yaml:"user"`
+	Status string `json:"status" yaml:"status"` // pending by default
+	Items  []Item `json:"items" yaml:"items"`
+}
+
+type Item struct {
+	Product  string `json:"product" yaml:"product"`
+	Quantity int    `json:"quantity" yaml:"quantity"`
+}
+
+// Generate asks for random users (each with an address), products and orders
+type Generate struct {
+	Users    int `json:"users" yaml:"users"`
+	Products int `json:"products" yaml:"products"`
+	Orders   int `json:"orders" yaml:"orders"`
+}
+
+// Sample returns the fixture set built into the binary
+func Sample() (*Set, error) {
+	return Parse(sample, "sample.yaml")
+}
+
+// Load reads a fixture file: JSON if its name ends in .json, YAML otherwise
+func Load(path string) (*Set, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data, path)
+}
+
+// Parse decodes and validates a fixture set; unknown fields are rejected. name is used in
+// errors and selects JSON when it ends in .json.
+func Parse(data []byte, name string) (*Set, error) {
+	var set Set
+	var err error
+	if strings.EqualFold(filepath.Ext(name), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&set)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err = dec.Decode(&set); errors.Is(err, io.EOF) {
+			err = nil // an empty file is an empty set
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	if err := set.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	return &set, nil
+}
+
+// validate checks the set before anything is written, so a seed does not stop half-way
+// over a mistake in the file
+func (s *Set) validate() error {
+	var errs []error
+	fail := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	users := map[string]bool{}
+	admins := 0
+	for i, u := range s.Users {
+		switch {
+		case u.Admin:
+			admins++
+			if u.Email != "" {
+				fail("users[%d]: the admin account's email is DEFAULT_ADMIN_EMAIL; remove email", i)
+			}
+		case u.Email == "":
+			fail("users[%d]: email is required", i)
+		case users[strings.ToLower(u.Email)]:
+			fail("users[%d]: %s is listed twice", i, u.Email)
+		default:
+			users[strings.ToLower(u.Email)] = true
+		}
+		if u.Password != "" && len(u.Password) < 6 {
+			fail("users[%d]: password must be at least 6 characters", i)
+		}
+	}
+	if admins > 1 {
+		fail("users: only one user can be the admin")
+	}
+	knownUser := func(ref string) bool {
+		if strings.EqualFold(ref, AdminRef) {
+			return admins == 1
+		}
+		return users[strings.ToLower(ref)]
+	}
+
+	roles := map[string]bool{}
+	for i, r := range s.Roles {
+		if r.Name == "" {
+			fail("roles[%d]: name is required", i)
+		} else if roles[r.Name] {
+			fail("roles[%d]: %s is listed twice", i, r.Name)
+		}
+		roles[r.Name] = true
+	}
+
+	products := map[string]bool{}
+	for i, p := range s.Products {
+		switch {
+		case p.Name == "":
+			fail("products[%d]: name is required", i)
+		case products[p.Name]:
+			fail("products[%d]: %s is listed twice", i, p.Name)
+		}
+		products[p.Name] = true
+		if p.Status != "" && p.Status != "active" && p.Status != "inactive" {
+			fail("products[%d]: status must be active or inactive", i)
+		}
+		if p.Price < 0 || p.Weight < 0 || p.Stock < 0 {
+			fail("products[%d]: price, weight and stock cannot be negative", i)
+		}
+	}
+
+	for i, a := range s.Addresses {
+		if !knownUser(a.User) {
+			fail("addresses[%d]: unknown user %q", i, a.User)
+		}
+		addr := a.model(1)
+		if err := models.NormalizeAddress(&addr); err != nil {
+			fail("addresses[%d]: %w", i, err)
+		}
+	}
+
+	for i, o := range s.Orders {
+		if !knownUser(o.User) {
+			fail("orders[%d]: unknown user %q", i, o.User)
+		}
+		if o.Status != "" && !models.IsValidOrderStatus(o.Status) {
+			fail("orders[%d]: unknown status %q", i, o.Status)
+		}
+		if len(o.Items) == 0 {
+			fail("orders[%d]: at least one item is required", i)
+		}
+		for j, item := range o.Items {
+			if !products[item.Product] {
+				fail("orders[%d].items[%d]: unknown product %q", i, j, item.Product)
+			}
+			if item.Quantity < 1 {
+				fail("orders[%d].items[%d]: quantity must be at least 1", i, j)
+			}
+		}
+	}
+
+	g := s.Generate
+	if g.Users < 0 || g.Products < 0 || g.Orders < 0 {
+		fail("generate: counts cannot be negative")
+	}
+
+	return errors.Join(errs...)
+}
+
+// model returns the address as stored for a user
+func (a Address) model(userID int) models.Address {
+	return models.Address{
+		UserID:      userID,
+		Type:        a.Type,
+		StreetLine1: a.StreetLine1,
+		StreetLine2: a.StreetLine2,
+		City:        a.City,
+		State:       a.State,
+		PostalCode:  a.PostalCode,
+		Country:     a.Country,
+		IsDefault:   a.Default,
+	}
+}
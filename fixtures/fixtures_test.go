@@ -0,0 +1,100 @@
+package fixtures
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSampleIsValid(t *testing.T) {
+	set, err := Sample()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if set.Seed == 0 || len(set.Users) == 0 || len(set.Products) == 0 || len(set.Orders) == 0 {
+		t.Errorf("sample set is missing data: %+v", set)
+	}
+}
+
+func TestParseRejectsInvalidSets(t *testing.T) {
+	tests := []struct {
+		name, data, want string
+	}{
+		{"unknown field", "userz: []", "field userz not found"},
+		{"unknown JSON field", `{"userz": []}`, "unknown field"},
+		{"admin email", "users: [{admin: true, email: a@example.com}]", "remove email"},
+		{"two admins", "users: [{admin: true}, {admin: true}]", "only one user can be the admin"},
+		{"missing email", "users: [{password: secret1}]", "email is required"},
+		{"duplicate email", "users: [{email: a@example.com}, {email: A@example.com}]", "listed twice"},
+		{"short password", "users: [{email: a@example.com, password: abc}]", "at least 6 characters"},
+		{"duplicate role", "roles: [{name: Editor}, {name: Editor}]", "Editor is listed twice"},
+		{"product status", "products: [{name: P, status: gone}]", "active or inactive"},
+		{"negative stock", "products: [{name: P, stock: -1}]", "cannot be negative"},
+		{"address user", "addresses: [{user: nobody@example.com, street_line1: 1 Main St, city: Austin, state: TX, postal_code: '73301', country: US}]", `unknown user "nobody@example.com"`},
+		{"admin without admin user", "orders: [{user: admin, items: [{product: P, quantity: 1}]}]\nproducts: [{name: P}]", `unknown user "admin"`},
+		{"order product", "users: [{email: a@example.com}]\norders: [{user: a@example.com, items: [{product: Q, quantity: 1}]}]", `unknown product "Q"`},
+		{"order quantity", "users: [{email: a@example.com}]\nproducts: [{name: P}]\norders: [{user: a@example.com, items: [{product: P}]}]", "quantity must be at least 1"},
+		{"order status", "users: [{email: a@example.com}]\nproducts: [{name: P}]\norders: [{user: a@example.com, status: lost, items: [{product: P, quantity: 1}]}]", `unknown status "lost"`},
+		{"no items", "users: [{email: a@example.com}]\norders: [{user: a@example.com}]", "at least one item"},
+		{"generate", "generate: {orders: -1}", "cannot be negative"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			name := "set.yaml"
+			if strings.HasPrefix(tt.data, "{") {
+				name = "set.json"
+			}
+			_, err := Parse([]byte(tt.data), name)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Parse error = %v, want %q", err, tt.want)
+			}
+			if err != nil && !strings.HasPrefix(err.Error(), name+": ") {
+				t.Errorf("error %q does not name the file", err)
+			}
+		})
+	}
+}
+
+func TestParseReportsEveryMistake(t *testing.T) {
+	_, err := Parse([]byte("users: [{}, {email: a@example.com, password: x}]\nproducts: [{price: -1}]"), "set.yaml")
+	if err == nil {
+		t.Fatal("Parse accepted an invalid set")
+	}
+	for _, want := range []string{"users[0]: email is required", "users[1]: password", "products[0]: name is required", "products[0]: price"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"set.json":   `{"seed": 3, "users": [{"email": "a@example.com"}], "generate": {"users": 2}}`,
+		"set.yml":    "seed: 3\nusers:\n  - email: a@example.com\ngenerate:\n  users: 2\n",
+		"empty.yaml": "",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, name := range []string{"set.json", "set.yml"} {
+		set, err := Load(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if set.Seed != 3 || len(set.Users) != 1 || set.Users[0].Email != "a@example.com" || set.Generate.Users != 2 {
+			t.Errorf("%s loaded as %+v", name, set)
+		}
+	}
+
+	if set, err := Load(filepath.Join(dir, "empty.yaml")); err != nil || len(set.Users) != 0 {
+		t.Errorf("empty file loaded as %+v, %v", set, err)
+	}
+	if _, err := Load(filepath.Join(dir, "missing.yaml")); !os.IsNotExist(err) {
+		t.Errorf("loading a missing file: %v", err)
+	}
+}
@@ -0,0 +1,274 @@
+package fixtures
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+
+	"go-crud/config"
+	"go-crud/models"
+)
+
+// ErrProduction is returned when seeding with APP_ENV=production
+var ErrProduction = errors.New("sample data cannot be seeded when APP_ENV is production")
+
+// Credential is the email and password of a seeded user
+type Credential struct {
+	Email    string
+	Password string
+}
+
+// Result counts what a seed created; Users holds every account's password so
+// developers can log in
+type Result struct {
+	Users     []Credential
+	Roles     int
+	Products  int
+	Addresses int
+	Orders    int
+}
+
+// Seed writes a fixture set to the database, then generates the set's extra users, products
+// and orders with a random number generator seeded by seed. The same set and seed always
+// produce the same accounts, passwords, products, addresses and orders.
+func Seed(set *Set, seed int64) (Result, error) {
+	if config.AppConfig.IsProduction() {
+		return Result{}, ErrProduction
+	}
+
+	s := &seeder{
+		rng:      rand.New(rand.NewSource(seed)),
+		users:    map[string]int{},
+		products: map[string]int{},
+	}
+	if err := s.seedSet(set); err != nil {
+		return s.result, err
+	}
+	if err := s.generate(set.Generate); err != nil {
+		return s.result, fmt.Errorf("generating data: %w", err)
+	}
+	return s.result, nil
+}
+
+type seeder struct {
+	rng    *rand.Rand
+	result Result
+
+	users     map[string]int // ID by lower-cased email, and AdminRef
+	customers []int          // every user but the admin, in the order created
+	products  map[string]int // ID by name
+	active    []int          // active products, in the order created
+}
+
+func (s *seeder) seedSet(set *Set) error {
+	for _, u := range set.Users {
+		email, password := u.Email, u.Password
+		if u.Admin {
+			email = config.AppConfig.DefaultAdminEmail
+			if password == "" {
+				password = config.AppConfig.DefaultAdminPassword
+			}
+		}
+		if err := s.addUser(email, password, u.Admin); err != nil {
+			return err
+		}
+	}
+
+	for _, r := range set.Roles {
+		if _, err := models.CreateRole(r.Name, r.Description); err != nil {
+			return fmt.Errorf("role %s: %w", r.Name, err)
+		}
+		s.result.Roles++
+	}
+
+	for _, p := range set.Products {
+		if err := s.addProduct(p); err != nil {
+			return err
+		}
+	}
+
+	for _, a := range set.Addresses {
+		if err := s.addAddress(s.userID(a.User), a); err != nil {
+			return err
+		}
+	}
+
+	for _, o := range set.Orders {
+		items := make([]models.ItemRequest, len(o.Items))
+		for i, item := range o.Items {
+			items[i] = models.ItemRequest{ProductID: s.products[item.Product], Quantity: item.Quantity}
+		}
+		if err := s.addOrder(s.userID(o.User), items, o.Status); err != nil {
+			return fmt.Errorf("order for %s: %w", o.User, err)
+		}
+	}
+	return nil
+}
+
+func (s *seeder) userID(ref string) int {
+	if strings.EqualFold(ref, AdminRef) {
+		return s.users[AdminRef]
+	}
+	return s.users[strings.ToLower(ref)]
+}
+
+func (s *seeder) addUser(email, password string, admin bool) error {
+	if password == "" {
+		password = s.password()
+	}
+	id, err := models.RegisterUser(email, password)
+	if err != nil {
+		return fmt.Errorf("user %s: %w", email, err)
+	}
+
+	s.users[strings.ToLower(email)] = id
+	if admin {
+		s.users[AdminRef] = id
+	} else {
+		s.customers = append(s.customers, id)
+	}
+	s.result.Users = append(s.result.Users, Credential{email, password})
+	return nil
+}
+
+func (s *seeder) addProduct(p Product) error {
+	id, err := models.CreateProduct(p.Name, p.Status, p.Price)
+	if err == nil {
+		err = models.UpdateProductDetails(id, p.Weight, p.Category, p.Stock)
+	}
+	if err != nil {
+		return fmt.Errorf("product %s: %w", p.Name, err)
+	}
+
+	s.products[p.Name] = id
+	if p.Status == "" || p.Status == "active" {
+		s.active = append(s.active, id)
+	}
+	s.result.Products++
+	return nil
+}
+
+func (s *seeder) addAddress(userID int, a Address) error {
+	if _, err := models.CreateAddress(a.model(userID)); err != nil {
+		return fmt.Errorf("address %s for user %d: %w", a.StreetLine1, userID, err)
+	}
+	s.result.Addresses++
+	return nil
+}
+
+func (s *seeder) addOrder(userID int, items []models.ItemRequest, status string) error {
+	id, err := models.PlaceOrder(models.OrderRequest{UserID: userID, Items: items})
+	if err != nil {
+		return err
+	}
+	// Walk the order through the statuses it would have passed on its way to status
+	if status != "" && status != models.OrderStatusPending {
+		path := models.OrderStatusPath(models.OrderStatusPending, status)
+		if path == nil {
+			return fmt.Errorf("order status %q cannot be reached from %s", status, models.OrderStatusPending)
+		}
+		for _, next := range path {
+			if err := models.UpdateOrderStatus(id, next); err != nil {
+				return err
+			}
+		}
+	}
+	s.result.Orders++
+	return nil
+}
+
+// Word lists for generated data
+var (
+	firstNames = []string{"ava", "ben", "chloe", "dev", "elena", "felix", "grace", "hugo", "isla", "jonas", "kai", "lena", "mateo", "nora", "omar", "priya"}
+	lastNames  = []string{"adams", "brown", "chen", "diaz", "evans", "fischer", "garcia", "haddad", "ito", "jensen", "kim", "lopez", "martin", "novak", "okafor", "patel"}
+	streets    = []string{"Main St", "Oak Ave", "Maple Dr", "Cedar Ln", "Elm St", "Park Ave", "Pine Rd", "Lake Blvd"}
+	adjectives = []string{"Classic", "Compact", "Deluxe", "Eco", "Essential", "Heavy-Duty", "Portable", "Premium", "Smart", "Vintage"}
+	nouns      = []string{"Backpack", "Blender", "Desk Lamp", "Headphones", "Kettle", "Notebook", "Sneakers", "Water Bottle", "Wall Clock", "Yoga Mat"}
+	categories = []string{"accessories", "electronics", "home", "outdoor", "stationery"}
+	statuses   = []string{
+		models.OrderStatusPending, models.OrderStatusPaid, models.OrderStatusProcessing, models.OrderStatusShipped,
+		models.OrderStatusDelivered, models.OrderStatusCompleted, models.OrderStatusCancelled,
+	}
+	// Cities with a valid state and postal code for address validation
+	places = []struct{ City, State, PostalCode, Country string }{
+		{"New York", "NY", "10001", "US"},
+		{"Los Angeles", "CA", "90001", "US"},
+		{"Austin", "TX", "73301", "US"},
+		{"Seattle", "WA", "98101", "US"},
+		{"Toronto", "ON", "M5H 2N2", "CA"},
+		{"Vancouver", "BC", "V6B 1A1", "CA"},
+	}
+)
+
+// generate adds random users, each with a default address, then products, then orders of
+// active products by any user but the admin
+func (s *seeder) generate(g Generate) error {
+	for i := 1; i <= g.Users; i++ {
+		first, last := s.pick(firstNames), s.pick(lastNames)
+		email := fmt.Sprintf("%s.%s%d@example.test", first, last, i)
+		if err := s.addUser(email, "", false); err != nil {
+			return err
+		}
+
+		place := places[s.rng.Intn(len(places))]
+		err := s.addAddress(s.users[email], Address{
+			StreetLine1: fmt.Sprintf("%d %s", 1+s.rng.Intn(9999), s.pick(streets)),
+			City:        place.City,
+			State:       place.State,
+			PostalCode:  place.PostalCode,
+			Country:     place.Country,
+			Default:     true,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for i := 1; i <= g.Products; i++ {
+		p := Product{
+			Name:     fmt.Sprintf("%s %s %d", s.pick(adjectives), s.pick(nouns), i),
+			Status:   "active",
+			Price:    math.Round((5+s.rng.Float64()*195)*100) / 100,
+			Weight:   math.Round((0.1+s.rng.Float64()*4.9)*10) / 10,
+			Category: s.pick(categories),
+			Stock:    50 + s.rng.Intn(51), // enough for every generated order
+		}
+		if s.rng.Intn(10) == 0 {
+			p.Status = "inactive"
+		}
+		if err := s.addProduct(p); err != nil {
+			return err
+		}
+	}
+
+	if g.Orders > 0 && (len(s.customers) == 0 || len(s.active) == 0) {
+		return errors.New("orders need at least one non-admin user and one active product")
+	}
+	for i := 0; i < g.Orders; i++ {
+		userID := s.customers[s.rng.Intn(len(s.customers))]
+		var items []models.ItemRequest
+		for _, j := range s.rng.Perm(len(s.active))[:1+s.rng.Intn(min(3, len(s.active)))] {
+			items = append(items, models.ItemRequest{ProductID: s.active[j], Quantity: 1 + s.rng.Intn(3)})
+		}
+		if err := s.addOrder(userID, items, s.pick(statuses)); err != nil {
+			return fmt.Errorf("order for user %d: %w", userID, err)
+		}
+	}
+	return nil
+}
+
+func (s *seeder) pick(words []string) string {
+	return words[s.rng.Intn(len(words))]
+}
+
+// password returns a random 12-character password without look-alike characters
+func (s *seeder) password() string {
+	const chars = "abcdefghjkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	b := make([]byte, 12)
+	for i := range b {
+		b[i] = chars[s.rng.Intn(len(chars))]
+	}
+	return string(b)
+}
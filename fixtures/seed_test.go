@@ -0,0 +1,212 @@
+package fixtures
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"go-crud/config"
+	"go-crud/models"
+)
+
+// useTestDatabase points models at a freshly migrated SQLite database and sets the
+// configuration a seed reads, until the test ends
+func useTestDatabase(t *testing.T, appEnv string) {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	prevDB, prevDriver, prevConfig := models.DB, models.Driver, config.AppConfig
+	t.Cleanup(func() {
+		models.DB, models.Driver, config.AppConfig = prevDB, prevDriver, prevConfig
+		log.SetOutput(os.Stderr)
+	})
+
+	db, err := models.Open(models.DriverSQLite, filepath.Join(t.TempDir(), "fixtures.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	models.DB = db
+	if _, err := models.MigrateUp(0); err != nil {
+		t.Fatalf("migrating the test database: %v", err)
+	}
+
+	config.AppConfig.AppEnv = appEnv
+	config.AppConfig.DefaultAdminEmail = "admin@example.com"
+	config.AppConfig.DefaultAdminPassword = "admin123"
+}
+
+// snapshot describes the seeded data without IDs the database assigned or timestamps
+func snapshot(t *testing.T) []string {
+	t.Helper()
+	var lines []string
+	users, err := models.GetUsers(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range users {
+		lines = append(lines, fmt.Sprintf("user %s", u.Email))
+	}
+	products, err := models.GetProducts(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range products {
+		lines = append(lines, fmt.Sprintf("product %s %s %.2f %.1f %s %d", p.Name, p.Status, p.Price, p.Weight, p.Category, p.Stock))
+	}
+	addresses, err := models.GetAddresses(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range addresses {
+		lines = append(lines, fmt.Sprintf("address %d %s %s %s %s %t", a.UserID, a.StreetLine1, a.City, a.PostalCode, a.Country, a.IsDefault))
+	}
+	orders, err := models.GetOrders(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, o := range orders {
+		o, err := models.GetOrderByID(o.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		line := fmt.Sprintf("order %d %d %s %.2f", o.ID, o.UserID, o.Status, o.TotalAmount)
+		for _, item := range o.Items {
+			line += fmt.Sprintf(" %dx%d", item.Quantity, item.ProductID)
+		}
+		lines = append(lines, line)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+func TestSeedIsReproducible(t *testing.T) {
+	set, err := Sample()
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.Generate = Generate{Users: 4, Products: 6, Orders: 10}
+
+	seed := func(seed int64) (Result, []string) {
+		t.Helper()
+		useTestDatabase(t, "development")
+		result, err := Seed(set, seed)
+		if err != nil {
+			t.Fatalf("seeding with %d: %v", seed, err)
+		}
+		return result, snapshot(t)
+	}
+
+	first, firstData := seed(7)
+	second, secondData := seed(7)
+	if !reflect.DeepEqual(first, second) {
+		t.Errorf("seed 7 gave different results:\n%+v\n%+v", first, second)
+	}
+	if !reflect.DeepEqual(firstData, secondData) {
+		t.Errorf("seed 7 wrote different data:\n%v\n%v", firstData, secondData)
+	}
+	if _, otherData := seed(8); reflect.DeepEqual(firstData, otherData) {
+		t.Error("seeds 7 and 8 wrote the same data")
+	}
+
+	want := Result{Roles: len(set.Roles), Products: len(set.Products) + 6, Addresses: len(set.Addresses) + 4, Orders: len(set.Orders) + 10}
+	if got := first; got.Roles != want.Roles || got.Products != want.Products || got.Addresses != want.Addresses ||
+		got.Orders != want.Orders || len(got.Users) != len(set.Users)+4 {
+		t.Errorf("result %+v, want %+v with %d users", got, want, len(set.Users)+4)
+	}
+}
+
+func TestSeedPasswords(t *testing.T) {
+	useTestDatabase(t, "development")
+	set, err := Parse([]byte("users:\n  - admin: true\n  - email: fixed@example.com\n    password: fixed-pass\n  - email: random@example.com\n"), "set.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := Seed(set, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(result.Users) != 3 || result.Users[0] != (Credential{"admin@example.com", "admin123"}) ||
+		result.Users[1].Password != "fixed-pass" || len(result.Users[2].Password) != 12 {
+		t.Fatalf("credentials %+v", result.Users)
+	}
+	for _, c := range result.Users {
+		if _, err := models.LoginUser(c.Email, c.Password); err != nil {
+			t.Errorf("logging in as %s: %v", c.Email, err)
+		}
+	}
+}
+
+func TestSeedOrderStatuses(t *testing.T) {
+	useTestDatabase(t, "development")
+	set, err := Parse([]byte(`
+users: [{email: buyer@example.com}]
+products: [{name: P, price: 10, stock: 5}]
+addresses: [{user: buyer@example.com, street_line1: 1 Main St, city: Austin, state: TX, postal_code: "73301", country: US, default: true}]
+orders:
+  - {user: buyer@example.com, items: [{product: P, quantity: 1}]}
+  - {user: buyer@example.com, status: delivered, items: [{product: P, quantity: 2}]}
+`), "set.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Seed(set, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	orders, err := models.GetOrders(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statuses := map[string]int{}
+	for _, o := range orders {
+		statuses[o.Status]++
+		if o.AddressID == nil {
+			t.Errorf("order %d has no shipping address", o.ID)
+		}
+	}
+	if statuses[models.OrderStatusPending] != 1 || statuses[models.OrderStatusDelivered] != 1 {
+		t.Errorf("order statuses %v", statuses)
+	}
+}
+
+func TestSeedRefusesProduction(t *testing.T) {
+	useTestDatabase(t, "Production")
+	set, err := Sample()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Seed(set, 1); !errors.Is(err, ErrProduction) {
+		t.Fatalf("Seed in production = %v, want ErrProduction", err)
+	}
+	if users, err := models.GetUsers(10); err != nil || len(users) != 0 {
+		t.Errorf("seeding in production wrote %d users (%v)", len(users), err)
+	}
+}
+
+func TestSeedTwiceConflicts(t *testing.T) {
+	useTestDatabase(t, "development")
+	set, err := Sample()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Seed(set, 1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Seed(set, 1); err == nil {
+		t.Error("seeding the same set twice succeeded")
+	}
+}
+
+func TestGeneratedOrdersNeedCustomersAndProducts(t *testing.T) {
+	useTestDatabase(t, "development")
+	if _, err := Seed(&Set{Generate: Generate{Products: 2, Orders: 1}}, 1); err == nil {
+		t.Error("generating orders without customers succeeded")
+	}
+}
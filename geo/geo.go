@@ -0,0 +1,192 @@
+// Package geo looks up ISO 3166 countries and their subdivisions, and checks postal codes
+// against each country's formats. The data is embedded from countries.json.
+//
+// Postal code formats use # for a digit, @ for a letter and ? for either; spaces and hyphens
+// are printed as written.
+package geo
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+//go:embed countries.json
+var countriesJSON []byte
+
+// Country is an ISO 3166-1 country with its address rules
+type Country struct {
+	Code          string            `json:"code"`   // ISO 3166-1 alpha-2, e.g. "US"
+	Alpha3        string            `json:"alpha3"` // ISO 3166-1 alpha-3, e.g. "USA"
+	Name          string            `json:"name"`
+	Aliases       []string          `json:"aliases,omitempty"`
+	PostalFormats []string          `json:"postal,omitempty"`         // empty when postal codes are not checked
+	StateRequired bool              `json:"state_required,omitempty"` // addresses must name a subdivision
+	Subdivisions  map[string]string `json:"subdivisions,omitempty"`   // ISO 3166-2 code (without the country prefix) to name
+}
+
+var (
+	countries      []Country
+	countryIndex   = map[string]int{}               // folded code, alpha-3, name or alias to index
+	subdivisionIdx = map[string]map[string]string{} // country code to folded subdivision code or name to code
+)
+
+func init() {
+	if err := json.Unmarshal(countriesJSON, &countries); err != nil {
+		panic("geo: parsing countries.json: " + err.Error())
+	}
+
+	for i, c := range countries {
+		keys := append([]string{c.Code, c.Alpha3, c.Name}, c.Aliases...)
+		for _, key := range keys {
+			k := fold(key)
+			if j, dup := countryIndex[k]; dup && j != i {
+				panic(fmt.Sprintf("geo: %q matches both %s and %s", key, countries[j].Code, c.Code))
+			}
+			countryIndex[k] = i
+		}
+
+		if len(c.Subdivisions) > 0 {
+			idx := map[string]string{}
+			for code, name := range c.Subdivisions {
+				idx[fold(code)] = code
+				idx[fold(c.Code+"-"+code)] = code
+				idx[fold(name)] = code
+			}
+			subdivisionIdx[c.Code] = idx
+		}
+	}
+}
+
+// fold canonicalises a name for matching: upper case, without accents, dots or repeated spaces
+func fold(s string) string {
+	var b strings.Builder
+	space := false
+	for _, r := range strings.TrimSpace(s) {
+		switch {
+		case r == '.':
+			continue
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		}
+		if space && b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		space = false
+		b.WriteRune(unicode.ToUpper(stripAccent(r)))
+	}
+	return b.String()
+}
+
+// stripAccent maps common accented Latin letters to their base letter
+func stripAccent(r rune) rune {
+	switch {
+	case strings.ContainsRune("áàâãäåÁÀÂÃÄÅ", r):
+		return 'a'
+	case strings.ContainsRune("éèêëÉÈÊË", r):
+		return 'e'
+	case strings.ContainsRune("íìîïÍÌÎÏ", r):
+		return 'i'
+	case strings.ContainsRune("óòôõöÓÒÔÕÖ", r):
+		return 'o'
+	case strings.ContainsRune("úùûüÚÙÛÜ", r):
+		return 'u'
+	case r == 'ç' || r == 'Ç':
+		return 'c'
+	case r == 'ñ' || r == 'Ñ':
+		return 'n'
+	}
+	return r
+}
+
+// LookupCountry finds a country by its alpha-2 or alpha-3 code, name or a common alias,
+// ignoring case, accents and dots ("usa", "U.S.A." and "United States" all find US)
+func LookupCountry(s string) (Country, bool) {
+	i, ok := countryIndex[fold(s)]
+	if !ok {
+		return Country{}, false
+	}
+	return countries[i], true
+}
+
+// Countries returns all countries sorted by code
+func Countries() []Country {
+	list := make([]Country, len(countries))
+	copy(list, countries)
+	sort.Slice(list, func(i, j int) bool { return list[i].Code < list[j].Code })
+	return list
+}
+
+// HasSubdivisions reports whether the dataset lists the country's subdivisions
+func (c Country) HasSubdivisions() bool {
+	return len(c.Subdivisions) > 0
+}
+
+// LookupSubdivision finds a subdivision of the country by code ("CA" or "US-CA") or name ("California")
+// and returns its code
+func (c Country) LookupSubdivision(s string) (string, bool) {
+	code, ok := subdivisionIdx[c.Code][fold(s)]
+	return code, ok
+}
+
+// NormalizePostalCode checks a postal code against the country's formats and returns it in the
+// canonical format, e.g. "k1a0b1" becomes "K1A 0B1" in Canada. Countries without formats accept
+// any code, returned upper-cased with spaces collapsed.
+func (c Country) NormalizePostalCode(s string) (string, bool) {
+	if len(c.PostalFormats) == 0 {
+		return strings.Join(strings.Fields(strings.ToUpper(s)), " "), true
+	}
+
+	compact := strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return unicode.ToUpper(r)
+	}, s)
+
+	for _, format := range c.PostalFormats {
+		if out, ok := applyPostalFormat(format, compact); ok {
+			return out, true
+		}
+	}
+	return "", false
+}
+
+// applyPostalFormat fills a format with the characters of a compact code if they fit it
+func applyPostalFormat(format, compact string) (string, bool) {
+	var b strings.Builder
+	chars := []rune(compact)
+	i := 0
+	for _, f := range format {
+		if f == ' ' || f == '-' {
+			b.WriteRune(f)
+			continue
+		}
+		if i >= len(chars) {
+			return "", false
+		}
+		r := chars[i]
+		switch {
+		case f == '#' && r >= '0' && r <= '9',
+			f == '@' && r >= 'A' && r <= 'Z',
+			f == '?' && (r >= '0' && r <= '9' || r >= 'A' && r <= 'Z'):
+			b.WriteRune(r)
+		default:
+			return "", false
+		}
+		i++
+	}
+	if i != len(chars) {
+		return "", false
+	}
+	return b.String(), true
+}
+
+// PostalExample describes the accepted postal code formats, for error messages
+func (c Country) PostalExample() string {
+	return strings.Join(c.PostalFormats, " or ")
+}
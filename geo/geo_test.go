@@ -0,0 +1,182 @@
+package geo
+
+import (
+	"strings"
+	"testing"
+)
+
+// samplePostalCode fills a postal code format with 1 for digits and A for letters
+func samplePostalCode(format string) string {
+	return strings.NewReplacer("#", "1", "@", "A", "?", "A").Replace(format)
+}
+
+func TestLookupCountry(t *testing.T) {
+	for _, tt := range []struct{ in, want string }{
+		{"US", "US"},
+		{"usa", "US"},
+		{"U.S.A.", "US"},
+		{"  united   states ", "US"},
+		{"DEU", "DE"},
+		{"Deutschland", "DE"},
+		{"España", "ES"},
+		{"espana", "ES"},
+		{"UK", "GB"},
+		{"Northern Ireland", "GB"},
+		{"Côte d'Ivoire", "CI"},
+		{"Ivory Coast", "CI"},
+		{"XX", ""},
+		{"", ""},
+		{"Atlantis", ""},
+	} {
+		c, ok := LookupCountry(tt.in)
+		if ok != (tt.want != "") || c.Code != tt.want {
+			t.Errorf("LookupCountry(%q) = %q, %v, want %q", tt.in, c.Code, ok, tt.want)
+		}
+	}
+}
+
+func TestCountries(t *testing.T) {
+	list := Countries()
+	if len(list) < 240 {
+		t.Fatalf("%d countries", len(list))
+	}
+	for i, c := range list {
+		if len(c.Code) != 2 || len(c.Alpha3) != 3 || c.Name == "" {
+			t.Errorf("incomplete country %+v", c)
+		}
+		if i > 0 && list[i-1].Code >= c.Code {
+			t.Errorf("%s listed after %s", c.Code, list[i-1].Code)
+		}
+		for _, key := range append([]string{c.Code, c.Alpha3, c.Name}, c.Aliases...) {
+			if found, _ := LookupCountry(key); found.Code != c.Code {
+				t.Errorf("%q finds %q, want %s", key, found.Code, c.Code)
+			}
+		}
+	}
+}
+
+func TestPostalCodes(t *testing.T) {
+	for _, tt := range []struct {
+		country, in, want string // want is empty for an invalid code
+	}{
+		{"US", "10001", "10001"},
+		{"US", "10001-1234", "10001-1234"},
+		{"US", "100011234", "10001-1234"},
+		{"US", "1000", ""},
+		{"US", "10001-12", ""},
+		{"US", "ABCDE", ""},
+		{"CA", "k1a0b1", "K1A 0B1"},
+		{"CA", "K1A 0B1", "K1A 0B1"},
+		{"CA", "K1A 0B", ""},
+		{"CA", "111 111", ""},
+		{"GB", "sw1a1aa", "SW1A 1AA"},
+		{"GB", "M1 1AE", "M1 1AE"},
+		{"GB", "B33 8TH", "B33 8TH"},
+		{"GB", "CR2 6XH", "CR2 6XH"},
+		{"GB", "DN55 1PT", "DN55 1PT"},
+		{"GB", "W1A 0AX", "W1A 0AX"},
+		{"GB", "SW1A", ""},
+		{"GB", "12345", ""},
+		{"DE", "10115", "10115"},
+		{"DE", "1011", ""},
+		{"NL", "1234ab", "1234 AB"},
+		{"NL", "1234 5A", ""},
+		{"JP", "1000001", "100-0001"},
+		{"JP", "100-0001", "100-0001"},
+		{"JP", "100-001", ""},
+		{"BR", "01310-100", "01310-100"},
+		{"BR", "01310100", "01310-100"},
+		{"BR", "0131-0100", "01310-100"}, // separators are ignored, then the format is applied
+		{"IE", "D02 X285", "D02 X285"},
+		{"IE", "d02x285", "D02 X285"},
+		{"IE", "102 X285", ""},
+		{"AR", "C1425DBU", "C1425DBU"},
+		{"AR", "1425", "1425"},
+		{"AR", "14250", ""},
+		{"PL", "00950", "00-950"},
+		{"PT", "1000-001", "1000-001"},
+		{"SE", "11455", "114 55"},
+		{"AD", "ad500", "AD500"},
+		// Countries without formats accept any code
+		{"HK", "anything  goes", "ANYTHING GOES"},
+		{"AE", "", ""},
+	} {
+		c, ok := LookupCountry(tt.country)
+		if !ok {
+			t.Fatalf("unknown country %s", tt.country)
+		}
+		got, ok := c.NormalizePostalCode(tt.in)
+		valid := tt.want != "" || len(c.PostalFormats) == 0
+		if ok != valid || got != tt.want {
+			t.Errorf("%s %q: got %q, %v, want %q", tt.country, tt.in, got, ok, tt.want)
+		}
+	}
+}
+
+// Every format of every country accepts a code written in it, compact or lower case, and does
+// not fit one character more or less
+func TestEveryPostalFormat(t *testing.T) {
+	for _, c := range Countries() {
+		for _, format := range c.PostalFormats {
+			sample := samplePostalCode(format)
+			compact := strings.NewReplacer(" ", "", "-", "").Replace(strings.ToLower(sample))
+			for _, in := range []string{sample, compact} {
+				if got, ok := c.NormalizePostalCode(in); !ok || got != sample {
+					t.Errorf("%s %s: %q gives %q, %v, want %q", c.Code, format, in, got, ok, sample)
+				}
+			}
+			for _, in := range []string{compact + "1", compact[:len(compact)-1], ""} {
+				if got, ok := applyPostalFormat(format, strings.ToUpper(in)); ok {
+					t.Errorf("%s %s: %q fits as %q", c.Code, format, in, got)
+				}
+			}
+		}
+		if c.PostalExample() != strings.Join(c.PostalFormats, " or ") {
+			t.Errorf("%s: example %q", c.Code, c.PostalExample())
+		}
+	}
+}
+
+func TestSubdivisions(t *testing.T) {
+	for _, tt := range []struct{ country, in, want string }{
+		{"US", "CA", "CA"},
+		{"US", "ca", "CA"},
+		{"US", "US-CA", "CA"},
+		{"US", "California", "CA"},
+		{"US", "new  york", "NY"},
+		{"US", "District of Columbia", "DC"},
+		{"US", "Ontario", ""},
+		{"CA", "Québec", "QC"},
+		{"CA", "quebec", "QC"},
+		{"CA", "CA-ON", "ON"},
+		{"AU", "New South Wales", "NSW"},
+		{"BR", "São Paulo", "SP"},
+		{"MX", "Baja California Sur", "BCS"},
+		{"MX", "BCN", "BCN"},
+		{"DE", "Bayern", ""}, // subdivisions not listed
+	} {
+		c, _ := LookupCountry(tt.country)
+		got, ok := c.LookupSubdivision(tt.in)
+		if ok != (tt.want != "") || got != tt.want {
+			t.Errorf("%s %q: got %q, %v, want %q", tt.country, tt.in, got, ok, tt.want)
+		}
+	}
+}
+
+func TestEverySubdivision(t *testing.T) {
+	for _, c := range Countries() {
+		if c.StateRequired && !c.HasSubdivisions() {
+			t.Errorf("%s requires a state but lists none", c.Code)
+		}
+		for code, name := range c.Subdivisions {
+			for _, in := range []string{code, strings.ToLower(code), c.Code + "-" + code, name, strings.ToUpper(name)} {
+				if got, ok := c.LookupSubdivision(in); !ok || got != code {
+					t.Errorf("%s %q: got %q, %v, want %s", c.Code, in, got, ok, code)
+				}
+			}
+		}
+		if _, ok := c.LookupSubdivision("Nowhere"); ok {
+			t.Errorf("%s has a subdivision Nowhere", c.Code)
+		}
+	}
+}
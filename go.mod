@@ -8,7 +8,9 @@ require github.com/lib/pq v1.10.9
 
 require (
 	github.com/golang-jwt/jwt/v5 v5.2.2
-	github.com/mattn/go-sqlite3 v2.0.3+incompatible
+	github.com/joho/godotenv v1.5.1
+	github.com/mattn/go-sqlite3 v1.14.24
 	golang.org/x/crypto v0.37.0
-	github.com/joho/godotenv v1.5.1 
 )
+
+require gopkg.in/yaml.v3 v3.0.1
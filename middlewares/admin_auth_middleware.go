@@ -3,6 +3,7 @@ package middlewares
 import (
 	"encoding/base64"
 	"go-crud/config"
+	"go-crud/problem"
 	"net/http"
 	"strings"
 )
@@ -13,27 +14,27 @@ func AdminAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		// Extract credentials from Authorization header
 		authHeader := r.Header.Get("Authorization")
 		if authHeader == "" {
-			http.Error(w, "Authorization header is required", http.StatusUnauthorized)
+			problem.Write(w, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization header is required")
 			return
 		}
 
 		// Only accept Basic auth for admin validation
 		if !strings.HasPrefix(authHeader, "Basic ") {
-			http.Error(w, "Authorization header must be Basic authentication", http.StatusUnauthorized)
+			problem.Write(w, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization header must be Basic authentication")
 			return
 		}
 
 		// Extract and decode credentials
 		credentials, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authHeader, "Basic "))
 		if err != nil {
-			http.Error(w, "Invalid Basic Auth format", http.StatusUnauthorized)
+			problem.Write(w, http.StatusUnauthorized, problem.CodeUnauthorized, "Invalid Basic Auth format")
 			return
 		}
 
 		// Split into email and password
 		credParts := strings.SplitN(string(credentials), ":", 2)
 		if len(credParts) != 2 {
-			http.Error(w, "Invalid Basic Auth format", http.StatusUnauthorized)
+			problem.Write(w, http.StatusUnauthorized, problem.CodeUnauthorized, "Invalid Basic Auth format")
 			return
 		}
 
@@ -42,11 +43,25 @@ func AdminAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
 
 		// Validate against environment variables
 		if email != config.AppConfig.DefaultAdminEmail || password != config.AppConfig.DefaultAdminPassword {
-			http.Error(w, "Invalid admin credentials", http.StatusUnauthorized)
+			problem.Write(w, http.StatusUnauthorized, problem.CodeUnauthorized, "Invalid admin credentials")
 			return
 		}
 
 		// Credentials match, proceed to the next handler
 		next(w, r)
 	}
-}
\ No newline at end of file
+}
+
+// IsAdmin reports whether the user authenticated by AuthMiddleware is the admin account
+// configured by DEFAULT_ADMIN_EMAIL
+func IsAdmin(r *http.Request) bool {
+	userID, ok := GetUserID(r)
+	if !ok {
+		return false
+	}
+	user, err := repos.Users.GetByID(userID)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(user.Email, config.AppConfig.DefaultAdminEmail)
+}
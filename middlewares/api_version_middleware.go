@@ -0,0 +1,119 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-crud/problem"
+)
+
+// DefaultAPIVersion serves unprefixed routes, used by clients that predate versioning,
+// unless the Accept header asks for another version
+const DefaultAPIVersion = 1
+
+// APIVersions lists the supported versions, oldest first; each is served under /vN
+var APIVersions = []int{1, 2}
+
+// APIVersionHeader is the response header naming the version that served the request
+const APIVersionHeader = "API-Version"
+
+// apiVersionMediaType is the vendor media type that selects a version, as in
+// "Accept: application/vnd.go-crud.v2+json"
+const apiVersionMediaType = "application/vnd.go-crud.v"
+
+type apiVersionKey struct{}
+
+// APIVersionSource says how the version of a request was chosen, for the request log
+type APIVersionSource string
+
+const (
+	APIVersionFromPath    APIVersionSource = "path"
+	APIVersionFromAccept  APIVersionSource = "accept"
+	APIVersionFromDefault APIVersionSource = "default"
+)
+
+// ResolveAPIVersion returns the API version a request asks for. A /vN path prefix wins;
+// otherwise the Accept header may name one as application/vnd.go-crud.vN+json or with a
+// version parameter (application/json; version=N). An unsupported version is an error.
+func ResolveAPIVersion(r *http.Request) (int, APIVersionSource, error) {
+	if v, ok := pathAPIVersion(r.URL.Path); ok {
+		return v, APIVersionFromPath, nil
+	}
+
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		var version string
+		if strings.HasPrefix(mediaType, apiVersionMediaType) {
+			version = strings.TrimSuffix(strings.TrimPrefix(mediaType, apiVersionMediaType), "+json")
+		} else if params["version"] != "" {
+			version = strings.TrimPrefix(params["version"], "v")
+		} else {
+			continue
+		}
+
+		v, err := strconv.Atoi(version)
+		if err != nil || !supportedAPIVersion(v) {
+			return 0, APIVersionFromAccept, fmt.Errorf("unsupported API version %q in Accept header", version)
+		}
+		return v, APIVersionFromAccept, nil
+	}
+	return DefaultAPIVersion, APIVersionFromDefault, nil
+}
+
+// pathAPIVersion returns N for a path under /vN/
+func pathAPIVersion(path string) (int, bool) {
+	prefix, _, found := strings.Cut(strings.TrimPrefix(path, "/"), "/")
+	if !found || !strings.HasPrefix(prefix, "v") {
+		return 0, false
+	}
+	v, err := strconv.Atoi(prefix[1:])
+	if err != nil || !supportedAPIVersion(v) {
+		return 0, false
+	}
+	return v, true
+}
+
+func supportedAPIVersion(v int) bool {
+	for _, supported := range APIVersions {
+		if v == supported {
+			return true
+		}
+	}
+	return false
+}
+
+// APIVersionMiddleware stores the negotiated API version in the request context and names
+// it in the API-Version response header. Unsupported versions are answered with 406.
+func APIVersionMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		version, source, err := ResolveAPIVersion(r)
+		if err != nil {
+			problem.Write(w, http.StatusNotAcceptable, problem.CodeNotAcceptable,
+				fmt.Sprintf("%v; supported versions are %v", err, APIVersions))
+			return
+		}
+
+		w.Header().Set(APIVersionHeader, strconv.Itoa(version))
+		if source != APIVersionFromPath {
+			w.Header().Add("Vary", "Accept")
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, version)))
+	}
+}
+
+// GetAPIVersion returns the API version of a request, DefaultAPIVersion outside
+// APIVersionMiddleware
+func GetAPIVersion(r *http.Request) int {
+	if v, ok := r.Context().Value(apiVersionKey{}).(int); ok {
+		return v
+	}
+	return DefaultAPIVersion
+}
@@ -0,0 +1,95 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-crud/problem"
+)
+
+func TestResolveAPIVersion(t *testing.T) {
+	for _, tt := range []struct {
+		path, accept string
+		version      int
+		source       APIVersionSource
+		err          bool
+	}{
+		{"/products", "", 1, APIVersionFromDefault, false},
+		{"/products", "application/json", 1, APIVersionFromDefault, false},
+		{"/products", "*/*", 1, APIVersionFromDefault, false},
+		{"/products", "application/vnd.go-crud.v2+json", 2, APIVersionFromAccept, false},
+		{"/products", "application/vnd.go-crud.v1+json", 1, APIVersionFromAccept, false},
+		{"/products", "application/json; version=2", 2, APIVersionFromAccept, false},
+		{"/products", "application/json; version=v2", 2, APIVersionFromAccept, false},
+		{"/products", "text/html, application/vnd.go-crud.v2+json;q=0.9", 2, APIVersionFromAccept, false},
+		{"/products", "not a media type;;, application/vnd.go-crud.v2+json", 2, APIVersionFromAccept, false},
+		{"/v2/products", "", 2, APIVersionFromPath, false},
+		{"/v1/orders/1", "", 1, APIVersionFromPath, false},
+		// The path wins over the Accept header, even an unsupported version in it
+		{"/v1/products", "application/vnd.go-crud.v2+json", 1, APIVersionFromPath, false},
+		{"/v2/products", "application/vnd.go-crud.v9+json", 2, APIVersionFromPath, false},
+		// An unsupported path prefix is just a path
+		{"/v9/products", "", 1, APIVersionFromDefault, false},
+		{"/vendors", "", 1, APIVersionFromDefault, false},
+		{"/products", "application/vnd.go-crud.v3+json", 0, APIVersionFromAccept, true},
+		{"/products", "application/vnd.go-crud.v0+json", 0, APIVersionFromAccept, true},
+		{"/products", "application/vnd.go-crud.vx+json", 0, APIVersionFromAccept, true},
+		{"/products", "application/json; version=3", 0, APIVersionFromAccept, true},
+	} {
+		r := httptest.NewRequest("GET", tt.path, nil)
+		if tt.accept != "" {
+			r.Header.Set("Accept", tt.accept)
+		}
+		version, source, err := ResolveAPIVersion(r)
+		if version != tt.version || source != tt.source || (err != nil) != tt.err {
+			t.Errorf("%s with Accept %q = %d, %s, %v; want %d, %s, error %v", tt.path, tt.accept,
+				version, source, err, tt.version, tt.source, tt.err)
+		}
+	}
+}
+
+func TestAPIVersionMiddleware(t *testing.T) {
+	var served int
+	h := APIVersionMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		served = GetAPIVersion(r)
+	})
+	serve := func(path, accept string) *httptest.ResponseRecorder {
+		served = 0
+		r := httptest.NewRequest("GET", path, nil)
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		h(w, r)
+		return w
+	}
+
+	w := serve("/products", "application/vnd.go-crud.v2+json")
+	if served != 2 || w.Header().Get(APIVersionHeader) != "2" || w.Header().Get("Vary") != "Accept" {
+		t.Errorf("negotiated: served v%d with headers %v", served, w.Header())
+	}
+	w = serve("/products", "")
+	if served != DefaultAPIVersion || w.Header().Get(APIVersionHeader) != "1" || w.Header().Get("Vary") != "Accept" {
+		t.Errorf("default: served v%d with headers %v", served, w.Header())
+	}
+	w = serve("/v2/products", "")
+	if served != 2 || w.Header().Get(APIVersionHeader) != "2" || w.Header().Get("Vary") != "" {
+		t.Errorf("path: served v%d with headers %v", served, w.Header())
+	}
+
+	w = serve("/products", "application/vnd.go-crud.v3+json")
+	var p struct {
+		Code string `json:"code"`
+	}
+	if served != 0 || w.Code != http.StatusNotAcceptable || json.Unmarshal(w.Body.Bytes(), &p) != nil ||
+		p.Code != problem.CodeNotAcceptable {
+		t.Errorf("unsupported version: served v%d, got %d %s", served, w.Code, w.Body)
+	}
+	if w.Header().Get(APIVersionHeader) != "" {
+		t.Errorf("unsupported version answered with %s %s", APIVersionHeader, w.Header().Get(APIVersionHeader))
+	}
+
+	if v := GetAPIVersion(httptest.NewRequest("GET", "/products", nil)); v != DefaultAPIVersion {
+		t.Errorf("GetAPIVersion outside the middleware = %d", v)
+	}
+}
@@ -5,7 +5,7 @@ import (
     "context"
     "encoding/base64"
     "go-crud/auth"
-    "go-crud/models"
+    "go-crud/problem"
     "net/http"
     "strings"
 )
@@ -20,7 +20,7 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
         // Extract token from the Authorization header
         authHeader := r.Header.Get("Authorization")
         if authHeader == "" {
-            http.Error(w, "Authorization header is required", http.StatusUnauthorized)
+            problem.Write(w, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization header is required")
             return
         }
 
@@ -33,7 +33,7 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
             tokenString := strings.TrimPrefix(authHeader, "Bearer ")
             claims, err := auth.ValidateToken(tokenString)
             if err != nil {
-                http.Error(w, "Invalid or expired token: "+err.Error(), http.StatusUnauthorized)
+                problem.Write(w, http.StatusUnauthorized, problem.CodeUnauthorized, "Invalid or expired token")
                 return
             }
             userID = claims.UserID
@@ -42,13 +42,13 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
             // Extract credentials from Basic Auth header
             credentials, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(authHeader, "Basic "))
             if err != nil {
-                http.Error(w, "Invalid Basic Auth format", http.StatusUnauthorized)
+                problem.Write(w, http.StatusUnauthorized, problem.CodeUnauthorized, "Invalid Basic Auth format")
                 return
             }
             
             credParts := strings.SplitN(string(credentials), ":", 2)
             if len(credParts) != 2 {
-                http.Error(w, "Invalid Basic Auth format", http.StatusUnauthorized)
+                problem.Write(w, http.StatusUnauthorized, problem.CodeUnauthorized, "Invalid Basic Auth format")
                 return
             }
             
@@ -56,16 +56,16 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
             password := credParts[1]
             
             // Authenticate user with credentials
-            user, err := models.LoginUser(email, password)
+            user, err := repos.Users.Login(email, password)
             if err != nil {
-                http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+                problem.Write(w, http.StatusUnauthorized, problem.CodeUnauthorized, "Invalid credentials")
                 return
             }
             
             userID = user.ID
             authenticated = true
         } else {
-            http.Error(w, "Authorization header format must be Bearer {token} or Basic {credentials}", http.StatusUnauthorized)
+            problem.Write(w, http.StatusUnauthorized, problem.CodeUnauthorized, "Authorization header format must be Bearer {token} or Basic {credentials}")
             return
         }
 
@@ -76,7 +76,7 @@ func AuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
             return
         }
 
-        http.Error(w, "Authentication failed", http.StatusUnauthorized)
+        problem.Write(w, http.StatusUnauthorized, problem.CodeUnauthorized, "Authentication failed")
     }
 }
 
@@ -113,7 +113,7 @@ func OptionalAuthMiddleware(next http.HandlerFunc) http.HandlerFunc {
                     password := credParts[1]
                     
                     // Authenticate user with credentials
-                    user, err := models.LoginUser(email, password)
+                    user, err := repos.Users.Login(email, password)
                     if err == nil {
                         userID = user.ID
                         authenticated = true
@@ -0,0 +1,37 @@
+package middlewares
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"go-crud/config"
+)
+
+// DeprecatedMiddleware marks a legacy route as deprecated in favour of successor, e.g.
+// "GET /orders/{id}". Responses carry a Deprecation header (RFC 9745) with the date from
+// LEGACY_ROUTES_DEPRECATED and, unless LEGACY_ROUTES_SUNSET is empty, a Sunset header
+// (RFC 8594). The first use of the route is logged so operators can see which clients
+// still need to move.
+func DeprecatedMiddleware(successor string, next http.HandlerFunc) http.HandlerFunc {
+	deprecated := config.AppConfig.LegacyRoutesDeprecated
+	sunset, err := time.Parse("2006-01-02", config.AppConfig.LegacyRoutesSunset)
+	if err != nil && config.AppConfig.LegacyRoutesSunset != "" {
+		log.Printf("Ignoring invalid LEGACY_ROUTES_SUNSET %q: %v", config.AppConfig.LegacyRoutesSunset, err)
+	}
+	var once sync.Once
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		once.Do(func() {
+			log.Printf("Deprecated route %s %s used; use %s", r.Method, r.URL.Path, successor)
+		})
+
+		w.Header().Set("Deprecation", fmt.Sprintf("@%d", deprecated.Unix()))
+		if !sunset.IsZero() {
+			w.Header().Set("Sunset", sunset.Format(http.TimeFormat))
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,49 @@
+package middlewares
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"go-crud/config"
+)
+
+func TestDeprecatedMiddleware(t *testing.T) {
+	log.SetOutput(io.Discard)
+	prevConfig := config.AppConfig
+	t.Cleanup(func() {
+		config.AppConfig = prevConfig
+		log.SetOutput(os.Stderr)
+	})
+	config.AppConfig.LegacyRoutesDeprecated = time.Date(2026, time.March, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, tt := range []struct {
+		sunset, want string // want is the Sunset header
+	}{
+		{"2027-04-30", "Fri, 30 Apr 2027 00:00:00 GMT"},
+		{"", ""},
+		{"30/04/2027", ""}, // invalid dates are ignored
+	} {
+		config.AppConfig.LegacyRoutesSunset = tt.sunset
+		h := DeprecatedMiddleware("GET /orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+		})
+		for i := 0; i < 2; i++ {
+			w := httptest.NewRecorder()
+			h(w, httptest.NewRequest("GET", "/orders/get?id=1", nil))
+			if w.Code != http.StatusTeapot {
+				t.Fatalf("status %d: the route's handler did not run", w.Code)
+			}
+			if got := w.Header().Get("Deprecation"); got != "@1772323200" {
+				t.Errorf("Deprecation %q, want @1772323200", got)
+			}
+			if got := w.Header().Get("Sunset"); got != tt.want {
+				t.Errorf("sunset %q: Sunset %q, want %q", tt.sunset, got, tt.want)
+			}
+		}
+	}
+}
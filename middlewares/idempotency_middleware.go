@@ -0,0 +1,178 @@
+package middlewares
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-crud/config"
+	"go-crud/models"
+	"go-crud/problem"
+	"go-crud/validate"
+)
+
+// IdempotencyKeyHeader is the request header clients use to make retries safe
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// responseRecorder passes the response through while keeping a copy to store
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	rec.status = status
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	rec.body.Write(b)
+	return rec.ResponseWriter.Write(b)
+}
+
+// IdempotencyMiddleware makes mutating requests carrying an Idempotency-Key header safe to retry.
+// The first response is stored per key, caller and route (see idempotencyScope); identical retries
+// replay it, while a retry with a different payload under the same key is rejected.
+func IdempotencyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimSpace(r.Header.Get(IdempotencyKeyHeader))
+		if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next(w, r)
+			return
+		}
+
+		if len(key) > 255 {
+			problem.Write(w, http.StatusBadRequest, problem.CodeInvalidParameter, "Idempotency-Key must be at most 255 characters")
+			return
+		}
+
+		// Read the body so it can be hashed and handed on to the handler
+		body, err := validate.ReadBody(w, r)
+		if err != nil {
+			problem.Error(w, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		scope := idempotencyScope(r)
+		hash := requestHash(r, body)
+
+		err = models.ClaimIdempotencyKey(scope, key, hash, config.AppConfig.IdempotencyTTL)
+		if err == models.ErrIdempotencyKeyExists {
+			replayIdempotentResponse(w, scope, key, hash)
+			return
+		}
+		if err != nil {
+			problem.Error(w, fmt.Errorf("storing idempotency key: %w", err))
+			return
+		}
+
+		rec := &responseRecorder{ResponseWriter: w}
+		next(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		// Server errors are not stored so the client can retry with the same key
+		if rec.status >= http.StatusInternalServerError {
+			if err := models.ReleaseIdempotencyKey(scope, key); err != nil {
+				log.Printf("Error releasing idempotency key %q: %v", key, err)
+			}
+			return
+		}
+
+		err = models.SaveIdempotencyResponse(scope, key, rec.status, storedHeaders(rec.Header()), rec.body.Bytes())
+		if err != nil {
+			log.Printf("Error storing response for idempotency key %q: %v", key, err)
+		}
+	}
+}
+
+func replayIdempotentResponse(w http.ResponseWriter, scope, key, hash string) {
+	stored, err := models.GetIdempotencyRecord(scope, key)
+	if err == sql.ErrNoRows {
+		// The record expired or was released between the claim and this lookup
+		problem.Write(w, http.StatusConflict, problem.CodeIdempotencyConflict, "Request with this Idempotency-Key is being retried, try again")
+		return
+	}
+	if err != nil {
+		problem.Error(w, fmt.Errorf("reading idempotency key: %w", err))
+		return
+	}
+
+	if stored.RequestHash != hash {
+		problem.Write(w, http.StatusUnprocessableEntity, problem.CodeIdempotencyMismatch, "Idempotency-Key was already used with a different request")
+		return
+	}
+
+	if stored.StatusCode == 0 {
+		problem.Write(w, http.StatusConflict, problem.CodeIdempotencyConflict, "A request with this Idempotency-Key is still being processed")
+		return
+	}
+
+	for name, values := range storedHeaders(stored.Headers) {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.Header().Set("Content-Length", strconv.Itoa(len(stored.Body)))
+	w.WriteHeader(stored.StatusCode)
+	w.Write(stored.Body)
+}
+
+// unstoredHeaders are the response headers that belong to each response rather than to the
+// stored one
+var unstoredHeaders = []string{"Content-Length", "Date", "Idempotent-Replayed", problem.RequestIDHeader}
+
+// storedHeaders returns the response headers to store and replay
+func storedHeaders(header http.Header) http.Header {
+	stored := header.Clone()
+	for _, name := range unstoredHeaders {
+		stored.Del(name)
+	}
+	return stored
+}
+
+// idempotencyScope keeps the keys of different callers and endpoints apart. It is the
+// authenticated principal, the user of a token or session or else the Basic Auth account, and
+// the method and route pattern the request matched, as in "user:5 PUT /addresses/{id}".
+func idempotencyScope(r *http.Request) string {
+	principal := "anonymous"
+	if userID, ok := GetUserID(r); ok {
+		principal = "user:" + strconv.Itoa(userID)
+	} else if email, _, ok := r.BasicAuth(); ok {
+		principal = "basic:" + email
+	}
+	return principal + " " + routePattern(r)
+}
+
+// routePattern returns the method and pattern of the route a request matched
+func routePattern(r *http.Request) string {
+	if strings.Contains(r.Pattern, " ") {
+		return r.Pattern
+	}
+	if r.Pattern == "" {
+		return r.Method + " " + r.URL.Path
+	}
+	return r.Method + " " + r.Pattern
+}
+
+// requestHash fingerprints a request within its scope: the route pattern, the path with the IDs
+// the pattern matched, the query in canonical order and the body
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(routePattern(r) + "\n" + r.URL.EscapedPath() + "?" + r.URL.Query().Encode() + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
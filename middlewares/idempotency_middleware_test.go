@@ -0,0 +1,181 @@
+package middlewares
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"go-crud/config"
+	"go-crud/models"
+)
+
+func TestIdempotencyScope(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern string
+		method  string
+		target  string
+		userID  int
+		want    string
+	}{
+		{"admin", "PATCH /orders/{id}", "PATCH", "/orders/2", 0, "basic:admin@example.com PATCH /orders/{id}"},
+		{"other ID on the same route", "PATCH /orders/{id}", "PATCH", "/orders/7", 0, "basic:admin@example.com PATCH /orders/{id}"},
+		{"versioned route", "PATCH /v1/orders/{id}", "PATCH", "/v1/orders/2", 0, "basic:admin@example.com PATCH /v1/orders/{id}"},
+		{"legacy route", "POST /orders/update-status", "POST", "/orders/update-status", 0, "basic:admin@example.com POST /orders/update-status"},
+		{"pattern without method", "/coupons", "POST", "/coupons", 0, "basic:admin@example.com POST /coupons"},
+		{"authenticated user", "PUT /addresses/{id}", "PUT", "/addresses/3", 5, "user:5 PUT /addresses/{id}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			mux := http.NewServeMux()
+			mux.HandleFunc(tt.pattern, func(w http.ResponseWriter, r *http.Request) {
+				got = idempotencyScope(r)
+			})
+			req := httptest.NewRequest(tt.method, tt.target, strings.NewReader(`{"user_id": 9}`))
+			req.SetBasicAuth("admin@example.com", "secret")
+			if tt.userID > 0 {
+				req = req.WithContext(context.WithValue(req.Context(), UserIDKey, tt.userID))
+			}
+			mux.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("scope = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	anonymous := httptest.NewRequest("POST", "/auth/register", nil)
+	if got := idempotencyScope(anonymous); got != "anonymous POST /auth/register" {
+		t.Errorf("scope without credentials = %q", got)
+	}
+}
+
+// useIdempotencyDatabase points models.DB at a migrated SQLite database for the test
+func useIdempotencyDatabase(t *testing.T) {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	prevDB, prevDriver, prevTTL := models.DB, models.Driver, config.AppConfig.IdempotencyTTL
+	db, err := models.Open(models.DriverSQLite, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	models.DB = db
+	config.AppConfig.IdempotencyTTL = time.Hour
+	t.Cleanup(func() {
+		db.Close()
+		models.DB, models.Driver, config.AppConfig.IdempotencyTTL = prevDB, prevDriver, prevTTL
+		log.SetOutput(os.Stderr)
+	})
+	if _, err := models.MigrateUp(0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// idempotentServer serves routes behind IdempotencyMiddleware whose handlers count their calls
+// and answer 201 with a Location header, or with status when it is set
+type idempotentServer struct {
+	mux    *http.ServeMux
+	calls  int
+	status int
+}
+
+func newIdempotentServer(patterns ...string) *idempotentServer {
+	s := &idempotentServer{mux: http.NewServeMux()}
+	for _, pattern := range patterns {
+		s.mux.HandleFunc(pattern, IdempotencyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+			s.calls++
+			if s.status != 0 {
+				w.WriteHeader(s.status)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Location", fmt.Sprintf("/things/%d", s.calls))
+			w.WriteHeader(http.StatusCreated)
+			fmt.Fprintf(w, `{"id": %d}`, s.calls)
+		}))
+	}
+	return s
+}
+
+func (s *idempotentServer) do(method, target, user, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.SetBasicAuth(user, "secret")
+	req.Header.Set(IdempotencyKeyHeader, key)
+	w := httptest.NewRecorder()
+	s.mux.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyMiddlewareReplays(t *testing.T) {
+	useIdempotencyDatabase(t)
+	s := newIdempotentServer("POST /orders", "POST /roles")
+
+	first := s.do("POST", "/orders?a=1&b=2", "admin@example.com", "k1", `{"user_id": 1}`)
+	if first.Code != http.StatusCreated || first.Header().Get("Location") != "/things/1" {
+		t.Fatalf("first request: %d, Location %q", first.Code, first.Header().Get("Location"))
+	}
+
+	// The query in another order is the same request
+	retry := s.do("POST", "/orders?b=2&a=1", "admin@example.com", "k1", `{"user_id": 1}`)
+	if s.calls != 1 || retry.Code != http.StatusCreated || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("retry: %d calls, status %d, replayed %q", s.calls, retry.Code, retry.Header().Get("Idempotent-Replayed"))
+	}
+	for _, name := range []string{"Location", "Content-Type"} {
+		if got, want := retry.Header().Get(name), first.Header().Get(name); got != want {
+			t.Errorf("replayed %s %q, want %q", name, got, want)
+		}
+	}
+	if retry.Body.String() != first.Body.String() {
+		t.Errorf("replayed body %s, want %s", retry.Body, first.Body)
+	}
+
+	// Whatever the body names, the key belongs to the caller and route
+	if w := s.do("POST", "/orders?a=1&b=2", "admin@example.com", "k1", `{"user_id": 2}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("same key, other body: %d, want 422", w.Code)
+	}
+	if w := s.do("POST", "/orders?a=1&b=2", "ops@example.com", "k1", `{"user_id": 1}`); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("same key, other caller: %d, replayed %q", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+	if w := s.do("POST", "/roles", "admin@example.com", "k1", `{"user_id": 1}`); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("same key, other route: %d, replayed %q", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+	if s.calls != 3 {
+		t.Errorf("handlers ran %d times, want 3", s.calls)
+	}
+}
+
+func TestIdempotencyMiddlewareKeysAResource(t *testing.T) {
+	useIdempotencyDatabase(t)
+	s := newIdempotentServer("PATCH /orders/{id}")
+
+	s.do("PATCH", "/orders/1", "admin@example.com", "k1", `{"status": "paid"}`)
+	if w := s.do("PATCH", "/orders/2", "admin@example.com", "k1", `{"status": "paid"}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("same key on another order: %d, want 422", w.Code)
+	}
+	if s.calls != 1 {
+		t.Errorf("handler ran %d times, want 1", s.calls)
+	}
+}
+
+func TestIdempotencyMiddlewareForgetsServerErrors(t *testing.T) {
+	useIdempotencyDatabase(t)
+	s := newIdempotentServer("POST /orders")
+
+	s.status = http.StatusInternalServerError
+	s.do("POST", "/orders", "admin@example.com", "k1", `{}`)
+	s.status = 0
+	if w := s.do("POST", "/orders", "admin@example.com", "k1", `{}`); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("retry after a server error: %d, replayed %q", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+	if s.calls != 2 {
+		t.Errorf("handler ran %d times, want 2", s.calls)
+	}
+}
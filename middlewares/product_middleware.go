@@ -6,8 +6,8 @@ import (
 	"log"
 	"net/http"
 	"strconv"
-	"strings"
 	"go-crud/models"
+	"go-crud/problem"
 )
 
 type ProductWithStatus struct {
@@ -23,6 +23,35 @@ type PaginatedProducts struct {
 	TotalPages  int                 `json:"total_pages"`
 	PerPage     int                 `json:"per_page"`
 	Filters     map[string]string   `json:"filters,omitempty"`
+	
+	found []models.Product // the full products, for V2
+}
+
+// PaginatedProductsV2 is the version 2 products page, whose products keep their price,
+// weight, category, stock and timestamps
+type PaginatedProductsV2 struct {
+	Products    []models.Product  `json:"products"`
+	TotalCount  int               `json:"total_count"`
+	CurrentPage int               `json:"current_page"`
+	TotalPages  int               `json:"total_pages"`
+	PerPage     int               `json:"per_page"`
+	Filters     map[string]string `json:"filters,omitempty"`
+}
+
+// V2 returns the page in its version 2 shape
+func (p PaginatedProducts) V2() PaginatedProductsV2 {
+	products := p.found
+	if products == nil {
+		products = []models.Product{}
+	}
+	return PaginatedProductsV2{
+		Products:    products,
+		TotalCount:  p.TotalCount,
+		CurrentPage: p.CurrentPage,
+		TotalPages:  p.TotalPages,
+		PerPage:     p.PerPage,
+		Filters:     p.Filters,
+	}
 }
 
 // FilterParams stores the filter parameters
@@ -80,7 +109,7 @@ func ProductMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		// Get filtered products with pagination
 		paginatedProducts, err := GetFilteredProducts(page, perPage, filters)
 		if err != nil {
-			http.Error(w, "Error fetching products: "+err.Error(), http.StatusInternalServerError)
+			problem.Error(w, fmt.Errorf("fetching products: %w", err))
 			return
 		}
 
@@ -96,44 +125,23 @@ func ProductMiddleware(next http.HandlerFunc) http.HandlerFunc {
 func GetFilteredProducts(page, perPage int, filters FilterParams) (PaginatedProducts, error) {
 	offset := (page - 1) * perPage
 	
-	// Build WHERE clause based on filters
-	whereClause, args := buildWhereClause(filters)
-	
-	// Count total products after filtering
-	var totalCount int
-	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM products %s", whereClause)
-	if err := models.DB.QueryRow(countQuery, args...).Scan(&totalCount); err != nil {
+	// Get filtered and paginated products, and the total count after filtering
+	found, totalCount, err := repos.Products.Filter(models.ProductFilter{
+		Name:   filters.Name,
+		Status: filters.Status,
+		MinID:  filters.MinID,
+		MaxID:  filters.MaxID,
+	}, perPage, offset)
+	if err != nil {
 		return PaginatedProducts{}, err
 	}
 
 	// Calculate total pages
 	totalPages := (totalCount + perPage - 1) / perPage
 
-	// Query for filtered and paginated products
-	query := fmt.Sprintf(`
-		SELECT p.id, p.name, p.status
-		FROM products p
-		%s
-		ORDER BY p.id
-		LIMIT ? OFFSET ?
-	`, whereClause)
-	
-	// Add pagination parameters to args
-	queryArgs := append(args, perPage, offset)
-	
-	rows, err := models.DB.Query(query, queryArgs...)
-	if err != nil {
-		return PaginatedProducts{}, err
-	}
-	defer rows.Close()
-
 	var products []ProductWithStatus
-	for rows.Next() {
-		var p ProductWithStatus
-		if err := rows.Scan(&p.ID, &p.Name, &p.Status); err != nil {
-			return PaginatedProducts{}, err
-		}
-		products = append(products, p)
+	for _, p := range found {
+		products = append(products, ProductWithStatus{ID: p.ID, Name: p.Name, Status: p.Status})
 	}
 	
 	// Create filters map for response
@@ -158,37 +166,6 @@ func GetFilteredProducts(page, perPage int, filters FilterParams) (PaginatedProd
 		TotalPages:  totalPages,
 		PerPage:     perPage,
 		Filters:     filtersMap,
+		found:       found,
 	}, nil
 }
-
-// buildWhereClause constructs SQL WHERE clause and arguments based on filters
-func buildWhereClause(filters FilterParams) (string, []interface{}) {
-	var conditions []string
-	var args []interface{}
-	
-	if filters.Name != "" {
-		conditions = append(conditions, "LOWER(name) LIKE LOWER(?)")
-		args = append(args, "%"+filters.Name+"%")
-	}
-	
-	if filters.Status != "" {
-		conditions = append(conditions, "status = ?")
-		args = append(args, filters.Status)
-	}
-	
-	if filters.MinID > 0 {
-		conditions = append(conditions, "id >= ?")
-		args = append(args, filters.MinID)
-	}
-	
-	if filters.MaxID > 0 {
-		conditions = append(conditions, "id <= ?")
-		args = append(args, filters.MaxID)
-	}
-	
-	if len(conditions) > 0 {
-		return "WHERE " + strings.Join(conditions, " AND "), args
-	}
-	
-	return "", args
-}
\ No newline at end of file
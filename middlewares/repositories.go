@@ -0,0 +1,12 @@
+package middlewares
+
+import "go-crud/models"
+
+// repos holds the repositories the middlewares read through
+var repos = models.SQLRepositories()
+
+// UseRepositories replaces the repositories the middlewares use, e.g. with the in-memory
+// fakes of package memory in tests
+func UseRepositories(r models.Repositories) {
+	repos = r
+}
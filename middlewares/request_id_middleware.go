@@ -0,0 +1,53 @@
+package middlewares
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"go-crud/problem"
+)
+
+type requestIDKey struct{}
+
+// RequestIDMiddleware gives every request an ID, names it in the X-Request-ID response header
+// and stores it in the request context. A client's own X-Request-ID is kept if it is a short
+// token, so a request can be followed across services; otherwise a random one is made.
+// Error responses and the request log quote the ID.
+func RequestIDMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(problem.RequestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(problem.RequestIDHeader, id)
+		next(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	}
+}
+
+// GetRequestID returns the ID of a request, or "" outside RequestIDMiddleware
+func GetRequestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID accepts up to 64 letters, digits, dashes, underscores and dots
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 64 {
+		return false
+	}
+	for _, c := range id {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
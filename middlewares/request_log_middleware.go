@@ -0,0 +1,50 @@
+package middlewares
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// statusWriter records the status code of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+// RequestLogMiddleware logs every request with its status, duration and the API version it
+// was served with, and how that version was chosen (path, accept or default), so the use of
+// each version and of unversioned routes can be followed from the log. The request ID ties
+// the line to errors logged while handling it.
+func RequestLogMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next(sw, r)
+
+		if sw.status == 0 {
+			sw.status = http.StatusOK
+		}
+		api := "unsupported"
+		if version, source, err := ResolveAPIVersion(r); err == nil {
+			api = "v" + strconv.Itoa(version) + " (" + string(source) + ")"
+		}
+		log.Printf("%s %s %d %s api=%s id=%s", r.Method, r.URL.RequestURI(), sw.status,
+			time.Since(start).Round(time.Microsecond), api, GetRequestID(r))
+	}
+}
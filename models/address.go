@@ -1,139 +1,255 @@
 package models
 
 import (
+	"database/sql"
 	"errors"
 	"time"
 )
 
+// Address types. A "both" address can be used for shipping and billing.
+const (
+	AddressUseShipping = "shipping"
+	AddressUseBilling  = "billing"
+	AddressUseBoth     = "both"
+)
+
 type Address struct {
-	ID          int       `json:"id"`
-	UserID      int       `json:"user_id"`
-	StreetLine1 string    `json:"street_line1"`
-	StreetLine2 string    `json:"street_line2"`
-	City        string    `json:"city"`
-	State       string    `json:"state"`
-	PostalCode  string    `json:"postal_code"`
-	Country     string    `json:"country"`
-	IsDefault   bool      `json:"is_default"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID                int       `json:"id"`
+	UserID            int       `json:"user_id"`
+	Type              string    `json:"type"` // shipping, billing or both
+	StreetLine1       string    `json:"street_line1"`
+	StreetLine2       string    `json:"street_line2"`
+	City              string    `json:"city"`
+	State             string    `json:"state"`
+	PostalCode        string    `json:"postal_code"`
+	Country           string    `json:"country"`
+	IsDefault         bool      `json:"is_default"` // default for every type the address has; on reads, default for any type
+	IsDefaultShipping bool      `json:"is_default_shipping"`
+	IsDefaultBilling  bool      `json:"is_default_billing"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// ShipsTo reports whether the address can be used as a shipping address
+func (a Address) ShipsTo() bool {
+	return a.Type == AddressUseShipping || a.Type == AddressUseBoth
+}
+
+// Bills reports whether the address can be used as a billing address
+func (a Address) Bills() bool {
+	return a.Type == AddressUseBilling || a.Type == AddressUseBoth
+}
+
+const addressColumns = `id, user_id, type, street_line1, street_line2, city, state, postal_code, country, 
+		       is_default_shipping, is_default_billing, created_at, updated_at`
+
+func scanAddress(row rowScanner) (Address, error) {
+	var a Address
+	err := row.Scan(&a.ID, &a.UserID, &a.Type, &a.StreetLine1, &a.StreetLine2, &a.City, &a.State,
+		&a.PostalCode, &a.Country, &a.IsDefaultShipping, &a.IsDefaultBilling, &a.CreatedAt, &a.UpdatedAt)
+	a.IsDefault = a.IsDefaultShipping || a.IsDefaultBilling
+	return a, err
+}
+
+func scanAddresses(rows *sql.Rows) ([]Address, error) {
+	defer rows.Close()
+	
+	var addresses []Address
+	for rows.Next() {
+		a, err := scanAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, a)
+	}
+	return addresses, rows.Err()
 }
 
 // Get all addresses with optional limit
 func GetAddresses(limit int) ([]Address, error) {
 	rows, err := DB.Query(`
-		SELECT id, user_id, street_line1, street_line2, city, state, postal_code, country, 
-		       is_default, created_at, updated_at
+		SELECT `+addressColumns+`
 		FROM addresses
 		ORDER BY id
 		LIMIT ?`, limit)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	
-	var addresses []Address
-	for rows.Next() {
-		var a Address
-		if err := rows.Scan(&a.ID, &a.UserID, &a.StreetLine1, &a.StreetLine2, &a.City, 
-				&a.State, &a.PostalCode, &a.Country, &a.IsDefault, &a.CreatedAt, &a.UpdatedAt); err != nil {
-			return nil, err
-		}
-		addresses = append(addresses, a)
-	}
-	return addresses, nil
+	return scanAddresses(rows)
 }
 
 // Get address by ID
 func GetAddressByID(id int) (Address, error) {
-	var address Address
-	err := DB.QueryRow(`
-		SELECT id, user_id, street_line1, street_line2, city, state, postal_code, country, 
-		       is_default, created_at, updated_at
+	return getAddress(DB, id)
+}
+
+func getAddress(q queryRower, id int) (Address, error) {
+	return scanAddress(q.QueryRow(`
+		SELECT `+addressColumns+`
 		FROM addresses 
-		WHERE id = ?`, id).Scan(
-		&address.ID, &address.UserID, &address.StreetLine1, &address.StreetLine2, &address.City,
-		&address.State, &address.PostalCode, &address.Country, &address.IsDefault, 
-		&address.CreatedAt, &address.UpdatedAt)
-	
-	if err != nil {
-		return address, err
-	}
-	
-	return address, nil
+		WHERE id = ?`, id))
 }
 
-// Get addresses by user ID
+// Get addresses by user ID, defaults first
 func GetAddressesByUserID(userID int) ([]Address, error) {
 	rows, err := DB.Query(`
-		SELECT id, user_id, street_line1, street_line2, city, state, postal_code, country, 
-		       is_default, created_at, updated_at
+		SELECT `+addressColumns+`
 		FROM addresses
 		WHERE user_id = ?
-		ORDER BY is_default DESC, id ASC`, userID)
+		ORDER BY (is_default_shipping OR is_default_billing) DESC, id ASC`, userID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-	
-	var addresses []Address
-	for rows.Next() {
-		var a Address
-		if err := rows.Scan(&a.ID, &a.UserID, &a.StreetLine1, &a.StreetLine2, &a.City, 
-				&a.State, &a.PostalCode, &a.Country, &a.IsDefault, &a.CreatedAt, &a.UpdatedAt); err != nil {
-			return nil, err
-		}
-		addresses = append(addresses, a)
+	return scanAddresses(rows)
+}
+
+// GetDefaultAddress returns a user's default address of a type (shipping or billing),
+// or sql.ErrNoRows if the user has none
+func GetDefaultAddress(userID int, addressType string) (Address, error) {
+	column := "is_default_shipping"
+	if addressType == AddressUseBilling {
+		column = "is_default_billing"
+	}
+	return scanAddress(DB.QueryRow(`
+		SELECT `+addressColumns+`
+		FROM addresses
+		WHERE user_id = ? AND `+column+` = TRUE`, userID))
+}
+
+// resolveDefaults works out which defaults the address should hold. IsDefault makes it the default
+// for every type it has; asking for a default of a type the address does not have is an error.
+func (a *Address) resolveDefaults() error {
+	verr := &ValidationError{}
+	if a.IsDefaultShipping && !a.ShipsTo() {
+		verr.add("is_default_shipping", FieldInvalid, "a billing address cannot be the default shipping address")
+	}
+	if a.IsDefaultBilling && !a.Bills() {
+		verr.add("is_default_billing", FieldInvalid, "a shipping address cannot be the default billing address")
+	}
+	if a.IsDefault {
+		a.IsDefaultShipping = a.IsDefaultShipping || a.ShipsTo()
+		a.IsDefaultBilling = a.IsDefaultBilling || a.Bills()
 	}
-	return addresses, nil
+	a.IsDefault = a.IsDefaultShipping || a.IsDefaultBilling
+	return verr.err()
 }
 
-// Create a new address
-func CreateAddress(userID int, streetLine1, streetLine2, city, state, postalCode, country string, isDefault bool) (int, error) {
-	// If this is a default address, unset default flag on other addresses for this user
-	if isDefault {
-		_, err := DB.Exec("UPDATE addresses SET is_default = 0 WHERE user_id = ?", userID)
+// clearDefaults takes the requested defaults away from the user's other addresses, so the
+// partial unique indexes on the default flags accept the new default
+func clearDefaults(tx *sql.Tx, a Address) error {
+	if a.IsDefaultShipping {
+		_, err := tx.Exec(`
+			UPDATE addresses SET is_default_shipping = FALSE, is_default = is_default_billing
+			WHERE user_id = ? AND id != ? AND is_default_shipping = TRUE`, a.UserID, a.ID)
 		if err != nil {
-			return 0, err
+			return err
+		}
+	}
+	if a.IsDefaultBilling {
+		_, err := tx.Exec(`
+			UPDATE addresses SET is_default_billing = FALSE, is_default = is_default_shipping
+			WHERE user_id = ? AND id != ? AND is_default_billing = TRUE`, a.UserID, a.ID)
+		if err != nil {
+			return err
 		}
 	}
+	return nil
+}
+
+// Create a new address. The address is normalized first; invalid fields are returned as a *ValidationError.
+// Making it a default replaces the user's previous default of that type in the same transaction.
+func CreateAddress(a Address) (int, error) {
+	if err := NormalizeAddress(&a); err != nil {
+		return 0, err
+	}
+	if err := a.resolveDefaults(); err != nil {
+		return 0, err
+	}
 	
-	result, err := DB.Exec(`
-		INSERT INTO addresses (user_id, street_line1, street_line2, city, state, postal_code, country, is_default, created_at, updated_at) 
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
-		userID, streetLine1, streetLine2, city, state, postalCode, country, isDefault)
+	tx, err := DB.Begin()
 	if err != nil {
 		return 0, err
 	}
+	defer tx.Rollback()
+	
+	if err := clearDefaults(tx, a); err != nil {
+		return 0, err
+	}
 	
-	id, err := result.LastInsertId()
-	return int(id), err
+	id, err := insertID(tx, `
+		INSERT INTO addresses (user_id, type, street_line1, street_line2, city, state, postal_code, country,
+		                       is_default, is_default_shipping, is_default_billing, created_at, updated_at) 
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
+		a.UserID, a.Type, a.StreetLine1, a.StreetLine2, a.City, a.State, a.PostalCode, a.Country,
+		a.IsDefault, a.IsDefaultShipping, a.IsDefaultBilling)
+	if isUniqueViolation(err) {
+		return 0, ErrAddressDefaultConflict
+	}
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
 }
 
-// Update an existing address
-func UpdateAddress(id, userID int, streetLine1, streetLine2, city, state, postalCode, country string, isDefault bool) error {
-	// If this is a default address, unset default flag on other addresses for this user
-	if isDefault {
-		_, err := DB.Exec("UPDATE addresses SET is_default = 0 WHERE user_id = ? AND id != ?", userID, id)
-		if err != nil {
-			return err
-		}
+// Update an existing address. The address is normalized first; invalid fields are returned as a *ValidationError.
+// It returns sql.ErrNoRows if the user has no such address.
+func UpdateAddress(a Address) error {
+	if err := NormalizeAddress(&a); err != nil {
+		return err
+	}
+	if err := a.resolveDefaults(); err != nil {
+		return err
 	}
 	
-	_, err := DB.Exec(`
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	
+	if err := clearDefaults(tx, a); err != nil {
+		return err
+	}
+	
+	result, err := tx.Exec(`
 		UPDATE addresses 
-		SET street_line1 = ?, street_line2 = ?, city = ?, state = ?, postal_code = ?, country = ?, 
-		    is_default = ?, updated_at = CURRENT_TIMESTAMP
+		SET type = ?, street_line1 = ?, street_line2 = ?, city = ?, state = ?, postal_code = ?, country = ?, 
+		    is_default = ?, is_default_shipping = ?, is_default_billing = ?, updated_at = CURRENT_TIMESTAMP
 		WHERE id = ? AND user_id = ?`,
-		streetLine1, streetLine2, city, state, postalCode, country, isDefault, id, userID)
-	return err
+		a.Type, a.StreetLine1, a.StreetLine2, a.City, a.State, a.PostalCode, a.Country,
+		a.IsDefault, a.IsDefaultShipping, a.IsDefaultBilling, a.ID, a.UserID)
+	if isUniqueViolation(err) {
+		return ErrAddressDefaultConflict
+	}
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	
+	return tx.Commit()
 }
 
-// Delete an address
+// Delete an address. Orders keep their own copy of the address, so they only lose the link to it.
 func DeleteAddress(id, userID int) error {
-	// Check if the address is referenced by any orders
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	
+	// Orders without a snapshot of the address still depend on it
 	var count int
-	err := DB.QueryRow("SELECT COUNT(*) FROM orders WHERE address_id = ?", id).Scan(&count)
+	err = tx.QueryRow(`
+		SELECT COUNT(*) FROM orders o
+		WHERE o.address_id = ?
+		  AND NOT EXISTS (SELECT 1 FROM order_addresses oa WHERE oa.order_id = o.id AND oa.type = ?)`,
+		id, AddressTypeShipping).Scan(&count)
 	if err != nil {
 		return err
 	}
@@ -142,9 +258,35 @@ func DeleteAddress(id, userID int) error {
 		return ErrAddressInUse
 	}
 	
-	_, err = DB.Exec("DELETE FROM addresses WHERE id = ? AND user_id = ?", id, userID)
-	return err
+	result, err := tx.Exec("DELETE FROM addresses WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return nil // nothing to delete for this user
+	}
+	
+	_, err = tx.Exec("UPDATE orders SET address_id = NULL WHERE address_id = ?", id)
+	if err != nil {
+		return err
+	}
+	
+	_, err = tx.Exec("UPDATE order_addresses SET source_address_id = NULL WHERE source_address_id = ?", id)
+	if err != nil {
+		return err
+	}
+	
+	return tx.Commit()
 }
 
-// Custom error
-var ErrAddressInUse = errors.New("address is in use by one or more orders")
\ No newline at end of file
+// Custom errors
+var (
+	ErrAddressInUse = errors.New("address is in use by one or more orders")
+	// ErrAddressDefaultConflict is returned when a concurrent request made another address the
+	// default of the same type first; the partial unique indexes allow only one
+	ErrAddressDefaultConflict = errors.New("another address was made the default at the same time")
+)
\ No newline at end of file
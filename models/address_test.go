@@ -0,0 +1,173 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// testAddress returns a valid German address of a type for a user
+func testAddress(userID int, addressType, street string) Address {
+	return Address{UserID: userID, Type: addressType, StreetLine1: street, City: "Berlin", Country: "DE", PostalCode: "10115"}
+}
+
+// defaultAddressIDs returns the IDs of a user's default shipping and billing addresses, 0 for none
+func defaultAddressIDs(t *testing.T, userID int) [2]int {
+	t.Helper()
+	var ids [2]int
+	for i, addressType := range []string{AddressUseShipping, AddressUseBilling} {
+		a, err := GetDefaultAddress(userID, addressType)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = a.ID
+	}
+	return ids
+}
+
+func TestAddressDefaults(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		userID, otherID := createTestUser(t), createTestUser(t)
+		create := func(a Address) int {
+			t.Helper()
+			id, err := CreateAddress(a)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return id
+		}
+
+		home := testAddress(userID, AddressUseBoth, "1 Home St")
+		home.IsDefault = true
+		homeID := create(home)
+		if got, want := defaultAddressIDs(t, userID), [2]int{homeID, homeID}; got != want {
+			t.Fatalf("defaults %v, want %v", got, want)
+		}
+
+		// A new default shipping address takes only that default away from the old one
+		work := testAddress(userID, AddressUseShipping, "2 Work St")
+		work.IsDefault = true
+		workID := create(work)
+		if got, want := defaultAddressIDs(t, userID), [2]int{workID, homeID}; got != want {
+			t.Fatalf("defaults %v, want %v", got, want)
+		}
+		stored, err := GetAddressByID(homeID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if stored.IsDefaultShipping || !stored.IsDefaultBilling || !stored.IsDefault {
+			t.Errorf("old default has shipping %v, billing %v, default %v", stored.IsDefaultShipping,
+				stored.IsDefaultBilling, stored.IsDefault)
+		}
+
+		// Another user's defaults are left alone
+		other := testAddress(otherID, AddressUseBoth, "3 Other St")
+		other.IsDefault = true
+		otherAddressID := create(other)
+		if got := defaultAddressIDs(t, userID); got != [2]int{workID, homeID} {
+			t.Errorf("defaults %v after another user's default", got)
+		}
+
+		// Updating an address to a default moves it the same way
+		home.ID, home.IsDefault, home.IsDefaultShipping = homeID, false, true
+		if err := UpdateAddress(home); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := defaultAddressIDs(t, userID), [2]int{homeID, 0}; got != want {
+			t.Errorf("defaults %v after the update, want %v", got, want)
+		}
+		if got := defaultAddressIDs(t, otherID); got != [2]int{otherAddressID, otherAddressID} {
+			t.Errorf("other user's defaults %v", got)
+		}
+	})
+}
+
+func TestAddressDefaultOfAMissingType(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		userID := createTestUser(t)
+
+		billing := testAddress(userID, AddressUseBilling, "1 Bill St")
+		billing.IsDefaultShipping = true
+		_, err := CreateAddress(billing)
+		if got, want := validationCodes(t, err), []string{"is_default_shipping: invalid"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("errors %v, want %v", got, want)
+		}
+
+		// IsDefault only covers the types the address has
+		billing.IsDefaultShipping, billing.IsDefault = false, true
+		id, err := CreateAddress(billing)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := defaultAddressIDs(t, userID), [2]int{0, id}; got != want {
+			t.Errorf("defaults %v, want %v", got, want)
+		}
+	})
+}
+
+// raceDefaultAddress makes the database insert a competing default address for the user just
+// before an address on "9 Race St" is written, as a concurrent request would between
+// clearDefaults and the write
+func raceDefaultAddress(t *testing.T) {
+	t.Helper()
+	competitor := `INSERT INTO addresses (user_id, type, street_line1, street_line2, city, state, postal_code, country,
+	                                      is_default, is_default_shipping, is_default_billing, created_at, updated_at)
+		VALUES (NEW.user_id, 'both', '1 Competing St', '', 'Berlin', '', '10115', 'DE', TRUE, TRUE, TRUE,
+		        CURRENT_TIMESTAMP, CURRENT_TIMESTAMP);`
+	if isPostgres() {
+		mustExec(t, `CREATE FUNCTION race_default_address() RETURNS trigger AS $$
+			BEGIN
+				IF NEW.street_line1 = '9 Race St' THEN `+competitor+` END IF;
+				RETURN NEW;
+			END $$ LANGUAGE plpgsql`)
+		mustExec(t, `CREATE TRIGGER race_default_address BEFORE INSERT OR UPDATE ON addresses
+			FOR EACH ROW EXECUTE FUNCTION race_default_address()`)
+		return
+	}
+	for _, event := range []string{"INSERT", "UPDATE"} {
+		mustExec(t, `CREATE TRIGGER race_default_address_`+event+` BEFORE `+event+` ON addresses
+			WHEN NEW.street_line1 = '9 Race St'
+			BEGIN `+competitor+` END`)
+	}
+}
+
+func TestAddressDefaultRace(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		raceDefaultAddress(t)
+		userID := createTestUser(t)
+
+		a := testAddress(userID, AddressUseShipping, "9 Race St")
+		a.IsDefault = true
+		if _, err := CreateAddress(a); !errors.Is(err, ErrAddressDefaultConflict) {
+			t.Fatalf("creating: got %v, want ErrAddressDefaultConflict", err)
+		}
+
+		id, err := CreateAddress(testAddress(userID, AddressUseShipping, "2 Quiet St"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		a.ID = id
+		if err := UpdateAddress(a); !errors.Is(err, ErrAddressDefaultConflict) {
+			t.Fatalf("updating: got %v, want ErrAddressDefaultConflict", err)
+		}
+
+		// Both writes were rolled back, the competing default included
+		addresses, err := GetAddressesByUserID(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addresses) != 1 || addresses[0].StreetLine1 != "2 Quiet St" || addresses[0].IsDefault {
+			t.Errorf("addresses %+v", addresses)
+		}
+
+		// Without the default, the address is written
+		a.IsDefault = false
+		if err := UpdateAddress(a); err != nil {
+			t.Errorf("updating without the default: %v", err)
+		}
+	})
+}
@@ -0,0 +1,183 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"go-crud/geo"
+)
+
+// Field validation error codes
+const (
+	FieldRequired       = "required"
+	FieldInvalid        = "invalid"
+	FieldUnknownCountry = "unknown_country"
+	FieldUnknownState   = "unknown_state"
+	FieldInvalidPostal  = "invalid_postal_code"
+	FieldUnknown        = "unknown_field"
+
+	FieldInsufficientStock = "insufficient_stock"
+)
+
+// FieldError is a validation failure of one request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every invalid field of a request
+type ValidationError struct {
+	Fields []FieldError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		messages[i] = f.Message
+	}
+	return "validation failed: " + strings.Join(messages, "; ")
+}
+
+func (e *ValidationError) add(field, code, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Code: code, Message: message})
+}
+
+// err returns the error if any field failed, or nil
+func (e *ValidationError) err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+// cleanText trims a free-text field and collapses runs of whitespace
+func cleanText(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// NormalizeAddress validates an address against the rules of its country and rewrites it in
+// canonical form: the country as its ISO 3166-1 alpha-2 code, the state as its ISO 3166-2
+// subdivision code where the country's subdivisions are known, and the postal code in the
+// country's format. It returns a *ValidationError listing every invalid field.
+func NormalizeAddress(a *Address) error {
+	verr := &ValidationError{}
+
+	a.StreetLine1 = cleanText(a.StreetLine1)
+	a.StreetLine2 = cleanText(a.StreetLine2)
+	a.City = cleanText(a.City)
+	a.State = cleanText(a.State)
+	a.PostalCode = cleanText(a.PostalCode)
+
+	if a.UserID == 0 {
+		verr.add("user_id", FieldRequired, "user ID is required")
+	}
+	switch a.Type = strings.ToLower(strings.TrimSpace(a.Type)); a.Type {
+	case "":
+		a.Type = AddressUseBoth
+	case AddressUseShipping, AddressUseBilling, AddressUseBoth:
+	default:
+		verr.add("type", FieldInvalid, fmt.Sprintf("type must be %s, %s or %s", AddressUseShipping, AddressUseBilling, AddressUseBoth))
+	}
+	if a.StreetLine1 == "" {
+		verr.add("street_line1", FieldRequired, "street address is required")
+	}
+	if a.City == "" {
+		verr.add("city", FieldRequired, "city is required")
+	}
+
+	if strings.TrimSpace(a.Country) == "" {
+		verr.add("country", FieldRequired, "country is required")
+		return verr
+	}
+	country, ok := geo.LookupCountry(a.Country)
+	if !ok {
+		verr.add("country", FieldUnknownCountry, fmt.Sprintf("%q is not a known country; use an ISO 3166 code such as US", a.Country))
+		return verr
+	}
+	a.Country = country.Code
+
+	switch {
+	case a.State == "" && country.StateRequired:
+		verr.add("state", FieldRequired, fmt.Sprintf("state is required for %s", country.Name))
+	case a.State != "" && country.HasSubdivisions():
+		code, ok := country.LookupSubdivision(a.State)
+		if !ok {
+			verr.add("state", FieldUnknownState, fmt.Sprintf("%q is not a state or province of %s", a.State, country.Name))
+		} else {
+			a.State = code
+		}
+	}
+
+	switch {
+	case a.PostalCode == "" && len(country.PostalFormats) > 0:
+		verr.add("postal_code", FieldRequired, fmt.Sprintf("postal code is required for %s", country.Name))
+	case a.PostalCode != "":
+		postal, ok := country.NormalizePostalCode(a.PostalCode)
+		if !ok {
+			verr.add("postal_code", FieldInvalidPostal, fmt.Sprintf("%q is not a valid postal code for %s (expected %s)",
+				a.PostalCode, country.Name, country.PostalExample()))
+		} else {
+			a.PostalCode = postal
+		}
+	}
+
+	return verr.err()
+}
+
+// normalizeRegion converts a country and state to their codes where they are recognised,
+// leaving unknown values as they are
+func normalizeRegion(country, state string) (string, string) {
+	c, ok := geo.LookupCountry(country)
+	if !ok {
+		return country, state
+	}
+	if code, ok := c.LookupSubdivision(state); ok {
+		return c.Code, code
+	}
+	return c.Code, state
+}
+
+// normalizeStoredRegions rewrites countries and states saved before addresses were normalized,
+// e.g. "USA" / "New York" becomes "US" / "NY", so they match tax rates and new addresses
+func normalizeStoredRegions() error {
+	for _, table := range []string{"addresses", "tax_rates"} {
+		rows, err := DB.Query("SELECT DISTINCT country, state FROM " + table)
+		if err != nil {
+			return err
+		}
+		type region struct{ country, state string }
+		var changes [][2]region
+		for rows.Next() {
+			var r region
+			if err := rows.Scan(&r.country, &r.state); err != nil {
+				rows.Close()
+				return err
+			}
+			country, state := normalizeRegion(r.country, r.state)
+			if country != r.country || state != r.state {
+				changes = append(changes, [2]region{r, {country, state}})
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// Skip a tax rate that would duplicate one already stored under the code
+		query := "UPDATE " + table + " SET country = ?, state = ? WHERE country = ? AND state = ?"
+		if table == "tax_rates" {
+			query += " AND NOT EXISTS (SELECT 1 FROM tax_rates t WHERE t.country = ? AND t.state = ?)"
+		}
+		for _, c := range changes {
+			args := []interface{}{c[1].country, c[1].state, c[0].country, c[0].state}
+			if table == "tax_rates" {
+				args = append(args, c[1].country, c[1].state)
+			}
+			if _, err := DB.Exec(query, args...); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
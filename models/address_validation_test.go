@@ -0,0 +1,168 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"go-crud/geo"
+)
+
+// validationCodes returns the field: code pairs of a *ValidationError, sorted, or nil for nil
+func validationCodes(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("got %v, want a *ValidationError", err)
+	}
+	var codes []string
+	for _, f := range verr.Fields {
+		codes = append(codes, f.Field+": "+f.Code)
+	}
+	sort.Strings(codes)
+	return codes
+}
+
+func TestNormalizeAddress(t *testing.T) {
+	tests := []struct {
+		name                   string
+		country, state, postal string
+		want                   Address  // Country, State and PostalCode after normalizing
+		errors                 []string // sorted field: code pairs
+	}{
+		{"US", "usa", "new york", "10001", Address{Country: "US", State: "NY", PostalCode: "10001"}, nil},
+		{"US ZIP+4", "United States", "CA", "941031234", Address{Country: "US", State: "CA", PostalCode: "94103-1234"}, nil},
+		{"US without state", "US", "", "10001", Address{}, []string{"state: required"}},
+		{"US unknown state", "US", "Ontario", "10001", Address{}, []string{"state: unknown_state"}},
+		{"US bad ZIP", "US", "NY", "1000", Address{}, []string{"postal_code: invalid_postal_code"}},
+		{"US without ZIP", "US", "NY", "", Address{}, []string{"postal_code: required"}},
+		{"CA", "Canada", "Québec", "h2x 1y4", Address{Country: "CA", State: "QC", PostalCode: "H2X 1Y4"}, nil},
+		{"CA US ZIP", "CA", "ON", "10001", Address{}, []string{"postal_code: invalid_postal_code"}},
+		{"AU", "AUS", "New South Wales", "2000", Address{Country: "AU", State: "NSW", PostalCode: "2000"}, nil},
+		{"BR", "Brasil", "São Paulo", "01310100", Address{Country: "BR", State: "SP", PostalCode: "01310-100"}, nil},
+		{"MX", "Mexico", "Jalisco", "44100", Address{Country: "MX", State: "JAL", PostalCode: "44100"}, nil},
+		{"MX without state", "MX", "", "44100", Address{}, []string{"state: required"}},
+		{"GB", "UK", "", "sw1a 1aa", Address{Country: "GB", PostalCode: "SW1A 1AA"}, nil},
+		{"GB with any region", "GB", "Greater London", "SW1A1AA", Address{Country: "GB", State: "Greater London", PostalCode: "SW1A 1AA"}, nil},
+		{"GB bad postcode", "GB", "", "SW1A", Address{}, []string{"postal_code: invalid_postal_code"}},
+		{"DE", "Deutschland", "", "10115", Address{Country: "DE", PostalCode: "10115"}, nil},
+		{"NL", "NL", "", "1234ab", Address{Country: "NL", PostalCode: "1234 AB"}, nil},
+		{"JP", "Japan", "", "1000001", Address{Country: "JP", PostalCode: "100-0001"}, nil},
+		{"HK without postal code", "Hong Kong", "", "", Address{Country: "HK"}, nil},
+		{"AE with any postal code", "UAE", "", " po box  12 ", Address{Country: "AE", PostalCode: "PO BOX 12"}, nil},
+		{"unknown country", "Atlantis", "", "1", Address{}, []string{"country: unknown_country"}},
+		{"no country", "", "NY", "10001", Address{}, []string{"country: required"}},
+		{"several mistakes", "US", "Texas?", "ABCDE", Address{}, []string{"postal_code: invalid_postal_code", "state: unknown_state"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := Address{UserID: 1, StreetLine1: "1 Main St", City: "Springfield",
+				Country: tt.country, State: tt.state, PostalCode: tt.postal}
+			err := NormalizeAddress(&a)
+			if got := validationCodes(t, err); !reflect.DeepEqual(got, tt.errors) {
+				t.Fatalf("errors %v, want %v", got, tt.errors)
+			}
+			if err == nil && (a.Country != tt.want.Country || a.State != tt.want.State || a.PostalCode != tt.want.PostalCode) {
+				t.Errorf("normalized to %q %q %q, want %q %q %q", a.Country, a.State, a.PostalCode,
+					tt.want.Country, tt.want.State, tt.want.PostalCode)
+			}
+		})
+	}
+}
+
+func TestNormalizeAddressFields(t *testing.T) {
+	a := Address{Type: " Shipping ", StreetLine1: "  1   Main St ", StreetLine2: "\tApt  2", City: " Springfield ",
+		Country: "US", State: "il", PostalCode: "62701"}
+	err := NormalizeAddress(&a)
+	if got, want := validationCodes(t, err), []string{"user_id: required"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("errors %v, want %v", got, want)
+	}
+	if a.Type != AddressUseShipping || a.StreetLine1 != "1 Main St" || a.StreetLine2 != "Apt 2" || a.City != "Springfield" {
+		t.Errorf("cleaned to %+v", a)
+	}
+
+	a = Address{UserID: 1, Type: "home", Country: "DE", PostalCode: "10115"}
+	want := []string{"city: required", "street_line1: required", "type: invalid"}
+	if got := validationCodes(t, NormalizeAddress(&a)); !reflect.DeepEqual(got, want) {
+		t.Errorf("errors %v, want %v", got, want)
+	}
+
+	a = Address{UserID: 1, StreetLine1: "1 Main St", City: "Berlin", Country: "DE", PostalCode: "10115"}
+	if err := NormalizeAddress(&a); err != nil || a.Type != AddressUseBoth {
+		t.Errorf("address without type: %v, type %q", err, a.Type)
+	}
+}
+
+// Every country accepts an address in each of its postal formats and with each of its listed
+// subdivisions, and rejects a postal code in none of its formats
+func TestNormalizeAddressForEveryCountry(t *testing.T) {
+	sample := strings.NewReplacer("#", "1", "@", "A", "?", "A")
+	for _, c := range geo.Countries() {
+		var states []string
+		for code := range c.Subdivisions {
+			states = append(states, code)
+		}
+		if len(states) == 0 {
+			states = []string{""}
+		}
+		postals := []string{""}
+		if len(c.PostalFormats) > 0 {
+			postals = nil
+			for _, format := range c.PostalFormats {
+				postals = append(postals, sample.Replace(format))
+			}
+		}
+
+		for _, state := range states {
+			for _, postal := range postals {
+				a := Address{UserID: 1, StreetLine1: "1 Main St", City: "Capital", Country: strings.ToLower(c.Alpha3),
+					State: c.Subdivisions[state], PostalCode: postal}
+				if err := NormalizeAddress(&a); err != nil {
+					t.Errorf("%s %q %q: %v", c.Code, state, postal, err)
+					continue
+				}
+				if a.Country != c.Code || a.State != state || a.PostalCode != postal {
+					t.Errorf("%s: normalized to %q %q %q", c.Code, a.Country, a.State, a.PostalCode)
+				}
+			}
+		}
+
+		if len(c.PostalFormats) > 0 {
+			a := Address{UserID: 1, StreetLine1: "1 Main St", City: "Capital", Country: c.Code,
+				State: states[0], PostalCode: "1234567890AB"}
+			if got, want := validationCodes(t, NormalizeAddress(&a)), []string{"postal_code: invalid_postal_code"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("%s with postal code %q: errors %v, want %v", c.Code, a.PostalCode, got, want)
+			}
+		}
+		if c.HasSubdivisions() {
+			a := Address{UserID: 1, StreetLine1: "1 Main St", City: "Capital", Country: c.Code,
+				State: "Nowhere", PostalCode: postals[0]}
+			if got, want := validationCodes(t, NormalizeAddress(&a)), []string{"state: unknown_state"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("%s with state Nowhere: errors %v, want %v", c.Code, got, want)
+			}
+		}
+	}
+}
+
+func TestNormalizeRegion(t *testing.T) {
+	for _, tt := range []struct{ country, state, wantCountry, wantState string }{
+		{"USA", "New York", "US", "NY"},
+		{"us", "ny", "US", "NY"},
+		{"Canada", "", "CA", ""},
+		{"Germany", "Bayern", "DE", "Bayern"}, // subdivisions not listed
+		{"US", "Nowhere", "US", "Nowhere"},
+		{"Atlantis", "North", "Atlantis", "North"},
+	} {
+		country, state := normalizeRegion(tt.country, tt.state)
+		if country != tt.wantCountry || state != tt.wantState {
+			t.Errorf("normalizeRegion(%q, %q) = %q, %q, want %q, %q", tt.country, tt.state, country, state,
+				tt.wantCountry, tt.wantState)
+		}
+	}
+}
@@ -0,0 +1,512 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Coupon types
+const (
+	CouponPercent      = "percent"
+	CouponFixed        = "fixed"
+	CouponFreeShipping = "free_shipping"
+)
+
+type Coupon struct {
+	ID            int        `json:"id"`
+	Code          string     `json:"code"`
+	Type          string     `json:"type"`
+	Value         float64    `json:"value"` // percentage for percent coupons, amount for fixed coupons
+	StartsAt      *time.Time `json:"starts_at,omitempty"`
+	EndsAt        *time.Time `json:"ends_at,omitempty"`
+	MinOrderValue float64    `json:"min_order_value"`
+	UsageLimit    int        `json:"usage_limit"`    // 0 means unlimited
+	PerUserLimit  int        `json:"per_user_limit"` // 0 means unlimited
+	TimesUsed     int        `json:"times_used"`
+	Active        bool       `json:"active"`
+	ProductIDs    []int      `json:"product_ids,omitempty"` // restrict the coupon to these products
+	Categories    []string   `json:"categories,omitempty"`  // restrict the coupon to these product categories
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+type CouponRedemption struct {
+	ID        int       `json:"id"`
+	CouponID  int       `json:"coupon_id"`
+	Code      string    `json:"code"`
+	UserID    int       `json:"user_id"`
+	OrderID   int       `json:"order_id"`
+	Amount    float64   `json:"amount"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// CouponReport summarises the redemptions of a coupon
+type CouponReport struct {
+	CouponID      int     `json:"coupon_id"`
+	Code          string  `json:"code"`
+	Redemptions   int     `json:"redemptions"`
+	UniqueUsers   int     `json:"unique_users"`
+	TotalDiscount float64 `json:"total_discount"`
+}
+
+// Coupon errors
+var (
+	ErrCouponNotFound      = errors.New("coupon not found")
+	ErrCouponInactive      = errors.New("coupon is not active")
+	ErrCouponNotStarted    = errors.New("coupon is not valid yet")
+	ErrCouponExpired       = errors.New("coupon has expired")
+	ErrCouponMinOrder      = errors.New("order total is below the coupon minimum")
+	ErrCouponUsageLimit    = errors.New("coupon usage limit reached")
+	ErrCouponUserLimit     = errors.New("coupon already used the maximum number of times by this user")
+	ErrCouponNotApplicable = errors.New("coupon does not apply to any item in the order")
+	ErrCouponExists        = errors.New("coupon with this code already exists")
+)
+
+const couponColumns = `id, code, type, value, starts_at, ends_at, min_order_value, usage_limit,
+		       per_user_limit, times_used, active, created_at, updated_at`
+
+func scanCoupon(row rowScanner) (Coupon, error) {
+	var c Coupon
+	var startsAt, endsAt sql.NullTime
+	err := row.Scan(&c.ID, &c.Code, &c.Type, &c.Value, &startsAt, &endsAt, &c.MinOrderValue, &c.UsageLimit,
+		&c.PerUserLimit, &c.TimesUsed, &c.Active, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return c, err
+	}
+	if startsAt.Valid {
+		c.StartsAt = &startsAt.Time
+	}
+	if endsAt.Valid {
+		c.EndsAt = &endsAt.Time
+	}
+	return c, nil
+}
+
+// NormalizeCouponCode returns the canonical form of a coupon code
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// GetCoupons returns all coupons with optional limit
+func GetCoupons(limit int) ([]Coupon, error) {
+	rows, err := DB.Query(`SELECT `+couponColumns+` FROM coupons ORDER BY id LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var coupons []Coupon
+	for rows.Next() {
+		c, err := scanCoupon(rows)
+		if err != nil {
+			return nil, err
+		}
+		coupons = append(coupons, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range coupons {
+		if err := loadCouponRestrictions(&coupons[i]); err != nil {
+			return nil, err
+		}
+	}
+	return coupons, nil
+}
+
+// GetCouponByID returns a coupon with its restrictions
+func GetCouponByID(id int) (Coupon, error) {
+	c, err := scanCoupon(DB.QueryRow(`SELECT `+couponColumns+` FROM coupons WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return c, ErrCouponNotFound
+	}
+	if err != nil {
+		return c, err
+	}
+	return c, loadCouponRestrictions(&c)
+}
+
+// GetCouponByCode returns a coupon with its restrictions by its (case-insensitive) code
+func GetCouponByCode(code string) (Coupon, error) {
+	c, err := scanCoupon(DB.QueryRow(`SELECT `+couponColumns+` FROM coupons WHERE code = ?`, NormalizeCouponCode(code)))
+	if err == sql.ErrNoRows {
+		return c, ErrCouponNotFound
+	}
+	if err != nil {
+		return c, err
+	}
+	return c, loadCouponRestrictions(&c)
+}
+
+func loadCouponRestrictions(c *Coupon) error {
+	rows, err := DB.Query(`
+		SELECT product_id, category
+		FROM coupon_restrictions
+		WHERE coupon_id = ?
+		ORDER BY id`, c.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	c.ProductIDs = nil
+	c.Categories = nil
+	for rows.Next() {
+		var productID sql.NullInt64
+		var category sql.NullString
+		if err := rows.Scan(&productID, &category); err != nil {
+			return err
+		}
+		if productID.Valid {
+			c.ProductIDs = append(c.ProductIDs, int(productID.Int64))
+		}
+		if category.Valid {
+			c.Categories = append(c.Categories, category.String)
+		}
+	}
+	return rows.Err()
+}
+
+func saveCouponRestrictions(tx *sql.Tx, c Coupon) error {
+	if _, err := tx.Exec("DELETE FROM coupon_restrictions WHERE coupon_id = ?", c.ID); err != nil {
+		return err
+	}
+	for _, productID := range c.ProductIDs {
+		if _, err := tx.Exec("INSERT INTO coupon_restrictions (coupon_id, product_id) VALUES (?, ?)", c.ID, productID); err != nil {
+			return err
+		}
+	}
+	for _, category := range c.Categories {
+		if _, err := tx.Exec("INSERT INTO coupon_restrictions (coupon_id, category) VALUES (?, ?)", c.ID, category); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateCoupon creates a coupon and its restrictions
+func CreateCoupon(c Coupon) (int, error) {
+	c.Code = NormalizeCouponCode(c.Code)
+
+	var exists int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM coupons WHERE code = ?", c.Code).Scan(&exists); err != nil {
+		return 0, err
+	}
+	if exists > 0 {
+		return 0, ErrCouponExists
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := insertID(tx, `
+		INSERT INTO coupons (code, type, value, starts_at, ends_at, min_order_value, usage_limit, per_user_limit,
+		                     active, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
+		c.Code, c.Type, c.Value, c.StartsAt, c.EndsAt, c.MinOrderValue, c.UsageLimit, c.PerUserLimit, c.Active)
+	if err != nil {
+		return 0, err
+	}
+	c.ID = id
+
+	if err := saveCouponRestrictions(tx, c); err != nil {
+		return 0, err
+	}
+	return c.ID, tx.Commit()
+}
+
+// UpdateCoupon updates a coupon and replaces its restrictions
+func UpdateCoupon(c Coupon) error {
+	c.Code = NormalizeCouponCode(c.Code)
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE coupons
+		SET code = ?, type = ?, value = ?, starts_at = ?, ends_at = ?, min_order_value = ?, usage_limit = ?,
+		    per_user_limit = ?, active = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		c.Code, c.Type, c.Value, c.StartsAt, c.EndsAt, c.MinOrderValue, c.UsageLimit, c.PerUserLimit, c.Active, c.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrCouponNotFound
+	}
+
+	if err := saveCouponRestrictions(tx, c); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteCoupon deletes a coupon that has never been redeemed, or deactivates it otherwise
+// so that existing orders keep their redemption history
+func DeleteCoupon(id int) error {
+	var redemptions int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM coupon_redemptions WHERE coupon_id = ?", id).Scan(&redemptions); err != nil {
+		return err
+	}
+
+	if redemptions > 0 {
+		_, err := DB.Exec("UPDATE coupons SET active = FALSE, updated_at = CURRENT_TIMESTAMP WHERE id = ?", id)
+		return err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM coupon_restrictions WHERE coupon_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM coupons WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Validate checks that the coupon can be used by the user on an order with the given items
+func (c Coupon) Validate(userID int, items []OrderItem, now time.Time) error {
+	if !c.Active {
+		return ErrCouponInactive
+	}
+	if c.StartsAt != nil && now.Before(*c.StartsAt) {
+		return ErrCouponNotStarted
+	}
+	if c.EndsAt != nil && !now.Before(*c.EndsAt) {
+		return ErrCouponExpired
+	}
+	if c.UsageLimit > 0 && c.TimesUsed >= c.UsageLimit {
+		return ErrCouponUsageLimit
+	}
+
+	var subtotal float64
+	for _, item := range items {
+		subtotal += item.Price * float64(item.Quantity)
+	}
+	if roundMoney(subtotal) < c.MinOrderValue {
+		return ErrCouponMinOrder
+	}
+
+	if c.eligibleSubtotal(items) <= 0 && c.Type != CouponFreeShipping {
+		return ErrCouponNotApplicable
+	}
+
+	if c.PerUserLimit > 0 {
+		used, err := countUserRedemptions(DB, c.ID, userID)
+		if err != nil {
+			return err
+		}
+		if used >= c.PerUserLimit {
+			return ErrCouponUserLimit
+		}
+	}
+	return nil
+}
+
+// appliesTo reports whether the coupon's product/category restrictions cover an item
+func (c Coupon) appliesTo(item OrderItem) bool {
+	if len(c.ProductIDs) == 0 && len(c.Categories) == 0 {
+		return true
+	}
+	for _, id := range c.ProductIDs {
+		if id == item.ProductID {
+			return true
+		}
+	}
+	for _, category := range c.Categories {
+		if item.Product.Category != "" && strings.EqualFold(category, item.Product.Category) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c Coupon) eligibleSubtotal(items []OrderItem) float64 {
+	var subtotal float64
+	for _, item := range items {
+		if c.appliesTo(item) {
+			subtotal += item.Price * float64(item.Quantity)
+		}
+	}
+	return roundMoney(subtotal)
+}
+
+// Discount makes a coupon usable as a DiscountCalculator
+func (c Coupon) Discount(ctx *PricingContext) ([]OrderAdjustment, error) {
+	eligible := c.eligibleSubtotal(ctx.Items)
+
+	switch c.Type {
+	case CouponPercent:
+		return PercentageDiscount{Code: c.Code, Percent: c.Value}.Discount(&PricingContext{Subtotal: eligible})
+	case CouponFixed:
+		lines, err := FixedDiscount{Code: c.Code, Amount: c.Value}.Discount(ctx)
+		for i := range lines {
+			if lines[i].Amount > eligible {
+				lines[i].Amount = eligible
+			}
+		}
+		return lines, err
+	case CouponFreeShipping:
+		ctx.FreeShippingCode = c.Code
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown coupon type %q", c.Type)
+}
+
+type queryRower interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func countUserRedemptions(q queryRower, couponID, userID int) (int, error) {
+	var used int
+	err := q.QueryRow("SELECT COUNT(*) FROM coupon_redemptions WHERE coupon_id = ? AND user_id = ?",
+		couponID, userID).Scan(&used)
+	return used, err
+}
+
+// redeemCoupon records the use of a coupon inside the order transaction.
+// The usage limits are re-checked against the database so concurrent orders cannot overspend a coupon:
+// the coupon row is locked first, so orders redeeming the same coupon count its redemptions one at a time.
+func redeemCoupon(tx *sql.Tx, c Coupon, userID, orderID int, amount float64) error {
+	if err := lockCoupon(tx, c.ID); err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		UPDATE coupons
+		SET times_used = times_used + 1, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND active = TRUE AND (usage_limit = 0 OR times_used < usage_limit)`, c.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrCouponUsageLimit
+	}
+
+	if c.PerUserLimit > 0 {
+		used, err := countUserRedemptions(tx, c.ID, userID)
+		if err != nil {
+			return err
+		}
+		if used >= c.PerUserLimit {
+			return ErrCouponUserLimit
+		}
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO coupon_redemptions (coupon_id, user_id, order_id, amount)
+		VALUES (?, ?, ?, ?)`, c.ID, userID, orderID, amount)
+	return err
+}
+
+// lockCoupon locks a coupon row until the transaction ends. PostgreSQL takes a row lock with
+// SELECT ... FOR UPDATE; SQLite has no row locks, so there a no-op UPDATE takes the database write
+// lock, which a deferred transaction otherwise only takes at its first write.
+func lockCoupon(tx *sql.Tx, id int) error {
+	if isPostgres() {
+		var locked int
+		err := tx.QueryRow("SELECT id FROM coupons WHERE id = ? FOR UPDATE", id).Scan(&locked)
+		if err == sql.ErrNoRows {
+			return ErrCouponNotFound
+		}
+		return err
+	}
+	_, err := tx.Exec("UPDATE coupons SET id = id WHERE id = ?", id)
+	return err
+}
+
+// releaseCoupons removes the redemptions of an order, e.g. when the order is deleted
+func releaseCoupons(tx *sql.Tx, orderID int) error {
+	_, err := tx.Exec(`
+		UPDATE coupons
+		SET times_used = times_used - 1
+		WHERE id IN (SELECT coupon_id FROM coupon_redemptions WHERE order_id = ?) AND times_used > 0`, orderID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM coupon_redemptions WHERE order_id = ?", orderID)
+	return err
+}
+
+// getOrderCoupon returns the coupon redeemed on an order, if any
+func getOrderCoupon(orderID int) (*Coupon, error) {
+	var couponID int
+	err := DB.QueryRow("SELECT coupon_id FROM coupon_redemptions WHERE order_id = ? LIMIT 1", orderID).Scan(&couponID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := GetCouponByID(couponID)
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// GetCouponRedemptions returns the redemptions of a coupon, newest first
+func GetCouponRedemptions(couponID int, limit int) ([]CouponRedemption, error) {
+	rows, err := DB.Query(`
+		SELECT r.id, r.coupon_id, c.code, r.user_id, r.order_id, r.amount, r.created_at
+		FROM coupon_redemptions r
+		JOIN coupons c ON c.id = r.coupon_id
+		WHERE r.coupon_id = ?
+		ORDER BY r.created_at DESC, r.id DESC
+		LIMIT ?`, couponID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var redemptions []CouponRedemption
+	for rows.Next() {
+		var r CouponRedemption
+		if err := rows.Scan(&r.ID, &r.CouponID, &r.Code, &r.UserID, &r.OrderID, &r.Amount, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		redemptions = append(redemptions, r)
+	}
+	return redemptions, rows.Err()
+}
+
+// GetCouponReport summarises redemptions per coupon
+func GetCouponReport() ([]CouponReport, error) {
+	rows, err := DB.Query(`
+		SELECT c.id, c.code, COUNT(r.id), COUNT(DISTINCT r.user_id), COALESCE(SUM(r.amount), 0)
+		FROM coupons c
+		LEFT JOIN coupon_redemptions r ON r.coupon_id = c.id
+		GROUP BY c.id, c.code
+		ORDER BY c.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []CouponReport
+	for rows.Next() {
+		var r CouponReport
+		if err := rows.Scan(&r.CouponID, &r.Code, &r.Redemptions, &r.UniqueUsers, &r.TotalDiscount); err != nil {
+			return nil, err
+		}
+		r.TotalDiscount = roundMoney(r.TotalDiscount)
+		reports = append(reports, r)
+	}
+	return reports, rows.Err()
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestRedeemCouponPerUserLimit(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		userID := createTestUser(t)
+		productID := createTestProduct(t, 50, 100)
+		couponID, err := CreateCoupon(Coupon{Code: "once", Type: CouponFixed, Value: 5, PerUserLimit: 1, Active: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		coupon, err := GetCouponByID(couponID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		redeem := func(orderID int) error {
+			userID, err := GetOrderUserID(orderID)
+			if err != nil {
+				return err
+			}
+			tx, err := DB.Begin()
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+			if err := redeemCoupon(tx, coupon, userID, orderID, 5); err != nil {
+				return err
+			}
+			return tx.Commit()
+		}
+
+		if err := redeem(createTestOrder(t, userID, productID, 1)); err != nil {
+			t.Fatalf("first redemption: %v", err)
+		}
+		if err := redeem(createTestOrder(t, userID, productID, 1)); !errors.Is(err, ErrCouponUserLimit) {
+			t.Fatalf("second redemption: got %v, want %v", err, ErrCouponUserLimit)
+		}
+
+		otherUser := createTestUser(t)
+		if err := redeem(createTestOrder(t, otherUser, productID, 1)); err != nil {
+			t.Fatalf("redemption by another user: %v", err)
+		}
+	})
+}
+
+func TestRedeemCouponConcurrently(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		userID := createTestUser(t)
+		productID := createTestProduct(t, 50, 100)
+		couponID, err := CreateCoupon(Coupon{Code: "race", Type: CouponFixed, Value: 5, PerUserLimit: 1, Active: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		coupon, err := GetCouponByID(couponID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		const attempts = 8
+		orders := make([]int, attempts)
+		for i := range orders {
+			orders[i] = createTestOrder(t, userID, productID, 1)
+		}
+
+		// Every attempt either redeems the coupon or fails; SQLite may fail one with "database is
+		// locked" rather than wait, but no two may both succeed
+		var wg sync.WaitGroup
+		for _, orderID := range orders {
+			wg.Add(1)
+			go func(orderID int) {
+				defer wg.Done()
+				tx, err := DB.Begin()
+				if err != nil {
+					return
+				}
+				defer tx.Rollback()
+				if redeemCoupon(tx, coupon, userID, orderID, 5) == nil {
+					tx.Commit()
+				}
+			}(orderID)
+		}
+		wg.Wait()
+
+		var redemptions int
+		if err := DB.QueryRow("SELECT COUNT(*) FROM coupon_redemptions WHERE coupon_id = ?", couponID).Scan(&redemptions); err != nil {
+			t.Fatal(err)
+		}
+		if redemptions > 1 {
+			t.Fatalf("coupon redeemed %d times by one user, limit is 1", redemptions)
+		}
+	})
+}
+
+func TestCancellingAnOrderReleasesItsCoupon(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		userID := createTestUser(t)
+		productID := createTestProduct(t, 50, 100)
+		couponID, err := CreateCoupon(Coupon{Code: "single", Type: CouponFixed, Value: 5, UsageLimit: 1, PerUserLimit: 1, Active: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		place := func() (int, error) {
+			return PlaceOrder(OrderRequest{UserID: userID, CouponCode: "single", Items: []ItemRequest{{ProductID: productID, Quantity: 1}}})
+		}
+		timesUsed := func() int {
+			t.Helper()
+			c, err := GetCouponByID(couponID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return c.TimesUsed
+		}
+
+		first, err := place()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := place(); !errors.Is(err, ErrCouponUsageLimit) && !errors.Is(err, ErrCouponUserLimit) {
+			t.Fatalf("redeeming a used-up coupon: %v", err)
+		}
+
+		if err := UpdateOrderStatus(first, OrderStatusCancelled); err != nil {
+			t.Fatal(err)
+		}
+		if n := timesUsed(); n != 0 {
+			t.Fatalf("coupon used %d times after its order was cancelled", n)
+		}
+		second, err := place()
+		if err != nil {
+			t.Fatalf("redeeming the coupon of a cancelled order: %v", err)
+		}
+
+		// A batch cancellation releases it too
+		if _, err := BatchUpdateOrderStatus([]int{second}, OrderStatusCancelled, true); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := place(); err != nil {
+			t.Fatalf("redeeming the coupon of a batch-cancelled order: %v", err)
+		}
+		if n := timesUsed(); n != 1 {
+			t.Errorf("coupon used %d times, want 1", n)
+		}
+	})
+}
@@ -0,0 +1,235 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/mattn/go-sqlite3"
+)
+
+// Supported database drivers
+const (
+	DriverSQLite   = "sqlite3"
+	DriverPostgres = "postgres"
+)
+
+// Driver is the driver of the open database. Queries are written for SQLite with "?"
+// placeholders; the few statements that differ between the databases check it.
+var Driver = DriverSQLite
+
+// Open connects to a SQLite or PostgreSQL database and sets Driver. For SQLite the DSN is
+// the database file; for PostgreSQL it is a lib/pq connection string or URL.
+func Open(driverName, dsn string) (*sql.DB, error) {
+	switch strings.ToLower(driverName) {
+	case "", "sqlite", DriverSQLite:
+		Driver = DriverSQLite
+		return sql.Open(DriverSQLite, dsn)
+	case DriverPostgres, "postgresql":
+		connector, err := pq.NewConnector(dsn)
+		if err != nil {
+			return nil, err
+		}
+		Driver = DriverPostgres
+		return sql.OpenDB(rebindConnector{connector}), nil
+	}
+	return nil, fmt.Errorf("unsupported DB_DRIVER %q (use %s or %s)", driverName, DriverSQLite, DriverPostgres)
+}
+
+// isPostgres reports whether the open database is PostgreSQL
+func isPostgres() bool {
+	return Driver == DriverPostgres
+}
+
+// ddl rewrites SQLite table definitions for the open database
+func ddl(s string) string {
+	if !isPostgres() {
+		return s
+	}
+	return strings.NewReplacer(
+		"INTEGER PRIMARY KEY AUTOINCREMENT", "SERIAL PRIMARY KEY",
+		" REAL", " DOUBLE PRECISION",
+		" BLOB", " BYTEA",
+		" DATETIME", " TIMESTAMP",
+	).Replace(s)
+}
+
+// tableExists reports whether a table exists in the open database
+func tableExists(table string) (bool, error) {
+	query := "SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?"
+	if isPostgres() {
+		query = "SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = ?"
+	}
+	var n int
+	err := DB.QueryRow(query, table).Scan(&n)
+	return n > 0, err
+}
+
+// SchemaExists reports whether the database has been initialized
+func SchemaExists() (bool, error) {
+	return tableExists("users")
+}
+
+// columnExists reports whether a table has a column in the open database
+func columnExists(table, column string) (bool, error) {
+	query := "SELECT COUNT(*) FROM pragma_table_info(?) WHERE name = ?"
+	if isPostgres() {
+		query = "SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = ? AND column_name = ?"
+	}
+	var n int
+	err := DB.QueryRow(query, table, column).Scan(&n)
+	return n > 0, err
+}
+
+type inserter interface {
+	execer
+	queryRower
+}
+
+// insertID runs an INSERT into a table with an id column and returns the new row's id.
+// PostgreSQL has no LastInsertId, so there the id is read back with RETURNING.
+func insertID(q inserter, query string, args ...interface{}) (int, error) {
+	if isPostgres() {
+		var id int
+		err := q.QueryRow(query+" RETURNING id", args...).Scan(&id)
+		return id, err
+	}
+
+	result, err := q.Exec(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+// isUniqueViolation reports whether err is a database's unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "23505"
+	}
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+	return false
+}
+
+// rebind rewrites "?" placeholders as PostgreSQL's numbered "$1", "$2", ... leaving
+// question marks inside quoted strings alone
+func rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	var quote byte
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '?':
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+// rebindConnector hands out PostgreSQL connections that accept "?" placeholders, so the
+// models' queries run unchanged on both databases
+type rebindConnector struct {
+	driver.Connector
+}
+
+func (c rebindConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return rebindConn{conn}, nil
+}
+
+type rebindConn struct {
+	driver.Conn
+}
+
+func (c rebindConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(rebind(query))
+}
+
+func (c rebindConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, rebind(query))
+	}
+	return c.Prepare(query)
+}
+
+func (c rebindConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	q, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return q.QueryContext(ctx, rebind(query), args)
+}
+
+func (c rebindConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	e, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return e.ExecContext(ctx, rebind(query), args)
+}
+
+func (c rebindConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+// The optional interfaces below are forwarded so database/sql keeps pinging, resetting and
+// discarding PostgreSQL connections as it would without the wrapper
+
+func (c rebindConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c rebindConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c rebindConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c rebindConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if n, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return n.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
@@ -0,0 +1,81 @@
+package models
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+)
+
+func TestRebind(t *testing.T) {
+	for _, tt := range []struct{ query, want string }{
+		{"SELECT 1", "SELECT 1"},
+		{"SELECT * FROM users WHERE id = ?", "SELECT * FROM users WHERE id = $1"},
+		{"UPDATE t SET a = ?, b = ? WHERE id = ?", "UPDATE t SET a = $1, b = $2 WHERE id = $3"},
+		{"SELECT '?' FROM t WHERE a = ?", "SELECT '?' FROM t WHERE a = $1"},
+		{`SELECT "a?" FROM t WHERE b = ? AND c = 'it''s ?'`, `SELECT "a?" FROM t WHERE b = $1 AND c = 'it''s ?'`},
+	} {
+		if got := rebind(tt.query); got != tt.want {
+			t.Errorf("rebind(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+// optionalConn implements the optional connection interfaces database/sql looks for
+type optionalConn struct {
+	driver.Conn
+	calls []string
+}
+
+func (c *optionalConn) Ping(ctx context.Context) error {
+	c.calls = append(c.calls, "ping")
+	return errors.New("connection lost")
+}
+
+func (c *optionalConn) ResetSession(ctx context.Context) error {
+	c.calls = append(c.calls, "reset")
+	return driver.ErrBadConn
+}
+
+func (c *optionalConn) IsValid() bool {
+	c.calls = append(c.calls, "valid")
+	return false
+}
+
+func (c *optionalConn) CheckNamedValue(nv *driver.NamedValue) error {
+	c.calls = append(c.calls, "check")
+	return nil
+}
+
+func TestRebindConnForwardsOptionalInterfaces(t *testing.T) {
+	inner := &optionalConn{}
+	var conn driver.Conn = rebindConn{inner}
+
+	if err := conn.(driver.Pinger).Ping(context.Background()); err == nil {
+		t.Error("Ping did not report the connection's error")
+	}
+	if err := conn.(driver.SessionResetter).ResetSession(context.Background()); err != driver.ErrBadConn {
+		t.Errorf("ResetSession = %v, want driver.ErrBadConn", err)
+	}
+	if conn.(driver.Validator).IsValid() {
+		t.Error("IsValid = true for an invalid connection")
+	}
+	if err := conn.(driver.NamedValueChecker).CheckNamedValue(&driver.NamedValue{}); err != nil {
+		t.Errorf("CheckNamedValue = %v", err)
+	}
+	if got := len(inner.calls); got != 4 {
+		t.Errorf("forwarded %v, want ping, reset, valid and check", inner.calls)
+	}
+
+	// A connection without them keeps database/sql's defaults
+	var plain driver.Conn = rebindConn{struct{ driver.Conn }{}}
+	if err := plain.(driver.Pinger).Ping(context.Background()); err != nil {
+		t.Errorf("Ping = %v", err)
+	}
+	if !plain.(driver.Validator).IsValid() {
+		t.Error("IsValid = false")
+	}
+	if err := plain.(driver.NamedValueChecker).CheckNamedValue(&driver.NamedValue{}); err != driver.ErrSkip {
+		t.Errorf("CheckNamedValue = %v, want driver.ErrSkip", err)
+	}
+}
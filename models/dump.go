@@ -0,0 +1,204 @@
+package models
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"time"
+)
+
+// exportTables lists the tables copied by ExportData, parents before the tables that
+// reference them. job_locks is left out: its leases belong to the running instances.
+var exportTables = []string{
+	"users", "refresh_tokens", "products", "roles", "addresses",
+	"orders", "order_items", "order_adjustments", "order_addresses", "tax_rates",
+	"coupons", "coupon_restrictions", "coupon_redemptions", "idempotency_keys",
+	"payments", "payment_webhook_events", "order_returns", "order_return_items",
+	"shipments", "shipment_items", "invoice_sequences", "invoices",
+	"stock_reservations", "job_runs",
+}
+
+// ErrImportSchemaVersion is returned when an export was taken at a different schema version
+var ErrImportSchemaVersion = errors.New("export was taken at a different schema version")
+
+// ErrImportNotEmpty is returned when importing into a database that already has data
+var ErrImportNotEmpty = errors.New("database already has data")
+
+// DataExport is a copy of every row of the application's tables. Binary columns are base64
+// and timestamps RFC 3339, so an export from SQLite can be imported into PostgreSQL.
+type DataExport struct {
+	SchemaVersion int           `json:"schema_version"`
+	ExportedAt    time.Time     `json:"exported_at"`
+	Tables        []TableExport `json:"tables"`
+}
+
+// TableExport holds a table's rows, each with a value per column
+type TableExport struct {
+	Name    string          `json:"name"`
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// ExportData writes every row of the application's tables to w as JSON
+func ExportData(w io.Writer) error {
+	version, err := SchemaVersion()
+	if err != nil {
+		return err
+	}
+
+	export := DataExport{SchemaVersion: version, ExportedAt: time.Now().UTC()}
+	for _, table := range exportTables {
+		t, err := exportTable(table)
+		if err != nil {
+			return fmt.Errorf("exporting %s: %w", table, err)
+		}
+		export.Tables = append(export.Tables, t)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(export)
+}
+
+func exportTable(table string) (TableExport, error) {
+	rows, err := DB.Query("SELECT * FROM " + table + " ORDER BY 1")
+	if err != nil {
+		return TableExport{}, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return TableExport{}, err
+	}
+
+	t := TableExport{Name: table, Columns: columns, Rows: [][]interface{}{}}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		dest := make([]interface{}, len(columns))
+		for i := range values {
+			dest[i] = &values[i]
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return TableExport{}, err
+		}
+		t.Rows = append(t.Rows, values)
+	}
+	return t, rows.Err()
+}
+
+// ImportData loads an export written by ExportData. The database must be migrated to the
+// export's schema version and hold no data; the rows are inserted in one transaction.
+func ImportData(r io.Reader) error {
+	var export DataExport
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(&export); err != nil {
+		return fmt.Errorf("reading export: %w", err)
+	}
+
+	version, err := SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if export.SchemaVersion != version {
+		return fmt.Errorf("%w: export is at %d, database at %d", ErrImportSchemaVersion, export.SchemaVersion, version)
+	}
+
+	for _, t := range export.Tables {
+		var n int
+		if err := DB.QueryRow("SELECT COUNT(*) FROM " + t.Name).Scan(&n); err != nil {
+			return fmt.Errorf("checking %s: %w", t.Name, err)
+		}
+		if n > 0 {
+			return fmt.Errorf("%w: %s has %d rows", ErrImportNotEmpty, t.Name, n)
+		}
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, t := range export.Tables {
+		types, err := columnTypes(t.Name)
+		if err != nil {
+			return fmt.Errorf("importing %s: %w", t.Name, err)
+		}
+
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+			t.Name, strings.Join(t.Columns, ", "), placeholders(len(t.Columns)))
+		for _, row := range t.Rows {
+			if len(row) != len(t.Columns) {
+				return fmt.Errorf("importing %s: row has %d values for %d columns", t.Name, len(row), len(t.Columns))
+			}
+			args := make([]interface{}, len(row))
+			for i, v := range row {
+				if args[i], err = importValue(v, types[t.Columns[i]]); err != nil {
+					return fmt.Errorf("importing %s.%s: %w", t.Name, t.Columns[i], err)
+				}
+			}
+			if _, err := tx.Exec(query, args...); err != nil {
+				return fmt.Errorf("importing %s: %w", t.Name, err)
+			}
+		}
+
+		// PostgreSQL sequences do not follow explicitly inserted ids; SQLite's do
+		if isPostgres() && len(t.Rows) > 0 && slices.Contains(t.Columns, "id") {
+			_, err := tx.Exec(fmt.Sprintf("SELECT setval(pg_get_serial_sequence('%s', 'id'), MAX(id)) FROM %s", t.Name, t.Name))
+			if err != nil {
+				return fmt.Errorf("resetting %s id sequence: %w", t.Name, err)
+			}
+		}
+	}
+	return tx.Commit()
+}
+
+// columnTypes returns the declared type of each column of a table, upper-cased
+func columnTypes(table string) (map[string]string, error) {
+	rows, err := DB.Query("SELECT * FROM " + table + " WHERE 1 = 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cts, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	types := make(map[string]string, len(cts))
+	for _, ct := range cts {
+		types[ct.Name()] = strings.ToUpper(ct.DatabaseTypeName())
+	}
+	return types, rows.Err()
+}
+
+// importValue converts a decoded JSON value back to what the column stores
+func importValue(v interface{}, columnType string) (interface{}, error) {
+	switch v := v.(type) {
+	case json.Number:
+		if columnType == "BOOLEAN" || columnType == "BOOL" {
+			return v.String() != "0", nil
+		}
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		return v.Float64()
+	case string:
+		switch columnType {
+		case "BLOB", "BYTEA":
+			return base64.StdEncoding.DecodeString(v)
+		case "TIMESTAMP", "TIMESTAMPTZ", "DATETIME":
+			// Values SQLite could not parse as times were exported as written
+			if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+				return t, nil
+			}
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// IdempotencyRecord is a stored response for an Idempotency-Key
+type IdempotencyRecord struct {
+	Scope       string
+	Key         string
+	RequestHash string
+	StatusCode  int // 0 while the first request is still being processed
+	Headers     map[string][]string
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// ErrIdempotencyKeyExists is returned when another request already claimed the key
+var ErrIdempotencyKeyExists = errors.New("idempotency key already exists")
+
+// GetIdempotencyRecord returns the unexpired record for a scope and key
+func GetIdempotencyRecord(scope, key string) (IdempotencyRecord, error) {
+	var rec IdempotencyRecord
+	var headers sql.NullString
+	err := DB.QueryRow(`
+		SELECT scope, idempotency_key, request_hash, status_code, response_headers, response_body, created_at, expires_at
+		FROM idempotency_keys
+		WHERE scope = ? AND idempotency_key = ? AND expires_at > ?`, scope, key, time.Now().UTC()).Scan(
+		&rec.Scope, &rec.Key, &rec.RequestHash, &rec.StatusCode, &headers, &rec.Body, &rec.CreatedAt, &rec.ExpiresAt)
+	if err != nil {
+		return rec, err
+	}
+	if headers.Valid {
+		err = json.Unmarshal([]byte(headers.String), &rec.Headers)
+	}
+	return rec, err
+}
+
+// ClaimIdempotencyKey reserves a key for a request before it is processed.
+// Expired records are purged first so keys can be reused after the TTL.
+func ClaimIdempotencyKey(scope, key, requestHash string, ttl time.Duration) error {
+	now := time.Now().UTC()
+	if _, err := DB.Exec("DELETE FROM idempotency_keys WHERE expires_at <= ?", now); err != nil {
+		return err
+	}
+
+	result, err := DB.Exec(`
+		INSERT INTO idempotency_keys (scope, idempotency_key, request_hash, status_code, created_at, expires_at)
+		VALUES (?, ?, ?, 0, ?, ?)
+		ON CONFLICT (scope, idempotency_key) DO NOTHING`,
+		scope, key, requestHash, now, now.Add(ttl))
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return ErrIdempotencyKeyExists
+	}
+	return nil
+}
+
+// SaveIdempotencyResponse stores the response of the request that claimed the key
+func SaveIdempotencyResponse(scope, key string, statusCode int, headers map[string][]string, body []byte) error {
+	encoded, err := json.Marshal(headers)
+	if err != nil {
+		return err
+	}
+	_, err = DB.Exec(`
+		UPDATE idempotency_keys
+		SET status_code = ?, response_headers = ?, response_body = ?
+		WHERE scope = ? AND idempotency_key = ?`,
+		statusCode, string(encoded), body, scope, key)
+	return err
+}
+
+// ReleaseIdempotencyKey forgets a key, e.g. after a server error so the client can retry
+func ReleaseIdempotencyKey(scope, key string) error {
+	_, err := DB.Exec("DELETE FROM idempotency_keys WHERE scope = ? AND idempotency_key = ?", scope, key)
+	return err
+}
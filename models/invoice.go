@@ -0,0 +1,137 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Invoice documents
+const (
+	DocumentInvoice     = "invoice"
+	DocumentPackingSlip = "packing_slip"
+)
+
+// invoiceableOrderStatuses are the order statuses that can be invoiced: the order has been paid
+var invoiceableOrderStatuses = map[string]bool{
+	OrderStatusPaid:              true,
+	OrderStatusProcessing:        true,
+	OrderStatusShipped:           true,
+	OrderStatusDelivered:         true,
+	OrderStatusCompleted:         true,
+	OrderStatusPartiallyRefunded: true,
+	OrderStatusRefunded:          true,
+}
+
+var (
+	ErrInvoiceNotAllowed = errors.New("only paid orders can be invoiced")
+	ErrOrderInvoiced     = errors.New("order has been invoiced and cannot be deleted")
+)
+
+// Invoice is issued once per order. Its PDFs are rendered when it is issued and stored,
+// so later downloads return the same bytes.
+type Invoice struct {
+	ID          int       `json:"id"`
+	OrderID     int       `json:"order_id"`
+	Sequence    int       `json:"sequence"`
+	Number      string    `json:"number"`
+	IssuedAt    time.Time `json:"issued_at"`
+	InvoicePDF  []byte    `json:"-"`
+	PackingSlip []byte    `json:"-"`
+}
+
+// InvoiceNumber formats an invoice sequence number
+func InvoiceNumber(sequence int) string {
+	return fmt.Sprintf("INV-%06d", sequence)
+}
+
+// Document returns the stored PDF of one of the invoice documents
+func (inv Invoice) Document(name string) ([]byte, bool) {
+	switch name {
+	case DocumentInvoice:
+		return inv.InvoicePDF, true
+	case DocumentPackingSlip:
+		return inv.PackingSlip, true
+	}
+	return nil, false
+}
+
+// GetInvoiceByOrderID returns the invoice of an order, or sql.ErrNoRows if none was issued yet
+func GetInvoiceByOrderID(orderID int) (Invoice, error) {
+	return getInvoice(DB, orderID)
+}
+
+func getInvoice(q queryRower, orderID int) (Invoice, error) {
+	var inv Invoice
+	err := q.QueryRow(`
+		SELECT id, order_id, sequence, number, issued_at, invoice_pdf, packing_slip_pdf
+		FROM invoices
+		WHERE order_id = ?`, orderID).Scan(&inv.ID, &inv.OrderID, &inv.Sequence, &inv.Number, &inv.IssuedAt,
+		&inv.InvoicePDF, &inv.PackingSlip)
+	return inv, err
+}
+
+// IssueInvoice returns the invoice of an order, issuing it on first use.
+//
+// Invoice numbers come from a counter incremented in the same transaction that stores the
+// invoice, so a failed render or insert never consumes a number and numbers have no gaps.
+func IssueInvoice(orderID int) (Invoice, error) {
+	if inv, err := GetInvoiceByOrderID(orderID); err != sql.ErrNoRows {
+		return inv, err
+	}
+
+	order, err := GetOrderByID(orderID)
+	if err != nil {
+		return Invoice{}, err
+	}
+	if !invoiceableOrderStatuses[order.Status] {
+		return Invoice{}, fmt.Errorf("%w: %s", ErrInvoiceNotAllowed, order.Status)
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return Invoice{}, err
+	}
+	defer tx.Rollback()
+
+	// Taking the counter first holds the write lock, so a concurrent request waits here
+	// and then sees the invoice issued by the first one
+	_, err = tx.Exec(`
+		INSERT INTO invoice_sequences (name, value) VALUES ('invoice', 1)
+		ON CONFLICT (name) DO UPDATE SET value = invoice_sequences.value + 1`)
+	if err != nil {
+		return Invoice{}, err
+	}
+
+	if inv, err := getInvoice(tx, orderID); err != sql.ErrNoRows {
+		return inv, err // issued meanwhile; the rollback gives the number back
+	}
+
+	inv := Invoice{OrderID: orderID, IssuedAt: time.Now().UTC().Truncate(time.Second)}
+	if err := tx.QueryRow("SELECT value FROM invoice_sequences WHERE name = 'invoice'").Scan(&inv.Sequence); err != nil {
+		return Invoice{}, err
+	}
+	inv.Number = InvoiceNumber(inv.Sequence)
+
+	inv.InvoicePDF = renderInvoicePDF(order, inv)
+	inv.PackingSlip = renderPackingSlipPDF(order, inv)
+
+	id, err := insertID(tx, `
+		INSERT INTO invoices (order_id, sequence, number, issued_at, invoice_pdf, packing_slip_pdf)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		inv.OrderID, inv.Sequence, inv.Number, inv.IssuedAt, inv.InvoicePDF, inv.PackingSlip)
+	if err != nil {
+		return Invoice{}, err
+	}
+	inv.ID = id
+
+	return inv, tx.Commit()
+}
+
+// orderHasInvoice reports whether an invoice was issued for the order
+func orderHasInvoice(q queryRower, orderID int) (bool, error) {
+	var count int
+	err := q.QueryRow("SELECT COUNT(*) FROM invoices WHERE order_id = ?", orderID).Scan(&count)
+	return count > 0, err
+}
@@ -0,0 +1,200 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+
+	"go-crud/config"
+	"go-crud/pdf"
+)
+
+// Layout of invoice and packing slip pages, in points
+const (
+	docMargin     = 50.0
+	docLineHeight = 16.0
+	docBottom     = pdf.PageHeight - 80
+)
+
+// docWriter lays out text lines top to bottom, starting a new page when one is full
+type docWriter struct {
+	doc  *pdf.Document
+	page *pdf.Page
+	y    float64
+}
+
+func newDocWriter(title string) *docWriter {
+	w := &docWriter{doc: pdf.New(title)}
+	w.newPage()
+	return w
+}
+
+func (w *docWriter) newPage() {
+	w.page = w.doc.AddPage()
+	w.y = docMargin + 20
+}
+
+// next moves to the next line, breaking the page if needed
+func (w *docWriter) next(lines float64) {
+	w.y += docLineHeight * lines
+	if w.y > docBottom {
+		w.newPage()
+	}
+}
+
+func (w *docWriter) rule() {
+	w.page.Line(docMargin, w.y-11, pdf.PageWidth-docMargin, w.y-11)
+}
+
+// header writes the seller, the document title and its reference lines
+func (w *docWriter) header(title string, refs [][2]string) {
+	w.page.Text(docMargin, w.y, 18, true, title)
+	w.page.TextRight(pdf.PageWidth-docMargin, w.y, 12, true, config.AppConfig.InvoiceSellerName)
+	sellerLines := 0
+	for _, line := range strings.Split(config.AppConfig.InvoiceSellerAddress, "|") {
+		if line = strings.TrimSpace(line); line != "" {
+			sellerLines++
+			w.page.TextRight(pdf.PageWidth-docMargin, w.y+float64(sellerLines)*12, 9, false, line)
+		}
+	}
+	w.next(float64(sellerLines)*12/docLineHeight + 2)
+
+	for _, ref := range refs {
+		w.page.Text(docMargin, w.y, 10, true, ref[0])
+		w.page.Text(docMargin+90, w.y, 10, false, ref[1])
+		w.next(1)
+	}
+	w.next(0.5)
+}
+
+// addressBlock is a titled address printed on a document
+type addressBlock struct {
+	Title   string
+	Address *OrderAddress
+}
+
+// addresses writes address snapshots side by side
+func (w *docWriter) addresses(blocks ...addressBlock) {
+	width := (pdf.PageWidth - 2*docMargin) / float64(len(blocks))
+	height := 0
+	for i, block := range blocks {
+		x := docMargin + float64(i)*width
+		w.page.Text(x, w.y, 10, true, block.Title)
+		lines := addressLines(block.Address)
+		for j, line := range lines {
+			w.page.Text(x, w.y+float64(j+1)*13, 10, false, line)
+		}
+		if len(lines) > height {
+			height = len(lines)
+		}
+	}
+	w.next(float64(height)*13/docLineHeight + 2)
+}
+
+func addressLines(a *OrderAddress) []string {
+	if a == nil {
+		return []string{"No address on file"}
+	}
+
+	lines := []string{a.StreetLine1}
+	if a.StreetLine2 != "" {
+		lines = append(lines, a.StreetLine2)
+	}
+	return append(lines,
+		strings.TrimSpace(fmt.Sprintf("%s, %s %s", a.City, a.State, a.PostalCode)),
+		a.Country)
+}
+
+// itemName is the product name of an order item, falling back to its product ID
+func itemName(item OrderItem) string {
+	if item.Product.Name != "" {
+		return item.Product.Name
+	}
+	return fmt.Sprintf("Product #%d", item.ProductID)
+}
+
+func formatMoney(v float64) string {
+	return fmt.Sprintf("%.2f %s", v, config.AppConfig.PaymentCurrency)
+}
+
+// renderInvoicePDF renders the invoice of an order with its items and totals
+func renderInvoicePDF(order Order, inv Invoice) []byte {
+	w := newDocWriter("Invoice " + inv.Number)
+	w.header("INVOICE", [][2]string{
+		{"Invoice no.", inv.Number},
+		{"Invoice date", inv.IssuedAt.Format("2006-01-02")},
+		{"Order no.", fmt.Sprintf("%d", order.ID)},
+		{"Order date", order.CreatedAt.Format("2006-01-02")},
+	})
+	w.addresses(addressBlock{"Bill to", order.BillingAddress}, addressBlock{"Ship to", order.ShippingAddress})
+
+	right := pdf.PageWidth - docMargin
+	w.page.Text(docMargin, w.y, 10, true, "Item")
+	w.page.TextRight(right-190, w.y, 10, true, "Qty")
+	w.page.TextRight(right-100, w.y, 10, true, "Unit price")
+	w.page.TextRight(right, w.y, 10, true, "Amount")
+	w.rule()
+	w.next(1.2)
+
+	for _, item := range order.Items {
+		w.page.Text(docMargin, w.y, 10, false, itemName(item))
+		w.page.TextRight(right-190, w.y, 10, false, fmt.Sprintf("%d", item.Quantity))
+		w.page.TextRight(right-100, w.y, 10, false, fmt.Sprintf("%.2f", item.Price))
+		w.page.TextRight(right, w.y, 10, false, fmt.Sprintf("%.2f", roundMoney(item.Price*float64(item.Quantity))))
+		w.next(1)
+	}
+	w.rule()
+	w.next(0.5)
+
+	totals := [][2]string{{"Subtotal", formatMoney(order.Subtotal)}}
+	for _, adj := range order.Adjustments {
+		amount := adj.Amount
+		if adj.Type == AdjustmentDiscount {
+			amount = -amount
+		}
+		if amount == 0 && adj.Type != AdjustmentShipping {
+			continue
+		}
+		label := adj.Description
+		if label == "" {
+			label = adj.Code
+		}
+		totals = append(totals, [2]string{label, formatMoney(amount)})
+	}
+
+	for _, line := range totals {
+		w.page.TextRight(right-110, w.y, 10, false, line[0])
+		w.page.TextRight(right, w.y, 10, false, line[1])
+		w.next(1)
+	}
+	w.page.TextRight(right-110, w.y, 11, true, "Total")
+	w.page.TextRight(right, w.y, 11, true, formatMoney(order.TotalAmount))
+
+	return w.doc.Bytes()
+}
+
+// renderPackingSlipPDF renders what goes in the box: the items and quantities, without prices
+func renderPackingSlipPDF(order Order, inv Invoice) []byte {
+	w := newDocWriter("Packing slip " + inv.Number)
+	w.header("PACKING SLIP", [][2]string{
+		{"Order no.", fmt.Sprintf("%d", order.ID)},
+		{"Order date", order.CreatedAt.Format("2006-01-02")},
+		{"Invoice no.", inv.Number},
+	})
+	w.addresses(addressBlock{"Ship to", order.ShippingAddress})
+
+	right := pdf.PageWidth - docMargin
+	w.page.Text(docMargin, w.y, 10, true, "Item")
+	w.page.Text(docMargin+300, w.y, 10, true, "SKU")
+	w.page.TextRight(right, w.y, 10, true, "Qty")
+	w.rule()
+	w.next(1.2)
+
+	for _, item := range order.Items {
+		w.page.Text(docMargin, w.y, 10, false, itemName(item))
+		w.page.Text(docMargin+300, w.y, 10, false, fmt.Sprintf("P-%d", item.ProductID))
+		w.page.TextRight(right, w.y, 10, false, fmt.Sprintf("%d", item.Quantity))
+		w.next(1)
+	}
+
+	return w.doc.Bytes()
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+// createPaidTestOrder creates an order and marks it paid, so it can be invoiced
+func createPaidTestOrder(t *testing.T) int {
+	t.Helper()
+	orderID := createTestOrder(t, createTestUser(t), createTestProduct(t, 15, 10), 1)
+	if err := UpdateOrderStatus(orderID, OrderStatusPaid); err != nil {
+		t.Fatal(err)
+	}
+	return orderID
+}
+
+func TestIssueInvoiceNumbersOrdersInSequence(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		for want := 1; want <= 3; want++ {
+			orderID := createPaidTestOrder(t)
+			inv, err := IssueInvoice(orderID)
+			if err != nil {
+				t.Fatalf("issuing invoice %d: %v", want, err)
+			}
+			if inv.Sequence != want || inv.Number != InvoiceNumber(want) {
+				t.Errorf("invoice %d: sequence %d, number %s", want, inv.Sequence, inv.Number)
+			}
+			if len(inv.InvoicePDF) == 0 || len(inv.PackingSlip) == 0 {
+				t.Errorf("invoice %d: documents were not rendered", want)
+			}
+
+			again, err := IssueInvoice(orderID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again.ID != inv.ID || again.Number != inv.Number {
+				t.Errorf("issuing again returned %s, want %s", again.Number, inv.Number)
+			}
+		}
+	})
+}
+
+func TestIssueInvoiceRejectsUnpaidOrders(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		pending := createTestOrder(t, createTestUser(t), createTestProduct(t, 15, 10), 1)
+		cancelled := createTestOrder(t, createTestUser(t), createTestProduct(t, 15, 10), 1)
+		if err := UpdateOrderStatus(cancelled, OrderStatusCancelled); err != nil {
+			t.Fatal(err)
+		}
+		for _, orderID := range []int{pending, cancelled} {
+			if _, err := IssueInvoice(orderID); !errors.Is(err, ErrInvoiceNotAllowed) {
+				t.Fatalf("order %d: got %v, want ErrInvoiceNotAllowed", orderID, err)
+			}
+		}
+
+		// The rejected orders consumed no number
+		inv, err := IssueInvoice(createPaidTestOrder(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inv.Sequence != 1 {
+			t.Errorf("sequence = %d, want 1", inv.Sequence)
+		}
+	})
+}
+
+func TestIssueInvoiceConcurrently(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		orderID := createPaidTestOrder(t)
+
+		const requests = 8
+		numbers := make(chan string, requests)
+		var wg sync.WaitGroup
+		for i := 0; i < requests; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				inv, err := IssueInvoice(orderID)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				numbers <- inv.Number
+			}()
+		}
+		wg.Wait()
+		close(numbers)
+
+		for number := range numbers {
+			if number != InvoiceNumber(1) {
+				t.Errorf("got invoice %s, want %s", number, InvoiceNumber(1))
+			}
+		}
+		var count int
+		if err := DB.QueryRow("SELECT COUNT(*) FROM invoices WHERE order_id = ?", orderID).Scan(&count); err != nil {
+			t.Fatal(err)
+		}
+		if count != 1 {
+			t.Errorf("%d invoices issued, want 1", count)
+		}
+	})
+}
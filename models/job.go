@@ -0,0 +1,99 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Job run statuses
+const (
+	JobRunRunning   = "running"
+	JobRunSucceeded = "succeeded"
+	JobRunFailed    = "failed"
+)
+
+// JobRun is one recorded execution of a scheduled job
+type JobRun struct {
+	ID         int        `json:"id"`
+	JobName    string     `json:"job_name"`
+	Instance   string     `json:"instance"` // the process that ran the job
+	Status     string     `json:"status"`
+	Message    string     `json:"message"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// AcquireJobLock takes the lock of a job for an instance until the given time. It returns false
+// if another instance holds an unexpired lock, so a job runs once even with several servers.
+func AcquireJobLock(name, instance string, until time.Time) (bool, error) {
+	now := time.Now().UTC()
+	result, err := DB.Exec(`
+		INSERT INTO job_locks (name, locked_by, locked_until) VALUES (?, ?, ?)
+		ON CONFLICT (name) DO UPDATE SET locked_by = excluded.locked_by, locked_until = excluded.locked_until
+		WHERE job_locks.locked_until <= ? OR job_locks.locked_by = excluded.locked_by`,
+		name, instance, until.UTC(), now)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// ReleaseJobLock gives up a lock held by the instance
+func ReleaseJobLock(name, instance string) error {
+	_, err := DB.Exec("DELETE FROM job_locks WHERE name = ? AND locked_by = ?", name, instance)
+	return err
+}
+
+// StartJobRun records that a job started running
+func StartJobRun(name, instance string) (int, error) {
+	return insertID(DB,
+		"INSERT INTO job_runs (job_name, instance, status, started_at) VALUES (?, ?, ?, ?)",
+		name, instance, JobRunRunning, time.Now().UTC().Truncate(time.Second))
+}
+
+// FinishJobRun records the outcome of a run
+func FinishJobRun(id int, status, message string) error {
+	_, err := DB.Exec(
+		"UPDATE job_runs SET status = ?, message = ?, finished_at = ? WHERE id = ?",
+		status, message, time.Now().UTC().Truncate(time.Second), id)
+	return err
+}
+
+const jobRunColumns = "id, job_name, instance, status, COALESCE(message, ''), started_at, finished_at"
+
+func scanJobRun(row rowScanner) (JobRun, error) {
+	var run JobRun
+	var finishedAt sql.NullTime
+	err := row.Scan(&run.ID, &run.JobName, &run.Instance, &run.Status, &run.Message, &run.StartedAt, &finishedAt)
+	if finishedAt.Valid {
+		run.FinishedAt = &finishedAt.Time
+	}
+	return run, err
+}
+
+// GetLastJobRun returns the latest run of a job, or sql.ErrNoRows if it never ran
+func GetLastJobRun(name string) (JobRun, error) {
+	return scanJobRun(DB.QueryRow(
+		"SELECT "+jobRunColumns+" FROM job_runs WHERE job_name = ? ORDER BY id DESC LIMIT 1", name))
+}
+
+// GetJobRuns returns the latest runs of a job, newest first
+func GetJobRuns(name string, limit int) ([]JobRun, error) {
+	rows, err := DB.Query(
+		"SELECT "+jobRunColumns+" FROM job_runs WHERE job_name = ? ORDER BY id DESC LIMIT ?", name, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []JobRun{}
+	for rows.Next() {
+		run, err := scanJobRun(rows)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
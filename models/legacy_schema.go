@@ -0,0 +1,399 @@
+package models
+
+import (
+	"fmt"
+	"log"
+)
+
+// Databases created before versioned migrations were upgraded in place on every startup.
+// upgradeLegacySchema keeps that upgrade so such a database can be brought to the schema of
+// legacyVersion once and adopted; it is frozen, and schema changes go in models/migrations.
+
+// schemaTables lists the tables of legacyVersion other than users.
+var schemaTables = []struct {
+	Name     string
+	DDL      string
+	Backfill string // optional statement run once when the table is first created
+}{
+	// Tables of the original schema; old databases may predate some of them
+	{"refresh_tokens", `
+	CREATE TABLE IF NOT EXISTS refresh_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		token TEXT NOT NULL UNIQUE,
+		expires_at TIMESTAMP NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	)`, ""},
+	{"products", `
+	CREATE TABLE IF NOT EXISTS products (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		status TEXT DEFAULT 'active',
+		price REAL DEFAULT 0.0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`, ""},
+	{"roles", `
+	CREATE TABLE IF NOT EXISTS roles (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		description TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`, ""},
+	{"orders", `
+	CREATE TABLE IF NOT EXISTS orders (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		address_id INTEGER DEFAULT NULL,
+		total_amount REAL NOT NULL,
+		status TEXT DEFAULT 'pending',
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	)`, ""},
+	{"order_items", `
+	CREATE TABLE IF NOT EXISTS order_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		product_id INTEGER NOT NULL,
+		quantity INTEGER NOT NULL,
+		price REAL NOT NULL,
+		FOREIGN KEY (order_id) REFERENCES orders(id),
+		FOREIGN KEY (product_id) REFERENCES products(id)
+	)`, ""},
+	{"addresses", `
+	CREATE TABLE IF NOT EXISTS addresses (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		street_line1 TEXT NOT NULL,
+		street_line2 TEXT,
+		city TEXT NOT NULL,
+		state TEXT NOT NULL,
+		postal_code TEXT NOT NULL,
+		country TEXT NOT NULL,
+		is_default BOOLEAN DEFAULT FALSE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	)`, ""},
+	{"order_adjustments", `
+	CREATE TABLE IF NOT EXISTS order_adjustments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		code TEXT NOT NULL,
+		description TEXT,
+		rate REAL DEFAULT 0.0,
+		amount REAL NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (order_id) REFERENCES orders(id)
+	)`, ""},
+	{"tax_rates", `
+	CREATE TABLE IF NOT EXISTS tax_rates (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		country TEXT NOT NULL,
+		state TEXT NOT NULL DEFAULT '',
+		rate REAL NOT NULL,
+		name TEXT,
+		UNIQUE (country, state)
+	)`, ""},
+	{"coupons", `
+	CREATE TABLE IF NOT EXISTS coupons (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		code TEXT NOT NULL UNIQUE,
+		type TEXT NOT NULL,
+		value REAL DEFAULT 0.0,
+		starts_at TIMESTAMP DEFAULT NULL,
+		ends_at TIMESTAMP DEFAULT NULL,
+		min_order_value REAL DEFAULT 0.0,
+		usage_limit INTEGER DEFAULT 0,
+		per_user_limit INTEGER DEFAULT 0,
+		times_used INTEGER DEFAULT 0,
+		active BOOLEAN DEFAULT TRUE,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+	)`, ""},
+	{"coupon_restrictions", `
+	CREATE TABLE IF NOT EXISTS coupon_restrictions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		coupon_id INTEGER NOT NULL,
+		product_id INTEGER DEFAULT NULL,
+		category TEXT DEFAULT NULL,
+		FOREIGN KEY (coupon_id) REFERENCES coupons(id),
+		FOREIGN KEY (product_id) REFERENCES products(id)
+	)`, ""},
+	{"coupon_redemptions", `
+	CREATE TABLE IF NOT EXISTS coupon_redemptions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		coupon_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		order_id INTEGER NOT NULL,
+		amount REAL NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (coupon_id) REFERENCES coupons(id),
+		FOREIGN KEY (user_id) REFERENCES users(id),
+		FOREIGN KEY (order_id) REFERENCES orders(id)
+	)`, ""},
+	{"idempotency_keys", `
+	CREATE TABLE IF NOT EXISTS idempotency_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		scope TEXT NOT NULL,
+		idempotency_key TEXT NOT NULL,
+		request_hash TEXT NOT NULL,
+		status_code INTEGER DEFAULT 0,
+		response_headers TEXT,
+		response_body BLOB,
+		created_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		UNIQUE (scope, idempotency_key)
+	)`, ""},
+	{"payments", `
+	CREATE TABLE IF NOT EXISTS payments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		provider TEXT NOT NULL,
+		provider_ref TEXT NOT NULL,
+		status TEXT NOT NULL,
+		amount REAL NOT NULL,
+		captured_amount REAL DEFAULT 0.0,
+		refunded_amount REAL DEFAULT 0.0,
+		failure_reason TEXT,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (provider, provider_ref),
+		FOREIGN KEY (order_id) REFERENCES orders(id)
+	)`, ""},
+	{"payment_webhook_events", `
+	CREATE TABLE IF NOT EXISTS payment_webhook_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		provider TEXT NOT NULL,
+		event_id TEXT NOT NULL,
+		event_type TEXT NOT NULL,
+		received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (provider, event_id)
+	)`, ""},
+	{"order_returns", `
+	CREATE TABLE IF NOT EXISTS order_returns (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		user_id INTEGER NOT NULL,
+		status TEXT NOT NULL,
+		reason TEXT,
+		note TEXT,
+		restock BOOLEAN DEFAULT FALSE,
+		refund_amount REAL NOT NULL,
+		refunded_amount REAL DEFAULT 0.0,
+		refund_claimed_until TIMESTAMP,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (order_id) REFERENCES orders(id),
+		FOREIGN KEY (user_id) REFERENCES users(id)
+	)`, ""},
+	{"order_return_items", `
+	CREATE TABLE IF NOT EXISTS order_return_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		return_id INTEGER NOT NULL,
+		order_item_id INTEGER NOT NULL,
+		product_id INTEGER NOT NULL,
+		quantity INTEGER NOT NULL,
+		unit_price REAL NOT NULL,
+		refund_amount REAL NOT NULL,
+		FOREIGN KEY (return_id) REFERENCES order_returns(id),
+		FOREIGN KEY (order_item_id) REFERENCES order_items(id)
+	)`, ""},
+	{"shipments", `
+	CREATE TABLE IF NOT EXISTS shipments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		carrier TEXT,
+		tracking_number TEXT,
+		status TEXT NOT NULL,
+		shipped_at TIMESTAMP DEFAULT NULL,
+		delivered_at TIMESTAMP DEFAULT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (order_id) REFERENCES orders(id)
+	)`, ""},
+	{"shipment_items", `
+	CREATE TABLE IF NOT EXISTS shipment_items (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		shipment_id INTEGER NOT NULL,
+		order_item_id INTEGER NOT NULL,
+		quantity INTEGER NOT NULL,
+		FOREIGN KEY (shipment_id) REFERENCES shipments(id),
+		FOREIGN KEY (order_item_id) REFERENCES order_items(id)
+	)`, ""},
+	{"order_addresses", `
+	CREATE TABLE IF NOT EXISTS order_addresses (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		type TEXT NOT NULL,
+		source_address_id INTEGER DEFAULT NULL,
+		street_line1 TEXT NOT NULL,
+		street_line2 TEXT,
+		city TEXT NOT NULL,
+		state TEXT NOT NULL,
+		postal_code TEXT NOT NULL,
+		country TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (order_id, type),
+		FOREIGN KEY (order_id) REFERENCES orders(id),
+		FOREIGN KEY (source_address_id) REFERENCES addresses(id)
+	)`, `
+	INSERT INTO order_addresses (order_id, type, source_address_id, street_line1, street_line2, city, state,
+	                             postal_code, country)
+	SELECT o.id, t.type, a.id, a.street_line1, a.street_line2, a.city, a.state, a.postal_code, a.country
+	FROM orders o
+	JOIN addresses a ON a.id = o.address_id
+	CROSS JOIN (SELECT 'shipping' AS type UNION ALL SELECT 'billing') t`},
+	{"invoice_sequences", `
+	CREATE TABLE IF NOT EXISTS invoice_sequences (
+		name TEXT PRIMARY KEY,
+		value INTEGER NOT NULL
+	)`, ""},
+	{"invoices", `
+	CREATE TABLE IF NOT EXISTS invoices (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL UNIQUE,
+		sequence INTEGER NOT NULL UNIQUE,
+		number TEXT NOT NULL UNIQUE,
+		issued_at TIMESTAMP NOT NULL,
+		invoice_pdf BLOB NOT NULL,
+		packing_slip_pdf BLOB NOT NULL,
+		FOREIGN KEY (order_id) REFERENCES orders(id)
+	)`, ""},
+	{"stock_reservations", `
+	CREATE TABLE IF NOT EXISTS stock_reservations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		product_id INTEGER NOT NULL,
+		quantity INTEGER NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		taken INTEGER NOT NULL DEFAULT 0,
+		released_at TIMESTAMP DEFAULT NULL,
+		FOREIGN KEY (order_id) REFERENCES orders(id),
+		FOREIGN KEY (product_id) REFERENCES products(id)
+	)`, `
+	INSERT INTO stock_reservations (order_id, product_id, quantity)
+	SELECT oi.order_id, oi.product_id, oi.quantity
+	FROM order_items oi
+	JOIN orders o ON o.id = oi.order_id
+	WHERE o.status = 'pending'`},
+	{"job_locks", `
+	CREATE TABLE IF NOT EXISTS job_locks (
+		name TEXT PRIMARY KEY,
+		locked_by TEXT NOT NULL,
+		locked_until TIMESTAMP NOT NULL
+	)`, ""},
+	{"job_runs", `
+	CREATE TABLE IF NOT EXISTS job_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		job_name TEXT NOT NULL,
+		instance TEXT NOT NULL,
+		status TEXT NOT NULL,
+		message TEXT,
+		started_at TIMESTAMP NOT NULL,
+		finished_at TIMESTAMP DEFAULT NULL
+	)`, ""},
+}
+
+// schemaColumns lists columns added to existing tables after the tables were first released.
+var schemaColumns = []struct {
+	Table      string
+	Column     string
+	Definition string
+	Backfill   string // optional statement run once after the column is added
+}{
+	// Added by the former upgrade scripts
+	{"users", "password", "TEXT", ""},
+	{"products", "price", "REAL DEFAULT 0.0", ""},
+	{"orders", "address_id", "INTEGER DEFAULT NULL", ""},
+	{"products", "weight", "REAL DEFAULT 0.0", ""},
+	{"products", "category", "TEXT DEFAULT ''", ""},
+	{"orders", "subtotal", "REAL DEFAULT 0.0", "UPDATE orders SET subtotal = total_amount"},
+	{"orders", "discount_total", "REAL DEFAULT 0.0", ""},
+	{"orders", "shipping_total", "REAL DEFAULT 0.0", ""},
+	{"orders", "tax_total", "REAL DEFAULT 0.0", ""},
+	{"orders", "refunded_total", "REAL DEFAULT 0.0", ""},
+	{"products", "stock", "INTEGER DEFAULT 0", ""},
+	{"order_return_items", "restocked", "INTEGER NOT NULL DEFAULT 0", `
+	UPDATE order_return_items SET restocked = quantity
+	WHERE return_id IN (SELECT id FROM order_returns WHERE restock = TRUE AND status IN ('received', 'refunded'))`},
+	{"addresses", "type", "TEXT NOT NULL DEFAULT 'both'", ""},
+	// A user may have flagged several addresses as default; the newest one keeps the flag
+	{"addresses", "is_default_shipping", "BOOLEAN NOT NULL DEFAULT FALSE", `
+	UPDATE addresses SET is_default_shipping = TRUE
+	WHERE id IN (SELECT MAX(id) FROM addresses WHERE is_default = TRUE GROUP BY user_id)`},
+	{"addresses", "is_default_billing", "BOOLEAN NOT NULL DEFAULT FALSE", `
+	UPDATE addresses SET is_default_billing = TRUE
+	WHERE id IN (SELECT MAX(id) FROM addresses WHERE is_default = TRUE GROUP BY user_id)`},
+}
+
+// schemaIndexes lists indexes created after the columns they cover exist
+var schemaIndexes = []string{
+	// One default address of each type per user
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_addresses_default_shipping ON addresses (user_id) WHERE is_default_shipping = TRUE`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_addresses_default_billing ON addresses (user_id) WHERE is_default_billing = TRUE`,
+}
+
+// upgradeLegacySchema brings a database created before migrations up to the schema of
+// legacyVersion by creating missing tables and adding missing columns.
+func upgradeLegacySchema() error {
+	// Tables are backfilled once the columns they copy from exist
+	var created []int
+	for i, t := range schemaTables {
+		exists, err := tableExists(t.Name)
+		if err != nil {
+			return err
+		}
+
+		if _, err := DB.Exec(ddl(t.DDL)); err != nil {
+			return fmt.Errorf("creating table %s: %w", t.Name, err)
+		}
+
+		if !exists && t.Backfill != "" {
+			created = append(created, i)
+		}
+	}
+
+	for _, c := range schemaColumns {
+		exists, err := columnExists(c.Table, c.Column)
+		if err != nil {
+			return err
+		}
+		if exists {
+			continue
+		}
+
+		_, err = DB.Exec(ddl(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", c.Table, c.Column, c.Definition)))
+		if err != nil {
+			return fmt.Errorf("adding column %s.%s: %w", c.Table, c.Column, err)
+		}
+		log.Printf("Added column %s to %s table", c.Column, c.Table)
+
+		if c.Backfill != "" {
+			if _, err := DB.Exec(c.Backfill); err != nil {
+				return fmt.Errorf("backfilling column %s.%s: %w", c.Table, c.Column, err)
+			}
+		}
+	}
+
+	for _, i := range created {
+		if _, err := DB.Exec(schemaTables[i].Backfill); err != nil {
+			return fmt.Errorf("backfilling table %s: %w", schemaTables[i].Name, err)
+		}
+	}
+
+	for _, ddl := range schemaIndexes {
+		if _, err := DB.Exec(ddl); err != nil {
+			return fmt.Errorf("creating index: %w", err)
+		}
+	}
+
+	if err := normalizeStoredRegions(); err != nil {
+		return fmt.Errorf("normalizing stored countries: %w", err)
+	}
+
+	return nil
+}
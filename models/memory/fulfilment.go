@@ -0,0 +1,370 @@
+package memory
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"go-crud/models"
+)
+
+// Order statuses that accept new shipments, returns and invoices, as in package models
+var (
+	shippableOrderStatuses = map[string]bool{
+		models.OrderStatusPending:    true,
+		models.OrderStatusPaid:       true,
+		models.OrderStatusProcessing: true,
+		models.OrderStatusShipped:    true,
+	}
+	returnableOrderStatuses = map[string]bool{
+		models.OrderStatusPaid:              true,
+		models.OrderStatusProcessing:        true,
+		models.OrderStatusShipped:           true,
+		models.OrderStatusDelivered:         true,
+		models.OrderStatusCompleted:         true,
+		models.OrderStatusPartiallyRefunded: true,
+	}
+	invoiceableOrderStatuses = map[string]bool{
+		models.OrderStatusPaid:              true,
+		models.OrderStatusProcessing:        true,
+		models.OrderStatusShipped:           true,
+		models.OrderStatusDelivered:         true,
+		models.OrderStatusCompleted:         true,
+		models.OrderStatusPartiallyRefunded: true,
+		models.OrderStatusRefunded:          true,
+	}
+)
+
+// Shipments is an in-memory models.ShipmentRepository for the orders of an order repository.
+// Like the SQL repository it moves orders to processing, shipped and delivered.
+type Shipments struct {
+	mu         sync.Mutex
+	shipments  map[int]models.Shipment
+	nextID     int
+	nextItemID int
+	orders     *Orders
+}
+
+func NewShipments(orders *Orders) *Shipments {
+	return &Shipments{shipments: map[int]models.Shipment{}, nextID: 1, nextItemID: 1, orders: orders}
+}
+
+func (s *Shipments) ListByOrder(orderID int) ([]models.Shipment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []models.Shipment
+	for _, sh := range sortedValues(s.shipments, func(sh models.Shipment) int { return sh.ID }) {
+		if sh.OrderID == orderID {
+			list = append(list, sh)
+		}
+	}
+	return list, nil
+}
+
+func (s *Shipments) GetByID(id int) (models.Shipment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sh, ok := s.shipments[id]
+	if !ok {
+		return models.Shipment{}, models.ErrShipmentNotFound
+	}
+	return sh, nil
+}
+
+func (s *Shipments) Create(orderID int, carrier, trackingNumber string, lines []models.ShipmentLine) (models.Shipment, error) {
+	o, err := s.orders.GetByID(orderID)
+	if err != nil {
+		return models.Shipment{}, err
+	}
+	if !shippableOrderStatuses[o.Status] {
+		return models.Shipment{}, fmt.Errorf("%w: %s", models.ErrShipmentNotAllowed, o.Status)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	remaining := map[int]int{}
+	products := map[int]int{}
+	for _, item := range o.Items {
+		remaining[item.ID], products[item.ID] = item.Quantity, item.ProductID
+	}
+	for _, sh := range s.shipments {
+		if sh.OrderID == orderID {
+			for _, item := range sh.Items {
+				remaining[item.OrderItemID] -= item.Quantity
+			}
+		}
+	}
+
+	if len(lines) == 0 {
+		for _, item := range o.Items {
+			if remaining[item.ID] > 0 {
+				lines = append(lines, models.ShipmentLine{OrderItemID: item.ID, Quantity: remaining[item.ID]})
+			}
+		}
+		if len(lines) == 0 {
+			return models.Shipment{}, models.ErrShipmentNothingToAdd
+		}
+	}
+
+	sh := models.Shipment{
+		ID:             s.nextID,
+		OrderID:        orderID,
+		Carrier:        carrier,
+		TrackingNumber: trackingNumber,
+		Status:         models.ShipmentStatusPending,
+		CreatedAt:      now(),
+		UpdatedAt:      now(),
+	}
+	for _, line := range lines {
+		left, ok := remaining[line.OrderItemID]
+		if !ok {
+			return models.Shipment{}, fmt.Errorf("%w: %d", models.ErrShipmentItem, line.OrderItemID)
+		}
+		if line.Quantity <= 0 || line.Quantity > left {
+			return models.Shipment{}, fmt.Errorf("%w: item %d has %d left", models.ErrShipmentQuantity, line.OrderItemID, left)
+		}
+		remaining[line.OrderItemID] -= line.Quantity
+		sh.Items = append(sh.Items, models.ShipmentItem{
+			ID:          s.nextItemID + len(sh.Items),
+			ShipmentID:  sh.ID,
+			OrderItemID: line.OrderItemID,
+			ProductID:   products[line.OrderItemID],
+			Quantity:    line.Quantity,
+		})
+	}
+	s.nextID++
+	s.nextItemID += len(sh.Items)
+	s.shipments[sh.ID] = sh
+	s.syncOrder(o)
+	return sh, nil
+}
+
+func (s *Shipments) MarkShipped(id int, carrier, trackingNumber string, shippedAt time.Time) (models.Shipment, error) {
+	return s.advance(id, models.ShipmentStatusPending, models.ShipmentStatusShipped, func(sh *models.Shipment) {
+		if carrier != "" {
+			sh.Carrier = carrier
+		}
+		if trackingNumber != "" {
+			sh.TrackingNumber = trackingNumber
+		}
+		at := shippedAt.UTC().Truncate(time.Second)
+		sh.ShippedAt = &at
+	})
+}
+
+func (s *Shipments) MarkDelivered(id int, deliveredAt time.Time) (models.Shipment, error) {
+	return s.advance(id, models.ShipmentStatusShipped, models.ShipmentStatusDelivered, func(sh *models.Shipment) {
+		at := deliveredAt.UTC().Truncate(time.Second)
+		sh.DeliveredAt = &at
+	})
+}
+
+func (s *Shipments) advance(id int, from, to string, update func(sh *models.Shipment)) (models.Shipment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sh, ok := s.shipments[id]
+	if !ok {
+		return sh, models.ErrShipmentNotFound
+	}
+	if sh.Status != from {
+		return sh, models.ErrShipmentState
+	}
+	update(&sh)
+	sh.Status, sh.UpdatedAt = to, now()
+	s.shipments[id] = sh
+
+	o, err := s.orders.GetByID(sh.OrderID)
+	if err != nil {
+		return sh, err
+	}
+	s.syncOrder(o)
+	return sh, nil
+}
+
+// syncOrder moves the order to processing, or to shipped or delivered once all its items are,
+// skipping statuses it cannot reach as models.syncOrderFulfilmentStatus does
+func (s *Shipments) syncOrder(o models.Order) {
+	var ordered, shipped, delivered int
+	for _, item := range o.Items {
+		ordered += item.Quantity
+	}
+	for _, sh := range s.shipments {
+		if sh.OrderID != o.ID {
+			continue
+		}
+		for _, item := range sh.Items {
+			switch sh.Status {
+			case models.ShipmentStatusDelivered:
+				delivered += item.Quantity
+				shipped += item.Quantity
+			case models.ShipmentStatusShipped:
+				shipped += item.Quantity
+			}
+		}
+	}
+
+	next := models.OrderStatusProcessing
+	switch {
+	case ordered > 0 && delivered >= ordered:
+		next = models.OrderStatusDelivered
+	case ordered > 0 && shipped >= ordered:
+		next = models.OrderStatusShipped
+	}
+	status := o.Status
+	for _, st := range []string{models.OrderStatusProcessing, models.OrderStatusShipped, models.OrderStatusDelivered} {
+		if models.CanTransitionOrder(status, st) {
+			s.orders.UpdateStatus(o.ID, st)
+			status = st
+		}
+		if st == next {
+			break
+		}
+	}
+}
+
+// Returns is an in-memory models.ReturnRepository for the orders of an order repository. Items are
+// refunded at their price, and receiving a return records it as refunded in full without payments.
+type Returns struct {
+	mu         sync.Mutex
+	returns    map[int]models.OrderReturn
+	nextID     int
+	nextItemID int
+	orders     *Orders
+}
+
+func NewReturns(orders *Orders) *Returns {
+	return &Returns{returns: map[int]models.OrderReturn{}, nextID: 1, nextItemID: 1, orders: orders}
+}
+
+func (s *Returns) List(orderID int, status string) ([]models.OrderReturn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []models.OrderReturn
+	all := sortedValues(s.returns, func(r models.OrderReturn) int { return r.ID })
+	for i := len(all) - 1; i >= 0; i-- {
+		r := all[i]
+		if (orderID > 0 && r.OrderID != orderID) || (status != "" && r.Status != status) {
+			continue
+		}
+		r.Items = nil
+		list = append(list, r)
+	}
+	return list, nil
+}
+
+func (s *Returns) GetByID(id int) (models.OrderReturn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.returns[id]
+	if !ok {
+		return models.OrderReturn{}, models.ErrReturnNotFound
+	}
+	return r, nil
+}
+
+func (s *Returns) Create(orderID int, reason string, lines []models.ReturnLine) (models.OrderReturn, error) {
+	if len(lines) == 0 {
+		return models.OrderReturn{}, models.ErrReturnNoItems
+	}
+	o, err := s.orders.GetByID(orderID)
+	if err != nil {
+		return models.OrderReturn{}, err
+	}
+	if !returnableOrderStatuses[o.Status] {
+		return models.OrderReturn{}, fmt.Errorf("%w: %s", models.ErrReturnNotAllowed, o.Status)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	returnable := map[int]int{}
+	ordered := map[int]models.OrderItem{}
+	for _, item := range o.Items {
+		returnable[item.ID], ordered[item.ID] = item.Quantity, item
+	}
+	for _, r := range s.returns {
+		if r.OrderID == orderID && r.Status != models.ReturnStatusRejected {
+			for _, item := range r.Items {
+				returnable[item.OrderItemID] -= item.Quantity
+			}
+		}
+	}
+
+	ret := models.OrderReturn{
+		ID:        s.nextID,
+		OrderID:   orderID,
+		UserID:    o.UserID,
+		Status:    models.ReturnStatusRequested,
+		Reason:    reason,
+		CreatedAt: now(),
+		UpdatedAt: now(),
+	}
+	for _, line := range lines {
+		item, ok := ordered[line.OrderItemID]
+		if !ok {
+			return models.OrderReturn{}, fmt.Errorf("%w: %d", models.ErrReturnItemNotInOrder, line.OrderItemID)
+		}
+		if line.Quantity <= 0 || line.Quantity > returnable[item.ID] {
+			return models.OrderReturn{}, fmt.Errorf("%w: item %d has %d left", models.ErrReturnQuantity, item.ID, returnable[item.ID])
+		}
+		returnable[item.ID] -= line.Quantity
+		refund := money(item.Price * float64(line.Quantity))
+		ret.RefundAmount = money(ret.RefundAmount + refund)
+		ret.Items = append(ret.Items, models.OrderReturnItem{
+			ID:           s.nextItemID + len(ret.Items),
+			ReturnID:     ret.ID,
+			OrderItemID:  item.ID,
+			ProductID:    item.ProductID,
+			Quantity:     line.Quantity,
+			UnitPrice:    item.Price,
+			RefundAmount: refund,
+		})
+	}
+	s.nextID++
+	s.nextItemID += len(ret.Items)
+	s.returns[ret.ID] = ret
+	return ret, nil
+}
+
+func (s *Returns) Approve(id int, note string) (models.OrderReturn, error) {
+	return s.review(id, models.ReturnStatusApproved, note)
+}
+
+func (s *Returns) Reject(id int, note string) (models.OrderReturn, error) {
+	return s.review(id, models.ReturnStatusRejected, note)
+}
+
+func (s *Returns) review(id int, status, note string) (models.OrderReturn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.returns[id]
+	if !ok {
+		return r, models.ErrReturnNotFound
+	}
+	if r.Status != models.ReturnStatusRequested {
+		return r, models.ErrReturnState
+	}
+	r.Status, r.Note, r.UpdatedAt = status, note, now()
+	s.returns[id] = r
+	return r, nil
+}
+
+func (s *Returns) Receive(id int, restock bool) (models.OrderReturn, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.returns[id]
+	if !ok {
+		return r, models.ErrReturnNotFound
+	}
+	if r.Status != models.ReturnStatusApproved {
+		return r, models.ErrReturnState
+	}
+	r.Items = append([]models.OrderReturnItem(nil), r.Items...)
+	if restock {
+		for i := range r.Items {
+			r.Items[i].Restocked = r.Items[i].Quantity
+		}
+	}
+	r.Status, r.Restock, r.RefundedAmount, r.UpdatedAt = models.ReturnStatusRefunded, restock, r.RefundAmount, now()
+	s.returns[id] = r
+	return r, nil
+}
@@ -0,0 +1,652 @@
+// Package memory implements the models repositories in memory, so handlers can be tested
+// without a database file. The fakes keep the rules handlers rely on — missing records are
+// reported as the SQL repositories report them, addresses are normalized, order status
+// transitions and return and shipment quantities are checked — but not pricing, stock, tax,
+// coupon redemption or refunds through a payment provider.
+package memory
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-crud/auth"
+	"go-crud/models"
+)
+
+// NewRepositories returns empty in-memory repositories. Orders are priced from the product
+// repository and may use the addresses stored in the address repository; payments, returns,
+// shipments and invoices work on the orders of the order repository.
+func NewRepositories() models.Repositories {
+	products := NewProducts()
+	addresses := NewAddresses()
+	orders := NewOrders(products, addresses)
+	return models.Repositories{
+		Users:     NewUsers(),
+		Roles:     NewRoles(),
+		Products:  products,
+		Orders:    orders,
+		Addresses: addresses,
+		Coupons:   NewCoupons(),
+		Payments:  NewPayments(orders),
+		Returns:   NewReturns(orders),
+		Shipments: NewShipments(orders),
+		TaxRates:  NewTaxRates(),
+		Invoices:  NewInvoices(orders),
+		JobRuns:   NewJobRuns(),
+	}
+}
+
+var (
+	_ models.UserRepository     = (*Users)(nil)
+	_ models.RoleRepository     = (*Roles)(nil)
+	_ models.ProductRepository  = (*Products)(nil)
+	_ models.AddressRepository  = (*Addresses)(nil)
+	_ models.OrderRepository    = (*Orders)(nil)
+	_ models.CouponRepository   = (*Coupons)(nil)
+	_ models.PaymentRepository  = (*Payments)(nil)
+	_ models.ReturnRepository   = (*Returns)(nil)
+	_ models.ShipmentRepository = (*Shipments)(nil)
+	_ models.TaxRateRepository  = (*TaxRates)(nil)
+	_ models.InvoiceRepository  = (*Invoices)(nil)
+	_ models.JobRunRepository   = (*JobRuns)(nil)
+)
+
+// Users is an in-memory models.UserRepository
+type Users struct {
+	mu     sync.Mutex
+	users  map[int]models.User
+	nextID int
+}
+
+func NewUsers() *Users {
+	return &Users{users: map[int]models.User{}, nextID: 1}
+}
+
+func (s *Users) List(limit int) ([]models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return limited(sortedValues(s.users, func(u models.User) int { return u.ID }), limit), nil
+}
+
+func (s *Users) GetByID(id int) (models.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u, ok := s.users[id]
+	if !ok {
+		return models.User{}, sql.ErrNoRows
+	}
+	return u, nil
+}
+
+func (s *Users) Create(email string) (int, error) {
+	return s.insert(email, "")
+}
+
+func (s *Users) Register(email, password string) (int, error) {
+	hashed, err := auth.HashPassword(password)
+	if err != nil {
+		return 0, err
+	}
+	return s.insert(email, hashed)
+}
+
+func (s *Users) insert(email, hashedPassword string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.byEmail(email); ok {
+		return 0, models.ErrUserExists
+	}
+	id := s.nextID
+	s.nextID++
+	s.users[id] = models.User{ID: id, Email: email, Password: hashedPassword, CreatedAt: now()}
+	return id, nil
+}
+
+func (s *Users) byEmail(email string) (models.User, bool) {
+	for _, u := range s.users {
+		if u.Email == email {
+			return u, true
+		}
+	}
+	return models.User{}, false
+}
+
+func (s *Users) Login(email, password string) (models.User, error) {
+	s.mu.Lock()
+	u, ok := s.byEmail(email)
+	s.mu.Unlock()
+	if !ok || auth.CheckPassword(u.Password, password) != nil {
+		return models.User{}, models.ErrInvalidLogin
+	}
+	return u, nil
+}
+
+func (s *Users) UpdateEmail(id int, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[id]; ok {
+		u.Email = email
+		s.users[id] = u
+	}
+	return nil
+}
+
+func (s *Users) UpdatePassword(id int, password string) error {
+	hashed, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u, ok := s.users[id]; ok {
+		u.Password = hashed
+		s.users[id] = u
+	}
+	return nil
+}
+
+func (s *Users) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.users, id)
+	return nil
+}
+
+// Roles is an in-memory models.RoleRepository
+type Roles struct {
+	mu     sync.Mutex
+	roles  map[int]models.Role
+	nextID int
+}
+
+func NewRoles() *Roles {
+	return &Roles{roles: map[int]models.Role{}, nextID: 1}
+}
+
+func (s *Roles) List(limit int) ([]models.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return limited(sortedValues(s.roles, func(r models.Role) int { return r.ID }), limit), nil
+}
+
+func (s *Roles) GetByID(id int) (models.Role, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	r, ok := s.roles[id]
+	if !ok {
+		return models.Role{}, sql.ErrNoRows
+	}
+	return r, nil
+}
+
+func (s *Roles) Create(name, description string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, r := range s.roles {
+		if r.Name == name {
+			return 0, fmt.Errorf("role %q already exists", name)
+		}
+	}
+	id := s.nextID
+	s.nextID++
+	s.roles[id] = models.Role{ID: id, Name: name, Description: description, CreatedAt: now()}
+	return id, nil
+}
+
+func (s *Roles) Update(id int, name, description string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.roles[id]; ok {
+		r.Name, r.Description = name, description
+		s.roles[id] = r
+	}
+	return nil
+}
+
+func (s *Roles) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.roles, id)
+	return nil
+}
+
+// Products is an in-memory models.ProductRepository
+type Products struct {
+	mu       sync.Mutex
+	products map[int]models.Product
+	nextID   int
+}
+
+func NewProducts() *Products {
+	return &Products{products: map[int]models.Product{}, nextID: 1}
+}
+
+// Add stores a product, for seeding tests, and returns its ID
+func (s *Products) Add(p models.Product) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if p.ID == 0 {
+		p.ID = s.nextID
+	}
+	if p.ID >= s.nextID {
+		s.nextID = p.ID + 1
+	}
+	if p.Status == "" {
+		p.Status = "active"
+	}
+	p.CreatedAt, p.UpdatedAt = now(), now()
+	s.products[p.ID] = p
+	return p.ID
+}
+
+func (s *Products) get(id int) (models.Product, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.products[id]
+	return p, ok
+}
+
+func (s *Products) List(limit int) ([]models.Product, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return limited(sortedValues(s.products, func(p models.Product) int { return p.ID }), limit), nil
+}
+
+func (s *Products) Filter(f models.ProductFilter, limit, offset int) ([]models.Product, int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	matches := []models.Product{}
+	for _, p := range sortedValues(s.products, func(p models.Product) int { return p.ID }) {
+		switch {
+		case f.Name != "" && !strings.Contains(strings.ToLower(p.Name), strings.ToLower(f.Name)),
+			f.Status != "" && p.Status != f.Status,
+			f.MinID > 0 && p.ID < f.MinID,
+			f.MaxID > 0 && p.ID > f.MaxID:
+			continue
+		}
+		matches = append(matches, p)
+	}
+	return page(matches, limit, offset), len(matches), nil
+}
+
+// Addresses is an in-memory models.AddressRepository
+type Addresses struct {
+	mu        sync.Mutex
+	addresses map[int]models.Address
+	nextID    int
+}
+
+func NewAddresses() *Addresses {
+	return &Addresses{addresses: map[int]models.Address{}, nextID: 1}
+}
+
+func (s *Addresses) List(limit int) ([]models.Address, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return limited(sortedValues(s.addresses, func(a models.Address) int { return a.ID }), limit), nil
+}
+
+func (s *Addresses) ListByUser(userID int) ([]models.Address, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []models.Address{}
+	for _, a := range sortedValues(s.addresses, func(a models.Address) int { return a.ID }) {
+		if a.UserID == userID {
+			list = append(list, a)
+		}
+	}
+	// Defaults first, as in the SQL repository
+	sort.SliceStable(list, func(i, j int) bool { return list[i].IsDefault && !list[j].IsDefault })
+	return list, nil
+}
+
+func (s *Addresses) GetByID(id int) (models.Address, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a, ok := s.addresses[id]
+	if !ok {
+		return models.Address{}, sql.ErrNoRows
+	}
+	return a, nil
+}
+
+func (s *Addresses) Create(a models.Address) (int, error) {
+	if err := models.NormalizeAddress(&a); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	a.ID = s.nextID
+	s.nextID++
+	a.CreatedAt, a.UpdatedAt = now(), now()
+	s.store(a)
+	return a.ID, nil
+}
+
+func (s *Addresses) Update(a models.Address) error {
+	if err := models.NormalizeAddress(&a); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.addresses[a.ID]
+	if !ok || old.UserID != a.UserID {
+		return sql.ErrNoRows
+	}
+	a.CreatedAt, a.UpdatedAt = old.CreatedAt, now()
+	s.store(a)
+	return nil
+}
+
+// store saves an address, moving the user's default flags to it where it asks for them
+func (s *Addresses) store(a models.Address) {
+	if a.IsDefault {
+		a.IsDefaultShipping = a.IsDefaultShipping || a.ShipsTo()
+		a.IsDefaultBilling = a.IsDefaultBilling || a.Bills()
+	}
+	a.IsDefault = a.IsDefaultShipping || a.IsDefaultBilling
+	for id, other := range s.addresses {
+		if other.UserID != a.UserID || id == a.ID {
+			continue
+		}
+		other.IsDefaultShipping = other.IsDefaultShipping && !a.IsDefaultShipping
+		other.IsDefaultBilling = other.IsDefaultBilling && !a.IsDefaultBilling
+		other.IsDefault = other.IsDefaultShipping || other.IsDefaultBilling
+		s.addresses[id] = other
+	}
+	s.addresses[a.ID] = a
+}
+
+func (s *Addresses) Delete(id, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if a, ok := s.addresses[id]; ok && a.UserID == userID {
+		delete(s.addresses, id)
+	}
+	return nil
+}
+
+// Orders is an in-memory models.OrderRepository
+type Orders struct {
+	mu         sync.Mutex
+	orders     map[int]models.Order
+	nextID     int
+	nextItemID int
+	products   *Products
+	addresses  *Addresses
+}
+
+// NewOrders returns an empty order repository pricing items from products and
+// taking addresses from addresses
+func NewOrders(products *Products, addresses *Addresses) *Orders {
+	return &Orders{orders: map[int]models.Order{}, nextID: 1, nextItemID: 1, products: products, addresses: addresses}
+}
+
+func (s *Orders) List(limit int) ([]models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	orders := sortedValues(s.orders, func(o models.Order) int { return o.ID })
+	sort.SliceStable(orders, func(i, j int) bool { return orders[i].CreatedAt.After(orders[j].CreatedAt) })
+	return limited(orders, limit), nil
+}
+
+func (s *Orders) matching(f models.OrderFilter) []models.Order {
+	statuses := map[string]bool{}
+	for _, st := range f.Statuses {
+		statuses[st] = true
+	}
+	var list []models.Order
+	for _, o := range s.orders {
+		switch {
+		case f.UserID > 0 && o.UserID != f.UserID,
+			len(statuses) > 0 && !statuses[o.Status],
+			!f.CreatedFrom.IsZero() && o.CreatedAt.Before(f.CreatedFrom),
+			!f.CreatedTo.IsZero() && !o.CreatedAt.Before(f.CreatedTo),
+			f.MinTotal != nil && o.TotalAmount < *f.MinTotal,
+			f.MaxTotal != nil && o.TotalAmount > *f.MaxTotal:
+			continue
+		}
+		list = append(list, o)
+	}
+	return list
+}
+
+func (s *Orders) Filter(f models.OrderFilter, pageNum, perPage int) (models.PaginatedOrders, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := s.matching(f)
+	sort.Slice(list, func(i, j int) bool {
+		a, b := list[i], list[j]
+		if f.SortDesc {
+			a, b = b, a
+		}
+		switch f.SortBy {
+		case "id":
+		case "total_amount":
+			if a.TotalAmount != b.TotalAmount {
+				return a.TotalAmount < b.TotalAmount
+			}
+		case "status":
+			if a.Status != b.Status {
+				return a.Status < b.Status
+			}
+		default:
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+		}
+		return a.ID < b.ID
+	})
+	return models.PaginatedOrders{
+		Orders:      page(list, perPage, (pageNum-1)*perPage),
+		TotalCount:  len(list),
+		CurrentPage: pageNum,
+		TotalPages:  (len(list) + perPage - 1) / perPage,
+		PerPage:     perPage,
+	}, nil
+}
+
+func (s *Orders) FilterIDs(f models.OrderFilter, limit int) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := s.matching(f)
+	sort.Slice(list, func(i, j int) bool {
+		if !list[i].CreatedAt.Equal(list[j].CreatedAt) {
+			return list[i].CreatedAt.Before(list[j].CreatedAt)
+		}
+		return list[i].ID < list[j].ID
+	})
+	ids := []int{}
+	for _, o := range limited(list, limit) {
+		ids = append(ids, o.ID)
+	}
+	return ids, nil
+}
+
+func (s *Orders) GetByID(id int) (models.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.orders[id]
+	if !ok {
+		return models.Order{}, sql.ErrNoRows
+	}
+	return o, nil
+}
+
+func (s *Orders) GetUserID(id int) (int, error) {
+	o, err := s.GetByID(id)
+	return o.UserID, err
+}
+
+// Place stores a pending order whose total is the sum of its items at their product prices
+func (s *Orders) Place(req models.OrderRequest) (int, error) {
+	o := models.Order{UserID: req.UserID, Status: models.OrderStatusPending, CreatedAt: now(), UpdatedAt: now()}
+	for _, item := range req.Items {
+		p, _ := s.products.get(item.ProductID)
+		o.Items = append(o.Items, models.OrderItem{ProductID: item.ProductID, Quantity: item.Quantity, Price: p.Price, Product: p})
+		o.Subtotal += p.Price * float64(item.Quantity)
+	}
+	o.TotalAmount, o.NetTotal = o.Subtotal, o.Subtotal
+
+	shippingID := req.ShippingAddressID
+	if shippingID == 0 {
+		shippingID = req.AddressID
+	}
+	if shippingID != 0 {
+		if err := s.checkAddress(req.UserID, shippingID, "address_id"); err != nil {
+			return 0, err
+		}
+		o.AddressID = &shippingID
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o.ID = s.nextID
+	s.nextID++
+	for i := range o.Items {
+		o.Items[i].ID, o.Items[i].OrderID = s.nextItemID, o.ID
+		s.nextItemID++
+	}
+	s.orders[o.ID] = o
+	return o.ID, nil
+}
+
+// checkAddress rejects an address that does not exist or belongs to another user
+func (s *Orders) checkAddress(userID, addressID int, field string) error {
+	a, err := s.addresses.GetByID(addressID)
+	switch {
+	case err == sql.ErrNoRows:
+		return invalid(field, fmt.Sprintf("address %d does not exist", addressID))
+	case err != nil:
+		return err
+	case a.UserID != userID:
+		return invalid(field, fmt.Sprintf("address %d belongs to another user", addressID))
+	}
+	return nil
+}
+
+func invalid(field, message string) error {
+	return &models.ValidationError{Fields: []models.FieldError{{Field: field, Code: models.FieldInvalid, Message: message}}}
+}
+
+func (s *Orders) UpdateStatus(id int, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, ok := s.orders[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if o.Status == status {
+		return nil
+	}
+	if !models.CanTransitionOrder(o.Status, status) {
+		return fmt.Errorf("%w: %s to %s", models.ErrIllegalTransition, o.Status, status)
+	}
+	o.Status, o.UpdatedAt = status, now()
+	s.orders[id] = o
+	return nil
+}
+
+func (s *Orders) BatchUpdateStatus(ids []int, status string, atomic bool) ([]models.OrderStatusResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	results := make([]models.OrderStatusResult, 0, len(ids))
+	updated := map[int]models.Order{}
+	failed := false
+	for _, id := range ids {
+		result := models.OrderStatusResult{OrderID: id, ToStatus: status}
+		o, ok := s.orders[id]
+		if u, done := updated[id]; done {
+			o = u
+		}
+		switch {
+		case !ok:
+			result.Result, result.ToStatus = models.BatchResultNotFound, ""
+			failed = true
+		case o.Status == status:
+			result.FromStatus, result.Result = o.Status, models.BatchResultUnchanged
+		case !models.CanTransitionOrder(o.Status, status):
+			result.FromStatus, result.Result = o.Status, models.BatchResultIllegal
+			failed = true
+		default:
+			result.FromStatus, result.Result = o.Status, models.BatchResultUpdated
+			o.Status, o.UpdatedAt = status, now()
+			updated[id] = o
+		}
+		results = append(results, result)
+	}
+
+	if atomic && failed {
+		for i := range results {
+			if results[i].Result == models.BatchResultUpdated {
+				results[i].Result = models.BatchResultRolledBack
+			}
+		}
+		return results, models.ErrBatchRejected
+	}
+	for id, o := range updated {
+		s.orders[id] = o
+	}
+	return results, nil
+}
+
+func (s *Orders) UpdateAddress(id int, addressType string, addressID int) error {
+	userID, err := s.GetUserID(id)
+	if err != nil {
+		return err
+	}
+	if err := s.checkAddress(userID, addressID, "address_id"); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o := s.orders[id]
+	if o.Status != models.OrderStatusPending {
+		return invalid("order_id", fmt.Sprintf("order %d is %s; only pending orders can change address or be repriced", id, o.Status))
+	}
+	if addressType == models.AddressTypeBilling {
+		return nil
+	}
+	o.AddressID, o.UpdatedAt = &addressID, now()
+	s.orders[id] = o
+	return nil
+}
+
+func (s *Orders) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.orders, id)
+	return nil
+}
+
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// sortedValues returns a map's values ordered by their ID
+func sortedValues[T any](m map[int]T, id func(T) int) []T {
+	list := make([]T, 0, len(m))
+	for _, v := range m {
+		list = append(list, v)
+	}
+	sort.Slice(list, func(i, j int) bool { return id(list[i]) < id(list[j]) })
+	return list
+}
+
+func limited[T any](list []T, limit int) []T {
+	if limit >= 0 && len(list) > limit {
+		return list[:limit]
+	}
+	return list
+}
+
+func page[T any](list []T, limit, offset int) []T {
+	if offset >= len(list) {
+		return []T{}
+	}
+	return limited(list[offset:], limit)
+}
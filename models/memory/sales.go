@@ -0,0 +1,400 @@
+package memory
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+
+	"go-crud/models"
+	"go-crud/payments"
+)
+
+// Coupons is an in-memory models.CouponRepository. Orders do not redeem coupons; tests add
+// redemptions with Redeem.
+type Coupons struct {
+	mu          sync.Mutex
+	coupons     map[int]models.Coupon
+	redemptions []models.CouponRedemption
+	nextID      int
+}
+
+func NewCoupons() *Coupons {
+	return &Coupons{coupons: map[int]models.Coupon{}, nextID: 1}
+}
+
+func (s *Coupons) List(limit int) ([]models.Coupon, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return limited(sortedValues(s.coupons, func(c models.Coupon) int { return c.ID }), limit), nil
+}
+
+func (s *Coupons) GetByID(id int) (models.Coupon, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.coupons[id]
+	if !ok {
+		return models.Coupon{}, models.ErrCouponNotFound
+	}
+	return c, nil
+}
+
+func (s *Coupons) Create(c models.Coupon) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c.Code = models.NormalizeCouponCode(c.Code)
+	for _, other := range s.coupons {
+		if other.Code == c.Code {
+			return 0, models.ErrCouponExists
+		}
+	}
+	c.ID, c.TimesUsed, c.CreatedAt, c.UpdatedAt = s.nextID, 0, now(), now()
+	s.nextID++
+	s.coupons[c.ID] = c
+	return c.ID, nil
+}
+
+func (s *Coupons) Update(c models.Coupon) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old, ok := s.coupons[c.ID]
+	if !ok {
+		return models.ErrCouponNotFound
+	}
+	c.Code = models.NormalizeCouponCode(c.Code)
+	c.TimesUsed, c.CreatedAt, c.UpdatedAt = old.TimesUsed, old.CreatedAt, now()
+	s.coupons[c.ID] = c
+	return nil
+}
+
+func (s *Coupons) Delete(id int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.coupons[id]
+	if !ok {
+		return nil
+	}
+	if c.TimesUsed > 0 {
+		c.Active, c.UpdatedAt = false, now()
+		s.coupons[id] = c
+		return nil
+	}
+	delete(s.coupons, id)
+	return nil
+}
+
+// Redeem records a redemption of a stored coupon
+func (s *Coupons) Redeem(r models.CouponRedemption) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.coupons[r.CouponID]
+	if !ok {
+		return models.ErrCouponNotFound
+	}
+	c.TimesUsed++
+	s.coupons[c.ID] = c
+	r.ID, r.Code, r.CreatedAt = len(s.redemptions)+1, c.Code, now()
+	s.redemptions = append(s.redemptions, r)
+	return nil
+}
+
+func (s *Coupons) Redemptions(couponID, limit int) ([]models.CouponRedemption, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []models.CouponRedemption
+	for i := len(s.redemptions) - 1; i >= 0; i-- {
+		if s.redemptions[i].CouponID == couponID {
+			list = append(list, s.redemptions[i])
+		}
+	}
+	return limited(list, limit), nil
+}
+
+func (s *Coupons) Report() ([]models.CouponReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var reports []models.CouponReport
+	for _, c := range sortedValues(s.coupons, func(c models.Coupon) int { return c.ID }) {
+		report := models.CouponReport{CouponID: c.ID, Code: c.Code}
+		users := map[int]bool{}
+		for _, r := range s.redemptions {
+			if r.CouponID == c.ID {
+				report.Redemptions++
+				report.TotalDiscount += r.Amount
+				users[r.UserID] = true
+			}
+		}
+		report.UniqueUsers, report.TotalDiscount = len(users), money(report.TotalDiscount)
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
+
+// Payments is an in-memory models.PaymentRepository for the orders of an order repository
+type Payments struct {
+	mu       sync.Mutex
+	payments map[int]models.Payment
+	events   map[string]bool // provider and event ID of applied webhook events
+	nextID   int
+	orders   *Orders
+}
+
+func NewPayments(orders *Orders) *Payments {
+	return &Payments{payments: map[int]models.Payment{}, events: map[string]bool{}, nextID: 1, orders: orders}
+}
+
+func (s *Payments) GetByID(id int) (models.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.payments[id]
+	if !ok {
+		return models.Payment{}, models.ErrPaymentNotFound
+	}
+	return p, nil
+}
+
+func (s *Payments) GetByProviderRef(provider, reference string) (models.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.payments {
+		if p.Provider == provider && p.ProviderRef == reference {
+			return p, nil
+		}
+	}
+	return models.Payment{}, models.ErrPaymentNotFound
+}
+
+func (s *Payments) ListByOrder(orderID int) ([]models.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []models.Payment
+	for _, p := range sortedValues(s.payments, func(p models.Payment) int { return p.ID }) {
+		if p.OrderID == orderID {
+			list = append(list, p)
+		}
+	}
+	return list, nil
+}
+
+// ChargeOrder runs charge with the repository locked, so attempts on any order run one at a time
+func (s *Payments) ChargeOrder(orderID int, charge func(total float64, attempt int) (models.Payment, error)) (models.Payment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	o, err := s.orders.GetByID(orderID)
+	if err != nil {
+		return models.Payment{}, err
+	}
+	if o.Status != models.OrderStatusPending {
+		return models.Payment{}, fmt.Errorf("%w, order is %s", models.ErrOrderNotPayable, o.Status)
+	}
+	attempts := 0
+	for _, p := range s.payments {
+		if p.OrderID != orderID {
+			continue
+		}
+		attempts++
+		if p.Status == payments.StatusAuthorized || p.Status == payments.StatusCaptured {
+			return models.Payment{}, models.ErrOrderPaymentActive
+		}
+	}
+
+	p, chargeErr := charge(o.TotalAmount, attempts+1)
+	if p.ProviderRef == "" {
+		return p, chargeErr
+	}
+	p.ID, p.OrderID, p.CreatedAt, p.UpdatedAt = s.nextID, orderID, now(), now()
+	s.nextID++
+	s.payments[p.ID] = p
+	return p, chargeErr
+}
+
+func (s *Payments) UpdateFromProvider(id int, result payments.Result, failureReason string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.update(id, result, failureReason)
+	return nil
+}
+
+func (s *Payments) update(id int, result payments.Result, failureReason string) {
+	if p, ok := s.payments[id]; ok {
+		p.Status, p.CapturedAmount, p.RefundedAmount = result.Status, result.CapturedAmount, result.RefundedAmount
+		p.FailureReason, p.UpdatedAt = failureReason, now()
+		s.payments[id] = p
+	}
+}
+
+func (s *Payments) ApplyWebhookEvent(provider, eventID, eventType string, paymentID int, result payments.Result, failureReason string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := provider + "\x00" + eventID
+	if s.events[key] {
+		return false, nil
+	}
+	s.events[key] = true
+	s.update(paymentID, result, failureReason)
+	return true, nil
+}
+
+// SyncOrderStatus follows models.SyncOrderPaymentStatus: captured payments covering the total
+// pay a pending order, and refunds make it partially_refunded or refunded
+func (s *Payments) SyncOrderStatus(orderID int) (string, error) {
+	o, err := s.orders.GetByID(orderID)
+	if err != nil {
+		return "", err
+	}
+
+	var captured, refunded float64
+	list, _ := s.ListByOrder(orderID)
+	for _, p := range list {
+		captured += p.CapturedAmount
+		refunded += p.RefundedAmount
+	}
+
+	next := o.Status
+	switch {
+	case refunded > 0 && money(refunded) >= money(o.TotalAmount):
+		next = models.OrderStatusRefunded
+	case refunded > 0:
+		next = models.OrderStatusPartiallyRefunded
+	case o.Status == models.OrderStatusPending && money(captured-refunded) >= money(o.TotalAmount):
+		next = models.OrderStatusPaid
+	}
+	if next == o.Status || !models.CanTransitionOrder(o.Status, next) {
+		return o.Status, nil
+	}
+	return next, s.orders.UpdateStatus(orderID, next)
+}
+
+// TaxRates is an in-memory models.TaxRateRepository. Countries and states are stored upper-cased
+// but, unlike in the SQL repository, not checked against the known regions.
+type TaxRates struct {
+	mu     sync.Mutex
+	rates  map[string]models.TaxRate // by code
+	nextID int
+}
+
+func NewTaxRates() *TaxRates {
+	return &TaxRates{rates: map[string]models.TaxRate{}, nextID: 1}
+}
+
+func (s *TaxRates) List() ([]models.TaxRate, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var list []models.TaxRate
+	for _, t := range s.rates {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Country != list[j].Country {
+			return list[i].Country < list[j].Country
+		}
+		return list[i].State < list[j].State
+	})
+	return list, nil
+}
+
+func (s *TaxRates) Set(country, state string, rate float64, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t := models.TaxRate{Country: strings.ToUpper(country), State: strings.ToUpper(state), Rate: rate, Name: name}
+	if old, ok := s.rates[t.Code()]; ok {
+		t.ID = old.ID
+	} else {
+		t.ID = s.nextID
+		s.nextID++
+	}
+	s.rates[t.Code()] = t
+	return nil
+}
+
+// Invoices is an in-memory models.InvoiceRepository for the orders of an order repository.
+// Its documents are placeholders, not rendered PDFs.
+type Invoices struct {
+	mu       sync.Mutex
+	invoices map[int]models.Invoice // by order ID
+	orders   *Orders
+}
+
+func NewInvoices(orders *Orders) *Invoices {
+	return &Invoices{invoices: map[int]models.Invoice{}, orders: orders}
+}
+
+func (s *Invoices) GetByOrderID(orderID int) (models.Invoice, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	inv, ok := s.invoices[orderID]
+	if !ok {
+		return models.Invoice{}, sql.ErrNoRows
+	}
+	return inv, nil
+}
+
+func (s *Invoices) Issue(orderID int) (models.Invoice, error) {
+	o, err := s.orders.GetByID(orderID)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if inv, ok := s.invoices[orderID]; ok {
+		return inv, nil
+	}
+	if !invoiceableOrderStatuses[o.Status] {
+		return models.Invoice{}, fmt.Errorf("%w: %s", models.ErrInvoiceNotAllowed, o.Status)
+	}
+
+	sequence := len(s.invoices) + 1
+	inv := models.Invoice{
+		ID:       sequence,
+		OrderID:  orderID,
+		Sequence: sequence,
+		Number:   models.InvoiceNumber(sequence),
+		IssuedAt: now(),
+	}
+	inv.InvoicePDF = []byte(fmt.Sprintf("%%PDF-1.4\n%% invoice %s\n", inv.Number))
+	inv.PackingSlip = []byte(fmt.Sprintf("%%PDF-1.4\n%% packing slip %s\n", inv.Number))
+	s.invoices[orderID] = inv
+	return inv, nil
+}
+
+// JobRuns is an in-memory models.JobRunRepository; tests record runs with Add
+type JobRuns struct {
+	mu   sync.Mutex
+	runs []models.JobRun
+}
+
+func NewJobRuns() *JobRuns {
+	return &JobRuns{}
+}
+
+// Add records a run and returns its ID
+func (s *JobRuns) Add(run models.JobRun) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	run.ID = len(s.runs) + 1
+	if run.StartedAt.IsZero() {
+		run.StartedAt = now()
+	}
+	s.runs = append(s.runs, run)
+	return run.ID
+}
+
+func (s *JobRuns) List(name string, limit int) ([]models.JobRun, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	runs := []models.JobRun{}
+	for i := len(s.runs) - 1; i >= 0; i-- {
+		if s.runs[i].JobName == name {
+			runs = append(runs, s.runs[i])
+		}
+	}
+	return limited(runs, limit), nil
+}
+
+// money rounds an amount to cents
+func money(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
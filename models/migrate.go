@@ -0,0 +1,420 @@
+package models
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema changes are numbered migrations in models/migrations, each a pair of files
+// NNNN_name.up.sql and NNNN_name.down.sql written for SQLite; CREATE TABLE and ALTER TABLE
+// statements are translated for PostgreSQL. Applied migrations are recorded in
+// schema_migrations with a checksum of their up SQL, so an edited migration is detected.
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// legacyVersion is the last migration whose schema databases created before versioned
+// migrations already have
+const legacyVersion = 12
+
+// ErrMigrationModified is returned when an applied migration's up SQL no longer matches
+// the checksum recorded when it ran
+var ErrMigrationModified = errors.New("applied migration has been modified")
+
+// ErrMigrationUnknown is returned when the database has a migration this build does not contain
+var ErrMigrationUnknown = errors.New("applied migration is not part of this build")
+
+// Migration is a numbered schema change with the SQL that applies and reverts it
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // SHA-256 of Up
+}
+
+func (m Migration) String() string {
+	return fmt.Sprintf("%04d_%s", m.Version, m.Name)
+}
+
+// MigrationStatus describes a migration and whether it has been applied
+type MigrationStatus struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+	Modified  bool // applied, but the up SQL has changed since
+	Unknown   bool // applied, but not part of this build
+}
+
+type appliedMigration struct {
+	Name      string
+	Checksum  string
+	AppliedAt time.Time
+}
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migrations returns the embedded migrations ordered by version
+func Migrations() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		parts := migrationFileName.FindStringSubmatch(e.Name())
+		if parts == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", e.Name())
+		}
+		version, _ := strconv.Atoi(parts[1])
+		data, err := migrationFiles.ReadFile("migrations/" + e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m := byVersion[version]
+		if m == nil {
+			m = &Migration{Version: version, Name: parts[2]}
+			byVersion[version] = m
+		} else if m.Name != parts[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, parts[2])
+		}
+		if parts[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			return nil, fmt.Errorf("migration %s needs both an up and a down file", m)
+		}
+		sum := sha256.Sum256([]byte(m.Up))
+		m.Checksum = hex.EncodeToString(sum[:])
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// appliedMigrations reads schema_migrations; a database without the table has none applied
+func appliedMigrations() (map[int]appliedMigration, error) {
+	applied := make(map[int]appliedMigration)
+	exists, err := tableExists("schema_migrations")
+	if err != nil || !exists {
+		return applied, err
+	}
+
+	rows, err := DB.Query("SELECT version, name, checksum, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var version int
+		var a appliedMigration
+		if err := rows.Scan(&version, &a.Name, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = a
+	}
+	return applied, rows.Err()
+}
+
+// MigrationStatuses lists the embedded migrations, and any applied ones missing from this
+// build, with whether they have been applied
+func MigrationStatuses() ([]MigrationStatus, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []MigrationStatus
+	for _, m := range migrations {
+		s := MigrationStatus{Migration: m}
+		if a, ok := applied[m.Version]; ok {
+			s.Applied = true
+			s.AppliedAt = a.AppliedAt
+			s.Modified = a.Checksum != m.Checksum
+			delete(applied, m.Version)
+		}
+		statuses = append(statuses, s)
+	}
+	for version, a := range applied {
+		statuses = append(statuses, MigrationStatus{
+			Migration: Migration{Version: version, Name: a.Name, Checksum: a.Checksum},
+			Applied:   true,
+			AppliedAt: a.AppliedAt,
+			Unknown:   true,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses, nil
+}
+
+// verifiedStatuses returns the migration statuses, failing if an applied migration has
+// been modified or is unknown to this build
+func verifiedStatuses() ([]MigrationStatus, error) {
+	statuses, err := MigrationStatuses()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range statuses {
+		switch {
+		case s.Unknown:
+			return nil, fmt.Errorf("%w: %s", ErrMigrationUnknown, s.Migration)
+		case s.Modified:
+			return nil, fmt.Errorf("%w: %s", ErrMigrationModified, s.Migration)
+		}
+	}
+	return statuses, nil
+}
+
+// SchemaVersion returns the highest applied migration, 0 for a database without any
+func SchemaVersion() (int, error) {
+	applied, err := appliedMigrations()
+	version := 0
+	for v := range applied {
+		version = max(version, v)
+	}
+	return version, err
+}
+
+// PendingMigrations returns the migrations not yet applied, in the order they would run.
+// A database created before versioned migrations reports them all until it is adopted by
+// MigrateUp.
+func PendingMigrations() ([]Migration, error) {
+	statuses, err := verifiedStatuses()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []Migration
+	for _, s := range statuses {
+		if !s.Applied {
+			pending = append(pending, s.Migration)
+		}
+	}
+	return pending, nil
+}
+
+// MigrateUp applies up to steps pending migrations, all of them when steps is 0, and
+// returns the ones applied
+func MigrateUp(steps int) ([]Migration, error) {
+	if err := adoptLegacySchema(); err != nil {
+		return nil, fmt.Errorf("adopting existing database: %w", err)
+	}
+
+	pending, err := PendingMigrations()
+	if err != nil {
+		return nil, err
+	}
+	if steps > 0 && steps < len(pending) {
+		pending = pending[:steps]
+	}
+
+	for i, m := range pending {
+		if err := runMigration(m, true); err != nil {
+			return pending[:i], err
+		}
+		log.Printf("Applied migration %s", m)
+	}
+	return pending, nil
+}
+
+// MigrateDown reverts up to steps of the most recently applied migrations and returns
+// the ones reverted
+func MigrateDown(steps int) ([]Migration, error) {
+	statuses, err := verifiedStatuses()
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for i := len(statuses) - 1; i >= 0 && len(reverted) < steps; i-- {
+		if !statuses[i].Applied {
+			continue
+		}
+		m := statuses[i].Migration
+		if err := runMigration(m, false); err != nil {
+			return reverted, err
+		}
+		log.Printf("Reverted migration %s", m)
+		reverted = append(reverted, m)
+	}
+	return reverted, nil
+}
+
+// RedoMigration reverts and reapplies the most recently applied migration
+func RedoMigration() (Migration, error) {
+	reverted, err := MigrateDown(1)
+	if err != nil {
+		return Migration{}, err
+	}
+	if len(reverted) == 0 {
+		return Migration{}, errors.New("no migration has been applied")
+	}
+
+	m := reverted[0]
+	if err := runMigration(m, true); err != nil {
+		return m, err
+	}
+	log.Printf("Applied migration %s", m)
+	return m, nil
+}
+
+func createMigrationsTable(e execer) error {
+	_, err := e.Exec(ddl(`
+	CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		checksum TEXT NOT NULL,
+		applied_at TIMESTAMP NOT NULL
+	)`))
+	return err
+}
+
+// runMigration applies or reverts a migration and records it in one transaction
+func runMigration(m Migration, up bool) error {
+	if err := createMigrationsTable(DB); err != nil {
+		return err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	script, action := m.Up, "applying"
+	if !up {
+		script, action = m.Down, "reverting"
+	}
+	for _, stmt := range splitStatements(script) {
+		if _, err := tx.Exec(migrationStatement(stmt)); err != nil {
+			return fmt.Errorf("%s migration %s: %w", action, m, err)
+		}
+	}
+
+	if up {
+		_, err = tx.Exec("INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+			m.Version, m.Name, m.Checksum, time.Now().UTC())
+	} else {
+		_, err = tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version)
+	}
+	if err != nil {
+		return fmt.Errorf("recording migration %s: %w", m, err)
+	}
+	return tx.Commit()
+}
+
+// migrationStatement translates table definitions for the open database; other statements
+// run as written
+func migrationStatement(stmt string) string {
+	upper := strings.ToUpper(stmt)
+	if strings.HasPrefix(upper, "CREATE TABLE") || strings.HasPrefix(upper, "ALTER TABLE") {
+		return ddl(stmt)
+	}
+	return stmt
+}
+
+// splitStatements splits a migration script on semicolons, dropping "--" comments and
+// leaving quoted text alone
+func splitStatements(script string) []string {
+	var statements []string
+	var b strings.Builder
+	var quote byte
+
+	flush := func() {
+		if s := strings.TrimSpace(b.String()); s != "" {
+			statements = append(statements, s)
+		}
+		b.Reset()
+	}
+
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '-' && i+1 < len(script) && script[i+1] == '-':
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+			continue
+		case c == ';':
+			flush()
+			continue
+		}
+		b.WriteByte(c)
+	}
+	flush()
+	return statements
+}
+
+// adoptLegacySchema brings a database created before versioned migrations to the schema of
+// legacyVersion and records migrations up to it as applied, so only later ones run
+func adoptLegacySchema() error {
+	tracked, err := tableExists("schema_migrations")
+	if err != nil || tracked {
+		return err
+	}
+	initialized, err := SchemaExists()
+	if err != nil || !initialized {
+		return err
+	}
+
+	log.Println("Database predates versioned migrations; upgrading it in place")
+	if err := upgradeLegacySchema(); err != nil {
+		return err
+	}
+
+	migrations, err := Migrations()
+	if err != nil {
+		return err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := createMigrationsTable(tx); err != nil {
+		return err
+	}
+	now := time.Now().UTC()
+	for _, m := range migrations {
+		if m.Version > legacyVersion {
+			break
+		}
+		_, err := tx.Exec("INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (?, ?, ?, ?)",
+			m.Version, m.Name, m.Checksum, now)
+		if err != nil {
+			return err
+		}
+		log.Printf("Recorded migration %s as applied", m)
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,199 @@
+package models
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMigrateUpAndDown(t *testing.T) {
+	forEachEmptyDatabase(t, func(t *testing.T) {
+		all, err := Migrations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		latest := all[len(all)-1].Version
+
+		pending, err := PendingMigrations()
+		if err != nil || len(pending) != len(all) {
+			t.Fatalf("pending on an empty database: %d, %v; want %d", len(pending), err, len(all))
+		}
+
+		applied, err := MigrateUp(2)
+		if err != nil || len(applied) != 2 {
+			t.Fatalf("MigrateUp(2) applied %v, %v", applied, err)
+		}
+		checkSchemaVersion(t, all[1].Version)
+
+		applied, err = MigrateUp(0)
+		if err != nil || len(applied) != len(all)-2 {
+			t.Fatalf("MigrateUp(0) applied %d, %v; want %d", len(applied), err, len(all)-2)
+		}
+		checkSchemaVersion(t, latest)
+		if applied, err = MigrateUp(0); err != nil || len(applied) != 0 {
+			t.Fatalf("MigrateUp on an up-to-date database applied %v, %v", applied, err)
+		}
+
+		// Each down script undoes its up script, so the schema can go all the way down and back
+		for i := len(all) - 1; i >= 0; i-- {
+			reverted, err := MigrateDown(1)
+			if err != nil {
+				t.Fatalf("reverting %s: %v", all[i], err)
+			}
+			if len(reverted) != 1 || reverted[0].Version != all[i].Version {
+				t.Fatalf("MigrateDown(1) reverted %v, want %s", reverted, all[i])
+			}
+			want := 0
+			if i > 0 {
+				want = all[i-1].Version
+			}
+			checkSchemaVersion(t, want)
+		}
+		if exists, err := SchemaExists(); err != nil || exists {
+			t.Errorf("users table left after reverting every migration: %v, %v", exists, err)
+		}
+		if reverted, err := MigrateDown(1); err != nil || len(reverted) != 0 {
+			t.Errorf("MigrateDown on an empty schema reverted %v, %v", reverted, err)
+		}
+
+		if _, err := MigrateUp(0); err != nil {
+			t.Fatalf("migrating up again: %v", err)
+		}
+		checkSchemaVersion(t, latest)
+	})
+}
+
+func TestMigrateDownSteps(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		all, err := Migrations()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		reverted, err := MigrateDown(3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int
+		for _, m := range reverted {
+			got = append(got, m.Version)
+		}
+		n := len(all)
+		if want := []int{all[n-1].Version, all[n-2].Version, all[n-3].Version}; !reflect.DeepEqual(got, want) {
+			t.Errorf("reverted %v, want %v", got, want)
+		}
+		checkSchemaVersion(t, all[n-4].Version)
+
+		pending, err := PendingMigrations()
+		if err != nil || len(pending) != 3 || pending[0].Version != all[n-3].Version {
+			t.Errorf("pending after MigrateDown(3): %v, %v", pending, err)
+		}
+	})
+}
+
+func TestRedoMigration(t *testing.T) {
+	forEachEmptyDatabase(t, func(t *testing.T) {
+		if _, err := RedoMigration(); err == nil {
+			t.Error("redo on an empty database succeeded")
+		}
+
+		if _, err := MigrateUp(0); err != nil {
+			t.Fatal(err)
+		}
+		all, err := Migrations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		latest := all[len(all)-1]
+
+		m, err := RedoMigration()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Version != latest.Version {
+			t.Errorf("redid %s, want %s", m, latest)
+		}
+		checkSchemaVersion(t, latest.Version)
+		if pending, err := PendingMigrations(); err != nil || len(pending) != 0 {
+			t.Errorf("pending after redo: %v, %v", pending, err)
+		}
+	})
+}
+
+func TestMigrateUpAdoptsLegacyDatabase(t *testing.T) {
+	forEachEmptyDatabase(t, func(t *testing.T) {
+		// A database created before versioned migrations has the schema without the bookkeeping
+		if _, err := MigrateUp(legacyVersion); err != nil {
+			t.Fatal(err)
+		}
+		mustExec(t, "DROP TABLE schema_migrations")
+		mustExec(t, "INSERT INTO users (email) VALUES ('old@example.com')")
+
+		applied, err := MigrateUp(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, m := range applied {
+			if m.Version <= legacyVersion {
+				t.Errorf("reapplied %s to a legacy database", m)
+			}
+		}
+		all, err := Migrations()
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkSchemaVersion(t, all[len(all)-1].Version)
+
+		var users int
+		if err := DB.QueryRow("SELECT COUNT(*) FROM users").Scan(&users); err != nil || users != 1 {
+			t.Errorf("users after adoption: %d, %v", users, err)
+		}
+	})
+}
+
+func TestMigrationsRefuseChangedHistory(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		mustExec(t, "UPDATE schema_migrations SET checksum = 'edited' WHERE version = 1")
+		if _, err := MigrateUp(0); !errors.Is(err, ErrMigrationModified) {
+			t.Errorf("MigrateUp with an edited migration: %v, want ErrMigrationModified", err)
+		}
+		if _, err := MigrateDown(1); !errors.Is(err, ErrMigrationModified) {
+			t.Errorf("MigrateDown with an edited migration: %v, want ErrMigrationModified", err)
+		}
+
+		statuses, err := MigrationStatuses()
+		if err != nil || !statuses[0].Modified {
+			t.Fatalf("status of the edited migration: %+v, %v", statuses[0], err)
+		}
+		m := statuses[0].Migration
+		mustExec(t, "UPDATE schema_migrations SET checksum = ? WHERE version = 1", m.Checksum)
+
+		mustExec(t, "INSERT INTO schema_migrations (version, name, checksum, applied_at) VALUES (9999, 'future', 'x', CURRENT_TIMESTAMP)")
+		if _, err := PendingMigrations(); !errors.Is(err, ErrMigrationUnknown) {
+			t.Errorf("PendingMigrations with a migration from a newer build: %v, want ErrMigrationUnknown", err)
+		}
+	})
+}
+
+func TestSplitStatements(t *testing.T) {
+	script := `
+		-- a comment; with a semicolon
+		CREATE TABLE a (note TEXT DEFAULT 'x;y');
+		INSERT INTO a (note) VALUES ('it''s'); -- trailing comment
+		UPDATE a SET note = "--not a comment"`
+	want := []string{
+		"CREATE TABLE a (note TEXT DEFAULT 'x;y')",
+		"INSERT INTO a (note) VALUES ('it''s')",
+		`UPDATE a SET note = "--not a comment"`,
+	}
+	if got := splitStatements(script); !reflect.DeepEqual(got, want) {
+		t.Errorf("splitStatements:\n got %q\nwant %q", got, want)
+	}
+}
+
+func checkSchemaVersion(t *testing.T, want int) {
+	t.Helper()
+	if got, err := SchemaVersion(); err != nil || got != want {
+		t.Errorf("schema version = %d, %v; want %d", got, err, want)
+	}
+}
@@ -0,0 +1,7 @@
+DROP TABLE addresses;
+DROP TABLE order_items;
+DROP TABLE orders;
+DROP TABLE roles;
+DROP TABLE products;
+DROP TABLE refresh_tokens;
+DROP TABLE users;
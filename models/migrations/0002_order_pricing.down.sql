@@ -0,0 +1,10 @@
+ALTER TABLE orders DROP COLUMN tax_total;
+ALTER TABLE orders DROP COLUMN shipping_total;
+ALTER TABLE orders DROP COLUMN discount_total;
+ALTER TABLE orders DROP COLUMN subtotal;
+
+ALTER TABLE products DROP COLUMN category;
+ALTER TABLE products DROP COLUMN weight;
+
+DROP TABLE tax_rates;
+DROP TABLE order_adjustments;
@@ -0,0 +1,32 @@
+-- Discounts, shipping and tax recorded on orders
+CREATE TABLE order_adjustments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	order_id INTEGER NOT NULL,
+	type TEXT NOT NULL,
+	code TEXT NOT NULL,
+	description TEXT,
+	rate REAL DEFAULT 0.0,
+	amount REAL NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (order_id) REFERENCES orders(id)
+);
+
+CREATE TABLE tax_rates (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	country TEXT NOT NULL,
+	state TEXT NOT NULL DEFAULT '',
+	rate REAL NOT NULL,
+	name TEXT,
+	UNIQUE (country, state)
+);
+
+ALTER TABLE products ADD COLUMN weight REAL DEFAULT 0.0;
+ALTER TABLE products ADD COLUMN category TEXT DEFAULT '';
+
+ALTER TABLE orders ADD COLUMN subtotal REAL DEFAULT 0.0;
+ALTER TABLE orders ADD COLUMN discount_total REAL DEFAULT 0.0;
+ALTER TABLE orders ADD COLUMN shipping_total REAL DEFAULT 0.0;
+ALTER TABLE orders ADD COLUMN tax_total REAL DEFAULT 0.0;
+
+-- Orders placed before pricing had no adjustments
+UPDATE orders SET subtotal = total_amount;
@@ -0,0 +1,36 @@
+CREATE TABLE coupons (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	code TEXT NOT NULL UNIQUE,
+	type TEXT NOT NULL,
+	value REAL DEFAULT 0.0,
+	starts_at TIMESTAMP DEFAULT NULL,
+	ends_at TIMESTAMP DEFAULT NULL,
+	min_order_value REAL DEFAULT 0.0,
+	usage_limit INTEGER DEFAULT 0,
+	per_user_limit INTEGER DEFAULT 0,
+	times_used INTEGER DEFAULT 0,
+	active BOOLEAN DEFAULT TRUE,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE coupon_restrictions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	coupon_id INTEGER NOT NULL,
+	product_id INTEGER DEFAULT NULL,
+	category TEXT DEFAULT NULL,
+	FOREIGN KEY (coupon_id) REFERENCES coupons(id),
+	FOREIGN KEY (product_id) REFERENCES products(id)
+);
+
+CREATE TABLE coupon_redemptions (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	coupon_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	order_id INTEGER NOT NULL,
+	amount REAL NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (coupon_id) REFERENCES coupons(id),
+	FOREIGN KEY (user_id) REFERENCES users(id),
+	FOREIGN KEY (order_id) REFERENCES orders(id)
+);
@@ -0,0 +1,13 @@
+-- Responses replayed for repeated Idempotency-Key requests
+CREATE TABLE idempotency_keys (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	scope TEXT NOT NULL,
+	idempotency_key TEXT NOT NULL,
+	request_hash TEXT NOT NULL,
+	status_code INTEGER DEFAULT 0,
+	response_headers TEXT,
+	response_body BLOB,
+	created_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	UNIQUE (scope, idempotency_key)
+);
@@ -0,0 +1,25 @@
+CREATE TABLE payments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	order_id INTEGER NOT NULL,
+	provider TEXT NOT NULL,
+	provider_ref TEXT NOT NULL,
+	status TEXT NOT NULL,
+	amount REAL NOT NULL,
+	captured_amount REAL DEFAULT 0.0,
+	refunded_amount REAL DEFAULT 0.0,
+	failure_reason TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (provider, provider_ref),
+	FOREIGN KEY (order_id) REFERENCES orders(id)
+);
+
+-- Webhook events already processed, so redeliveries are ignored
+CREATE TABLE payment_webhook_events (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	provider TEXT NOT NULL,
+	event_id TEXT NOT NULL,
+	event_type TEXT NOT NULL,
+	received_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (provider, event_id)
+);
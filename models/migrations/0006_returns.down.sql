@@ -0,0 +1,4 @@
+ALTER TABLE orders DROP COLUMN refunded_total;
+
+DROP TABLE order_return_items;
+DROP TABLE order_returns;
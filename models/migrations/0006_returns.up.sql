@@ -0,0 +1,33 @@
+CREATE TABLE order_returns (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	order_id INTEGER NOT NULL,
+	user_id INTEGER NOT NULL,
+	status TEXT NOT NULL,
+	reason TEXT,
+	note TEXT,
+	restock BOOLEAN DEFAULT FALSE,
+	refund_amount REAL NOT NULL,
+	refunded_amount REAL DEFAULT 0.0,
+	-- Set while a request is refunding a received return, so concurrent retries do not refund it twice
+	refund_claimed_until TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (order_id) REFERENCES orders(id),
+	FOREIGN KEY (user_id) REFERENCES users(id)
+);
+
+CREATE TABLE order_return_items (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	return_id INTEGER NOT NULL,
+	order_item_id INTEGER NOT NULL,
+	product_id INTEGER NOT NULL,
+	quantity INTEGER NOT NULL,
+	unit_price REAL NOT NULL,
+	refund_amount REAL NOT NULL,
+	-- Units put back in stock, at most what was taken out for the order
+	restocked INTEGER NOT NULL DEFAULT 0,
+	FOREIGN KEY (return_id) REFERENCES order_returns(id),
+	FOREIGN KEY (order_item_id) REFERENCES order_items(id)
+);
+
+ALTER TABLE orders ADD COLUMN refunded_total REAL DEFAULT 0.0;
@@ -0,0 +1,2 @@
+DROP TABLE shipment_items;
+DROP TABLE shipments;
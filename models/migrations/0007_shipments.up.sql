@@ -0,0 +1,21 @@
+CREATE TABLE shipments (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	order_id INTEGER NOT NULL,
+	carrier TEXT,
+	tracking_number TEXT,
+	status TEXT NOT NULL,
+	shipped_at TIMESTAMP DEFAULT NULL,
+	delivered_at TIMESTAMP DEFAULT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (order_id) REFERENCES orders(id)
+);
+
+CREATE TABLE shipment_items (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	shipment_id INTEGER NOT NULL,
+	order_item_id INTEGER NOT NULL,
+	quantity INTEGER NOT NULL,
+	FOREIGN KEY (shipment_id) REFERENCES shipments(id),
+	FOREIGN KEY (order_item_id) REFERENCES order_items(id)
+);
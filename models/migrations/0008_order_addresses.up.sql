@@ -0,0 +1,25 @@
+-- Copies of the shipping and billing address taken when an order is placed
+CREATE TABLE order_addresses (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	order_id INTEGER NOT NULL,
+	type TEXT NOT NULL,
+	source_address_id INTEGER DEFAULT NULL,
+	street_line1 TEXT NOT NULL,
+	street_line2 TEXT,
+	city TEXT NOT NULL,
+	state TEXT NOT NULL,
+	postal_code TEXT NOT NULL,
+	country TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	UNIQUE (order_id, type),
+	FOREIGN KEY (order_id) REFERENCES orders(id),
+	FOREIGN KEY (source_address_id) REFERENCES addresses(id)
+);
+
+-- Existing orders ship to and are billed at the address they reference
+INSERT INTO order_addresses (order_id, type, source_address_id, street_line1, street_line2, city, state,
+                             postal_code, country)
+SELECT o.id, t.type, a.id, a.street_line1, a.street_line2, a.city, a.state, a.postal_code, a.country
+FROM orders o
+JOIN addresses a ON a.id = o.address_id
+CROSS JOIN (SELECT 'shipping' AS type UNION ALL SELECT 'billing') t;
@@ -0,0 +1,15 @@
+CREATE TABLE invoice_sequences (
+	name TEXT PRIMARY KEY,
+	value INTEGER NOT NULL
+);
+
+CREATE TABLE invoices (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	order_id INTEGER NOT NULL UNIQUE,
+	sequence INTEGER NOT NULL UNIQUE,
+	number TEXT NOT NULL UNIQUE,
+	issued_at TIMESTAMP NOT NULL,
+	invoice_pdf BLOB NOT NULL,
+	packing_slip_pdf BLOB NOT NULL,
+	FOREIGN KEY (order_id) REFERENCES orders(id)
+);
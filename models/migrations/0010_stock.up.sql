@@ -0,0 +1,21 @@
+ALTER TABLE products ADD COLUMN stock INTEGER DEFAULT 0;
+
+CREATE TABLE stock_reservations (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	order_id INTEGER NOT NULL,
+	product_id INTEGER NOT NULL,
+	quantity INTEGER NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	-- Units that have left the warehouse, e.g. shipped; only the rest is held
+	taken INTEGER NOT NULL DEFAULT 0,
+	released_at TIMESTAMP DEFAULT NULL,
+	FOREIGN KEY (order_id) REFERENCES orders(id),
+	FOREIGN KEY (product_id) REFERENCES products(id)
+);
+
+-- Pending orders hold their items until they are paid or cancelled
+INSERT INTO stock_reservations (order_id, product_id, quantity)
+SELECT oi.order_id, oi.product_id, oi.quantity
+FROM order_items oi
+JOIN orders o ON o.id = oi.order_id
+WHERE o.status = 'pending';
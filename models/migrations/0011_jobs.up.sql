@@ -0,0 +1,16 @@
+-- Background job leases and run history
+CREATE TABLE job_locks (
+	name TEXT PRIMARY KEY,
+	locked_by TEXT NOT NULL,
+	locked_until TIMESTAMP NOT NULL
+);
+
+CREATE TABLE job_runs (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	job_name TEXT NOT NULL,
+	instance TEXT NOT NULL,
+	status TEXT NOT NULL,
+	message TEXT,
+	started_at TIMESTAMP NOT NULL,
+	finished_at TIMESTAMP DEFAULT NULL
+);
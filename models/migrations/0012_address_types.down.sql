@@ -0,0 +1,6 @@
+DROP INDEX idx_addresses_default_billing;
+DROP INDEX idx_addresses_default_shipping;
+
+ALTER TABLE addresses DROP COLUMN is_default_billing;
+ALTER TABLE addresses DROP COLUMN is_default_shipping;
+ALTER TABLE addresses DROP COLUMN type;
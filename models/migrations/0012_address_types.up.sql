@@ -0,0 +1,13 @@
+ALTER TABLE addresses ADD COLUMN type TEXT NOT NULL DEFAULT 'both';
+ALTER TABLE addresses ADD COLUMN is_default_shipping BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE addresses ADD COLUMN is_default_billing BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- A user may have flagged several addresses as default; the newest one keeps the flag
+UPDATE addresses SET is_default_shipping = TRUE
+WHERE id IN (SELECT MAX(id) FROM addresses WHERE is_default = TRUE GROUP BY user_id);
+UPDATE addresses SET is_default_billing = TRUE
+WHERE id IN (SELECT MAX(id) FROM addresses WHERE is_default = TRUE GROUP BY user_id);
+
+-- One default address of each type per user
+CREATE UNIQUE INDEX idx_addresses_default_shipping ON addresses (user_id) WHERE is_default_shipping = TRUE;
+CREATE UNIQUE INDEX idx_addresses_default_billing ON addresses (user_id) WHERE is_default_billing = TRUE;
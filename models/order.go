@@ -2,19 +2,61 @@ package models
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 )
 
 type Order struct {
-	ID          int         `json:"id"`
-	UserID      int         `json:"user_id"`
-	AddressID   *int        `json:"address_id,omitempty"` // Using pointer to handle NULL values
-	TotalAmount float64     `json:"total_amount"`
-	Status      string      `json:"status"`
-	CreatedAt   time.Time   `json:"created_at"`
-	UpdatedAt   time.Time   `json:"updated_at"`
-	Items       []OrderItem `json:"items,omitempty"`
-	Address     *Address    `json:"address,omitempty"` // Address details
+	ID            int               `json:"id"`
+	UserID        int               `json:"user_id"`
+	AddressID     *int              `json:"address_id,omitempty"` // Using pointer to handle NULL values
+	Subtotal      float64           `json:"subtotal"`
+	DiscountTotal float64           `json:"discount_total"`
+	ShippingTotal float64           `json:"shipping_total"`
+	TaxTotal      float64           `json:"tax_total"`
+	TotalAmount   float64           `json:"total_amount"`
+	RefundedTotal float64           `json:"refunded_total"`
+	NetTotal      float64           `json:"net_total"` // total_amount less refunds
+	Status        string            `json:"status"`
+	CreatedAt     time.Time         `json:"created_at"`
+	UpdatedAt     time.Time         `json:"updated_at"`
+	Items         []OrderItem       `json:"items,omitempty"`
+	Adjustments   []OrderAdjustment `json:"adjustments,omitempty"` // Discount, shipping and tax lines
+	Shipments     []Shipment        `json:"shipments,omitempty"`
+
+	// Copies of the addresses taken when the order was placed or its address assigned
+	ShippingAddress *OrderAddress `json:"shipping_address,omitempty"`
+	BillingAddress  *OrderAddress `json:"billing_address,omitempty"`
+}
+
+// orderColumns is the column list shared by all order queries, in scanOrder order
+const orderColumns = `id, user_id, address_id, subtotal, discount_total, shipping_total, tax_total,
+		       total_amount, refunded_total, status, created_at, updated_at`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanOrder scans a row selected with orderColumns
+func scanOrder(row rowScanner) (Order, error) {
+	var o Order
+	var addressID sql.NullInt64
+	err := row.Scan(&o.ID, &o.UserID, &addressID, &o.Subtotal, &o.DiscountTotal, &o.ShippingTotal,
+		&o.TaxTotal, &o.TotalAmount, &o.RefundedTotal, &o.Status, &o.CreatedAt, &o.UpdatedAt)
+	if err != nil {
+		return o, err
+	}
+	o.NetTotal = roundMoney(o.TotalAmount - o.RefundedTotal)
+	
+	// Handle NULL address_id
+	if addressID.Valid {
+		addrID := int(addressID.Int64)
+		o.AddressID = &addrID
+	}
+	return o, nil
 }
 
 type OrderItem struct {
@@ -28,20 +70,23 @@ type OrderItem struct {
 
 // For creating a new order
 type OrderRequest struct {
-	UserID    int           `json:"user_id"`
-	AddressID int           `json:"address_id,omitempty"`
-	Items     []ItemRequest `json:"items"`
+	UserID            int           `json:"user_id" validate:"required"`
+	AddressID         int           `json:"address_id,omitempty"` // shipping and billing address, unless set separately
+	ShippingAddressID int           `json:"shipping_address_id,omitempty"`
+	BillingAddressID  int           `json:"billing_address_id,omitempty"`
+	Items             []ItemRequest `json:"items" validate:"required"`
+	CouponCode        string        `json:"coupon_code,omitempty" validate:"max=64"`
 }
 
 type ItemRequest struct {
-	ProductID int `json:"product_id"`
-	Quantity  int `json:"quantity"`
+	ProductID int `json:"product_id" validate:"required"`
+	Quantity  int `json:"quantity" validate:"min=1"`
 }
 
 // Get all orders with optional limit
 func GetOrders(limit int) ([]Order, error) {
 	rows, err := DB.Query(`
-		SELECT id, user_id, address_id, total_amount, status, created_at, updated_at 
+		SELECT `+orderColumns+` 
 		FROM orders 
 		ORDER BY created_at DESC
 		LIMIT ?`, limit)
@@ -52,57 +97,39 @@ func GetOrders(limit int) ([]Order, error) {
 	
 	var orders []Order
 	for rows.Next() {
-		var o Order
-		var addressID sql.NullInt64
-		if err := rows.Scan(&o.ID, &o.UserID, &addressID, &o.TotalAmount, &o.Status, &o.CreatedAt, &o.UpdatedAt); err != nil {
-			return nil, err
-		}
-		
-		// Handle NULL address_id
-		if addressID.Valid {
-			addrID := int(addressID.Int64)
-			o.AddressID = &addrID
-		}
-		
-		// Get order items for this order
-		items, err := GetOrderItems(o.ID)
+		o, err := scanOrder(rows)
 		if err != nil {
 			return nil, err
 		}
-		o.Items = items
-		
 		orders = append(orders, o)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	
+	// Load items and addresses for all orders at once
+	if err := LoadOrderDetails(orders); err != nil {
+		return nil, err
+	}
 	return orders, nil
 }
 
+// GetOrderUserID returns the ID of the user who placed an order, or sql.ErrNoRows if there is no such order
+func GetOrderUserID(id int) (int, error) {
+	var userID int
+	err := DB.QueryRow("SELECT user_id FROM orders WHERE id = ?", id).Scan(&userID)
+	return userID, err
+}
+
 // Get order by ID
 func GetOrderByID(id int) (Order, error) {
-	var order Order
-	var addressID sql.NullInt64
-	
-	err := DB.QueryRow(`
-		SELECT id, user_id, address_id, total_amount, status, created_at, updated_at 
-		FROM orders 
-		WHERE id = ?`, id).Scan(
-		&order.ID, &order.UserID, &addressID, &order.TotalAmount, &order.Status, &order.CreatedAt, &order.UpdatedAt)
-	
+	// The order and its address snapshots come back in a single query
+	order, err := getOrderWithAddress(id)
 	if err != nil {
 		return order, err
 	}
 	
-	// Handle NULL address_id
-	if addressID.Valid {
-		addrID := int(addressID.Int64)
-		order.AddressID = &addrID
-		
-		// Get address details if address_id is not null
-		address, err := GetAddressByID(addrID)
-		if err == nil {
-			order.Address = &address
-		}
-	}
-	
 	// Get order items
 	items, err := GetOrderItems(order.ID)
 	if err != nil {
@@ -110,17 +137,31 @@ func GetOrderByID(id int) (Order, error) {
 	}
 	order.Items = items
 	
+	// Get the persisted pricing lines
+	adjustments, err := GetOrderAdjustments(order.ID)
+	if err != nil {
+		return order, err
+	}
+	order.Adjustments = adjustments
+	
+	// Get shipments and tracking numbers
+	shipments, err := GetShipmentsByOrderID(order.ID)
+	if err != nil {
+		return order, err
+	}
+	order.Shipments = shipments
+	
 	return order, nil
 }
 
 // Get order items for a specific order
 func GetOrderItems(orderID int) ([]OrderItem, error) {
 	rows, err := DB.Query(`
-		SELECT oi.id, oi.order_id, oi.product_id, oi.quantity, oi.price,
-		       p.name, p.status
+		SELECT `+orderItemColumns+`
 		FROM order_items oi
 		JOIN products p ON oi.product_id = p.id
-		WHERE oi.order_id = ?`, orderID)
+		WHERE oi.order_id = ?
+		ORDER BY oi.id`, orderID)
 	if err != nil {
 		return nil, err
 	}
@@ -128,89 +169,126 @@ func GetOrderItems(orderID int) ([]OrderItem, error) {
 	
 	var items []OrderItem
 	for rows.Next() {
-		var oi OrderItem
-		var productName, productStatus string
-		
-		if err := rows.Scan(&oi.ID, &oi.OrderID, &oi.ProductID, &oi.Quantity, &oi.Price,
-			&productName, &productStatus); err != nil {
+		oi, err := scanOrderItem(rows)
+		if err != nil {
 			return nil, err
 		}
-		
-		// Set basic product info
-		oi.Product = Product{
-			ID:     oi.ProductID,
-			Name:   productName,
-			Status: productStatus,
-		}
-		
 		items = append(items, oi)
 	}
-	return items, nil
+	return items, rows.Err()
 }
 
 // Create a new order with items
 func CreateOrder(userID int, items []ItemRequest, addressID ...int) (int, error) {
-	// Start a transaction
-	tx, err := DB.Begin()
+	req := OrderRequest{UserID: userID, Items: items}
+	if len(addressID) > 0 {
+		req.AddressID = addressID[0]
+	}
+	return PlaceOrder(req)
+}
+
+// PlaceOrder creates an order from a request, redeeming its coupon code if one is given
+func PlaceOrder(req OrderRequest) (int, error) {
+	userID := req.UserID
+	
+	// Snapshot product prices and weights
+	orderItems, err := snapshotItems(req.Items)
 	if err != nil {
 		return 0, err
 	}
-	defer tx.Rollback() // Will be ignored if transaction is committed
 	
-	// Initialize total amount
-	var totalAmount float64 = 0
-	
-	// Calculate total amount based on product prices and quantities
-	for _, item := range items {
-		// Get product price
-		var price float64
-		err := DB.QueryRow("SELECT COALESCE((SELECT price FROM products WHERE id = ?), 0)", item.ProductID).Scan(&price)
+	// Validate the coupon before pricing; it is redeemed atomically with the order below
+	engine := activePricing()
+	var coupon *Coupon
+	if req.CouponCode != "" {
+		c, err := GetCouponByCode(req.CouponCode)
 		if err != nil {
 			return 0, err
 		}
-		
-		// Add to total
-		totalAmount += price * float64(item.Quantity)
+		if err := c.Validate(userID, orderItems, time.Now()); err != nil {
+			return 0, err
+		}
+		coupon = &c
+		engine = engine.WithDiscounts(c)
+	}
+	
+	// Look up the destination address so tax can be calculated
+	address, billing, err := resolveOrderAddresses(req)
+	if err != nil {
+		return 0, err
 	}
 	
-	var result sql.Result
+	// Calculate subtotal, discounts, shipping and tax
+	totals, err := engine.Price(&PricingContext{
+		UserID:  userID,
+		Items:   orderItems,
+		Address: address,
+	})
+	if err != nil {
+		return 0, err
+	}
 	
-	// Insert order (with or without address_id)
-	if len(addressID) > 0 && addressID[0] > 0 {
+	// Start a transaction
+	tx, err := DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // Will be ignored if transaction is committed
+	
+	var orderID int
+	
+	// Insert order (with or without address_id, which holds the shipping address)
+	if address != nil {
 		// With address
-		result, err = tx.Exec(
+		orderID, err = insertID(tx,
 			"INSERT INTO orders (user_id, address_id, total_amount, status, created_at, updated_at) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)", 
-			userID, addressID[0], totalAmount, "pending")
+			userID, address.ID, totals.Total, "pending")
 	} else {
 		// Without address
-		result, err = tx.Exec(
+		orderID, err = insertID(tx,
 			"INSERT INTO orders (user_id, total_amount, status, created_at, updated_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)", 
-			userID, totalAmount, "pending")
+			userID, totals.Total, "pending")
 	}
 	
 	if err != nil {
 		return 0, err
 	}
 	
-	// Get the order ID
-	orderID, err := result.LastInsertId()
-	if err != nil {
+	// Insert order items with their price snapshot
+	for _, item := range orderItems {
+		_, err = tx.Exec(
+			"INSERT INTO order_items (order_id, product_id, quantity, price) VALUES (?, ?, ?, ?)", 
+			orderID, item.ProductID, item.Quantity, item.Price)
+		if err != nil {
+			return 0, err
+		}
+	}
+	
+	// Reserve the ordered stock; the reservation is released if the order is cancelled
+	if err := reserveStock(tx, orderID, orderItems); err != nil {
 		return 0, err
 	}
 	
-	// Insert order items
-	for _, item := range items {
-		// Get product price again (for safety, though we calculated it above)
-		var price float64
-		err := DB.QueryRow("SELECT COALESCE((SELECT price FROM products WHERE id = ?), 0)", item.ProductID).Scan(&price)
-		if err != nil {
+	// Copy the addresses into the order so later edits to them don't change where this order goes
+	if address != nil {
+		if err := snapshotOrderAddress(tx, orderID, AddressTypeShipping, address.ID); err != nil {
 			return 0, err
 		}
-		
-		_, err = tx.Exec(
-			"INSERT INTO order_items (order_id, product_id, quantity, price) VALUES (?, ?, ?, ?)", 
-			orderID, item.ProductID, item.Quantity, price)
-		if err != nil {
+	}
+	if billing != nil {
+		if err := snapshotOrderAddress(tx, orderID, AddressTypeBilling, billing.ID); err != nil {
+			return 0, err
+		}
+	}
+	
+	// Persist totals and the computed pricing lines
+	if err := saveOrderTotals(tx, orderID, totals); err != nil {
+		return 0, err
+	}
+	
+	// Redeem the coupon in the same transaction so a failed order never consumes it
+	if coupon != nil {
+		if err := redeemCoupon(tx, *coupon, userID, orderID, totals.DiscountTotal); err != nil {
 			return 0, err
 		}
 	}
@@ -220,25 +298,167 @@ func CreateOrder(userID int, items []ItemRequest, addressID ...int) (int, error)
 		return 0, err
 	}
 	
-	return int(orderID), nil
+	return orderID, nil
 }
 
-// Update order status
+// snapshotItems resolves the current price and weight of each requested product.
+// Unknown products are priced at 0, as before.
+func snapshotItems(items []ItemRequest) ([]OrderItem, error) {
+	orderItems := make([]OrderItem, 0, len(items))
+	for _, item := range items {
+		oi := OrderItem{ProductID: item.ProductID, Quantity: item.Quantity}
+		err := DB.QueryRow(
+			"SELECT id, name, status, price, COALESCE(weight, 0), COALESCE(category, '') FROM products WHERE id = ?",
+			item.ProductID).Scan(&oi.Product.ID, &oi.Product.Name, &oi.Product.Status, &oi.Product.Price,
+			&oi.Product.Weight, &oi.Product.Category)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		oi.Price = oi.Product.Price
+		orderItems = append(orderItems, oi)
+	}
+	return orderItems, nil
+}
+
+// UpdateOrderStatus moves an order to a new status. It returns sql.ErrNoRows if the order does
+// not exist and ErrIllegalTransition if the order may not move from its current status, which is
+// read in the same transaction and must still hold when the order is updated.
 func UpdateOrderStatus(id int, status string) error {
-	_, err := DB.Exec(
-		"UPDATE orders SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", 
-		status, id)
-	return err
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	
+	var current string
+	if err := tx.QueryRow("SELECT status FROM orders WHERE id = ?", id).Scan(&current); err != nil {
+		return err
+	}
+	if current == status {
+		return nil
+	}
+	if !CanTransitionOrder(current, status) {
+		return fmt.Errorf("%w: %s to %s", ErrIllegalTransition, current, status)
+	}
+	
+	result, err := tx.Exec(
+		"UPDATE orders SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?", 
+		status, id, current)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: the order is no longer %s", ErrIllegalTransition, current)
+	}
+	
+	// A cancelled order no longer holds its stock; a shipped one has taken it
+	if err := settleStock(tx, id, status); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// Update order address
-func UpdateOrderAddress(id int, addressID int) error {
-	_, err := DB.Exec(
-		"UPDATE orders SET address_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", 
-		addressID, id)
+// Update an order's shipping or billing address, or both when addressType is empty.
+// A new shipping address reprices the order for its destination. It returns sql.ErrNoRows
+// if the order does not exist and a *ValidationError if the address cannot be used or the
+// order is no longer pending or has been invoiced.
+func UpdateOrderAddress(id int, addressType string, addressID int) error {
+	userID, err := GetOrderUserID(id)
+	if err != nil {
+		return err
+	}
+	
+	verr := &ValidationError{}
+	types := []string{AddressTypeShipping, AddressTypeBilling}
+	switch addressType {
+	case "":
+	case AddressTypeShipping, AddressTypeBilling:
+		types = []string{addressType}
+	default:
+		verr.add("type", FieldInvalid, fmt.Sprintf("type must be %s or %s", AddressTypeShipping, AddressTypeBilling))
+		return verr
+	}
+	for _, t := range types {
+		if _, err := orderAddress(userID, orderAddressRef{"address_id", addressID}, t, verr); err != nil {
+			return err
+		}
+	}
+	if err := verr.err(); err != nil {
+		return err
+	}
+	
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	
+	// Once paid, invoiced or shipped an order keeps the addresses and prices it was billed with
+	if err := checkOrderRepriceable(tx, id); err != nil {
+		return err
+	}
+	
+	reprice := false
+	for _, t := range types {
+		// orders.address_id follows the shipping address
+		if t == AddressTypeShipping {
+			_, err = tx.Exec(
+				"UPDATE orders SET address_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", 
+				addressID, id)
+			if err != nil {
+				return err
+			}
+			reprice = true
+		}
+		
+		// Replace the order's snapshot of this type with the newly assigned address
+		if err := snapshotOrderAddress(tx, id, t, addressID); err != nil {
+			return err
+		}
+	}
+	
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	
+	if !reprice {
+		return nil
+	}
+	_, err = RepriceOrder(id)
 	return err
 }
 
+// checkOrderRepriceable returns a *ValidationError unless the order is pending and not invoiced,
+// the only orders whose addresses and totals may change. Run in a transaction, it takes the order's
+// row lock (the database lock on SQLite) so a payment cannot slip in before the change is stored.
+func checkOrderRepriceable(tx *sql.Tx, id int) error {
+	result, err := tx.Exec(
+		"UPDATE orders SET updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?",
+		id, OrderStatusPending)
+	if err != nil {
+		return err
+	}
+	
+	verr := &ValidationError{}
+	if n, _ := result.RowsAffected(); n == 0 {
+		var status string
+		if err := tx.QueryRow("SELECT status FROM orders WHERE id = ?", id).Scan(&status); err != nil {
+			return err
+		}
+		verr.add("order_id", FieldInvalid, fmt.Sprintf("order %d is %s; only pending orders can change address or be repriced", id, status))
+		return verr
+	}
+	
+	invoiced, err := orderHasInvoice(tx, id)
+	if err != nil {
+		return err
+	}
+	if invoiced {
+		verr.add("order_id", FieldInvalid, fmt.Sprintf("order %d has been invoiced; its address and prices cannot change", id))
+	}
+	return verr.err()
+}
+
 // Delete an order and its items
 func DeleteOrder(id int) error {
 	// Start a transaction
@@ -248,12 +468,62 @@ func DeleteOrder(id int) error {
 	}
 	defer tx.Rollback()
 	
-	// Delete order items first (foreign key constraint)
+	// Invoices are kept for the books, so invoiced orders stay
+	invoiced, err := orderHasInvoice(tx, id)
+	if err != nil {
+		return err
+	}
+	if invoiced {
+		return ErrOrderInvoiced
+	}
+	
+	// Delete order items and pricing lines first (foreign key constraint)
 	_, err = tx.Exec("DELETE FROM order_items WHERE order_id = ?", id)
 	if err != nil {
 		return err
 	}
 	
+	_, err = tx.Exec("DELETE FROM order_adjustments WHERE order_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM order_return_items WHERE return_id IN (SELECT id FROM order_returns WHERE order_id = ?)", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM order_returns WHERE order_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM shipment_items WHERE shipment_id IN (SELECT id FROM shipments WHERE order_id = ?)", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM shipments WHERE order_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM order_addresses WHERE order_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec("DELETE FROM stock_reservations WHERE order_id = ?", id)
+	if err != nil {
+		return err
+	}
+
+	// Give back any coupon used by the order
+	err = releaseCoupons(tx, id)
+	if err != nil {
+		return err
+	}
+	
 	// Delete the order
 	_, err = tx.Exec("DELETE FROM orders WHERE id = ?", id)
 	if err != nil {
@@ -267,7 +537,7 @@ func DeleteOrder(id int) error {
 // GetPendingOrdersByUserID retrieves all pending orders for a specific user
 func GetPendingOrdersByUserID(userID int) ([]Order, error) {
 	rows, err := DB.Query(`
-		SELECT id, user_id, address_id, total_amount, status, created_at, updated_at 
+		SELECT `+orderColumns+` 
 		FROM orders 
 		WHERE user_id = ? AND status = 'pending'
 		ORDER BY created_at ASC`, userID)
@@ -278,54 +548,274 @@ func GetPendingOrdersByUserID(userID int) ([]Order, error) {
 	
 	var orders []Order
 	for rows.Next() {
-		var o Order
-		var addressID sql.NullInt64
-		if err := rows.Scan(&o.ID, &o.UserID, &addressID, &o.TotalAmount, &o.Status, &o.CreatedAt, &o.UpdatedAt); err != nil {
-			return nil, err
-		}
-		
-		// Handle NULL address_id
-		if addressID.Valid {
-			addrID := int(addressID.Int64)
-			o.AddressID = &addrID
-		}
-		
-		// Get order items for this order
-		items, err := GetOrderItems(o.ID)
+		o, err := scanOrder(rows)
 		if err != nil {
 			return nil, err
 		}
-		o.Items = items
-		
 		orders = append(orders, o)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+	
+	// Load items and addresses for all orders at once
+	if err := LoadOrderDetails(orders); err != nil {
+		return nil, err
+	}
 	return orders, nil
 }
 
-// BatchUpdateOrderStatus updates the status of multiple orders in a single transaction
-func BatchUpdateOrderStatus(orderIDs []int, status string) (int, error) {
+// Per-order results of a batch status update
+const (
+	BatchResultUpdated    = "updated"
+	BatchResultUnchanged  = "unchanged"
+	BatchResultNotFound   = "not_found"
+	BatchResultIllegal    = "illegal_transition"
+	BatchResultRolledBack = "rolled_back" // would have been updated, but the atomic batch was rejected
+)
+
+// OrderStatusResult is the outcome of a batch status update for one order
+type OrderStatusResult struct {
+	OrderID    int    `json:"order_id"`
+	Result     string `json:"result"`
+	FromStatus string `json:"from_status,omitempty"`
+	ToStatus   string `json:"to_status,omitempty"`
+}
+
+// ErrBatchRejected is returned when an all-or-nothing batch update was rolled back
+var ErrBatchRejected = errors.New("batch rejected: not every order could be updated")
+
+// BatchUpdateOrderStatus updates the status of multiple orders in a single transaction.
+// Each order gets its own result. Missing orders and illegal transitions are skipped,
+// unless atomic is set, in which case nothing is updated and ErrBatchRejected is returned.
+func BatchUpdateOrderStatus(orderIDs []int, status string, atomic bool) ([]OrderStatusResult, error) {
 	// Start a transaction
 	tx, err := DB.Begin()
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	defer tx.Rollback() // Will be ignored if transaction is committed
 	
-	updatedCount := 0
+	results := make([]OrderStatusResult, 0, len(orderIDs))
+	failed := false
 	for _, id := range orderIDs {
-		_, err := tx.Exec(
-			"UPDATE orders SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?", 
-			status, id)
+		result := OrderStatusResult{OrderID: id, ToStatus: status}
+		
+		var current string
+		err := tx.QueryRow("SELECT status FROM orders WHERE id = ?", id).Scan(&current)
+		if err == sql.ErrNoRows {
+			result.Result = BatchResultNotFound
+			result.ToStatus = ""
+			results = append(results, result)
+			failed = true
+			continue
+		}
 		if err != nil {
-			return updatedCount, err
+			return nil, err
+		}
+		result.FromStatus = current
+		
+		switch {
+		case current == status:
+			result.Result = BatchResultUnchanged
+		case !CanTransitionOrder(current, status):
+			result.Result = BatchResultIllegal
+			failed = true
+		default:
+			res, err := tx.Exec(
+				"UPDATE orders SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?", 
+				status, id, current)
+			if err != nil {
+				return nil, err
+			}
+			// Only count the order if the row was actually changed
+			if n, _ := res.RowsAffected(); n == 0 {
+				result.Result = BatchResultNotFound
+				failed = true
+			} else {
+				result.Result = BatchResultUpdated
+				if err := settleStock(tx, id, status); err != nil {
+					return nil, err
+				}
+			}
 		}
-		updatedCount++
+		results = append(results, result)
+	}
+	
+	if atomic && failed {
+		for i := range results {
+			if results[i].Result == BatchResultUpdated {
+				results[i].Result = BatchResultRolledBack
+			}
+		}
+		return results, ErrBatchRejected
 	}
 	
 	// Commit the transaction
 	if err := tx.Commit(); err != nil {
-		return updatedCount, err
+		return results, err
+	}
+	
+	return results, nil
+}
+
+// GetOrderIDs returns the IDs of orders matching a filter, oldest first, up to limit
+func GetOrderIDs(filter OrderFilter, limit int) ([]int, error) {
+	whereClause, args := buildOrderWhereClause(filter)
+	rows, err := DB.Query("SELECT id FROM orders "+whereClause+" ORDER BY created_at, id LIMIT ?", append(args, limit)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// OrderFilter holds the filters for listing orders
+type OrderFilter struct {
+	UserID      int
+	Statuses    []string
+	CreatedFrom time.Time // inclusive, zero means unbounded
+	CreatedTo   time.Time // exclusive, zero means unbounded
+	MinTotal    *float64
+	MaxTotal    *float64
+	SortBy      string // one of OrderSortColumns
+	SortDesc    bool
+}
+
+// OrderSortColumns are the columns orders can be sorted by
+var OrderSortColumns = map[string]bool{
+	"id":           true,
+	"created_at":   true,
+	"updated_at":   true,
+	"total_amount": true,
+	"status":       true,
+}
+
+type PaginatedOrders struct {
+	Orders      []Order           `json:"orders"`
+	TotalCount  int               `json:"total_count"`
+	CurrentPage int               `json:"current_page"`
+	TotalPages  int               `json:"total_pages"`
+	PerPage     int               `json:"per_page"`
+	Filters     map[string]string `json:"filters,omitempty"`
+}
+
+// sqliteTimeFormat matches the format of CURRENT_TIMESTAMP so text comparisons work
+const sqliteTimeFormat = "2006-01-02 15:04:05"
+
+// buildOrderWhereClause constructs SQL WHERE clause and arguments based on filters
+func buildOrderWhereClause(filter OrderFilter) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	
+	if filter.UserID > 0 {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, filter.UserID)
 	}
 	
-	return updatedCount, nil
-}
\ No newline at end of file
+	if len(filter.Statuses) > 0 {
+		placeholders := make([]string, len(filter.Statuses))
+		for i, status := range filter.Statuses {
+			placeholders[i] = "?"
+			args = append(args, status)
+		}
+		conditions = append(conditions, "status IN ("+strings.Join(placeholders, ", ")+")")
+	}
+	
+	if !filter.CreatedFrom.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, filter.CreatedFrom.UTC().Format(sqliteTimeFormat))
+	}
+	
+	if !filter.CreatedTo.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, filter.CreatedTo.UTC().Format(sqliteTimeFormat))
+	}
+	
+	if filter.MinTotal != nil {
+		conditions = append(conditions, "total_amount >= ?")
+		args = append(args, *filter.MinTotal)
+	}
+	
+	if filter.MaxTotal != nil {
+		conditions = append(conditions, "total_amount <= ?")
+		args = append(args, *filter.MaxTotal)
+	}
+	
+	if len(conditions) > 0 {
+		return "WHERE " + strings.Join(conditions, " AND "), args
+	}
+	
+	return "", args
+}
+
+// GetFilteredOrders returns one page of orders matching the filter, with their items
+func GetFilteredOrders(filter OrderFilter, page, perPage int) (PaginatedOrders, error) {
+	offset := (page - 1) * perPage
+	whereClause, args := buildOrderWhereClause(filter)
+	
+	// Count total orders after filtering
+	var totalCount int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM orders "+whereClause, args...).Scan(&totalCount); err != nil {
+		return PaginatedOrders{}, err
+	}
+	
+	// Only whitelisted columns are interpolated into ORDER BY
+	sortBy := "created_at"
+	if OrderSortColumns[filter.SortBy] {
+		sortBy = filter.SortBy
+	}
+	direction := "ASC"
+	if filter.SortDesc {
+		direction = "DESC"
+	}
+	
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM orders
+		%s
+		ORDER BY %s %s, id %s
+		LIMIT ? OFFSET ?`, orderColumns, whereClause, sortBy, direction, direction)
+	
+	rows, err := DB.Query(query, append(args, perPage, offset)...)
+	if err != nil {
+		return PaginatedOrders{}, err
+	}
+	defer rows.Close()
+	
+	orders := []Order{}
+	for rows.Next() {
+		o, err := scanOrder(rows)
+		if err != nil {
+			return PaginatedOrders{}, err
+		}
+		orders = append(orders, o)
+	}
+	if err := rows.Err(); err != nil {
+		return PaginatedOrders{}, err
+	}
+	rows.Close()
+	
+	// Load items and addresses for the whole page at once
+	if err := LoadOrderDetails(orders); err != nil {
+		return PaginatedOrders{}, err
+	}
+	
+	return PaginatedOrders{
+		Orders:      orders,
+		TotalCount:  totalCount,
+		CurrentPage: page,
+		TotalPages:  (totalCount + perPage - 1) / perPage,
+		PerPage:     perPage,
+	}, nil
+}
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Order address types
+const (
+	AddressTypeShipping = "shipping"
+	AddressTypeBilling  = "billing"
+)
+
+// OrderAddress is a copy of an address taken when it was attached to an order.
+// Later edits to the source address do not change it.
+type OrderAddress struct {
+	Type            string    `json:"type"`
+	SourceAddressID *int      `json:"source_address_id,omitempty"` // nil once the source address is deleted
+	StreetLine1     string    `json:"street_line1"`
+	StreetLine2     string    `json:"street_line2"`
+	City            string    `json:"city"`
+	State           string    `json:"state"`
+	PostalCode      string    `json:"postal_code"`
+	Country         string    `json:"country"`
+	CreatedAt       time.Time `json:"created_at"`
+}
+
+// AsAddress returns the snapshot as an Address, e.g. for pricing
+func (a *OrderAddress) AsAddress() *Address {
+	if a == nil {
+		return nil
+	}
+
+	address := &Address{
+		StreetLine1: a.StreetLine1,
+		StreetLine2: a.StreetLine2,
+		City:        a.City,
+		State:       a.State,
+		PostalCode:  a.PostalCode,
+		Country:     a.Country,
+	}
+	if a.SourceAddressID != nil {
+		address.ID = *a.SourceAddressID
+	}
+	return address
+}
+
+const orderAddressColumns = `type, source_address_id, street_line1, COALESCE(street_line2, ''), city, state,
+		       postal_code, country, created_at`
+
+func scanOrderAddress(row rowScanner) (int, OrderAddress, error) {
+	var orderID int
+	var a OrderAddress
+	var sourceID sql.NullInt64
+	err := row.Scan(&orderID, &a.Type, &sourceID, &a.StreetLine1, &a.StreetLine2, &a.City, &a.State,
+		&a.PostalCode, &a.Country, &a.CreatedAt)
+	if sourceID.Valid {
+		id := int(sourceID.Int64)
+		a.SourceAddressID = &id
+	}
+	return orderID, a, err
+}
+
+// attachOrderAddress sets an order address to the given type, replacing any earlier snapshot of that type
+func (o *Order) attachOrderAddress(a OrderAddress) {
+	copied := a
+	switch a.Type {
+	case AddressTypeShipping:
+		o.ShippingAddress = &copied
+	case AddressTypeBilling:
+		o.BillingAddress = &copied
+	}
+}
+
+// snapshotOrderAddress copies an address into the order as its shipping or billing address.
+// It returns sql.ErrNoRows if the address does not exist.
+func snapshotOrderAddress(tx *sql.Tx, orderID int, addressType string, addressID int) error {
+	result, err := tx.Exec(`
+		INSERT INTO order_addresses (order_id, type, source_address_id, street_line1, street_line2, city, state,
+		                             postal_code, country, created_at)
+		SELECT ?, ?, id, street_line1, street_line2, city, state, postal_code, country, CURRENT_TIMESTAMP
+		FROM addresses
+		WHERE id = ?
+		ON CONFLICT (order_id, type) DO UPDATE SET
+			source_address_id = excluded.source_address_id,
+			street_line1 = excluded.street_line1,
+			street_line2 = excluded.street_line2,
+			city = excluded.city,
+			state = excluded.state,
+			postal_code = excluded.postal_code,
+			country = excluded.country,
+			created_at = excluded.created_at`,
+		orderID, addressType, addressID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// orderAddressRef names the request field an address ID came from, for validation errors
+type orderAddressRef struct {
+	field string
+	id    int
+}
+
+// resolveOrderAddresses picks the shipping and billing addresses of a new order. Explicit IDs win,
+// then address_id for both, then the user's default address of each type. A default "both" shipping
+// address also bills when the user has no default billing address. Either address may be nil.
+func resolveOrderAddresses(req OrderRequest) (*Address, *Address, error) {
+	shippingRef := orderAddressRef{"shipping_address_id", req.ShippingAddressID}
+	if shippingRef.id == 0 {
+		shippingRef = orderAddressRef{"address_id", req.AddressID}
+	}
+	billingRef := orderAddressRef{"billing_address_id", req.BillingAddressID}
+	if billingRef.id == 0 {
+		billingRef = orderAddressRef{"address_id", req.AddressID}
+	}
+
+	verr := &ValidationError{}
+	shipping, err := orderAddress(req.UserID, shippingRef, AddressTypeShipping, verr)
+	if err != nil {
+		return nil, nil, err
+	}
+	billing, err := orderAddress(req.UserID, billingRef, AddressTypeBilling, verr)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := verr.err(); err != nil {
+		return nil, nil, err
+	}
+
+	if billing == nil && billingRef.id == 0 && shipping != nil && shipping.Bills() {
+		billing = shipping
+	}
+	return shipping, billing, nil
+}
+
+// orderAddress loads the address a request refers to for one use, or the user's default for it.
+// Problems with a requested address are added to verr.
+func orderAddress(userID int, ref orderAddressRef, addressType string, verr *ValidationError) (*Address, error) {
+	if ref.id == 0 {
+		a, err := GetDefaultAddress(userID, addressType)
+		if err == sql.ErrNoRows {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &a, nil
+	}
+
+	a, err := GetAddressByID(ref.id)
+	if err == sql.ErrNoRows {
+		verr.add(ref.field, FieldInvalid, fmt.Sprintf("address %d does not exist", ref.id))
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case a.UserID != userID:
+		verr.add(ref.field, FieldInvalid, fmt.Sprintf("address %d belongs to another user", ref.id))
+	case addressType == AddressTypeShipping && !a.ShipsTo():
+		verr.add(ref.field, FieldInvalid, fmt.Sprintf("address %d is a billing address and cannot be shipped to", ref.id))
+	case addressType == AddressTypeBilling && !a.Bills():
+		verr.add(ref.field, FieldInvalid, fmt.Sprintf("address %d is a shipping-only address and cannot be billed", ref.id))
+	default:
+		return &a, nil
+	}
+	return nil, nil
+}
+
+// loadOrderAddresses fills in the address snapshots of a page of orders
+func loadOrderAddresses(orders []Order, orderIndex map[int]int, orderIDs []int) error {
+	return forEachBatch(orderIDs, func(ids []int, args []interface{}) error {
+		rows, err := DB.Query(`
+			SELECT order_id, `+orderAddressColumns+`
+			FROM order_addresses
+			WHERE order_id IN (`+placeholders(len(ids))+`)`, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			orderID, a, err := scanOrderAddress(rows)
+			if err != nil {
+				return err
+			}
+			orders[orderIndex[orderID]].attachOrderAddress(a)
+		}
+		return rows.Err()
+	})
+}
@@ -0,0 +1,166 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// maxBatchIDs keeps IN (...) lists below SQLite's limit on bound parameters
+const maxBatchIDs = 500
+
+// orderItemColumns is the column list shared by order item queries, in scanOrderItem order
+const orderItemColumns = `oi.id, oi.order_id, oi.product_id, oi.quantity, oi.price,
+		       p.name, p.status, COALESCE(p.weight, 0), COALESCE(p.category, '')`
+
+// scanOrderItem scans a row selected with orderItemColumns
+func scanOrderItem(row rowScanner) (OrderItem, error) {
+	var oi OrderItem
+	err := row.Scan(&oi.ID, &oi.OrderID, &oi.ProductID, &oi.Quantity, &oi.Price,
+		&oi.Product.Name, &oi.Product.Status, &oi.Product.Weight, &oi.Product.Category)
+	oi.Product.ID = oi.ProductID
+	return oi, err
+}
+
+// LoadOrderDetails fills in the items and address snapshots of a page of orders.
+// It runs one query per relation (per maxBatchIDs orders) instead of one per order.
+func LoadOrderDetails(orders []Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	orderIndex := make(map[int]int, len(orders))
+	orderIDs := make([]int, 0, len(orders))
+	for i, o := range orders {
+		orderIndex[o.ID] = i
+		orderIDs = append(orderIDs, o.ID)
+	}
+
+	// Items together with their products
+	err := forEachBatch(orderIDs, func(ids []int, args []interface{}) error {
+		rows, err := DB.Query(`
+			SELECT `+orderItemColumns+`
+			FROM order_items oi
+			JOIN products p ON oi.product_id = p.id
+			WHERE oi.order_id IN (`+placeholders(len(ids))+`)
+			ORDER BY oi.order_id, oi.id`, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			item, err := scanOrderItem(rows)
+			if err != nil {
+				return err
+			}
+			i := orderIndex[item.OrderID]
+			orders[i].Items = append(orders[i].Items, item)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	// Address snapshots taken when the order was placed or its address assigned
+	return loadOrderAddresses(orders, orderIndex, orderIDs)
+}
+
+// getOrderWithAddress loads an order and its address snapshots in a single query
+func getOrderWithAddress(id int) (Order, error) {
+	rows, err := DB.Query(`
+		SELECT o.id, o.user_id, o.address_id, o.subtotal, o.discount_total, o.shipping_total, o.tax_total,
+		       o.total_amount, o.refunded_total, o.status, o.created_at, o.updated_at,
+		       oa.type, oa.source_address_id, oa.street_line1, oa.street_line2, oa.city, oa.state,
+		       oa.postal_code, oa.country, oa.created_at
+		FROM orders o
+		LEFT JOIN order_addresses oa ON oa.order_id = o.id
+		WHERE o.id = ?`, id)
+	if err != nil {
+		return Order{}, err
+	}
+	defer rows.Close()
+
+	var o Order
+	found := false
+	for rows.Next() {
+		var addressID, sourceID sql.NullInt64
+		var addrType, street1, street2, city, state, postalCode, country sql.NullString
+		var aCreatedAt sql.NullTime
+		err := rows.Scan(&o.ID, &o.UserID, &addressID, &o.Subtotal, &o.DiscountTotal, &o.ShippingTotal, &o.TaxTotal,
+			&o.TotalAmount, &o.RefundedTotal, &o.Status, &o.CreatedAt, &o.UpdatedAt,
+			&addrType, &sourceID, &street1, &street2, &city, &state, &postalCode, &country, &aCreatedAt)
+		if err != nil {
+			return o, err
+		}
+		found = true
+
+		if addressID.Valid {
+			addrID := int(addressID.Int64)
+			o.AddressID = &addrID
+		}
+
+		if addrType.Valid {
+			a := OrderAddress{
+				Type:        addrType.String,
+				StreetLine1: street1.String,
+				StreetLine2: street2.String,
+				City:        city.String,
+				State:       state.String,
+				PostalCode:  postalCode.String,
+				Country:     country.String,
+				CreatedAt:   nullTime(aCreatedAt),
+			}
+			if sourceID.Valid {
+				srcID := int(sourceID.Int64)
+				a.SourceAddressID = &srcID
+			}
+			o.attachOrderAddress(a)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return o, err
+	}
+	if !found {
+		return o, sql.ErrNoRows
+	}
+
+	o.NetTotal = roundMoney(o.TotalAmount - o.RefundedTotal)
+	return o, nil
+}
+
+func nullTime(t sql.NullTime) time.Time {
+	if t.Valid {
+		return t.Time
+	}
+	return time.Time{}
+}
+
+// forEachBatch calls fn with chunks of at most maxBatchIDs ids and the matching query arguments
+func forEachBatch(ids []int, fn func(ids []int, args []interface{}) error) error {
+	for start := 0; start < len(ids); start += maxBatchIDs {
+		end := start + maxBatchIDs
+		if end > len(ids) {
+			end = len(ids)
+		}
+
+		chunk := ids[start:end]
+		args := make([]interface{}, len(chunk))
+		for i, id := range chunk {
+			args[i] = id
+		}
+		if err := fn(chunk, args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// placeholders returns "?, ?, ..." with n placeholders
+func placeholders(n int) string {
+	if n <= 0 {
+		return ""
+	}
+	return strings.Repeat("?, ", n-1) + "?"
+}
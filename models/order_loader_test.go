@@ -0,0 +1,91 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// benchmarkOrders is the number of orders BenchmarkGetFilteredOrders seeds
+const benchmarkOrders = 10000
+
+// seedBenchmarkOrders inserts n orders of two items each, spread over 50 users, four statuses
+// and the last n minutes, in one transaction
+func seedBenchmarkOrders(b *testing.B, n int) {
+	b.Helper()
+	users := make([]int, 50)
+	for i := range users {
+		id, err := CreateUser(fmt.Sprintf("bench%d@example.com", i))
+		if err != nil {
+			b.Fatal(err)
+		}
+		users[i] = id
+	}
+	products := make([]int, 20)
+	for i := range products {
+		id, err := CreateProduct(fmt.Sprintf("Bench product %d", i), "active", float64(5+i))
+		if err != nil {
+			b.Fatal(err)
+		}
+		products[i] = id
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer tx.Rollback()
+	statuses := []string{"pending", "paid", "shipped", "cancelled"}
+	start := time.Now().UTC().Add(-time.Duration(n) * time.Minute)
+	for i := 0; i < n; i++ {
+		created := start.Add(time.Duration(i) * time.Minute).Format("2006-01-02 15:04:05")
+		orderID, err := insertID(tx,
+			"INSERT INTO orders (user_id, total_amount, status, created_at, updated_at) VALUES (?, ?, ?, ?, ?)",
+			users[i%len(users)], float64(10+i%200), statuses[i%len(statuses)], created, created)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < 2; j++ {
+			_, err := tx.Exec("INSERT INTO order_items (order_id, product_id, quantity, price) VALUES (?, ?, ?, ?)",
+				orderID, products[(i+j)%len(products)], 1+j, float64(5+j))
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkGetFilteredOrders(b *testing.B) {
+	benchmarkEachDatabase(b, func(b *testing.B) {
+		seedBenchmarkOrders(b, benchmarkOrders)
+
+		minTotal := 100.0
+		benchmarks := []struct {
+			name   string
+			filter OrderFilter
+			page   int
+		}{
+			{"newest", OrderFilter{SortBy: "created_at", SortDesc: true}, 1},
+			{"deep page", OrderFilter{SortBy: "created_at", SortDesc: true}, 400},
+			{"by user", OrderFilter{UserID: 1, SortBy: "created_at", SortDesc: true}, 1},
+			{"by status", OrderFilter{Statuses: []string{"paid", "shipped"}, SortBy: "total_amount"}, 1},
+			{"by total", OrderFilter{MinTotal: &minTotal, SortBy: "id"}, 1},
+		}
+		for _, bm := range benchmarks {
+			b.Run(bm.name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					result, err := GetFilteredOrders(bm.filter, bm.page, 25)
+					if err != nil {
+						b.Fatal(err)
+					}
+					if len(result.Orders) == 0 {
+						b.Fatal("no orders returned")
+					}
+				}
+			})
+		}
+	})
+}
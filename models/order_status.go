@@ -0,0 +1,80 @@
+package models
+
+import "errors"
+
+// Order statuses
+const (
+	OrderStatusPending    = "pending"
+	OrderStatusPaid       = "paid"
+	OrderStatusProcessing = "processing"
+	OrderStatusShipped    = "shipped"
+	OrderStatusDelivered  = "delivered"
+	OrderStatusCompleted  = "completed"
+	OrderStatusCancelled  = "cancelled"
+	OrderStatusRefunded   = "refunded"
+
+	OrderStatusPartiallyRefunded = "partially_refunded"
+)
+
+// ErrIllegalTransition is returned when an order may not move from its current status to the
+// one requested
+var ErrIllegalTransition = errors.New("illegal order status transition")
+
+// orderTransitions lists the statuses an order may move to from each status
+var orderTransitions = map[string][]string{
+	OrderStatusPending:           {OrderStatusPaid, OrderStatusProcessing, OrderStatusCancelled},
+	OrderStatusPaid:              {OrderStatusProcessing, OrderStatusShipped, OrderStatusCancelled, OrderStatusPartiallyRefunded, OrderStatusRefunded},
+	OrderStatusProcessing:        {OrderStatusShipped, OrderStatusCompleted, OrderStatusCancelled, OrderStatusPartiallyRefunded, OrderStatusRefunded},
+	OrderStatusShipped:           {OrderStatusDelivered, OrderStatusCompleted, OrderStatusPartiallyRefunded, OrderStatusRefunded},
+	OrderStatusDelivered:         {OrderStatusCompleted, OrderStatusPartiallyRefunded, OrderStatusRefunded},
+	OrderStatusCompleted:         {OrderStatusPartiallyRefunded, OrderStatusRefunded},
+	OrderStatusPartiallyRefunded: {OrderStatusCompleted, OrderStatusRefunded},
+	OrderStatusCancelled:         {},
+	OrderStatusRefunded:          {},
+}
+
+// IsValidOrderStatus reports whether status is a known order status
+func IsValidOrderStatus(status string) bool {
+	_, ok := orderTransitions[status]
+	return ok
+}
+
+// CanTransitionOrder reports whether an order may move from one status to another.
+// Unknown current statuses (e.g. from old data) may move anywhere.
+func CanTransitionOrder(from, to string) bool {
+	allowed, ok := orderTransitions[from]
+	if !ok {
+		return IsValidOrderStatus(to)
+	}
+	for _, status := range allowed {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderStatusPath returns the shortest series of allowed transitions that moves an order from
+// one status to another, without from, or nil if to cannot be reached
+func OrderStatusPath(from, to string) []string {
+	previous := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 {
+		status := queue[0]
+		queue = queue[1:]
+		if status == to {
+			var path []string
+			for ; status != from; status = previous[status] {
+				path = append([]string{status}, path...)
+			}
+			return path
+		}
+		for _, next := range orderTransitions[status] {
+			if _, seen := previous[next]; !seen {
+				previous[next] = status
+				queue = append(queue, next)
+			}
+		}
+	}
+	return nil
+}
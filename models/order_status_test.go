@@ -0,0 +1,59 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestOrderStatusPath(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     []string
+	}{
+		{OrderStatusPending, OrderStatusPaid, []string{OrderStatusPaid}},
+		{OrderStatusPending, OrderStatusCompleted, []string{OrderStatusProcessing, OrderStatusCompleted}},
+		{OrderStatusPending, OrderStatusDelivered, []string{OrderStatusPaid, OrderStatusShipped, OrderStatusDelivered}},
+		{OrderStatusPending, OrderStatusRefunded, []string{OrderStatusPaid, OrderStatusRefunded}},
+		{OrderStatusCancelled, OrderStatusPaid, nil},
+	}
+	for _, tt := range tests {
+		if got := OrderStatusPath(tt.from, tt.to); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("OrderStatusPath(%s, %s) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestUpdateOrderStatusChecksTransitions(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		orderID := createTestOrder(t, createTestUser(t), createTestProduct(t, 10, 5), 1)
+
+		if err := UpdateOrderStatus(orderID, OrderStatusPaid); err != nil {
+			t.Fatalf("pending to paid: %v", err)
+		}
+		if err := UpdateOrderStatus(orderID, OrderStatusPaid); err != nil {
+			t.Fatalf("paid to paid: %v", err)
+		}
+		if err := UpdateOrderStatus(orderID, OrderStatusPending); !errors.Is(err, ErrIllegalTransition) {
+			t.Fatalf("paid to pending: got %v, want %v", err, ErrIllegalTransition)
+		}
+		if err := UpdateOrderStatus(orderID, OrderStatusCancelled); err != nil {
+			t.Fatalf("paid to cancelled: %v", err)
+		}
+		if err := UpdateOrderStatus(orderID, OrderStatusPaid); !errors.Is(err, ErrIllegalTransition) {
+			t.Fatalf("cancelled to paid: got %v, want %v", err, ErrIllegalTransition)
+		}
+
+		order, err := GetOrderByID(orderID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if order.Status != OrderStatusCancelled {
+			t.Errorf("status = %s, want %s", order.Status, OrderStatusCancelled)
+		}
+		if err := UpdateOrderStatus(orderID+1000, OrderStatusPaid); err != sql.ErrNoRows {
+			t.Errorf("missing order: got %v, want %v", err, sql.ErrNoRows)
+		}
+	})
+}
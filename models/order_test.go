@@ -0,0 +1,62 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestUpdateOrderAddressOnlyRepricesPendingOrders(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		userID := createTestUser(t)
+		productID := createTestProduct(t, 20, 10)
+		addressID, err := CreateAddress(Address{
+			UserID:      userID,
+			Type:        AddressUseBoth,
+			StreetLine1: "1 Main St",
+			City:        "Austin",
+			State:       "TX",
+			PostalCode:  "73301",
+			Country:     "US",
+		})
+		if err != nil {
+			t.Fatalf("creating an address: %v", err)
+		}
+
+		pending := createTestOrder(t, userID, productID, 1)
+		if err := UpdateOrderAddress(pending, "", addressID); err != nil {
+			t.Fatalf("changing the address of a pending order: %v", err)
+		}
+		order, err := GetOrderByID(pending)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if order.AddressID == nil || *order.AddressID != addressID {
+			t.Errorf("address_id = %v, want %d", order.AddressID, addressID)
+		}
+
+		paid := createTestOrder(t, userID, productID, 1)
+		if err := UpdateOrderStatus(paid, OrderStatusPaid); err != nil {
+			t.Fatal(err)
+		}
+		before, err := GetOrderByID(paid)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var verr *ValidationError
+		if err := UpdateOrderAddress(paid, AddressTypeShipping, addressID); !errors.As(err, &verr) {
+			t.Fatalf("changing the address of a paid order: got %v, want a *ValidationError", err)
+		}
+		if _, err := RepriceOrder(paid); !errors.As(err, &verr) {
+			t.Fatalf("repricing a paid order: got %v, want a *ValidationError", err)
+		}
+
+		after, err := GetOrderByID(paid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if after.AddressID != nil || after.TotalAmount != before.TotalAmount {
+			t.Errorf("paid order changed: address_id %v, total %.2f -> %.2f", after.AddressID, before.TotalAmount, after.TotalAmount)
+		}
+	})
+}
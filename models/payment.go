@@ -0,0 +1,287 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-crud/payments"
+)
+
+type Payment struct {
+	ID             int       `json:"id"`
+	OrderID        int       `json:"order_id"`
+	Provider       string    `json:"provider"`
+	ProviderRef    string    `json:"provider_ref"`
+	Status         string    `json:"status"`
+	Amount         float64   `json:"amount"`
+	CapturedAmount float64   `json:"captured_amount"`
+	RefundedAmount float64   `json:"refunded_amount"`
+	FailureReason  string    `json:"failure_reason,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// Errors of payments
+var (
+	ErrPaymentNotFound    = errors.New("payment not found")
+	ErrOrderNotPayable    = errors.New("only pending orders can be paid")
+	ErrOrderPaymentActive = errors.New("order already has an authorized or captured payment")
+)
+
+const paymentColumns = `id, order_id, provider, provider_ref, status, amount, captured_amount, refunded_amount,
+		       COALESCE(failure_reason, ''), created_at, updated_at`
+
+func scanPayment(row rowScanner) (Payment, error) {
+	var p Payment
+	err := row.Scan(&p.ID, &p.OrderID, &p.Provider, &p.ProviderRef, &p.Status, &p.Amount, &p.CapturedAmount,
+		&p.RefundedAmount, &p.FailureReason, &p.CreatedAt, &p.UpdatedAt)
+	return p, err
+}
+
+// CreatePayment records a payment attempt
+func CreatePayment(p Payment) (int, error) {
+	return insertPayment(DB, p)
+}
+
+func insertPayment(q inserter, p Payment) (int, error) {
+	return insertID(q, `
+		INSERT INTO payments (order_id, provider, provider_ref, status, amount, captured_amount, refunded_amount,
+		                      failure_reason, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
+		p.OrderID, p.Provider, p.ProviderRef, p.Status, p.Amount, p.CapturedAmount, p.RefundedAmount, p.FailureReason)
+}
+
+// UpdatePaymentFromProvider stores the provider's latest view of a payment
+func UpdatePaymentFromProvider(id int, result payments.Result, failureReason string) error {
+	return updatePaymentFromProvider(DB, id, result, failureReason)
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func updatePaymentFromProvider(q execer, id int, result payments.Result, failureReason string) error {
+	_, err := q.Exec(`
+		UPDATE payments
+		SET status = ?, captured_amount = ?, refunded_amount = ?, failure_reason = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		result.Status, result.CapturedAmount, result.RefundedAmount, failureReason, id)
+	return err
+}
+
+// GetPaymentByID returns a payment
+func GetPaymentByID(id int) (Payment, error) {
+	p, err := scanPayment(DB.QueryRow(`SELECT `+paymentColumns+` FROM payments WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return p, ErrPaymentNotFound
+	}
+	return p, err
+}
+
+// GetPaymentByProviderRef returns the payment with a provider's reference
+func GetPaymentByProviderRef(provider, reference string) (Payment, error) {
+	p, err := scanPayment(DB.QueryRow(`SELECT `+paymentColumns+` FROM payments WHERE provider = ? AND provider_ref = ?`,
+		provider, reference))
+	if err == sql.ErrNoRows {
+		return p, ErrPaymentNotFound
+	}
+	return p, err
+}
+
+// GetPaymentsByOrderID returns all payment attempts of an order, oldest first
+func GetPaymentsByOrderID(orderID int) ([]Payment, error) {
+	rows, err := DB.Query(`SELECT `+paymentColumns+` FROM payments WHERE order_id = ? ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Payment
+	for rows.Next() {
+		p, err := scanPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+// ChargeOrder makes a payment attempt on a pending order. charge is given the order total and
+// the attempt number and calls the provider while the order row is locked, so concurrent
+// requests cannot both charge the order. The payment it returns is recorded in the same
+// transaction if it has a provider reference, even when charge also returns an error such as
+// a decline; that error is returned after the payment is stored. Orders that are not pending
+// fail with ErrOrderNotPayable, and orders with an authorized or captured payment with
+// ErrOrderPaymentActive.
+func ChargeOrder(orderID int, charge func(total float64, attempt int) (Payment, error)) (Payment, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return Payment{}, err
+	}
+	defer tx.Rollback()
+
+	// Take the order's row lock
+	result, err := tx.Exec("UPDATE orders SET updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?",
+		orderID, OrderStatusPending)
+	if err != nil {
+		return Payment{}, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return Payment{}, err
+	} else if n == 0 {
+		var status string
+		if err := tx.QueryRow("SELECT status FROM orders WHERE id = ?", orderID).Scan(&status); err != nil {
+			return Payment{}, err
+		}
+		return Payment{}, fmt.Errorf("%w, order is %s", ErrOrderNotPayable, status)
+	}
+
+	var total float64
+	if err := tx.QueryRow("SELECT total_amount FROM orders WHERE id = ?", orderID).Scan(&total); err != nil {
+		return Payment{}, err
+	}
+	var attempts, active int
+	err = tx.QueryRow(`
+		SELECT COUNT(*), COALESCE(SUM(CASE WHEN status IN (?, ?) THEN 1 ELSE 0 END), 0)
+		FROM payments WHERE order_id = ?`,
+		payments.StatusAuthorized, payments.StatusCaptured, orderID).Scan(&attempts, &active)
+	if err != nil {
+		return Payment{}, err
+	}
+	if active > 0 {
+		return Payment{}, ErrOrderPaymentActive
+	}
+
+	p, chargeErr := charge(total, attempts+1)
+	if p.ProviderRef == "" {
+		return p, chargeErr
+	}
+	p.OrderID = orderID
+	if p.ID, err = insertPayment(tx, p); err != nil {
+		return p, err
+	}
+	if err := tx.Commit(); err != nil {
+		return p, err
+	}
+	return p, chargeErr
+}
+
+// ApplyWebhookEvent records a provider event ID and stores the payment update it reports, in one
+// transaction, so an event is only marked processed once its update is stored. It returns false,
+// leaving the payment alone, if the event was already processed.
+func ApplyWebhookEvent(provider, eventID, eventType string, paymentID int, result payments.Result, failureReason string) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	inserted, err := tx.Exec(`
+		INSERT INTO payment_webhook_events (provider, event_id, event_type, received_at)
+		VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT (provider, event_id) DO NOTHING`, provider, eventID, eventType)
+	if err != nil {
+		return false, err
+	}
+	if n, err := inserted.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	if err := updatePaymentFromProvider(tx, paymentID, result, failureReason); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// SyncOrderPaymentStatus moves an order through its lifecycle based on its payments and refunds:
+// a pending order becomes paid once the captured amount covers the total, and an order with
+// refunds becomes partially_refunded or, once refunds cover the total, refunded.
+func SyncOrderPaymentStatus(orderID int) (string, error) {
+	var status string
+	var total, refundedTotal float64
+	err := DB.QueryRow("SELECT status, total_amount, COALESCE(refunded_total, 0) FROM orders WHERE id = ?", orderID).
+		Scan(&status, &total, &refundedTotal)
+	if err != nil {
+		return "", err
+	}
+
+	var captured, refunded float64
+	err = DB.QueryRow(`
+		SELECT COALESCE(SUM(captured_amount), 0), COALESCE(SUM(refunded_amount), 0)
+		FROM payments
+		WHERE order_id = ?`, orderID).Scan(&captured, &refunded)
+	if err != nil {
+		return "", err
+	}
+
+	// Refunds made directly at the provider (reported by webhook) count towards the order too
+	if roundMoney(refunded) > roundMoney(refundedTotal) {
+		refundedTotal = roundMoney(refunded)
+		_, err = DB.Exec("UPDATE orders SET refunded_total = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+			refundedTotal, orderID)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	next := status
+	switch {
+	case refundedTotal > 0 && roundMoney(refundedTotal) >= roundMoney(total):
+		next = OrderStatusRefunded
+	case refundedTotal > 0:
+		next = OrderStatusPartiallyRefunded
+	case status == OrderStatusPending && roundMoney(captured-refunded) >= roundMoney(total):
+		next = OrderStatusPaid
+	}
+
+	if next == status || !CanTransitionOrder(status, next) {
+		return status, nil
+	}
+	return next, UpdateOrderStatus(orderID, next)
+}
+
+// refundOrderPayments refunds up to amount against the order's captured payments, newest first.
+// Each provider refund is recorded as it succeeds and reported through onRefund, so a failed
+// run can be retried for the remainder. It returns the amount actually refunded.
+func refundOrderPayments(orderID int, amount float64, onRefund func(amount float64) error) (float64, error) {
+	list, err := GetPaymentsByOrderID(orderID)
+	if err != nil {
+		return 0, err
+	}
+
+	refunded := 0.0
+	for i := len(list) - 1; i >= 0 && roundMoney(amount-refunded) > 0; i-- {
+		p := list[i]
+		available := roundMoney(p.CapturedAmount - p.RefundedAmount)
+		if available <= 0 {
+			continue
+		}
+
+		take := roundMoney(amount - refunded)
+		if take > available {
+			take = available
+		}
+
+		provider, err := payments.Get(p.Provider)
+		if err != nil {
+			return refunded, err
+		}
+		result, err := provider.Refund(p.ProviderRef, take)
+		if err != nil {
+			return refunded, fmt.Errorf("refunding payment %d: %w", p.ID, err)
+		}
+		if err := UpdatePaymentFromProvider(p.ID, result, p.FailureReason); err != nil {
+			return refunded, err
+		}
+
+		refunded = roundMoney(refunded + take)
+		if err := onRefund(take); err != nil {
+			return refunded, err
+		}
+	}
+	return refunded, nil
+}
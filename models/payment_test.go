@@ -0,0 +1,135 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-crud/payments"
+)
+
+func TestApplyWebhookEventOnce(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		orderID := createTestOrder(t, createTestUser(t), createTestProduct(t, 20, 5), 1)
+		paymentID, err := CreatePayment(Payment{OrderID: orderID, Provider: "mock", ProviderRef: "ref_1",
+			Status: payments.StatusAuthorized, Amount: 20})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		captured := payments.Result{Reference: "ref_1", Status: payments.StatusCaptured, Amount: 20, CapturedAmount: 20}
+		applied, err := ApplyWebhookEvent("mock", "evt_1", "payment.captured", paymentID, captured, "")
+		if err != nil || !applied {
+			t.Fatalf("first delivery: applied %v, err %v", applied, err)
+		}
+
+		// A redelivery of the same event leaves the payment alone, even with other data
+		voided := payments.Result{Reference: "ref_1", Status: payments.StatusVoided, Amount: 20}
+		applied, err = ApplyWebhookEvent("mock", "evt_1", "payment.voided", paymentID, voided, "")
+		if err != nil || applied {
+			t.Fatalf("redelivery: applied %v, err %v", applied, err)
+		}
+
+		payment, err := GetPaymentByID(paymentID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if payment.Status != payments.StatusCaptured || payment.CapturedAmount != 20 {
+			t.Errorf("payment is %s with %.2f captured, want %s with 20.00", payment.Status, payment.CapturedAmount, payments.StatusCaptured)
+		}
+	})
+}
+
+func TestApplyWebhookEventRollsBackOnFailure(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		// Without the payments table the update fails; the event must not be marked processed
+		mustExec(t, "ALTER TABLE payments RENAME TO payments_gone")
+		result := payments.Result{Reference: "ref_1", Status: payments.StatusCaptured, Amount: 20, CapturedAmount: 20}
+		if _, err := ApplyWebhookEvent("mock", "evt_2", "payment.captured", 1, result, ""); err == nil {
+			t.Fatal("expected the payment update to fail")
+		}
+
+		var recorded int
+		if err := DB.QueryRow("SELECT COUNT(*) FROM payment_webhook_events WHERE event_id = ?", "evt_2").Scan(&recorded); err != nil {
+			t.Fatal(err)
+		}
+		if recorded != 0 {
+			t.Errorf("the event was recorded although its update failed")
+		}
+	})
+}
+
+func TestChargeOrderConcurrently(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		orderID := createTestOrder(t, createTestUser(t), createTestProduct(t, 20, 5), 1)
+
+		var charges atomic.Int32
+		charge := func(total float64, attempt int) (Payment, error) {
+			charges.Add(1)
+			time.Sleep(10 * time.Millisecond)
+			ref := fmt.Sprintf("ref_%d", attempt)
+			return Payment{Provider: "mock", ProviderRef: ref, Status: payments.StatusCaptured, Amount: total, CapturedAmount: total}, nil
+		}
+
+		var wg sync.WaitGroup
+		for i := 0; i < 6; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, err := ChargeOrder(orderID, charge)
+				if err != nil && !errors.Is(err, ErrOrderPaymentActive) {
+					t.Errorf("concurrent charge: %v", err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		list, err := GetPaymentsByOrderID(orderID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := charges.Load(); n != 1 || len(list) != 1 {
+			t.Fatalf("order charged %d times with %d payments recorded, want 1", n, len(list))
+		}
+	})
+}
+
+func TestChargeOrderRecordsDeclines(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		orderID := createTestOrder(t, createTestUser(t), createTestProduct(t, 20, 5), 1)
+
+		declined, err := ChargeOrder(orderID, func(total float64, attempt int) (Payment, error) {
+			return Payment{Provider: "mock", ProviderRef: "ref_declined", Status: payments.StatusFailed, Amount: total}, payments.ErrDeclined
+		})
+		if !errors.Is(err, payments.ErrDeclined) || declined.ID == 0 {
+			t.Fatalf("declined charge: %+v, %v", declined, err)
+		}
+
+		// An attempt without a provider reference records nothing
+		if _, err := ChargeOrder(orderID, func(float64, int) (Payment, error) { return Payment{}, errors.New("timeout") }); err == nil {
+			t.Fatal("failed charge returned no error")
+		}
+
+		var attempt int
+		paid, err := ChargeOrder(orderID, func(total float64, n int) (Payment, error) {
+			attempt = n
+			return Payment{Provider: "mock", ProviderRef: "ref_paid", Status: payments.StatusCaptured, Amount: total, CapturedAmount: total}, nil
+		})
+		if err != nil || attempt != 2 || paid.Amount != 20 {
+			t.Fatalf("charge after a decline: attempt %d, %+v, %v", attempt, paid, err)
+		}
+		if _, err := SyncOrderPaymentStatus(orderID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ChargeOrder(orderID, nil); !errors.Is(err, ErrOrderNotPayable) {
+			t.Errorf("charging a paid order: %v", err)
+		}
+		if _, err := ChargeOrder(orderID+100, nil); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("charging a missing order: %v", err)
+		}
+	})
+}
@@ -0,0 +1,464 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"strings"
+
+	"go-crud/config"
+	"go-crud/geo"
+)
+
+// Adjustment types stored in order_adjustments
+const (
+	AdjustmentDiscount = "discount"
+	AdjustmentShipping = "shipping"
+	AdjustmentTax      = "tax"
+)
+
+// OrderAdjustment is one computed pricing line (discount, shipping or tax) of an order.
+// Lines are persisted so an invoice can be reproduced exactly as it was priced.
+type OrderAdjustment struct {
+	ID          int     `json:"id,omitempty"`
+	OrderID     int     `json:"order_id,omitempty"`
+	Type        string  `json:"type"`
+	Code        string  `json:"code"`
+	Description string  `json:"description"`
+	Rate        float64 `json:"rate,omitempty"`
+	Amount      float64 `json:"amount"`
+}
+
+// PricingContext carries everything a calculator needs to price an order
+type PricingContext struct {
+	UserID   int
+	Items    []OrderItem // items with their price snapshot and product details
+	Address  *Address    // shipping destination, nil when not known yet
+	Subtotal float64
+	Discount float64 // discount applied so far, updated as discount calculators run
+
+	// FreeShippingCode is set by a discount that waives shipping, e.g. a free shipping coupon
+	FreeShippingCode string
+}
+
+// Weight returns the total weight of all items in the order
+func (c *PricingContext) Weight() float64 {
+	var weight float64
+	for _, item := range c.Items {
+		weight += item.Product.Weight * float64(item.Quantity)
+	}
+	return weight
+}
+
+// OrderTotals is the result of pricing an order
+type OrderTotals struct {
+	Subtotal      float64
+	DiscountTotal float64
+	ShippingTotal float64
+	TaxTotal      float64
+	Total         float64
+	Adjustments   []OrderAdjustment
+}
+
+// DiscountCalculator computes discount lines for an order
+type DiscountCalculator interface {
+	Discount(ctx *PricingContext) ([]OrderAdjustment, error)
+}
+
+// ShippingCalculator computes shipping lines for an order
+type ShippingCalculator interface {
+	Shipping(ctx *PricingContext) ([]OrderAdjustment, error)
+}
+
+// TaxCalculator computes tax lines for an order
+type TaxCalculator interface {
+	Tax(ctx *PricingContext) ([]OrderAdjustment, error)
+}
+
+// PricingEngine runs the configured calculators in order: discounts, shipping, then tax.
+// Any calculator may be nil, in which case that step is skipped.
+type PricingEngine struct {
+	Discounts []DiscountCalculator
+	Shipping  ShippingCalculator
+	Tax       TaxCalculator
+}
+
+// Pricing is the engine used when creating and repricing orders.
+// When nil, an engine built from config.AppConfig is used.
+var Pricing *PricingEngine
+
+func activePricing() *PricingEngine {
+	if Pricing != nil {
+		return Pricing
+	}
+	return NewDefaultPricingEngine()
+}
+
+// NewDefaultPricingEngine builds a pricing engine from the application configuration
+func NewDefaultPricingEngine() *PricingEngine {
+	cfg := config.AppConfig
+
+	var shipping ShippingCalculator
+	switch cfg.ShippingMode {
+	case "weight":
+		shipping = WeightBasedShipping{
+			BaseRate: cfg.ShippingBaseRate,
+			PerKg:    cfg.ShippingPerKg,
+			FreeOver: cfg.FreeShippingThreshold,
+		}
+	case "none":
+		shipping = nil
+	default:
+		shipping = FlatRateShipping{
+			Rate:     cfg.ShippingBaseRate,
+			FreeOver: cfg.FreeShippingThreshold,
+		}
+	}
+
+	return &PricingEngine{
+		Shipping: shipping,
+		Tax:      RegionTaxCalculator{},
+	}
+}
+
+// WithDiscounts returns a copy of the engine with additional discount calculators
+func (e *PricingEngine) WithDiscounts(discounts ...DiscountCalculator) *PricingEngine {
+	copied := *e
+	copied.Discounts = append(append([]DiscountCalculator{}, e.Discounts...), discounts...)
+	return &copied
+}
+
+// Price computes the totals and adjustment lines for an order
+func (e *PricingEngine) Price(ctx *PricingContext) (OrderTotals, error) {
+	var totals OrderTotals
+
+	ctx.Subtotal = 0
+	ctx.Discount = 0
+	ctx.FreeShippingCode = ""
+	for _, item := range ctx.Items {
+		ctx.Subtotal += item.Price * float64(item.Quantity)
+	}
+	ctx.Subtotal = roundMoney(ctx.Subtotal)
+	totals.Subtotal = ctx.Subtotal
+
+	// Discounts are applied first and can never exceed the subtotal
+	for _, calc := range e.Discounts {
+		lines, err := calc.Discount(ctx)
+		if err != nil {
+			return totals, err
+		}
+		for _, line := range lines {
+			line.Type = AdjustmentDiscount
+			line.Amount = roundMoney(math.Min(line.Amount, ctx.Subtotal-ctx.Discount))
+			if line.Amount <= 0 {
+				continue
+			}
+			ctx.Discount = roundMoney(ctx.Discount + line.Amount)
+			totals.Adjustments = append(totals.Adjustments, line)
+		}
+	}
+	totals.DiscountTotal = ctx.Discount
+
+	if e.Shipping != nil {
+		lines, err := e.Shipping.Shipping(ctx)
+		if err != nil {
+			return totals, err
+		}
+		for _, line := range lines {
+			line.Type = AdjustmentShipping
+			line.Amount = roundMoney(line.Amount)
+			if ctx.FreeShippingCode != "" {
+				line.Amount = 0
+				line.Description += " (waived by " + ctx.FreeShippingCode + ")"
+			}
+			totals.ShippingTotal = roundMoney(totals.ShippingTotal + line.Amount)
+			totals.Adjustments = append(totals.Adjustments, line)
+		}
+	}
+
+	if e.Tax != nil {
+		lines, err := e.Tax.Tax(ctx)
+		if err != nil {
+			return totals, err
+		}
+		for _, line := range lines {
+			line.Type = AdjustmentTax
+			line.Amount = roundMoney(line.Amount)
+			totals.TaxTotal = roundMoney(totals.TaxTotal + line.Amount)
+			totals.Adjustments = append(totals.Adjustments, line)
+		}
+	}
+
+	totals.Total = roundMoney(totals.Subtotal - totals.DiscountTotal + totals.ShippingTotal + totals.TaxTotal)
+	return totals, nil
+}
+
+// PercentageDiscount takes a percentage off the order subtotal
+type PercentageDiscount struct {
+	Code    string
+	Percent float64
+}
+
+func (d PercentageDiscount) Discount(ctx *PricingContext) ([]OrderAdjustment, error) {
+	return []OrderAdjustment{{
+		Code:        d.Code,
+		Description: fmt.Sprintf("%g%% off", d.Percent),
+		Rate:        d.Percent / 100,
+		Amount:      ctx.Subtotal * d.Percent / 100,
+	}}, nil
+}
+
+// FixedDiscount takes a fixed amount off the order subtotal
+type FixedDiscount struct {
+	Code   string
+	Amount float64
+}
+
+func (d FixedDiscount) Discount(ctx *PricingContext) ([]OrderAdjustment, error) {
+	return []OrderAdjustment{{
+		Code:        d.Code,
+		Description: fmt.Sprintf("%.2f off", d.Amount),
+		Amount:      d.Amount,
+	}}, nil
+}
+
+// FlatRateShipping charges a single rate per order, free above an optional threshold
+type FlatRateShipping struct {
+	Rate     float64
+	FreeOver float64 // 0 disables free shipping
+}
+
+func (s FlatRateShipping) Shipping(ctx *PricingContext) ([]OrderAdjustment, error) {
+	amount := s.Rate
+	if s.FreeOver > 0 && ctx.Subtotal-ctx.Discount >= s.FreeOver {
+		amount = 0
+	}
+	return []OrderAdjustment{{
+		Code:        "flat_rate",
+		Description: "Flat rate shipping",
+		Amount:      amount,
+	}}, nil
+}
+
+// WeightBasedShipping charges a base rate plus a rate per kilogram of item weight
+type WeightBasedShipping struct {
+	BaseRate float64
+	PerKg    float64
+	FreeOver float64 // 0 disables free shipping
+}
+
+func (s WeightBasedShipping) Shipping(ctx *PricingContext) ([]OrderAdjustment, error) {
+	weight := ctx.Weight()
+	amount := s.BaseRate + weight*s.PerKg
+	if s.FreeOver > 0 && ctx.Subtotal-ctx.Discount >= s.FreeOver {
+		amount = 0
+	}
+	return []OrderAdjustment{{
+		Code:        "weight",
+		Description: fmt.Sprintf("Shipping for %.2f kg", weight),
+		Rate:        s.PerKg,
+		Amount:      amount,
+	}}, nil
+}
+
+// RegionTaxCalculator applies the tax_rates entry for the destination country and state.
+// A state-specific rate takes precedence over the country-wide rate (empty state).
+// Orders without an address are not taxed until one is assigned.
+type RegionTaxCalculator struct{}
+
+func (RegionTaxCalculator) Tax(ctx *PricingContext) ([]OrderAdjustment, error) {
+	if ctx.Address == nil {
+		return nil, nil
+	}
+
+	rate, err := GetTaxRate(ctx.Address.Country, ctx.Address.State)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	taxable := ctx.Subtotal - ctx.Discount
+	return []OrderAdjustment{{
+		Code:        rate.Code(),
+		Description: rate.Name,
+		Rate:        rate.Rate,
+		Amount:      taxable * rate.Rate,
+	}}, nil
+}
+
+// TaxRate is a tax rate for a country, optionally narrowed to a state
+type TaxRate struct {
+	ID      int     `json:"id"`
+	Country string  `json:"country"`
+	State   string  `json:"state"`
+	Rate    float64 `json:"rate"`
+	Name    string  `json:"name"`
+}
+
+// Code returns the identifier stored on tax adjustment lines, e.g. "US-NY"
+func (t TaxRate) Code() string {
+	if t.State == "" {
+		return t.Country
+	}
+	return t.Country + "-" + t.State
+}
+
+// GetTaxRate finds the most specific tax rate for a country and state.
+// Names are matched by their codes, so "United States" / "California" finds US-CA.
+func GetTaxRate(country, state string) (TaxRate, error) {
+	country, state = normalizeRegion(country, state)
+	var rate TaxRate
+	var name sql.NullString
+	err := DB.QueryRow(`
+		SELECT id, country, state, rate, name
+		FROM tax_rates
+		WHERE UPPER(country) = UPPER(?) AND (UPPER(state) = UPPER(?) OR state = '')
+		ORDER BY state DESC
+		LIMIT 1`, country, state).Scan(&rate.ID, &rate.Country, &rate.State, &rate.Rate, &name)
+	rate.Name = name.String
+	return rate, err
+}
+
+// GetTaxRates returns all configured tax rates
+func GetTaxRates() ([]TaxRate, error) {
+	rows, err := DB.Query("SELECT id, country, state, rate, COALESCE(name, '') FROM tax_rates ORDER BY country, state")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []TaxRate
+	for rows.Next() {
+		var t TaxRate
+		if err := rows.Scan(&t.ID, &t.Country, &t.State, &t.Rate, &t.Name); err != nil {
+			return nil, err
+		}
+		rates = append(rates, t)
+	}
+	return rates, rows.Err()
+}
+
+// SetTaxRate creates or replaces the tax rate for a country and state, stored by their codes.
+// It returns a *ValidationError if the country or state is not known.
+func SetTaxRate(country, state string, rate float64, name string) error {
+	c, ok := geo.LookupCountry(country)
+	if !ok {
+		verr := &ValidationError{}
+		verr.add("country", FieldUnknownCountry, fmt.Sprintf("%q is not a known country; use an ISO 3166 code such as US", country))
+		return verr
+	}
+	country, state = normalizeRegion(country, strings.ToUpper(cleanText(state)))
+	if state != "" && c.HasSubdivisions() {
+		if _, ok := c.LookupSubdivision(state); !ok {
+			verr := &ValidationError{}
+			verr.add("state", FieldUnknownState, fmt.Sprintf("%q is not a state or province of %s", state, c.Name))
+			return verr
+		}
+	}
+
+	_, err := DB.Exec(`
+		INSERT INTO tax_rates (country, state, rate, name) VALUES (?, ?, ?, ?)
+		ON CONFLICT (country, state) DO UPDATE SET rate = excluded.rate, name = excluded.name`,
+		country, state, rate, name)
+	return err
+}
+
+// GetOrderAdjustments returns the persisted pricing lines of an order
+func GetOrderAdjustments(orderID int) ([]OrderAdjustment, error) {
+	rows, err := DB.Query(`
+		SELECT id, order_id, type, code, COALESCE(description, ''), rate, amount
+		FROM order_adjustments
+		WHERE order_id = ?
+		ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var adjustments []OrderAdjustment
+	for rows.Next() {
+		var a OrderAdjustment
+		if err := rows.Scan(&a.ID, &a.OrderID, &a.Type, &a.Code, &a.Description, &a.Rate, &a.Amount); err != nil {
+			return nil, err
+		}
+		adjustments = append(adjustments, a)
+	}
+	return adjustments, rows.Err()
+}
+
+// saveOrderTotals replaces the stored totals and adjustment lines of an order
+func saveOrderTotals(tx *sql.Tx, orderID int, totals OrderTotals) error {
+	_, err := tx.Exec(`
+		UPDATE orders
+		SET subtotal = ?, discount_total = ?, shipping_total = ?, tax_total = ?, total_amount = ?,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		totals.Subtotal, totals.DiscountTotal, totals.ShippingTotal, totals.TaxTotal, totals.Total, orderID)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM order_adjustments WHERE order_id = ?", orderID); err != nil {
+		return err
+	}
+
+	for _, a := range totals.Adjustments {
+		_, err := tx.Exec(`
+			INSERT INTO order_adjustments (order_id, type, code, description, rate, amount)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			orderID, a.Type, a.Code, a.Description, a.Rate, a.Amount)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RepriceOrder recomputes the totals of an order from its item price snapshots
+// and current address, e.g. after an address is assigned. Only pending orders that have
+// not been invoiced are repriced; others get a *ValidationError.
+func RepriceOrder(orderID int) (OrderTotals, error) {
+	order, err := GetOrderByID(orderID)
+	if err != nil {
+		return OrderTotals{}, err
+	}
+
+	// Keep the discount of a coupon redeemed when the order was placed
+	engine := activePricing()
+	coupon, err := getOrderCoupon(orderID)
+	if err != nil {
+		return OrderTotals{}, err
+	}
+	if coupon != nil {
+		engine = engine.WithDiscounts(*coupon)
+	}
+
+	totals, err := engine.Price(&PricingContext{
+		UserID:  order.UserID,
+		Items:   order.Items,
+		Address: order.ShippingAddress.AsAddress(),
+	})
+	if err != nil {
+		return totals, err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return totals, err
+	}
+	defer tx.Rollback()
+
+	if err := checkOrderRepriceable(tx, orderID); err != nil {
+		return totals, err
+	}
+	if err := saveOrderTotals(tx, orderID, totals); err != nil {
+		return totals, err
+	}
+	return totals, tx.Commit()
+}
+
+func roundMoney(v float64) float64 {
+	return math.Round(v*100) / 100
+}
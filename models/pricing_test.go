@@ -0,0 +1,249 @@
+package models
+
+import (
+	"reflect"
+	"testing"
+)
+
+// fixedTax taxes what is left after discounts at one rate, without looking up tax_rates
+type fixedTax float64
+
+func (r fixedTax) Tax(ctx *PricingContext) ([]OrderAdjustment, error) {
+	return []OrderAdjustment{{Code: "TEST", Rate: float64(r), Amount: (ctx.Subtotal - ctx.Discount) * float64(r)}}, nil
+}
+
+// pricingItems returns order items of the given prices, one of each, weighing 1 kg apiece
+func pricingItems(prices ...float64) []OrderItem {
+	items := make([]OrderItem, len(prices))
+	for i, price := range prices {
+		items[i] = OrderItem{Quantity: 1, Price: price, Product: Product{Weight: 1}}
+	}
+	return items
+}
+
+func TestPrice(t *testing.T) {
+	tests := []struct {
+		name   string
+		engine PricingEngine
+		items  []OrderItem
+		want   OrderTotals // Adjustments are not compared
+		lines  int
+	}{
+		{
+			name:  "no items",
+			items: nil,
+			engine: PricingEngine{Discounts: []DiscountCalculator{PercentageDiscount{"TEN", 10}},
+				Shipping: FlatRateShipping{Rate: 5}, Tax: fixedTax(0.2)},
+			want:  OrderTotals{ShippingTotal: 5, TaxTotal: 0, Total: 5},
+			lines: 2,
+		},
+		{
+			name:   "quantities",
+			items:  []OrderItem{{Quantity: 3, Price: 19.99}, {Quantity: 0, Price: 50}},
+			engine: PricingEngine{},
+			want:   OrderTotals{Subtotal: 59.97, Total: 59.97},
+		},
+		{
+			name:   "percentage discount",
+			items:  pricingItems(40, 60),
+			engine: PricingEngine{Discounts: []DiscountCalculator{PercentageDiscount{"TEN", 10}}},
+			want:   OrderTotals{Subtotal: 100, DiscountTotal: 10, Total: 90},
+			lines:  1,
+		},
+		{
+			name:   "fixed discount",
+			items:  pricingItems(40),
+			engine: PricingEngine{Discounts: []DiscountCalculator{FixedDiscount{"FIVE", 5}}},
+			want:   OrderTotals{Subtotal: 40, DiscountTotal: 5, Total: 35},
+			lines:  1,
+		},
+		{
+			name:  "discounts are capped at the subtotal",
+			items: pricingItems(30),
+			engine: PricingEngine{Discounts: []DiscountCalculator{FixedDiscount{"TWENTY", 20}, PercentageDiscount{"HALF", 50}},
+				Tax: fixedTax(0.1)},
+			want:  OrderTotals{Subtotal: 30, DiscountTotal: 30, Total: 0},
+			lines: 3, // the second discount takes the remaining 10; tax is 0
+		},
+		{
+			name:   "discount over the subtotal",
+			items:  pricingItems(12.5),
+			engine: PricingEngine{Discounts: []DiscountCalculator{PercentageDiscount{"ALL", 150}}},
+			want:   OrderTotals{Subtotal: 12.5, DiscountTotal: 12.5, Total: 0},
+			lines:  1,
+		},
+		{
+			name:  "zero and negative discounts are dropped",
+			items: pricingItems(20),
+			engine: PricingEngine{Discounts: []DiscountCalculator{
+				FixedDiscount{"ZERO", 0}, FixedDiscount{"NEG", -5}, PercentageDiscount{"NEGPCT", -10}}},
+			want: OrderTotals{Subtotal: 20, Total: 20},
+		},
+		{
+			name:   "tax applies after discounts",
+			items:  pricingItems(50, 50),
+			engine: PricingEngine{Discounts: []DiscountCalculator{FixedDiscount{"TWENTY", 20}}, Tax: fixedTax(0.25)},
+			want:   OrderTotals{Subtotal: 100, DiscountTotal: 20, TaxTotal: 20, Total: 100},
+			lines:  2,
+		},
+		{
+			name:   "zero tax rate",
+			items:  pricingItems(10),
+			engine: PricingEngine{Tax: fixedTax(0)},
+			want:   OrderTotals{Subtotal: 10, Total: 10},
+			lines:  1,
+		},
+		{
+			name:   "rounding of floating point sums",
+			items:  []OrderItem{{Quantity: 3, Price: 0.1}},
+			engine: PricingEngine{},
+			want:   OrderTotals{Subtotal: 0.3, Total: 0.3},
+		},
+		{
+			name:   "rounding of percentages",
+			items:  pricingItems(19.99),
+			engine: PricingEngine{Discounts: []DiscountCalculator{PercentageDiscount{"P15", 15}}, Tax: fixedTax(0.0825)},
+			// 19.99 - 2.9985 (3.00) = 16.99, taxed 1.401675 (1.40)
+			want:  OrderTotals{Subtotal: 19.99, DiscountTotal: 3, TaxTotal: 1.4, Total: 18.39},
+			lines: 2,
+		},
+		{
+			name:   "half cents round away from zero",
+			items:  pricingItems(0.125),
+			engine: PricingEngine{Tax: fixedTax(1)},
+			want:   OrderTotals{Subtotal: 0.13, TaxTotal: 0.13, Total: 0.26},
+			lines:  1,
+		},
+		{
+			name:   "free shipping over the threshold after discounts",
+			items:  pricingItems(60),
+			engine: PricingEngine{Discounts: []DiscountCalculator{FixedDiscount{"TEN", 10}}, Shipping: FlatRateShipping{Rate: 4.99, FreeOver: 50}},
+			want:   OrderTotals{Subtotal: 60, DiscountTotal: 10, Total: 50},
+			lines:  2,
+		},
+		{
+			name:   "shipping under the threshold",
+			items:  pricingItems(60),
+			engine: PricingEngine{Discounts: []DiscountCalculator{FixedDiscount{"TEN", 10.01}}, Shipping: FlatRateShipping{Rate: 4.99, FreeOver: 50}},
+			want:   OrderTotals{Subtotal: 60, DiscountTotal: 10.01, ShippingTotal: 4.99, Total: 54.98},
+			lines:  2,
+		},
+		{
+			name:   "weight based shipping",
+			items:  pricingItems(5, 5, 5),
+			engine: PricingEngine{Shipping: WeightBasedShipping{BaseRate: 2, PerKg: 1.333}},
+			want:   OrderTotals{Subtotal: 15, ShippingTotal: 6, Total: 21}, // 2 + 3.999
+			lines:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.engine.Price(&PricingContext{Items: tt.items})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got.Adjustments) != tt.lines {
+				t.Errorf("%d adjustment lines, want %d: %+v", len(got.Adjustments), tt.lines, got.Adjustments)
+			}
+			got.Adjustments = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("totals %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPriceWaivesShippingForFreeShippingCoupons(t *testing.T) {
+	waive := discountFunc(func(ctx *PricingContext) ([]OrderAdjustment, error) {
+		ctx.FreeShippingCode = "SHIPFREE"
+		return nil, nil
+	})
+	engine := PricingEngine{Discounts: []DiscountCalculator{waive}, Shipping: FlatRateShipping{Rate: 7}}
+	got, err := engine.Price(&PricingContext{Items: pricingItems(20)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ShippingTotal != 0 || got.Total != 20 || len(got.Adjustments) != 1 ||
+		got.Adjustments[0].Description != "Flat rate shipping (waived by SHIPFREE)" {
+		t.Errorf("totals %+v", got)
+	}
+}
+
+// discountFunc adapts a function to a DiscountCalculator
+type discountFunc func(ctx *PricingContext) ([]OrderAdjustment, error)
+
+func (f discountFunc) Discount(ctx *PricingContext) ([]OrderAdjustment, error) { return f(ctx) }
+
+func TestRegionTaxCalculator(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		for _, rate := range []struct {
+			country, state string
+			rate           float64
+		}{
+			{"US", "", 0.05},
+			{"US", "CA", 0.0725},
+			{"DE", "", 0.19},
+			{"GB", "", 0},
+		} {
+			if err := SetTaxRate(rate.country, rate.state, rate.rate, rate.country+rate.state); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		tests := []struct {
+			name     string
+			address  *Address
+			discount float64
+			code     string
+			want     float64
+		}{
+			{"no address", nil, 0, "", 0},
+			{"state rate", &Address{Country: "US", State: "CA"}, 0, "US-CA", 7.25},
+			{"state rate by names", &Address{Country: "United States", State: "California"}, 0, "US-CA", 7.25},
+			{"country rate for other states", &Address{Country: "US", State: "NY"}, 0, "US", 5},
+			{"country without states", &Address{Country: "de"}, 0, "DE", 19},
+			{"after discounts", &Address{Country: "DE"}, 40, "DE", 11.4},
+			{"zero rate", &Address{Country: "GB"}, 0, "GB", 0},
+			{"country without a rate", &Address{Country: "FR"}, 0, "", 0},
+		}
+		for _, tt := range tests {
+			engine := PricingEngine{Tax: RegionTaxCalculator{}}
+			if tt.discount > 0 {
+				engine.Discounts = []DiscountCalculator{FixedDiscount{"D", tt.discount}}
+			}
+			got, err := engine.Price(&PricingContext{Items: pricingItems(100), Address: tt.address})
+			if err != nil {
+				t.Fatalf("%s: %v", tt.name, err)
+			}
+			if got.TaxTotal != tt.want {
+				t.Errorf("%s: tax %.2f, want %.2f", tt.name, got.TaxTotal, tt.want)
+			}
+			var code string
+			for _, line := range got.Adjustments {
+				if line.Type == AdjustmentTax {
+					code = line.Code
+				}
+			}
+			if code != tt.code {
+				t.Errorf("%s: tax line %q, want %q", tt.name, code, tt.code)
+			}
+		}
+	})
+}
+
+func TestSetTaxRateRejectsUnknownRegions(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		for _, tt := range []struct{ country, state, field string }{
+			{"XX", "", "country"},
+			{"US", "ZZ", "state"},
+			{"Canada", "Texas", "state"},
+		} {
+			err := SetTaxRate(tt.country, tt.state, 0.1, "")
+			verr, ok := err.(*ValidationError)
+			if !ok || len(verr.Fields) != 1 || verr.Fields[0].Field != tt.field {
+				t.Errorf("SetTaxRate(%q, %q): got %v, want an error on %s", tt.country, tt.state, err, tt.field)
+			}
+		}
+	})
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 )
 
@@ -9,12 +10,20 @@ type Product struct {
 	Name      string    `json:"name"`
 	Status    string    `json:"status"`
 	Price     float64   `json:"price"`  // Add price field
+	Weight    float64   `json:"weight"` // Weight in kg, used for shipping
+	Category  string    `json:"category,omitempty"`
+	Stock     int       `json:"stock"`   // Units that can be ordered: on hand less those reserved by open orders
+	OnHand    int       `json:"on_hand"` // Units in the warehouse, raised when returns are restocked
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// productColumns is the column list of product queries: on hand before available stock
+const productColumns = `id, name, status, price, COALESCE(weight, 0), COALESCE(category, ''), COALESCE(stock, 0),
+		` + availableStockColumn + `, created_at, updated_at`
+
 func GetProducts(limit int) ([]Product, error) {
-	rows, err := DB.Query("SELECT id, name, status, price, created_at, updated_at FROM products LIMIT ?", limit)
+	rows, err := DB.Query("SELECT "+productColumns+" FROM products LIMIT ?", limit)
 	if err != nil {
 		return nil, err
 	}
@@ -23,7 +32,7 @@ func GetProducts(limit int) ([]Product, error) {
 	var products []Product
 	for rows.Next() {
 		var p Product
-		if err := rows.Scan(&p.ID, &p.Name, &p.Status, &p.Price, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.Status, &p.Price, &p.Weight, &p.Category, &p.OnHand, &p.Stock, &p.CreatedAt, &p.UpdatedAt); err != nil {
 			return nil, err
 		}
 		products = append(products, p)
@@ -31,10 +40,65 @@ func GetProducts(limit int) ([]Product, error) {
 	return products, nil
 }
 
+// FilterProducts returns one page of products matching the filter ordered by ID, and the number of matches
+func FilterProducts(filter ProductFilter, limit, offset int) ([]Product, int, error) {
+	var conditions []string
+	var args []interface{}
+	
+	if filter.Name != "" {
+		conditions = append(conditions, "LOWER(name) LIKE LOWER(?)")
+		args = append(args, "%"+filter.Name+"%")
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.MinID > 0 {
+		conditions = append(conditions, "id >= ?")
+		args = append(args, filter.MinID)
+	}
+	if filter.MaxID > 0 {
+		conditions = append(conditions, "id <= ?")
+		args = append(args, filter.MaxID)
+	}
+	
+	whereClause := ""
+	if len(conditions) > 0 {
+		whereClause = "WHERE " + strings.Join(conditions, " AND ")
+	}
+	
+	var total int
+	if err := DB.QueryRow("SELECT COUNT(*) FROM products "+whereClause, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	
+	rows, err := DB.Query(`
+		SELECT `+productColumns+`
+		FROM products
+		`+whereClause+`
+		ORDER BY id
+		LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	
+	products := []Product{}
+	for rows.Next() {
+		var p Product
+		if err := rows.Scan(&p.ID, &p.Name, &p.Status, &p.Price, &p.Weight, &p.Category, &p.OnHand, &p.Stock, &p.CreatedAt, &p.UpdatedAt); err != nil {
+			return nil, 0, err
+		}
+		products = append(products, p)
+	}
+	return products, total, rows.Err()
+}
+
 func GetProductByID(id int) (Product, error) {
 	var product Product
-	err := DB.QueryRow("SELECT id, name, status, price, created_at, updated_at FROM products WHERE id = ?", id).Scan(
-		&product.ID, &product.Name, &product.Status, &product.Price, &product.CreatedAt, &product.UpdatedAt)
+	err := DB.QueryRow("SELECT "+productColumns+" FROM products WHERE id = ?", id).Scan(
+		&product.ID, &product.Name, &product.Status, &product.Price, &product.Weight, &product.Category,
+		&product.OnHand, &product.Stock, &product.CreatedAt, &product.UpdatedAt)
 	return product, err
 }
 
@@ -43,15 +107,9 @@ func CreateProduct(name string, status string, price float64) (int, error) {
 		status = "active"
 	}
 	
-	result, err := DB.Exec(
+	return insertID(DB,
 		"INSERT INTO products (name, status, price, created_at, updated_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)", 
 		name, status, price)
-	if err != nil {
-		return 0, err
-	}
-	
-	id, err := result.LastInsertId()
-	return int(id), err
 }
 
 func UpdateProduct(id int, name string, status string, price float64) error {
@@ -61,6 +119,14 @@ func UpdateProduct(id int, name string, status string, price float64) error {
 	return err
 }
 
+// UpdateProductDetails sets the shipping weight, category and stock on hand of a product
+func UpdateProductDetails(id int, weight float64, category string, stock int) error {
+	_, err := DB.Exec(
+		"UPDATE products SET weight = ?, category = ?, stock = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		weight, category, stock, id)
+	return err
+}
+
 func DeleteProduct(id int) error {
 	_, err := DB.Exec("DELETE FROM products WHERE id = ?", id)
 	return err
@@ -0,0 +1,299 @@
+package models
+
+import (
+	"time"
+
+	"go-crud/payments"
+)
+
+// Repositories give handlers access to stored data without depending on the database.
+// SQLRepositories returns the implementations backed by DB; package memory has in-memory
+// fakes for tests. Missing records are reported as sql.ErrNoRows by every implementation.
+
+// UserRepository stores user accounts
+type UserRepository interface {
+	List(limit int) ([]User, error)
+	GetByID(id int) (User, error)
+	Create(email string) (int, error)
+	Register(email, password string) (int, error) // ErrUserExists if the email is taken
+	Login(email, password string) (User, error)   // ErrInvalidLogin on a wrong email or password
+	UpdateEmail(id int, email string) error
+	UpdatePassword(id int, password string) error
+	Delete(id int) error
+}
+
+// RoleRepository stores roles
+type RoleRepository interface {
+	List(limit int) ([]Role, error)
+	GetByID(id int) (Role, error)
+	Create(name, description string) (int, error)
+	Update(id int, name, description string) error
+	Delete(id int) error
+}
+
+// ProductFilter selects products; zero fields do not filter
+type ProductFilter struct {
+	Name   string // case-insensitive partial match
+	Status string
+	MinID  int
+	MaxID  int
+}
+
+// ProductRepository stores products
+type ProductRepository interface {
+	List(limit int) ([]Product, error)
+	// Filter returns one page of matching products ordered by ID, and the number of matches
+	Filter(filter ProductFilter, limit, offset int) ([]Product, int, error)
+}
+
+// OrderRepository stores orders with their items and addresses
+type OrderRepository interface {
+	List(limit int) ([]Order, error)
+	Filter(filter OrderFilter, page, perPage int) (PaginatedOrders, error)
+	FilterIDs(filter OrderFilter, limit int) ([]int, error)
+	GetByID(id int) (Order, error)
+	GetUserID(id int) (int, error)
+	Place(req OrderRequest) (int, error)
+	UpdateStatus(id int, status string) error
+	BatchUpdateStatus(ids []int, status string, atomic bool) ([]OrderStatusResult, error)
+	UpdateAddress(id int, addressType string, addressID int) error
+	Delete(id int) error
+}
+
+// AddressRepository stores users' addresses
+type AddressRepository interface {
+	List(limit int) ([]Address, error)
+	ListByUser(userID int) ([]Address, error)
+	GetByID(id int) (Address, error)
+	Create(a Address) (int, error)
+	Update(a Address) error
+	Delete(id, userID int) error
+}
+
+// CouponRepository stores coupons and their redemptions; missing coupons are ErrCouponNotFound
+type CouponRepository interface {
+	List(limit int) ([]Coupon, error)
+	GetByID(id int) (Coupon, error)
+	Create(c Coupon) (int, error) // ErrCouponExists if the code is taken
+	Update(c Coupon) error
+	Delete(id int) error // coupons that were redeemed are deactivated instead
+	Redemptions(couponID, limit int) ([]CouponRedemption, error)
+	Report() ([]CouponReport, error)
+}
+
+// PaymentRepository stores payment attempts; missing payments are ErrPaymentNotFound
+type PaymentRepository interface {
+	GetByID(id int) (Payment, error)
+	GetByProviderRef(provider, reference string) (Payment, error)
+	ListByOrder(orderID int) ([]Payment, error)
+	// ChargeOrder records the payment charge makes on a pending order, one attempt at a time (see ChargeOrder)
+	ChargeOrder(orderID int, charge func(total float64, attempt int) (Payment, error)) (Payment, error)
+	UpdateFromProvider(id int, result payments.Result, failureReason string) error
+	// ApplyWebhookEvent stores the update of a provider event; false if the event was already applied
+	ApplyWebhookEvent(provider, eventID, eventType string, paymentID int, result payments.Result, failureReason string) (bool, error)
+	// SyncOrderStatus moves the order to paid or refunded as its payments require, returning its status
+	SyncOrderStatus(orderID int) (string, error)
+}
+
+// ReturnRepository stores order returns; missing returns are ErrReturnNotFound
+type ReturnRepository interface {
+	List(orderID int, status string) ([]OrderReturn, error) // zero arguments do not filter
+	GetByID(id int) (OrderReturn, error)
+	Create(orderID int, reason string, lines []ReturnLine) (OrderReturn, error)
+	Approve(id int, note string) (OrderReturn, error)
+	Reject(id int, note string) (OrderReturn, error)
+	Receive(id int, restock bool) (OrderReturn, error) // also refunds the return
+}
+
+// ShipmentRepository stores order shipments; missing shipments are ErrShipmentNotFound
+type ShipmentRepository interface {
+	ListByOrder(orderID int) ([]Shipment, error)
+	GetByID(id int) (Shipment, error)
+	Create(orderID int, carrier, trackingNumber string, lines []ShipmentLine) (Shipment, error)
+	MarkShipped(id int, carrier, trackingNumber string, shippedAt time.Time) (Shipment, error)
+	MarkDelivered(id int, deliveredAt time.Time) (Shipment, error)
+}
+
+// TaxRateRepository stores tax rates by country and state
+type TaxRateRepository interface {
+	List() ([]TaxRate, error)
+	Set(country, state string, rate float64, name string) error
+}
+
+// InvoiceRepository stores the invoices issued for orders
+type InvoiceRepository interface {
+	GetByOrderID(orderID int) (Invoice, error)
+	Issue(orderID int) (Invoice, error) // returns the order's invoice, issuing it on first use
+}
+
+// JobRunRepository stores the run history of scheduled jobs
+type JobRunRepository interface {
+	List(name string, limit int) ([]JobRun, error) // newest first
+}
+
+// Repositories bundles the repositories handlers use
+type Repositories struct {
+	Users     UserRepository
+	Roles     RoleRepository
+	Products  ProductRepository
+	Orders    OrderRepository
+	Addresses AddressRepository
+	Coupons   CouponRepository
+	Payments  PaymentRepository
+	Returns   ReturnRepository
+	Shipments ShipmentRepository
+	TaxRates  TaxRateRepository
+	Invoices  InvoiceRepository
+	JobRuns   JobRunRepository
+}
+
+// SQLRepositories returns repositories backed by the open database
+func SQLRepositories() Repositories {
+	return Repositories{
+		Users:     sqlUsers{},
+		Roles:     sqlRoles{},
+		Products:  sqlProducts{},
+		Orders:    sqlOrders{},
+		Addresses: sqlAddresses{},
+		Coupons:   sqlCoupons{},
+		Payments:  sqlPayments{},
+		Returns:   sqlReturns{},
+		Shipments: sqlShipments{},
+		TaxRates:  sqlTaxRates{},
+		Invoices:  sqlInvoices{},
+		JobRuns:   sqlJobRuns{},
+	}
+}
+
+type sqlUsers struct{}
+
+func (sqlUsers) List(limit int) ([]User, error)         { return GetUsers(limit) }
+func (sqlUsers) GetByID(id int) (User, error)           { return GetUserByID(id) }
+func (sqlUsers) Create(email string) (int, error)       { return CreateUser(email) }
+func (sqlUsers) Register(email, pw string) (int, error) { return RegisterUser(email, pw) }
+func (sqlUsers) Login(email, pw string) (User, error)   { return LoginUser(email, pw) }
+func (sqlUsers) UpdateEmail(id int, email string) error { return UpdateUser(id, email) }
+func (sqlUsers) UpdatePassword(id int, pw string) error { return UpdateUserPassword(id, pw) }
+func (sqlUsers) Delete(id int) error                    { return DeleteUser(id) }
+
+type sqlRoles struct{}
+
+func (sqlRoles) List(limit int) ([]Role, error)         { return GetRoles(limit) }
+func (sqlRoles) GetByID(id int) (Role, error)           { return GetRoleByID(id) }
+func (sqlRoles) Create(name, desc string) (int, error)  { return CreateRole(name, desc) }
+func (sqlRoles) Update(id int, name, desc string) error { return UpdateRole(id, name, desc) }
+func (sqlRoles) Delete(id int) error                    { return DeleteRole(id) }
+
+type sqlProducts struct{}
+
+func (sqlProducts) List(limit int) ([]Product, error) { return GetProducts(limit) }
+func (sqlProducts) Filter(f ProductFilter, limit, offset int) ([]Product, int, error) {
+	return FilterProducts(f, limit, offset)
+}
+
+type sqlOrders struct{}
+
+func (sqlOrders) List(limit int) ([]Order, error) { return GetOrders(limit) }
+func (sqlOrders) Filter(f OrderFilter, page, perPage int) (PaginatedOrders, error) {
+	return GetFilteredOrders(f, page, perPage)
+}
+func (sqlOrders) FilterIDs(f OrderFilter, limit int) ([]int, error) { return GetOrderIDs(f, limit) }
+func (sqlOrders) GetByID(id int) (Order, error)                     { return GetOrderByID(id) }
+func (sqlOrders) GetUserID(id int) (int, error)                     { return GetOrderUserID(id) }
+func (sqlOrders) Place(req OrderRequest) (int, error)               { return PlaceOrder(req) }
+func (sqlOrders) UpdateStatus(id int, status string) error          { return UpdateOrderStatus(id, status) }
+func (sqlOrders) BatchUpdateStatus(ids []int, status string, atomic bool) ([]OrderStatusResult, error) {
+	return BatchUpdateOrderStatus(ids, status, atomic)
+}
+func (sqlOrders) UpdateAddress(id int, addressType string, addressID int) error {
+	return UpdateOrderAddress(id, addressType, addressID)
+}
+func (sqlOrders) Delete(id int) error { return DeleteOrder(id) }
+
+type sqlAddresses struct{}
+
+func (sqlAddresses) List(limit int) ([]Address, error)        { return GetAddresses(limit) }
+func (sqlAddresses) ListByUser(userID int) ([]Address, error) { return GetAddressesByUserID(userID) }
+func (sqlAddresses) GetByID(id int) (Address, error)          { return GetAddressByID(id) }
+func (sqlAddresses) Create(a Address) (int, error)            { return CreateAddress(a) }
+func (sqlAddresses) Update(a Address) error                   { return UpdateAddress(a) }
+func (sqlAddresses) Delete(id, userID int) error              { return DeleteAddress(id, userID) }
+
+type sqlCoupons struct{}
+
+func (sqlCoupons) List(limit int) ([]Coupon, error) { return GetCoupons(limit) }
+func (sqlCoupons) GetByID(id int) (Coupon, error)   { return GetCouponByID(id) }
+func (sqlCoupons) Create(c Coupon) (int, error)     { return CreateCoupon(c) }
+func (sqlCoupons) Update(c Coupon) error            { return UpdateCoupon(c) }
+func (sqlCoupons) Delete(id int) error              { return DeleteCoupon(id) }
+func (sqlCoupons) Redemptions(couponID, limit int) ([]CouponRedemption, error) {
+	return GetCouponRedemptions(couponID, limit)
+}
+func (sqlCoupons) Report() ([]CouponReport, error) { return GetCouponReport() }
+
+type sqlPayments struct{}
+
+func (sqlPayments) GetByID(id int) (Payment, error) { return GetPaymentByID(id) }
+func (sqlPayments) GetByProviderRef(provider, ref string) (Payment, error) {
+	return GetPaymentByProviderRef(provider, ref)
+}
+func (sqlPayments) ListByOrder(orderID int) ([]Payment, error) { return GetPaymentsByOrderID(orderID) }
+func (sqlPayments) ChargeOrder(orderID int, charge func(total float64, attempt int) (Payment, error)) (Payment, error) {
+	return ChargeOrder(orderID, charge)
+}
+func (sqlPayments) UpdateFromProvider(id int, result payments.Result, reason string) error {
+	return UpdatePaymentFromProvider(id, result, reason)
+}
+func (sqlPayments) ApplyWebhookEvent(provider, eventID, eventType string, paymentID int, result payments.Result, reason string) (bool, error) {
+	return ApplyWebhookEvent(provider, eventID, eventType, paymentID, result, reason)
+}
+func (sqlPayments) SyncOrderStatus(orderID int) (string, error) {
+	return SyncOrderPaymentStatus(orderID)
+}
+
+type sqlReturns struct{}
+
+func (sqlReturns) List(orderID int, status string) ([]OrderReturn, error) {
+	return GetReturns(orderID, status)
+}
+func (sqlReturns) GetByID(id int) (OrderReturn, error) { return GetReturnByID(id) }
+func (sqlReturns) Create(orderID int, reason string, lines []ReturnLine) (OrderReturn, error) {
+	return CreateReturn(orderID, reason, lines)
+}
+func (sqlReturns) Approve(id int, note string) (OrderReturn, error) { return ApproveReturn(id, note) }
+func (sqlReturns) Reject(id int, note string) (OrderReturn, error)  { return RejectReturn(id, note) }
+func (sqlReturns) Receive(id int, restock bool) (OrderReturn, error) {
+	return ReceiveReturn(id, restock)
+}
+
+type sqlShipments struct{}
+
+func (sqlShipments) ListByOrder(orderID int) ([]Shipment, error) {
+	return GetShipmentsByOrderID(orderID)
+}
+func (sqlShipments) GetByID(id int) (Shipment, error) { return GetShipmentByID(id) }
+func (sqlShipments) Create(orderID int, carrier, tracking string, lines []ShipmentLine) (Shipment, error) {
+	return CreateShipment(orderID, carrier, tracking, lines)
+}
+func (sqlShipments) MarkShipped(id int, carrier, tracking string, at time.Time) (Shipment, error) {
+	return MarkShipmentShipped(id, carrier, tracking, at)
+}
+func (sqlShipments) MarkDelivered(id int, at time.Time) (Shipment, error) {
+	return MarkShipmentDelivered(id, at)
+}
+
+type sqlTaxRates struct{}
+
+func (sqlTaxRates) List() ([]TaxRate, error) { return GetTaxRates() }
+func (sqlTaxRates) Set(country, state string, rate float64, name string) error {
+	return SetTaxRate(country, state, rate, name)
+}
+
+type sqlInvoices struct{}
+
+func (sqlInvoices) GetByOrderID(orderID int) (Invoice, error) { return GetInvoiceByOrderID(orderID) }
+func (sqlInvoices) Issue(orderID int) (Invoice, error)        { return IssueInvoice(orderID) }
+
+type sqlJobRuns struct{}
+
+func (sqlJobRuns) List(name string, limit int) ([]JobRun, error) { return GetJobRuns(name, limit) }
@@ -0,0 +1,462 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Return statuses. A return moves requested -> approved -> received -> refunded, or requested -> rejected.
+const (
+	ReturnStatusRequested = "requested"
+	ReturnStatusApproved  = "approved"
+	ReturnStatusRejected  = "rejected"
+	ReturnStatusReceived  = "received"
+	ReturnStatusRefunded  = "refunded"
+)
+
+// returnableOrderStatuses are the order statuses that accept new return requests
+var returnableOrderStatuses = map[string]bool{
+	OrderStatusPaid:              true,
+	OrderStatusProcessing:        true,
+	OrderStatusShipped:           true,
+	OrderStatusDelivered:         true,
+	OrderStatusCompleted:         true,
+	OrderStatusPartiallyRefunded: true,
+}
+
+// Return errors
+var (
+	ErrReturnNotFound       = errors.New("return not found")
+	ErrReturnNotAllowed     = errors.New("order cannot be returned in its current status")
+	ErrReturnNoItems        = errors.New("a return needs at least one item")
+	ErrReturnItemNotInOrder = errors.New("item does not belong to the order")
+	ErrReturnQuantity       = errors.New("return quantity exceeds the quantity still returnable")
+	ErrReturnState          = errors.New("return is not in a state that allows this step")
+	ErrReturnRefunding      = errors.New("return is being refunded by another request")
+)
+
+// returnRefundClaim is how long a request may take to refund a return before another one can
+// take over, e.g. after the first one crashed
+const returnRefundClaim = 5 * time.Minute
+
+type OrderReturn struct {
+	ID             int               `json:"id"`
+	OrderID        int               `json:"order_id"`
+	UserID         int               `json:"user_id"`
+	Status         string            `json:"status"`
+	Reason         string            `json:"reason,omitempty"`
+	Note           string            `json:"note,omitempty"` // Set by the admin who approved or rejected it
+	Restock        bool              `json:"restock"`
+	RefundAmount   float64           `json:"refund_amount"`   // Amount owed for the returned items
+	RefundedAmount float64           `json:"refunded_amount"` // Amount refunded so far
+	CreatedAt      time.Time         `json:"created_at"`
+	UpdatedAt      time.Time         `json:"updated_at"`
+	Items          []OrderReturnItem `json:"items,omitempty"`
+}
+
+type OrderReturnItem struct {
+	ID           int     `json:"id"`
+	ReturnID     int     `json:"return_id"`
+	OrderItemID  int     `json:"order_item_id"`
+	ProductID    int     `json:"product_id"`
+	Quantity     int     `json:"quantity"`
+	UnitPrice    float64 `json:"unit_price"` // Copied from order_items.price
+	RefundAmount float64 `json:"refund_amount"`
+	Restocked    int     `json:"restocked"` // Units put back in stock when the return was received
+}
+
+// ReturnLine is a requested quantity of one order item
+type ReturnLine struct {
+	OrderItemID int `json:"order_item_id" validate:"required"`
+	Quantity    int `json:"quantity" validate:"min=1"`
+}
+
+const returnColumns = `id, order_id, user_id, status, COALESCE(reason, ''), COALESCE(note, ''), restock,
+		       refund_amount, refunded_amount, created_at, updated_at`
+
+func scanReturn(row rowScanner) (OrderReturn, error) {
+	var r OrderReturn
+	err := row.Scan(&r.ID, &r.OrderID, &r.UserID, &r.Status, &r.Reason, &r.Note, &r.Restock,
+		&r.RefundAmount, &r.RefundedAmount, &r.CreatedAt, &r.UpdatedAt)
+	return r, err
+}
+
+// GetReturns lists returns, newest first, optionally for one order and/or status
+func GetReturns(orderID int, status string) ([]OrderReturn, error) {
+	query := `SELECT ` + returnColumns + ` FROM order_returns WHERE 1 = 1`
+	var args []interface{}
+	if orderID > 0 {
+		query += " AND order_id = ?"
+		args = append(args, orderID)
+	}
+	if status != "" {
+		query += " AND status = ?"
+		args = append(args, status)
+	}
+	query += " ORDER BY id DESC"
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []OrderReturn
+	for rows.Next() {
+		r, err := scanReturn(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// GetReturnByID returns a return with its items
+func GetReturnByID(id int) (OrderReturn, error) {
+	r, err := scanReturn(DB.QueryRow(`SELECT `+returnColumns+` FROM order_returns WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return r, ErrReturnNotFound
+	} else if err != nil {
+		return r, err
+	}
+
+	rows, err := DB.Query(`
+		SELECT id, return_id, order_item_id, product_id, quantity, unit_price, refund_amount, restocked
+		FROM order_return_items
+		WHERE return_id = ?
+		ORDER BY id`, id)
+	if err != nil {
+		return r, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item OrderReturnItem
+		err := rows.Scan(&item.ID, &item.ReturnID, &item.OrderItemID, &item.ProductID, &item.Quantity,
+			&item.UnitPrice, &item.RefundAmount, &item.Restocked)
+		if err != nil {
+			return r, err
+		}
+		r.Items = append(r.Items, item)
+	}
+	return r, rows.Err()
+}
+
+// CreateReturn records a return request for items of an order.
+//
+// Each line is refunded at its order_items.price snapshot, less its share of the order discount
+// plus its share of the tax. The return that brings every item back refunds whatever remains of
+// the order total, so shipping and rounding differences are refunded in full.
+func CreateReturn(orderID int, reason string, lines []ReturnLine) (OrderReturn, error) {
+	if len(lines) == 0 {
+		return OrderReturn{}, ErrReturnNoItems
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return OrderReturn{}, err
+	}
+	defer tx.Rollback()
+
+	var order Order
+	err = tx.QueryRow(`
+		SELECT id, user_id, status, subtotal, discount_total, tax_total, total_amount
+		FROM orders
+		WHERE id = ?`, orderID).Scan(&order.ID, &order.UserID, &order.Status, &order.Subtotal,
+		&order.DiscountTotal, &order.TaxTotal, &order.TotalAmount)
+	if err != nil {
+		return OrderReturn{}, err
+	}
+
+	if !returnableOrderStatuses[order.Status] {
+		return OrderReturn{}, fmt.Errorf("%w: %s", ErrReturnNotAllowed, order.Status)
+	}
+
+	// Quantities already claimed by returns that were not rejected
+	ordered := map[int]OrderItem{}
+	returnable := map[int]int{}
+	rows, err := tx.Query(`
+		SELECT oi.id, oi.product_id, oi.quantity, oi.price,
+		       oi.quantity - COALESCE((
+		           SELECT SUM(ri.quantity)
+		           FROM order_return_items ri
+		           JOIN order_returns r ON r.id = ri.return_id
+		           WHERE ri.order_item_id = oi.id AND r.status != ?
+		       ), 0)
+		FROM order_items oi
+		WHERE oi.order_id = ?`, ReturnStatusRejected, orderID)
+	if err != nil {
+		return OrderReturn{}, err
+	}
+	for rows.Next() {
+		var item OrderItem
+		var left int
+		if err := rows.Scan(&item.ID, &item.ProductID, &item.Quantity, &item.Price, &left); err != nil {
+			rows.Close()
+			return OrderReturn{}, err
+		}
+		ordered[item.ID] = item
+		returnable[item.ID] = left
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return OrderReturn{}, err
+	}
+
+	ret := OrderReturn{OrderID: orderID, UserID: order.UserID, Status: ReturnStatusRequested, Reason: reason}
+	for _, line := range lines {
+		item, ok := ordered[line.OrderItemID]
+		if !ok {
+			return OrderReturn{}, fmt.Errorf("%w: %d", ErrReturnItemNotInOrder, line.OrderItemID)
+		}
+		if line.Quantity <= 0 || line.Quantity > returnable[item.ID] {
+			return OrderReturn{}, fmt.Errorf("%w: item %d has %d left", ErrReturnQuantity, item.ID, returnable[item.ID])
+		}
+		returnable[item.ID] -= line.Quantity
+
+		lineTotal := item.Price * float64(line.Quantity)
+		refund := lineTotal
+		if order.Subtotal > 0 {
+			share := lineTotal / order.Subtotal
+			refund = lineTotal - order.DiscountTotal*share + order.TaxTotal*share
+		}
+
+		ret.Items = append(ret.Items, OrderReturnItem{
+			OrderItemID:  item.ID,
+			ProductID:    item.ProductID,
+			Quantity:     line.Quantity,
+			UnitPrice:    item.Price,
+			RefundAmount: roundMoney(refund),
+		})
+		ret.RefundAmount += roundMoney(refund)
+	}
+	ret.RefundAmount = roundMoney(ret.RefundAmount)
+
+	// The last return of the order settles whatever is left of its total
+	allReturned := true
+	for _, left := range returnable {
+		if left > 0 {
+			allReturned = false
+			break
+		}
+	}
+	if allReturned {
+		var committed float64
+		err := tx.QueryRow("SELECT COALESCE(SUM(refund_amount), 0) FROM order_returns WHERE order_id = ? AND status != ?",
+			orderID, ReturnStatusRejected).Scan(&committed)
+		if err != nil {
+			return OrderReturn{}, err
+		}
+		if remaining := roundMoney(order.TotalAmount - committed); remaining > 0 {
+			ret.RefundAmount = remaining
+		}
+	}
+
+	id, err := insertID(tx, `
+		INSERT INTO order_returns (order_id, user_id, status, reason, refund_amount, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
+		ret.OrderID, ret.UserID, ret.Status, ret.Reason, ret.RefundAmount)
+	if err != nil {
+		return OrderReturn{}, err
+	}
+
+	for _, item := range ret.Items {
+		_, err := tx.Exec(`
+			INSERT INTO order_return_items (return_id, order_item_id, product_id, quantity, unit_price, refund_amount)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			id, item.OrderItemID, item.ProductID, item.Quantity, item.UnitPrice, item.RefundAmount)
+		if err != nil {
+			return OrderReturn{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return OrderReturn{}, err
+	}
+	return GetReturnByID(id)
+}
+
+// setReturnStatus moves a return from one status to another, failing if it is not in the expected status
+func setReturnStatus(q execer, id int, from, to, note string) error {
+	result, err := q.Exec(`
+		UPDATE order_returns
+		SET status = ?, note = CASE WHEN ? = '' THEN note ELSE ? END, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status = ?`, to, note, note, id, from)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if _, err := GetReturnByID(id); err != nil {
+			return err
+		}
+		return ErrReturnState
+	}
+	return nil
+}
+
+// ApproveReturn accepts a requested return
+func ApproveReturn(id int, note string) (OrderReturn, error) {
+	if err := setReturnStatus(DB, id, ReturnStatusRequested, ReturnStatusApproved, note); err != nil {
+		return OrderReturn{}, err
+	}
+	return GetReturnByID(id)
+}
+
+// RejectReturn declines a requested return; its items become returnable again
+func RejectReturn(id int, note string) (OrderReturn, error) {
+	if err := setReturnStatus(DB, id, ReturnStatusRequested, ReturnStatusRejected, note); err != nil {
+		return OrderReturn{}, err
+	}
+	return GetReturnByID(id)
+}
+
+// ReceiveReturn records that the goods of an approved return arrived, optionally puts them back
+// in stock, and refunds the return through the order's payments.
+//
+// Calling it again for a received return that is not yet fully refunded retries the refund.
+// Any part of the refund not covered by captured payments is recorded as refunded offline.
+func ReceiveReturn(id int, restock bool) (OrderReturn, error) {
+	ret, err := GetReturnByID(id)
+	if err != nil {
+		return ret, err
+	}
+
+	switch ret.Status {
+	case ReturnStatusApproved:
+		if err := receiveReturnItems(ret, restock); err != nil {
+			return ret, err
+		}
+	case ReturnStatusReceived:
+		// A previous refund attempt failed part way
+	default:
+		return ret, ErrReturnState
+	}
+
+	// Only the request holding the claim calls the provider. The return is read again under
+	// the claim, since a concurrent attempt may have refunded part of it meanwhile.
+	if err := claimReturnRefund(id); err != nil {
+		return ret, err
+	}
+	if ret, err = GetReturnByID(id); err != nil {
+		return ret, err
+	}
+
+	owed := roundMoney(ret.RefundAmount - ret.RefundedAmount)
+	_, err = refundOrderPayments(ret.OrderID, owed, func(amount float64) error {
+		_, err := DB.Exec("UPDATE order_returns SET refunded_amount = refunded_amount + ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+			amount, id)
+		return err
+	})
+	if err != nil {
+		// Give the claim up so the refund can be retried right away
+		if _, releaseErr := DB.Exec("UPDATE order_returns SET refund_claimed_until = NULL WHERE id = ?", id); releaseErr != nil {
+			return ret, errors.Join(err, releaseErr)
+		}
+		return ret, err
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return ret, err
+	}
+	defer tx.Rollback()
+
+	if err := setReturnStatus(tx, id, ReturnStatusReceived, ReturnStatusRefunded, ""); err != nil {
+		return ret, err
+	}
+	_, err = tx.Exec("UPDATE order_returns SET refunded_amount = refund_amount, refund_claimed_until = NULL WHERE id = ?", id)
+	if err != nil {
+		return ret, err
+	}
+	_, err = tx.Exec("UPDATE orders SET refunded_total = COALESCE(refunded_total, 0) + ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		ret.RefundAmount, ret.OrderID)
+	if err != nil {
+		return ret, err
+	}
+	if err := tx.Commit(); err != nil {
+		return ret, err
+	}
+
+	if _, err := SyncOrderPaymentStatus(ret.OrderID); err != nil {
+		return ret, err
+	}
+	return GetReturnByID(id)
+}
+
+// claimReturnRefund claims the refund of a received return for returnRefundClaim. It fails with
+// ErrReturnRefunding while another request holds the claim, and with ErrReturnState once the
+// return is no longer received.
+func claimReturnRefund(id int) error {
+	now := time.Now().UTC()
+	result, err := DB.Exec(`
+		UPDATE order_returns SET refund_claimed_until = ?
+		WHERE id = ? AND status = ? AND (refund_claimed_until IS NULL OR refund_claimed_until <= ?)`,
+		now.Add(returnRefundClaim), id, ReturnStatusReceived, now)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return err
+	} else if n > 0 {
+		return nil
+	}
+
+	ret, err := GetReturnByID(id)
+	if err != nil {
+		return err
+	}
+	if ret.Status != ReturnStatusReceived {
+		return ErrReturnState
+	}
+	return ErrReturnRefunding
+}
+
+// receiveReturnItems marks an approved return as received and restocks its items if asked to, up
+// to the quantities taken out of stock for the order
+func receiveReturnItems(ret OrderReturn, restock bool) error {
+	tx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setReturnStatus(tx, ret.ID, ReturnStatusApproved, ReturnStatusReceived, ""); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE order_returns SET restock = ? WHERE id = ?", restock, ret.ID); err != nil {
+		return err
+	}
+
+	// Only units taken out of stock for the order go back, so goods that never left the warehouse
+	// are not counted twice
+	if restock {
+		for _, item := range ret.Items {
+			quantity, err := restockableQuantity(tx, ret.OrderID, item.ProductID)
+			if err != nil {
+				return err
+			}
+			quantity = min(quantity, item.Quantity)
+			if quantity == 0 {
+				continue
+			}
+			_, err = tx.Exec("UPDATE products SET stock = COALESCE(stock, 0) + ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+				quantity, item.ProductID)
+			if err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE order_return_items SET restocked = ? WHERE id = ?", quantity, item.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
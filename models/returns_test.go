@@ -0,0 +1,182 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"go-crud/payments"
+)
+
+// flakyRefunds is the mock provider failing the next refund of one payment, and counting
+// the refunds that went through
+type flakyRefunds struct {
+	*payments.MockProvider
+	mu       sync.Mutex
+	failNext string
+	refunds  map[string]int
+}
+
+func (p *flakyRefunds) Name() string { return "flaky" }
+
+func (p *flakyRefunds) Refund(reference string, amount float64) (payments.Result, error) {
+	p.mu.Lock()
+	fail := reference == p.failNext
+	if fail {
+		p.failNext = ""
+	}
+	p.mu.Unlock()
+	if fail {
+		return payments.Result{}, errors.New("gateway timeout")
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	result, err := p.MockProvider.Refund(reference, amount)
+	if err == nil {
+		p.mu.Lock()
+		p.refunds[reference]++
+		p.mu.Unlock()
+	}
+	return result, err
+}
+
+// receivedReturn returns a received return of a paid order charged in two captured payments,
+// whose refund failed after the newer payment was refunded
+func receivedReturn(t *testing.T, provider *flakyRefunds) OrderReturn {
+	t.Helper()
+	orderID := createTestOrder(t, createTestUser(t), createTestProduct(t, 20, 5), 2)
+	if err := UpdateOrderStatus(orderID, OrderStatusPaid); err != nil {
+		t.Fatal(err)
+	}
+	items, err := GetOrderItems(orderID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret, err := CreateReturn(orderID, "damaged", []ReturnLine{{OrderItemID: items[0].ID, Quantity: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ApproveReturn(ret.ID, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, amount := range []float64{10, ret.RefundAmount - 10} {
+		reference := fmt.Sprintf("order_%d_attempt_%d", orderID, i+1)
+		authorized, err := provider.Authorize(payments.AuthorizeRequest{OrderID: orderID, Amount: amount, MerchantReference: reference})
+		if err != nil {
+			t.Fatal(err)
+		}
+		captured, err := provider.Capture(authorized.Reference, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = CreatePayment(Payment{OrderID: orderID, Provider: provider.Name(), ProviderRef: captured.Reference,
+			Status: captured.Status, Amount: amount, CapturedAmount: captured.CapturedAmount})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			provider.failNext = captured.Reference
+		}
+	}
+
+	if _, err := ReceiveReturn(ret.ID, false); err == nil {
+		t.Fatal("the refund did not fail")
+	}
+	ret, err = GetReturnByID(ret.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.Status != ReturnStatusReceived || ret.RefundedAmount != roundMoney(ret.RefundAmount-10) {
+		t.Fatalf("after the failed refund the return is %s with %.2f refunded", ret.Status, ret.RefundedAmount)
+	}
+	return ret
+}
+
+func newFlakyRefunds() *flakyRefunds {
+	p := &flakyRefunds{MockProvider: payments.NewMockProvider(), refunds: map[string]int{}}
+	payments.Register(p)
+	return p
+}
+
+func TestReceiveReturnRetriesAPartialRefund(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		provider := newFlakyRefunds()
+		ret := receivedReturn(t, provider)
+
+		ret, err := ReceiveReturn(ret.ID, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ret.Status != ReturnStatusRefunded || ret.RefundedAmount != ret.RefundAmount {
+			t.Errorf("return is %s with %.2f of %.2f refunded", ret.Status, ret.RefundedAmount, ret.RefundAmount)
+		}
+
+		// Each payment was refunded once, in full
+		list, err := GetPaymentsByOrderID(ret.OrderID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range list {
+			if provider.refunds[p.ProviderRef] != 1 || p.Status != payments.StatusRefunded {
+				t.Errorf("payment %s: %d refunds, status %s", p.ProviderRef, provider.refunds[p.ProviderRef], p.Status)
+			}
+		}
+
+		if _, err := ReceiveReturn(ret.ID, false); !errors.Is(err, ErrReturnState) {
+			t.Errorf("receiving a refunded return: got %v, want ErrReturnState", err)
+		}
+	})
+}
+
+func TestReceiveReturnRetriedConcurrently(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		provider := newFlakyRefunds()
+		ret := receivedReturn(t, provider)
+
+		const retries = 6
+		errs := make([]error, retries)
+		var wg sync.WaitGroup
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, errs[i] = ReceiveReturn(ret.ID, false)
+			}(i)
+		}
+		wg.Wait()
+
+		succeeded := 0
+		for _, err := range errs {
+			switch {
+			case err == nil:
+				succeeded++
+			case errors.Is(err, ErrReturnRefunding), errors.Is(err, ErrReturnState):
+			default:
+				t.Errorf("concurrent retry: %v", err)
+			}
+		}
+		if succeeded != 1 {
+			t.Errorf("%d retries succeeded, want 1", succeeded)
+		}
+		for reference, n := range provider.refunds {
+			if n != 1 {
+				t.Errorf("payment %s was refunded %d times", reference, n)
+			}
+		}
+
+		ret, err := GetReturnByID(ret.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var refundedTotal float64
+		if err := DB.QueryRow("SELECT refunded_total FROM orders WHERE id = ?", ret.OrderID).Scan(&refundedTotal); err != nil {
+			t.Fatal(err)
+		}
+		if ret.Status != ReturnStatusRefunded || refundedTotal != ret.RefundAmount {
+			t.Errorf("return is %s, order refunded %.2f, want %.2f", ret.Status, refundedTotal, ret.RefundAmount)
+		}
+	})
+}
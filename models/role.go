@@ -37,15 +37,9 @@ func GetRoleByID(id int) (Role, error) {
 }
 
 func CreateRole(name string, description string) (int, error) {
-	result, err := DB.Exec(
+	return insertID(DB,
 		"INSERT INTO roles (name, description) VALUES (?, ?)", 
 		name, description)
-	if err != nil {
-		return 0, err
-	}
-	
-	id, err := result.LastInsertId()
-	return int(id), err
 }
 
 func UpdateRole(id int, name string, description string) error {
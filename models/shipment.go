@@ -0,0 +1,353 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Shipment statuses
+const (
+	ShipmentStatusPending   = "pending" // created, waiting for the carrier
+	ShipmentStatusShipped   = "shipped"
+	ShipmentStatusDelivered = "delivered"
+)
+
+// shippableOrderStatuses are the order statuses that accept new shipments
+var shippableOrderStatuses = map[string]bool{
+	OrderStatusPending:    true,
+	OrderStatusPaid:       true,
+	OrderStatusProcessing: true,
+	OrderStatusShipped:    true,
+}
+
+// Shipment errors
+var (
+	ErrShipmentNotFound     = errors.New("shipment not found")
+	ErrShipmentNotAllowed   = errors.New("order cannot be shipped in its current status")
+	ErrShipmentNothingToAdd = errors.New("all items of the order are already in shipments")
+	ErrShipmentItem         = errors.New("item does not belong to the order")
+	ErrShipmentQuantity     = errors.New("shipment quantity exceeds the quantity still to ship")
+	ErrShipmentState        = errors.New("shipment is not in a state that allows this step")
+)
+
+type Shipment struct {
+	ID             int            `json:"id"`
+	OrderID        int            `json:"order_id"`
+	Carrier        string         `json:"carrier,omitempty"`
+	TrackingNumber string         `json:"tracking_number,omitempty"`
+	Status         string         `json:"status"`
+	ShippedAt      *time.Time     `json:"shipped_at,omitempty"`
+	DeliveredAt    *time.Time     `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	Items          []ShipmentItem `json:"items,omitempty"`
+}
+
+type ShipmentItem struct {
+	ID          int `json:"id"`
+	ShipmentID  int `json:"shipment_id"`
+	OrderItemID int `json:"order_item_id"`
+	ProductID   int `json:"product_id"`
+	Quantity    int `json:"quantity"`
+}
+
+// ShipmentLine is a quantity of one order item to put in a shipment
+type ShipmentLine struct {
+	OrderItemID int `json:"order_item_id" validate:"required"`
+	Quantity    int `json:"quantity" validate:"min=1"`
+}
+
+const shipmentColumns = `id, order_id, COALESCE(carrier, ''), COALESCE(tracking_number, ''), status,
+		       shipped_at, delivered_at, created_at, updated_at`
+
+func scanShipment(row rowScanner) (Shipment, error) {
+	var s Shipment
+	var shippedAt, deliveredAt sql.NullTime
+	err := row.Scan(&s.ID, &s.OrderID, &s.Carrier, &s.TrackingNumber, &s.Status,
+		&shippedAt, &deliveredAt, &s.CreatedAt, &s.UpdatedAt)
+	if shippedAt.Valid {
+		s.ShippedAt = &shippedAt.Time
+	}
+	if deliveredAt.Valid {
+		s.DeliveredAt = &deliveredAt.Time
+	}
+	return s, err
+}
+
+// GetShipmentsByOrderID returns the shipments of an order with their items, oldest first
+func GetShipmentsByOrderID(orderID int) ([]Shipment, error) {
+	rows, err := DB.Query(`SELECT `+shipmentColumns+` FROM shipments WHERE order_id = ? ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Shipment
+	index := map[int]int{}
+	for rows.Next() {
+		s, err := scanShipment(rows)
+		if err != nil {
+			return nil, err
+		}
+		index[s.ID] = len(list)
+		list = append(list, s)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return list, nil
+	}
+
+	itemRows, err := DB.Query(`
+		SELECT si.id, si.shipment_id, si.order_item_id, oi.product_id, si.quantity
+		FROM shipment_items si
+		JOIN shipments s ON s.id = si.shipment_id
+		JOIN order_items oi ON oi.id = si.order_item_id
+		WHERE s.order_id = ?
+		ORDER BY si.id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer itemRows.Close()
+
+	for itemRows.Next() {
+		var item ShipmentItem
+		if err := itemRows.Scan(&item.ID, &item.ShipmentID, &item.OrderItemID, &item.ProductID, &item.Quantity); err != nil {
+			return nil, err
+		}
+		if i, ok := index[item.ShipmentID]; ok {
+			list[i].Items = append(list[i].Items, item)
+		}
+	}
+	return list, itemRows.Err()
+}
+
+// GetShipmentByID returns a shipment with its items
+func GetShipmentByID(id int) (Shipment, error) {
+	s, err := scanShipment(DB.QueryRow(`SELECT `+shipmentColumns+` FROM shipments WHERE id = ?`, id))
+	if err == sql.ErrNoRows {
+		return s, ErrShipmentNotFound
+	} else if err != nil {
+		return s, err
+	}
+
+	list, err := GetShipmentsByOrderID(s.OrderID)
+	if err != nil {
+		return s, err
+	}
+	for _, candidate := range list {
+		if candidate.ID == id {
+			return candidate, nil
+		}
+	}
+	return s, nil
+}
+
+// CreateShipment puts quantities of order items into a new shipment. With no lines, every
+// quantity not yet in a shipment is included. The order moves to processing.
+func CreateShipment(orderID int, carrier, trackingNumber string, lines []ShipmentLine) (Shipment, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return Shipment{}, err
+	}
+	defer tx.Rollback()
+
+	var status string
+	if err := tx.QueryRow("SELECT status FROM orders WHERE id = ?", orderID).Scan(&status); err != nil {
+		return Shipment{}, err
+	}
+	if !shippableOrderStatuses[status] {
+		return Shipment{}, fmt.Errorf("%w: %s", ErrShipmentNotAllowed, status)
+	}
+
+	// Quantities of each order item not yet in a shipment
+	remaining := map[int]int{}
+	var itemIDs []int
+	rows, err := tx.Query(`
+		SELECT oi.id,
+		       oi.quantity - COALESCE((SELECT SUM(si.quantity) FROM shipment_items si WHERE si.order_item_id = oi.id), 0)
+		FROM order_items oi
+		WHERE oi.order_id = ?
+		ORDER BY oi.id`, orderID)
+	if err != nil {
+		return Shipment{}, err
+	}
+	for rows.Next() {
+		var id, left int
+		if err := rows.Scan(&id, &left); err != nil {
+			rows.Close()
+			return Shipment{}, err
+		}
+		remaining[id] = left
+		itemIDs = append(itemIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return Shipment{}, err
+	}
+
+	if len(lines) == 0 {
+		for _, id := range itemIDs {
+			if remaining[id] > 0 {
+				lines = append(lines, ShipmentLine{OrderItemID: id, Quantity: remaining[id]})
+			}
+		}
+		if len(lines) == 0 {
+			return Shipment{}, ErrShipmentNothingToAdd
+		}
+	}
+
+	for _, line := range lines {
+		left, ok := remaining[line.OrderItemID]
+		if !ok {
+			return Shipment{}, fmt.Errorf("%w: %d", ErrShipmentItem, line.OrderItemID)
+		}
+		if line.Quantity <= 0 || line.Quantity > left {
+			return Shipment{}, fmt.Errorf("%w: item %d has %d left", ErrShipmentQuantity, line.OrderItemID, left)
+		}
+		remaining[line.OrderItemID] -= line.Quantity
+	}
+
+	id, err := insertID(tx, `
+		INSERT INTO shipments (order_id, carrier, tracking_number, status, created_at, updated_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)`,
+		orderID, carrier, trackingNumber, ShipmentStatusPending)
+	if err != nil {
+		return Shipment{}, err
+	}
+
+	for _, line := range lines {
+		_, err := tx.Exec("INSERT INTO shipment_items (shipment_id, order_item_id, quantity) VALUES (?, ?, ?)",
+			id, line.OrderItemID, line.Quantity)
+		if err != nil {
+			return Shipment{}, err
+		}
+	}
+
+	if err := syncOrderFulfilmentStatus(tx, orderID); err != nil {
+		return Shipment{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Shipment{}, err
+	}
+	return GetShipmentByID(id)
+}
+
+// MarkShipmentShipped records that the carrier picked a shipment up and takes its items out of stock.
+// Empty carrier or tracking number keep the values given at creation. Once every item has shipped the
+// order moves to shipped.
+func MarkShipmentShipped(id int, carrier, trackingNumber string, shippedAt time.Time) (Shipment, error) {
+	return advanceShipment(id, ShipmentStatusPending, ShipmentStatusShipped, `
+		UPDATE shipments
+		SET status = ?,
+		    carrier = CASE WHEN ? = '' THEN carrier ELSE ? END,
+		    tracking_number = CASE WHEN ? = '' THEN tracking_number ELSE ? END,
+		    shipped_at = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status = ?`,
+		ShipmentStatusShipped, carrier, carrier, trackingNumber, trackingNumber, shippedAt.UTC().Truncate(time.Second), id, ShipmentStatusPending)
+}
+
+// MarkShipmentDelivered records the delivery of a shipped shipment. Once every item has been
+// delivered the order moves to delivered.
+func MarkShipmentDelivered(id int, deliveredAt time.Time) (Shipment, error) {
+	return advanceShipment(id, ShipmentStatusShipped, ShipmentStatusDelivered, `
+		UPDATE shipments
+		SET status = ?, delivered_at = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status = ?`,
+		ShipmentStatusDelivered, deliveredAt.UTC().Truncate(time.Second), id, ShipmentStatusShipped)
+}
+
+// advanceShipment runs a guarded status update and syncs the order status in one transaction
+func advanceShipment(id int, from, to, query string, args ...interface{}) (Shipment, error) {
+	shipment, err := GetShipmentByID(id)
+	if err != nil {
+		return shipment, err
+	}
+	if shipment.Status != from {
+		return shipment, ErrShipmentState
+	}
+
+	tx, err := DB.Begin()
+	if err != nil {
+		return shipment, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(query, args...)
+	if err != nil {
+		return shipment, err
+	}
+	if n, err := result.RowsAffected(); err != nil {
+		return shipment, err
+	} else if n == 0 {
+		return shipment, ErrShipmentState
+	}
+
+	// Shipped goods leave the warehouse
+	if to == ShipmentStatusShipped {
+		for _, item := range shipment.Items {
+			if err := takeStock(tx, shipment.OrderID, item.ProductID, item.Quantity); err != nil {
+				return shipment, err
+			}
+		}
+	}
+
+	if err := syncOrderFulfilmentStatus(tx, shipment.OrderID); err != nil {
+		return shipment, err
+	}
+	if err := tx.Commit(); err != nil {
+		return shipment, err
+	}
+	return GetShipmentByID(id)
+}
+
+// syncOrderFulfilmentStatus derives the order status from its shipments: processing while
+// anything is being fulfilled, shipped once every item has shipped and delivered once every
+// item has been delivered. Orders only ever move forward.
+func syncOrderFulfilmentStatus(tx *sql.Tx, orderID int) error {
+	var status string
+	var ordered, shipped, delivered int
+	err := tx.QueryRow(`
+		SELECT o.status,
+		       COALESCE((SELECT SUM(quantity) FROM order_items WHERE order_id = o.id), 0),
+		       COALESCE((SELECT SUM(si.quantity) FROM shipment_items si JOIN shipments s ON s.id = si.shipment_id
+		                 WHERE s.order_id = o.id AND s.status IN (?, ?)), 0),
+		       COALESCE((SELECT SUM(si.quantity) FROM shipment_items si JOIN shipments s ON s.id = si.shipment_id
+		                 WHERE s.order_id = o.id AND s.status = ?), 0)
+		FROM orders o
+		WHERE o.id = ?`, ShipmentStatusShipped, ShipmentStatusDelivered, ShipmentStatusDelivered, orderID).
+		Scan(&status, &ordered, &shipped, &delivered)
+	if err != nil {
+		return err
+	}
+
+	next := OrderStatusProcessing
+	switch {
+	case ordered > 0 && delivered >= ordered:
+		next = OrderStatusDelivered
+	case ordered > 0 && shipped >= ordered:
+		next = OrderStatusShipped
+	}
+
+	// Skip intermediate statuses, e.g. processing -> delivered when the last shipment is delivered
+	// before the order was marked shipped
+	path := []string{status}
+	for _, s := range []string{OrderStatusProcessing, OrderStatusShipped, OrderStatusDelivered} {
+		if CanTransitionOrder(path[len(path)-1], s) {
+			path = append(path, s)
+		}
+		if s == next {
+			break
+		}
+	}
+	if path[len(path)-1] == status {
+		return nil
+	}
+
+	_, err = tx.Exec("UPDATE orders SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		path[len(path)-1], orderID)
+	return err
+}
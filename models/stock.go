@@ -0,0 +1,253 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// openReservations is the quantity of a product held by open reservations, less what has already
+// been taken out of stock, for use in a query on products
+const openReservations = `COALESCE((SELECT SUM(r.quantity - r.taken) FROM stock_reservations r
+		WHERE r.product_id = products.id AND r.released_at IS NULL), 0)`
+
+// availableStockColumn is the stock of a product that can still be ordered: the units on hand
+// less those open orders have reserved
+const availableStockColumn = `COALESCE(stock, 0) - ` + openReservations
+
+// reserveStock records the ordered quantity of each item as held by the order until it is cancelled
+// or the stock is taken out. Reservations do not change products.stock; they record what is spoken for. An item ordering more
+// than is available is rejected with a *ValidationError. On PostgreSQL the product rows are locked
+// so concurrent orders check their stock one at a time; on SQLite the order already inserted in tx
+// holds the database write lock.
+func reserveStock(tx *sql.Tx, orderID int, items []OrderItem) error {
+	verr := &ValidationError{}
+	ordered := map[int]int{}
+	for i, item := range items {
+		if isPostgres() {
+			if _, err := tx.Exec("SELECT id FROM products WHERE id = ? FOR UPDATE", item.ProductID); err != nil {
+				return err
+			}
+		}
+		var available int
+		err := tx.QueryRow("SELECT "+availableStockColumn+" FROM products WHERE id = ?", item.ProductID).Scan(&available)
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+
+		// Lines of the same product draw on the same stock
+		ordered[item.ProductID] += item.Quantity
+		if ordered[item.ProductID] > available {
+			field := fmt.Sprintf("items[%d].quantity", i)
+			verr.add(field, FieldInsufficientStock,
+				fmt.Sprintf("%s exceeds the %d units of product %d available", field, max(available, 0), item.ProductID))
+		}
+	}
+	if err := verr.err(); err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		_, err := tx.Exec(
+			"INSERT INTO stock_reservations (order_id, product_id, quantity, created_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)",
+			orderID, item.ProductID, item.Quantity)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseStockReservations releases the open reservations of an order
+func releaseStockReservations(q execer, orderID int) error {
+	_, err := q.Exec(
+		"UPDATE stock_reservations SET released_at = CURRENT_TIMESTAMP WHERE order_id = ? AND released_at IS NULL",
+		orderID)
+	return err
+}
+
+// takeStock takes quantity units of a product out of stock for an order as they leave the
+// warehouse, e.g. when a shipment ships: products.stock is lowered and the order's reservations
+// of the product no longer hold them. A reservation taken in full is closed.
+func takeStock(tx *sql.Tx, orderID, productID, quantity int) error {
+	if quantity <= 0 {
+		return nil
+	}
+	_, err := tx.Exec("UPDATE products SET stock = COALESCE(stock, 0) - ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		quantity, productID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`
+		SELECT id, quantity - taken FROM stock_reservations
+		WHERE order_id = ? AND product_id = ? AND released_at IS NULL
+		ORDER BY id`, orderID, productID)
+	if err != nil {
+		return err
+	}
+	type reservation struct{ id, held int }
+	var reservations []reservation
+	for rows.Next() {
+		var r reservation
+		if err := rows.Scan(&r.id, &r.held); err != nil {
+			rows.Close()
+			return err
+		}
+		reservations = append(reservations, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, r := range reservations {
+		if quantity <= 0 {
+			break
+		}
+		n := min(quantity, r.held)
+		quantity -= n
+		_, err := tx.Exec(`
+			UPDATE stock_reservations
+			SET taken = taken + ?, released_at = CASE WHEN taken + ? >= quantity THEN CURRENT_TIMESTAMP END
+			WHERE id = ?`, n, n, r.id)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// takeReservedStock takes everything an order still holds out of stock, for orders marked
+// shipped, delivered or completed without shipments
+func takeReservedStock(tx *sql.Tx, orderID int) error {
+	rows, err := tx.Query(`
+		SELECT product_id, SUM(quantity - taken) FROM stock_reservations
+		WHERE order_id = ? AND released_at IS NULL
+		GROUP BY product_id
+		ORDER BY product_id`, orderID)
+	if err != nil {
+		return err
+	}
+	held := map[int]int{}
+	var products []int
+	for rows.Next() {
+		var productID, quantity int
+		if err := rows.Scan(&productID, &quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		held[productID] = quantity
+		products = append(products, productID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, productID := range products {
+		if err := takeStock(tx, orderID, productID, held[productID]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// settleStock updates the stock an order holds for its new status: a cancelled or refunded order
+// gives back what it has not taken, and a shipped, delivered or completed one takes the rest.
+// A cancelled order also gives back the coupon it redeemed, as CancelStaleOrders does.
+func settleStock(tx *sql.Tx, orderID int, status string) error {
+	switch status {
+	case OrderStatusCancelled:
+		if err := releaseStockReservations(tx, orderID); err != nil {
+			return err
+		}
+		return releaseCoupons(tx, orderID)
+	case OrderStatusRefunded:
+		return releaseStockReservations(tx, orderID)
+	case OrderStatusShipped, OrderStatusDelivered, OrderStatusCompleted:
+		return takeReservedStock(tx, orderID)
+	}
+	return nil
+}
+
+// restockableQuantity returns how many units of a product can be put back in stock for an order:
+// those taken out for it less those earlier returns already restocked
+func restockableQuantity(tx *sql.Tx, orderID, productID int) (int, error) {
+	var taken, restocked int
+	err := tx.QueryRow("SELECT COALESCE(SUM(taken), 0) FROM stock_reservations WHERE order_id = ? AND product_id = ?",
+		orderID, productID).Scan(&taken)
+	if err != nil {
+		return 0, err
+	}
+	err = tx.QueryRow(`
+		SELECT COALESCE(SUM(ri.restocked), 0)
+		FROM order_return_items ri
+		JOIN order_returns r ON r.id = ri.return_id
+		WHERE r.order_id = ? AND ri.product_id = ?`, orderID, productID).Scan(&restocked)
+	return max(taken-restocked, 0), err
+}
+
+// CancelStaleOrders cancels pending orders created before now minus olderThan, releasing their
+// reserved stock and any coupon they redeemed. It returns the IDs of the cancelled orders.
+func CancelStaleOrders(olderThan time.Duration) ([]int, error) {
+	cutoff := time.Now().UTC().Add(-olderThan)
+	rows, err := DB.Query(
+		"SELECT id FROM orders WHERE status = ? AND created_at < ? ORDER BY id",
+		OrderStatusPending, cutoff.Format("2006-01-02 15:04:05"))
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	cancelled := make([]int, 0, len(ids))
+	for _, id := range ids {
+		ok, err := cancelStaleOrder(id)
+		if err != nil {
+			return cancelled, err
+		}
+		if ok {
+			cancelled = append(cancelled, id)
+		}
+	}
+	return cancelled, nil
+}
+
+// cancelStaleOrder cancels one order if it is still pending, e.g. not paid meanwhile
+func cancelStaleOrder(id int) (bool, error) {
+	tx, err := DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"UPDATE orders SET status = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND status = ?",
+		OrderStatusCancelled, id, OrderStatusPending)
+	if err != nil {
+		return false, err
+	}
+	if n, err := result.RowsAffected(); err != nil || n == 0 {
+		return false, err
+	}
+
+	if err := releaseStockReservations(tx, id); err != nil {
+		return false, err
+	}
+	if err := releaseCoupons(tx, id); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPlaceOrderChecksAvailableStock(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		userID := createTestUser(t)
+		productID := createTestProduct(t, 10, 5)
+
+		assertStock := func(wantAvailable, wantOnHand int) {
+			t.Helper()
+			p, err := GetProductByID(productID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Stock != wantAvailable || p.OnHand != wantOnHand {
+				t.Errorf("stock %d, on hand %d, want %d and %d", p.Stock, p.OnHand, wantAvailable, wantOnHand)
+			}
+		}
+
+		first := createTestOrder(t, userID, productID, 3)
+		assertStock(2, 5)
+
+		// Two lines of the product together ask for more than the 2 left
+		_, err := CreateOrder(userID, []ItemRequest{{ProductID: productID, Quantity: 1}, {ProductID: productID, Quantity: 2}})
+		var verr *ValidationError
+		if !errors.As(err, &verr) || len(verr.Fields) != 1 || verr.Fields[0].Field != "items[1].quantity" ||
+			verr.Fields[0].Code != FieldInsufficientStock {
+			t.Fatalf("ordering 3 of 2 available: got %v", err)
+		}
+		assertStock(2, 5)
+
+		createTestOrder(t, userID, productID, 2)
+		assertStock(0, 5)
+
+		// Cancelling gives the reservation back
+		if err := UpdateOrderStatus(first, OrderStatusCancelled); err != nil {
+			t.Fatal(err)
+		}
+		assertStock(3, 5)
+		createTestOrder(t, userID, productID, 3)
+		assertStock(0, 5)
+	})
+}
+
+func TestShippingTakesStockAndReturnsOnlyRestockIt(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		productID := createTestProduct(t, 10, 10)
+		orderID := createTestOrder(t, createTestUser(t), productID, 4)
+		if err := UpdateOrderStatus(orderID, OrderStatusPaid); err != nil {
+			t.Fatal(err)
+		}
+		items, err := GetOrderItems(orderID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		assertStock := func(wantAvailable, wantOnHand int) {
+			t.Helper()
+			p, err := GetProductByID(productID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Stock != wantAvailable || p.OnHand != wantOnHand {
+				t.Errorf("stock %d, on hand %d, want %d and %d", p.Stock, p.OnHand, wantAvailable, wantOnHand)
+			}
+		}
+		assertStock(6, 10)
+
+		// Three of the four units ship; the fourth stays reserved
+		shipment, err := CreateShipment(orderID, "ups", "1Z", []ShipmentLine{{OrderItemID: items[0].ID, Quantity: 3}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := MarkShipmentShipped(shipment.ID, "", "", time.Now()); err != nil {
+			t.Fatal(err)
+		}
+		assertStock(6, 7)
+
+		// All four come back, but only the three that left the warehouse go back in stock
+		ret, err := CreateReturn(orderID, "damaged", []ReturnLine{{OrderItemID: items[0].ID, Quantity: 4}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ApproveReturn(ret.ID, ""); err != nil {
+			t.Fatal(err)
+		}
+		ret, err = ReceiveReturn(ret.ID, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ret.Items[0].Restocked != 3 {
+			t.Errorf("restocked %d units, want 3", ret.Items[0].Restocked)
+		}
+		// The full refund also gives back the unit still reserved
+		assertStock(10, 10)
+	})
+}
+
+func TestStatusChangesSettleStock(t *testing.T) {
+	forEachDatabase(t, func(t *testing.T) {
+		productID := createTestProduct(t, 10, 10)
+		userID := createTestUser(t)
+
+		// Marked completed without shipments: the goods have left
+		completed := createTestOrder(t, userID, productID, 2)
+		for _, status := range OrderStatusPath(OrderStatusPending, OrderStatusCompleted) {
+			if err := UpdateOrderStatus(completed, status); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Refunded before shipping: the reservation is given back
+		refunded := createTestOrder(t, userID, productID, 3)
+		for _, status := range OrderStatusPath(OrderStatusPending, OrderStatusRefunded) {
+			if err := UpdateOrderStatus(refunded, status); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		p, err := GetProductByID(productID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Stock != 8 || p.OnHand != 8 {
+			t.Errorf("stock %d, on hand %d, want 8 and 8", p.Stock, p.OnHand)
+		}
+	})
+}
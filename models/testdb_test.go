@@ -0,0 +1,251 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testPostgresDSN names the environment variable with a PostgreSQL DSN to run the database tests
+// against. They use a schema of their own, go_crud_test, which is dropped first.
+const testPostgresDSN = "TEST_POSTGRES_DSN"
+
+const testSchema = "go_crud_test"
+
+// testPostgres is the PostgreSQL server of the tests: the one in TEST_POSTGRES_DSN, or else a
+// temporary one started with the initdb and pg_ctl of a local installation
+var testPostgres struct {
+	once sync.Once
+	dsn  string
+	err  error
+	stop func()
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if testPostgres.stop != nil {
+		testPostgres.stop()
+	}
+	os.Exit(code)
+}
+
+// postgresDSN returns the DSN of the test PostgreSQL server. Without one the PostgreSQL tests
+// are skipped, except when CI is set: there they fail, so a CI run cannot pass on SQLite alone.
+func postgresDSN(t testing.TB) string {
+	t.Helper()
+	testPostgres.once.Do(func() {
+		if dsn := os.Getenv(testPostgresDSN); dsn != "" {
+			testPostgres.dsn = dsn
+			return
+		}
+		testPostgres.dsn, testPostgres.stop, testPostgres.err = startPostgres()
+	})
+	if testPostgres.err != nil {
+		if os.Getenv("CI") != "" {
+			t.Fatalf("PostgreSQL is required in CI: %v", testPostgres.err)
+		}
+		t.Skipf("PostgreSQL: %v", testPostgres.err)
+	}
+	return testPostgres.dsn
+}
+
+// startPostgres starts a temporary PostgreSQL server listening only on a socket in a temporary
+// directory, and returns its DSN and a function stopping it
+func startPostgres() (string, func(), error) {
+	bin, err := postgresBinDir()
+	if err != nil {
+		return "", nil, err
+	}
+	dir, err := os.MkdirTemp("", "go-crud-pg")
+	if err != nil {
+		return "", nil, err
+	}
+	data := filepath.Join(dir, "data")
+	pgCtl := filepath.Join(bin, "pg_ctl")
+
+	out, err := exec.Command(filepath.Join(bin, "initdb"), "-D", data, "-U", "postgres", "-A", "trust", "--no-sync").CombinedOutput()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("initdb: %v\n%s", err, out)
+	}
+	out, err = exec.Command(pgCtl, "-D", data, "-l", filepath.Join(dir, "postgres.log"), "-w",
+		"-o", "-k "+dir+" -c listen_addresses='' -F", "start").CombinedOutput()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("pg_ctl start: %v\n%s", err, out)
+	}
+
+	stop := func() {
+		exec.Command(pgCtl, "-D", data, "-m", "immediate", "stop").Run()
+		os.RemoveAll(dir)
+	}
+	return "host=" + dir + " user=postgres dbname=postgres sslmode=disable", stop, nil
+}
+
+// postgresBinDir finds the directory with initdb and pg_ctl, on the PATH or through pg_config
+func postgresBinDir() (string, error) {
+	if initdb, err := exec.LookPath("initdb"); err == nil {
+		return filepath.Dir(initdb), nil
+	}
+	if out, err := exec.Command("pg_config", "--bindir").Output(); err == nil {
+		bin := strings.TrimSpace(string(out))
+		if _, err := os.Stat(filepath.Join(bin, "initdb")); err == nil {
+			return bin, nil
+		}
+	}
+	return "", errors.New("set " + testPostgresDSN + " or install PostgreSQL so initdb and pg_ctl can be found")
+}
+
+// forEachDatabase runs fn against a freshly migrated SQLite database and PostgreSQL database (see
+// postgresDSN). DB and Driver point at the database while fn runs, so tests using it cannot run
+// in parallel.
+func forEachDatabase(t *testing.T, fn func(t *testing.T)) {
+	t.Helper()
+	forEachEmptyDatabase(t, func(t *testing.T) {
+		if _, err := MigrateUp(0); err != nil {
+			t.Fatalf("migrating the test database: %v", err)
+		}
+		fn(t)
+	})
+}
+
+// forEachEmptyDatabase is forEachDatabase without the migrations
+func forEachEmptyDatabase(t *testing.T, fn func(t *testing.T)) {
+	t.Helper()
+	t.Run(DriverSQLite, func(t *testing.T) {
+		openTestDatabase(t, DriverSQLite, filepath.Join(t.TempDir(), "test.db"))
+		fn(t)
+	})
+	t.Run(DriverPostgres, func(t *testing.T) {
+		openTestDatabase(t, DriverPostgres, postgresTestDSN(t, postgresDSN(t)))
+		fn(t)
+	})
+}
+
+// benchmarkEachDatabase is forEachDatabase for benchmarks
+func benchmarkEachDatabase(b *testing.B, fn func(b *testing.B)) {
+	b.Helper()
+	b.Run(DriverSQLite, func(b *testing.B) {
+		useTestDatabase(b, DriverSQLite, filepath.Join(b.TempDir(), "bench.db"))
+		fn(b)
+	})
+	b.Run(DriverPostgres, func(b *testing.B) {
+		useTestDatabase(b, DriverPostgres, postgresTestDSN(b, postgresDSN(b)))
+		fn(b)
+	})
+}
+
+func useTestDatabase(t testing.TB, driver, dsn string) {
+	t.Helper()
+	openTestDatabase(t, driver, dsn)
+	if _, err := MigrateUp(0); err != nil {
+		t.Fatalf("migrating the test database: %v", err)
+	}
+}
+
+func openTestDatabase(t testing.TB, driver, dsn string) {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	prevDB, prevDriver := DB, Driver
+	db, err := Open(driver, dsn)
+	if err != nil {
+		t.Fatalf("opening the test database: %v", err)
+	}
+	DB = db
+	t.Cleanup(func() {
+		db.Close()
+		DB, Driver = prevDB, prevDriver
+	})
+	if err := db.Ping(); err != nil {
+		t.Fatalf("connecting to the test database: %v", err)
+	}
+}
+
+// postgresTestDSN recreates the test schema and returns dsn with its search_path set to it
+func postgresTestDSN(t testing.TB, dsn string) string {
+	t.Helper()
+	prevDriver := Driver
+	db, err := Open(DriverPostgres, dsn)
+	Driver = prevDriver
+	if err != nil {
+		t.Fatalf("opening %s: %v", testPostgresDSN, err)
+	}
+	defer db.Close()
+	for _, stmt := range []string{
+		"DROP SCHEMA IF EXISTS " + testSchema + " CASCADE",
+		"CREATE SCHEMA " + testSchema,
+	} {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatalf("preparing the test schema: %v", err)
+		}
+	}
+
+	if strings.Contains(dsn, "://") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		return dsn + sep + "search_path=" + testSchema
+	}
+	return dsn + " search_path=" + testSchema
+}
+
+// mustExec runs a statement the test depends on
+func mustExec(t *testing.T, query string, args ...interface{}) sql.Result {
+	t.Helper()
+	result, err := DB.Exec(query, args...)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	return result
+}
+
+// createTestUser creates a user with a unique email
+func createTestUser(t *testing.T) int {
+	t.Helper()
+	id, err := CreateUser(fmt.Sprintf("user%d@example.com", nextTestID()))
+	if err != nil {
+		t.Fatalf("creating a user: %v", err)
+	}
+	return id
+}
+
+// createTestProduct creates an active product with stock on hand
+func createTestProduct(t *testing.T, price float64, stock int) int {
+	t.Helper()
+	id, err := CreateProduct(fmt.Sprintf("Product %d", nextTestID()), "active", price)
+	if err != nil {
+		t.Fatalf("creating a product: %v", err)
+	}
+	if err := UpdateProductDetails(id, 1, "general", stock); err != nil {
+		t.Fatalf("setting product stock: %v", err)
+	}
+	return id
+}
+
+// createTestOrder places a pending order for quantity of a product
+func createTestOrder(t *testing.T, userID, productID, quantity int) int {
+	t.Helper()
+	id, err := CreateOrder(userID, []ItemRequest{{ProductID: productID, Quantity: quantity}})
+	if err != nil {
+		t.Fatalf("creating an order: %v", err)
+	}
+	return id
+}
+
+var testIDs int
+
+func nextTestID() int {
+	testIDs++
+	return testIDs
+}
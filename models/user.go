@@ -16,14 +16,14 @@ type User struct {
 
 // UserSignup represents the data needed for registration
 type UserSignup struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required,email"`
+	Password string `json:"password" validate:"required,min=6"`
 }
 
 // UserLogin represents the data needed for login
 type UserLogin struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
 }
 
 // AuthResponse represents the response for successful authentication
@@ -72,13 +72,7 @@ func GetUserByEmail(email string) (User, error) {
 
 // CreateUser creates a new user with plain text password
 func CreateUser(email string) (int, error) {
-	result, err := DB.Exec("INSERT INTO users (email) VALUES (?)", email)
-	if err != nil {
-		return 0, err
-	}
-	
-	id, err := result.LastInsertId()
-	return int(id), err
+	return insertID(DB, "INSERT INTO users (email) VALUES (?)", email)
 }
 
 // RegisterUser creates a new user with hashed password
@@ -100,13 +94,7 @@ func RegisterUser(email, password string) (int, error) {
 	}
 
 	// Create the user
-	result, err := DB.Exec("INSERT INTO users (email, password) VALUES (?, ?)", email, hashedPassword)
-	if err != nil {
-		return 0, err
-	}
-
-	id, err := result.LastInsertId()
-	return int(id), err
+	return insertID(DB, "INSERT INTO users (email, password) VALUES (?, ?)", email, hashedPassword)
 }
 
 // LoginUser validates credentials and returns user if valid
@@ -0,0 +1,356 @@
+// Package openapi builds an OpenAPI 3.1 document from the server's route registrations and
+// the Go types of their request and response bodies.
+package openapi
+
+import (
+	_ "embed"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"go-crud/problem"
+)
+
+//go:embed docs.html
+var DocsPage []byte
+
+// Auth is the kind of credentials a route requires
+type Auth int
+
+const (
+	AuthNone      Auth = iota
+	AuthAdmin          // Basic auth with DEFAULT_ADMIN_EMAIL and DEFAULT_ADMIN_PASSWORD
+	AuthUser           // a user's JWT bearer token or Basic credentials
+	AuthSignature      // an HMAC signature of the body in X-Payment-Signature
+)
+
+// Param is a query parameter
+type Param struct {
+	Name        string
+	Type        string // "integer", "number", "boolean" or "string" (default)
+	Description string
+	Required    bool
+}
+
+// Endpoint describes a route for the document. Request and Response are values of the body
+// types, e.g. addressRequest{} or []models.Order{}; their schemas are derived by reflection.
+type Endpoint struct {
+	Summary     string
+	Tag         string
+	Auth        Auth
+	Query       []Param
+	Request     interface{}         // JSON request body; nil for none
+	Response    interface{}         // JSON response body; nil for none
+	ByVersion   map[int]interface{} // response body of the API versions where it differs
+	Status      int                 // success status, 200 by default
+	ContentType string              // response media type when it is not JSON, e.g. application/pdf
+}
+
+// Route is a registered route. Legacy aliases name the route that replaces them.
+type Route struct {
+	Pattern   string // method and path, as registered with the ServeMux
+	Versioned bool   // also served under /v1 and /v2
+	Successor string // pattern of the replacement of a deprecated alias
+}
+
+// Document is an OpenAPI 3.1 document
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       Info                 `json:"info"`
+	Servers    []Server             `json:"servers,omitempty"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type Server struct {
+	URL         string `json:"url"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations of a path by lower-case method, as the specification does
+type PathItem struct {
+	Servers    []Server    `json:"servers,omitempty"`
+	Get        *Operation  `json:"get,omitempty"`
+	Put        *Operation  `json:"put,omitempty"`
+	Post       *Operation  `json:"post,omitempty"`
+	Delete     *Operation  `json:"delete,omitempty"`
+	Patch      *Operation  `json:"patch,omitempty"`
+	Parameters []Parameter `json:"parameters,omitempty"`
+}
+
+type Operation struct {
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId"`
+	Tags        []string              `json:"tags,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type Header struct {
+	Description string  `json:"description,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+var securitySchemes = map[string]SecurityScheme{
+	"adminBasic": {Type: "http", Scheme: "basic", Description: "DEFAULT_ADMIN_EMAIL and DEFAULT_ADMIN_PASSWORD"},
+	"userBearer": {Type: "http", Scheme: "bearer", BearerFormat: "JWT", Description: "Token from POST /auth/login"},
+	"userBasic":  {Type: "http", Scheme: "basic", Description: "A user's email and password"},
+	"signature":  {Type: "apiKey", In: "header", Name: "X-Payment-Signature", Description: "Hex HMAC-SHA256 of the body with PAYMENT_WEBHOOK_SECRET"},
+}
+
+func (a Auth) security() []map[string][]string {
+	switch a {
+	case AuthAdmin:
+		return []map[string][]string{{"adminBasic": {}}}
+	case AuthUser:
+		return []map[string][]string{{"userBearer": {}}, {"userBasic": {}}}
+	case AuthSignature:
+		return []map[string][]string{{"signature": {}}}
+	}
+	return []map[string][]string{}
+}
+
+var pathParam = regexp.MustCompile(`\{([A-Za-z_][A-Za-z0-9_]*)(\.\.\.)?\}`)
+
+// Build returns the document of an API version. Versioned routes are listed relative to the
+// /vN server; unversioned ones and legacy aliases override it with the root. Deprecated
+// aliases are listed once, under GET for reads and POST for writes, with the request of
+// their successor. It fails if a route has no endpoint.
+func Build(info Info, version int, routes []Route, endpoints map[string]Endpoint) (*Document, error) {
+	if err := Check(routes, endpoints); err != nil {
+		return nil, err
+	}
+
+	doc := &Document{
+		OpenAPI: "3.1.0",
+		Info:    info,
+		Servers: []Server{{URL: fmt.Sprintf("/v%d", version), Description: fmt.Sprintf("API version %d", version)}},
+		Paths:   map[string]*PathItem{},
+		Components: Components{
+			Schemas:         map[string]*Schema{},
+			SecuritySchemes: securitySchemes,
+		},
+	}
+	gen := newGenerator(doc.Components.Schemas)
+
+	seen := map[string]bool{}
+	for _, route := range routes {
+		method, path, _ := strings.Cut(route.Pattern, " ")
+		endpoint := endpoints[route.Pattern]
+		deprecated := route.Successor != ""
+		if deprecated {
+			endpoint = endpoints[route.Successor]
+			// One entry per alias: GET for reads, POST (or the alias's only method) for writes
+			if method != http.MethodGet && method != http.MethodPost {
+				continue
+			}
+			if seen[path] {
+				continue
+			}
+		}
+		seen[path] = true
+
+		path = strings.TrimSuffix(path, "{$}")
+		item := doc.Paths[path]
+		if item == nil {
+			item = &PathItem{}
+			if !route.Versioned {
+				item.Servers = []Server{{URL: "/", Description: "Not versioned"}}
+			}
+			doc.Paths[path] = item
+		}
+
+		op := gen.operation(method, path, endpoint, version)
+		if deprecated {
+			op.Deprecated = true
+			op.OperationID = "legacy" + strings.ToUpper(op.OperationID[:1]) + op.OperationID[1:]
+			op.Description = fmt.Sprintf("Deprecated alias of `%s`. IDs are passed as the `id` query "+
+				"parameter or in the body instead of the path. Responses carry `Deprecation` and `Sunset` headers.",
+				route.Successor)
+			op.Parameters = nil
+			if strings.Contains(route.Successor, "{id}") && method == http.MethodGet {
+				op.Parameters = append(op.Parameters, Parameter{Name: "id", In: "query", Required: true, Schema: &Schema{Type: "integer"}})
+			}
+			op.Parameters = append(op.Parameters, gen.queryParams(endpoint.Query)...)
+		}
+
+		switch method {
+		case http.MethodGet:
+			item.Get = op
+		case http.MethodPut:
+			item.Put = op
+		case http.MethodPost:
+			item.Post = op
+		case http.MethodDelete:
+			item.Delete = op
+		case http.MethodPatch:
+			item.Patch = op
+		}
+	}
+	return doc, nil
+}
+
+// Check reports the routes without an endpoint and the endpoints without a route
+func Check(routes []Route, endpoints map[string]Endpoint) error {
+	var missing, stale []string
+	registered := map[string]bool{}
+	for _, route := range routes {
+		registered[route.Pattern] = true
+		if route.Successor != "" {
+			if _, ok := endpoints[route.Successor]; !ok {
+				missing = append(missing, route.Successor)
+			}
+		} else if _, ok := endpoints[route.Pattern]; !ok {
+			missing = append(missing, route.Pattern)
+		}
+	}
+	for pattern := range endpoints {
+		if !registered[pattern] {
+			stale = append(stale, pattern)
+		}
+	}
+
+	var problems []string
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		problems = append(problems, "routes without an OpenAPI endpoint: "+strings.Join(missing, ", "))
+	}
+	if len(stale) > 0 {
+		sort.Strings(stale)
+		problems = append(problems, "OpenAPI endpoints without a route: "+strings.Join(stale, ", "))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%s", strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (g *generator) operation(method, path string, e Endpoint, version int) *Operation {
+	op := &Operation{
+		Summary:     e.Summary,
+		OperationID: operationID(method, path),
+		Responses:   map[string]Response{},
+		Security:    e.Auth.security(),
+	}
+	if e.Tag != "" {
+		op.Tags = []string{e.Tag}
+	}
+
+	for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+		schema := &Schema{Type: "string"}
+		if m[1] == "id" || strings.HasSuffix(m[1], "_id") {
+			schema = &Schema{Type: "integer"}
+		}
+		op.Parameters = append(op.Parameters, Parameter{Name: m[1], In: "path", Required: true, Schema: schema})
+	}
+	op.Parameters = append(op.Parameters, g.queryParams(e.Query)...)
+
+	if e.Request != nil {
+		op.RequestBody = &RequestBody{
+			Required: method != http.MethodDelete,
+			Content:  map[string]MediaType{"application/json": {Schema: g.schemaOf(e.Request)}},
+		}
+	}
+
+	status := e.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	response := Response{Description: http.StatusText(status)}
+	body := e.Response
+	if v, ok := e.ByVersion[version]; ok {
+		body = v
+	}
+	switch {
+	case e.ContentType != "":
+		response.Content = map[string]MediaType{e.ContentType: {Schema: &Schema{Type: "string"}}}
+		if e.ContentType == "application/pdf" {
+			response.Content[e.ContentType].Schema.Format = "binary"
+		}
+	case body != nil:
+		response.Content = map[string]MediaType{"application/json": {Schema: g.schemaOf(body)}}
+	}
+	op.Responses[fmt.Sprint(status)] = response
+	op.Responses["default"] = Response{
+		Description: "Error",
+		Content:     map[string]MediaType{problem.ContentType: {Schema: g.schemaOf(problem.Problem{})}},
+	}
+	return op
+}
+
+func (g *generator) queryParams(params []Param) []Parameter {
+	var out []Parameter
+	for _, p := range params {
+		typ := p.Type
+		if typ == "" {
+			typ = "string"
+		}
+		out = append(out, Parameter{Name: p.Name, In: "query", Description: p.Description, Required: p.Required, Schema: &Schema{Type: typ}})
+	}
+	return out
+}
+
+// operationID turns "GET /orders/{id}/invoice" into "getOrdersByIdInvoice"
+func operationID(method, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, segment := range strings.Split(path, "/") {
+		if m := pathParam.FindStringSubmatch(segment); m != nil {
+			b.WriteString("By")
+			segment = m[1]
+		}
+		for _, word := range strings.FieldsFunc(segment, func(r rune) bool { return r == '-' || r == '_' || r == '.' }) {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	return b.String()
+}
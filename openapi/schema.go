@@ -0,0 +1,210 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-crud/validate"
+)
+
+// Schema is a JSON Schema (2020-12) as used by OpenAPI 3.1
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 interface{}        `json:"type,omitempty"` // a type name, or a list of them
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	ExclusiveMinimum     *float64           `json:"exclusiveMinimum,omitempty"`
+	ExclusiveMaximum     *float64           `json:"exclusiveMaximum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+var (
+	timeType       = reflect.TypeOf(time.Time{})
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+)
+
+// generator derives schemas from Go types, putting named structs into components
+type generator struct {
+	schemas map[string]*Schema
+	names   map[reflect.Type]string
+	taken   map[string]reflect.Type
+}
+
+func newGenerator(schemas map[string]*Schema) *generator {
+	return &generator{schemas: schemas, names: map[reflect.Type]string{}, taken: map[string]reflect.Type{}}
+}
+
+func (g *generator) schemaOf(v interface{}) *Schema {
+	return g.schema(reflect.TypeOf(v))
+}
+
+// schema follows encoding/json: field names come from json tags, "-" fields are left out,
+// pointers may be null and embedded structs are flattened
+func (g *generator) schema(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case rawMessageType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		s := g.schema(t.Elem())
+		if typ, ok := s.Type.(string); ok {
+			s.Type = []string{typ, "null"}
+		}
+		return s
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schema(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + g.component(t)}
+	}
+	return &Schema{} // interface{} and anything else: any value
+}
+
+// component adds a named struct to the components once and returns its name
+func (g *generator) component(t reflect.Type) string {
+	if name, ok := g.names[t]; ok {
+		return name
+	}
+
+	name := strings.ToUpper(t.Name()[:1]) + t.Name()[1:]
+	if other, ok := g.taken[name]; ok && other != t {
+		pkg := t.PkgPath()[strings.LastIndex(t.PkgPath(), "/")+1:]
+		name = strings.ToUpper(pkg[:1]) + pkg[1:] + name
+	}
+	g.names[t] = name
+	g.taken[name] = t
+
+	g.schemas[name] = &Schema{} // placeholder for recursive types
+	*g.schemas[name] = *g.object(t)
+	return name
+}
+
+func (g *generator) object(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	g.fields(t, s)
+	return s
+}
+
+func (g *generator) fields(t reflect.Type, s *Schema) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.fields(ft, s)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		s.Properties[name] = g.schema(f.Type)
+		if constrain(s.Properties[name], f.Type, validate.Parse(f.Tag.Get("validate"))) {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// constrain adds the rules of a field's validate tag to its schema and reports whether the
+// field is required
+func constrain(s *Schema, t reflect.Type, rules []validate.Rule) (required bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	for _, rule := range rules {
+		n, _ := strconv.ParseFloat(rule.Param, 64)
+		switch rule.Name {
+		case "required":
+			required = true
+		case "oneof":
+			if s.Items != nil {
+				s.Items.Enum = strings.Fields(rule.Param)
+			} else {
+				s.Enum = strings.Fields(rule.Param)
+			}
+		case "email":
+			s.Format = "email"
+		case "min", "max", "gt", "lt":
+			bound(s, t.Kind(), rule.Name, n)
+		}
+	}
+	return required
+}
+
+// bound sets the schema keyword of a min, max, gt or lt rule: a bound of a number, or of the
+// length of a string or array
+func bound(s *Schema, kind reflect.Kind, rule string, n float64) {
+	length := int(n)
+	switch kind {
+	case reflect.String:
+		switch rule {
+		case "min":
+			s.MinLength = &length
+		case "max":
+			s.MaxLength = &length
+		}
+	case reflect.Slice, reflect.Array:
+		switch rule {
+		case "min":
+			s.MinItems = &length
+		case "max":
+			s.MaxItems = &length
+		}
+	default:
+		switch rule {
+		case "min":
+			s.Minimum = &n
+		case "max":
+			s.Maximum = &n
+		case "gt":
+			s.ExclusiveMinimum = &n
+		case "lt":
+			s.ExclusiveMaximum = &n
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package payments
+
+import (
+	"fmt"
+	"math"
+	"sync"
+)
+
+// Tokens understood by the mock provider. Any other token is approved.
+const (
+	MockTokenDecline      = "tok_decline"
+	MockTokenInsufficient = "tok_insufficient_funds"
+)
+
+// MockProviderName is the name the mock provider is selected by in PAYMENT_PROVIDER
+const MockProviderName = "mock"
+
+// MockProvider is a deterministic in-process gateway for development and tests.
+// References are derived from the merchant reference and outcomes from the token,
+// so the same calls always produce the same results. State is kept in memory only.
+type MockProvider struct {
+	mu       sync.Mutex
+	payments map[string]*Result
+}
+
+// NewMockProvider creates an empty mock gateway
+func NewMockProvider() *MockProvider {
+	return &MockProvider{payments: make(map[string]*Result)}
+}
+
+func (m *MockProvider) Name() string {
+	return MockProviderName
+}
+
+func (m *MockProvider) Authorize(req AuthorizeRequest) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	reference := "mock_" + req.MerchantReference
+	if req.MerchantReference == "" {
+		reference = fmt.Sprintf("mock_order_%d", req.OrderID)
+	}
+
+	// Retrying an authorization returns the existing payment
+	if existing, ok := m.payments[reference]; ok {
+		return *existing, nil
+	}
+
+	switch req.Token {
+	case MockTokenDecline:
+		return Result{Reference: reference, Status: StatusFailed, Amount: req.Amount}, ErrDeclined
+	case MockTokenInsufficient:
+		return Result{Reference: reference, Status: StatusFailed, Amount: req.Amount}, fmt.Errorf("%w: insufficient funds", ErrDeclined)
+	}
+
+	if req.Amount <= 0 {
+		return Result{}, fmt.Errorf("%w: amount must be positive", ErrDeclined)
+	}
+
+	payment := &Result{Reference: reference, Status: StatusAuthorized, Amount: req.Amount}
+	m.payments[reference] = payment
+	return *payment, nil
+}
+
+func (m *MockProvider) Capture(reference string, amount float64) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	payment, ok := m.payments[reference]
+	if !ok {
+		return Result{}, ErrUnknownPayment
+	}
+	if payment.Status != StatusAuthorized {
+		return *payment, ErrInvalidState
+	}
+	if amount <= 0 {
+		amount = payment.Amount
+	}
+	if amount > payment.Amount+0.005 {
+		return *payment, ErrAmountTooLarge
+	}
+
+	payment.Status = StatusCaptured
+	payment.CapturedAmount = round(amount)
+	return *payment, nil
+}
+
+func (m *MockProvider) Refund(reference string, amount float64) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	payment, ok := m.payments[reference]
+	if !ok {
+		return Result{}, ErrUnknownPayment
+	}
+	if payment.Status != StatusCaptured && payment.Status != StatusPartiallyRefunded {
+		return *payment, ErrInvalidState
+	}
+
+	available := payment.CapturedAmount - payment.RefundedAmount
+	if amount <= 0 {
+		amount = available
+	}
+	if amount > available+0.005 {
+		return *payment, ErrAmountTooLarge
+	}
+
+	payment.RefundedAmount = round(payment.RefundedAmount + amount)
+	if payment.RefundedAmount >= payment.CapturedAmount {
+		payment.Status = StatusRefunded
+	} else {
+		payment.Status = StatusPartiallyRefunded
+	}
+	return *payment, nil
+}
+
+func (m *MockProvider) Void(reference string) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	payment, ok := m.payments[reference]
+	if !ok {
+		return Result{}, ErrUnknownPayment
+	}
+	if payment.Status != StatusAuthorized {
+		return *payment, ErrInvalidState
+	}
+
+	payment.Status = StatusVoided
+	return *payment, nil
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
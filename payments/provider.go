@@ -0,0 +1,121 @@
+// Package payments defines the interface to payment gateways and a mock gateway for development
+package payments
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Payment statuses reported by providers
+const (
+	StatusAuthorized        = "authorized"
+	StatusCaptured          = "captured"
+	StatusPartiallyRefunded = "partially_refunded"
+	StatusRefunded          = "refunded"
+	StatusVoided            = "voided"
+	StatusFailed            = "failed"
+)
+
+// Provider errors
+var (
+	ErrDeclined         = errors.New("payment declined")
+	ErrUnknownPayment   = errors.New("unknown payment reference")
+	ErrInvalidState     = errors.New("operation not allowed in the current payment state")
+	ErrAmountTooLarge   = errors.New("amount exceeds the available balance")
+	ErrUnknownProvider  = errors.New("unknown payment provider")
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	ErrMockInProduction = errors.New("the mock payment provider approves any token and cannot be used in production")
+)
+
+// AuthorizeRequest describes a payment to authorize
+type AuthorizeRequest struct {
+	OrderID  int
+	Amount   float64
+	Currency string
+	Token    string // opaque payment method token from the client
+
+	// MerchantReference uniquely identifies this attempt on our side, e.g. "order_12_attempt_1".
+	// Providers use it to make authorization retries idempotent.
+	MerchantReference string
+}
+
+// Result is the provider's view of a payment after an operation
+type Result struct {
+	Reference      string
+	Status         string
+	Amount         float64
+	CapturedAmount float64
+	RefundedAmount float64
+}
+
+// Provider is implemented by payment gateways
+type Provider interface {
+	Name() string
+	Authorize(req AuthorizeRequest) (Result, error)
+	Capture(reference string, amount float64) (Result, error)
+	Refund(reference string, amount float64) (Result, error)
+	Void(reference string) (Result, error)
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]Provider{}
+)
+
+// Register makes a provider available by name
+func Register(p Provider) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	registry[p.Name()] = p
+}
+
+// Get returns a registered provider
+func Get(name string) (Provider, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	p, ok := registry[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProvider, name)
+	}
+	return p, nil
+}
+
+// Setup prepares the provider named by PAYMENT_PROVIDER at startup, registering the mock
+// provider when it is named. An empty name leaves payments disabled. It fails if the provider
+// is not registered, or if production asks for the mock provider.
+func Setup(name string, production bool) error {
+	if name == "" {
+		return nil
+	}
+	if name == MockProviderName {
+		if production {
+			return ErrMockInProduction
+		}
+		Register(NewMockProvider())
+	}
+	_, err := Get(name)
+	return err
+}
+
+// Sign returns the webhook signature of a payload: "sha256=" followed by the hex HMAC-SHA256
+func Sign(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature checks a webhook signature in constant time
+func VerifySignature(secret string, payload []byte, signature string) error {
+	if secret == "" || !strings.HasPrefix(signature, "sha256=") {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(Sign(secret, payload)), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
@@ -0,0 +1,44 @@
+package payments
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestSetup(t *testing.T) {
+	tests := []struct {
+		name       string
+		production bool
+		want       error
+	}{
+		{"", false, nil},
+		{"", true, nil},
+		{MockProviderName, false, nil},
+		{MockProviderName, true, ErrMockInProduction},
+		{"stripe", false, ErrUnknownProvider},
+	}
+	for _, tt := range tests {
+		if err := Setup(tt.name, tt.production); !errors.Is(err, tt.want) {
+			t.Errorf("Setup(%q, production %t) = %v, want %v", tt.name, tt.production, err, tt.want)
+		}
+	}
+
+	if _, err := Get(MockProviderName); err != nil {
+		t.Errorf("mock provider is not registered after Setup: %v", err)
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"id": "evt_1"}`)
+	if err := VerifySignature("secret", body, Sign("secret", body)); err != nil {
+		t.Errorf("valid signature: %v", err)
+	}
+	for _, signature := range []string{Sign("other", body), "", "deadbeef", Sign("secret", []byte("{}"))} {
+		if err := VerifySignature("secret", body, signature); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("signature %q: %v", signature, err)
+		}
+	}
+	if err := VerifySignature("", body, Sign("", body)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("an empty secret accepted a signature: %v", err)
+	}
+}
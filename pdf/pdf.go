@@ -0,0 +1,158 @@
+// Package pdf writes simple single-font PDF documents (text and lines) without external dependencies.
+//
+// Output is deterministic: the same calls always produce the same bytes.
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A4 page size in points
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+// Document is a PDF being built page by page
+type Document struct {
+	title string
+	pages []*Page
+}
+
+// Page holds the content stream of one page. Coordinates are in points from the top-left corner.
+type Page struct {
+	content bytes.Buffer
+}
+
+// New returns an empty document
+func New(title string) *Document {
+	return &Document{title: title}
+}
+
+// AddPage appends a new A4 page
+func (d *Document) AddPage() *Page {
+	p := &Page{}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Text draws s with its baseline starting at (x, y)
+func (p *Page) Text(x, y, size float64, bold bool, s string) {
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(&p.content, "BT /%s %s Tf %s %s Td (%s) Tj ET\n",
+		font, num(size), num(x), num(PageHeight-y), escape(s))
+}
+
+// TextRight draws s so that it ends at x
+func (p *Page) TextRight(x, y, size float64, bold bool, s string) {
+	p.Text(x-TextWidth(s, size, bold), y, size, bold, s)
+}
+
+// Line draws a thin line from (x1, y1) to (x2, y2)
+func (p *Page) Line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(&p.content, "0.5 w %s %s m %s %s l S\n",
+		num(x1), num(PageHeight-y1), num(x2), num(PageHeight-y2))
+}
+
+// Bytes renders the document
+func (d *Document) Bytes() []byte {
+	var buf bytes.Buffer
+	var offsets []int
+
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	pages := d.pages
+	if len(pages) == 0 {
+		pages = []*Page{{}}
+	}
+
+	// Objects 1-5 are fixed; each page then takes two objects (page, content stream)
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 6+2*i)
+	}
+
+	buf.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object(fmt.Sprintf("<< /Title (%s) /Producer (go-crud) >>", escape(d.title)))
+
+	for i, p := range pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %s %s] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			num(PageWidth), num(PageHeight), 7+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.content.Len(), p.content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R /Info 5 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(offsets)+1, xref)
+	return buf.Bytes()
+}
+
+// TextWidth approximates the width of s in Helvetica, good enough for aligning numbers
+func TextWidth(s string, size float64, bold bool) float64 {
+	units := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9', r == '$', r == '#':
+			units += 556
+		case r == '.' || r == ',' || r == ' ' || r == ':' || r == '/':
+			units += 278
+		case r == '-' || r == '(' || r == ')':
+			units += 333
+		case r >= 'A' && r <= 'Z':
+			units += 667
+		case r == 'i' || r == 'l' || r == 'j':
+			units += 222
+		default:
+			units += 556
+		}
+		if bold {
+			units += 20
+		}
+	}
+	return float64(units) * size / 1000
+}
+
+// escape makes s safe inside a PDF string literal. Characters outside Latin-1 become '?'.
+func escape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\n' || r == '\r' || r == '\t':
+			b.WriteByte(' ')
+		case r < 32 || r > 255:
+			b.WriteByte('?')
+		case r > 126:
+			fmt.Fprintf(&b, "\\%03o", r)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// num formats a coordinate without trailing zeros
+func num(v float64) string {
+	s := fmt.Sprintf("%.2f", v)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
@@ -0,0 +1,118 @@
+package problem
+
+import (
+	"database/sql"
+	"net/http"
+
+	"go-crud/models"
+	"go-crud/payments"
+	"go-crud/validate"
+)
+
+// Error codes. Clients branch on these, so they never change once released; new failures get
+// new codes.
+const (
+	// Request errors
+	CodeInvalidBody      = "invalid_body"      // the body is not valid JSON or could not be read
+	CodeInvalidParameter = "invalid_parameter" // a path or query parameter is malformed
+	CodeValidation       = "validation_failed" // the body is well-formed but a field is missing or invalid
+	CodeBodyTooLarge     = "body_too_large"
+	CodeUnauthorized     = "unauthorized"
+	CodeInvalidLogin     = "invalid_login"
+	CodeForbidden        = "forbidden"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeNotAcceptable    = "unsupported_api_version"
+	CodeConflict         = "conflict"
+
+	// Resource errors
+	CodeUserExists           = "user_exists"
+	CodeAddressInUse         = "address_in_use"
+	CodeCouponExists         = "coupon_exists"
+	CodeCouponInvalid        = "coupon_invalid"
+	CodeOrderState           = "order_state"
+	CodeIllegalTransition    = "illegal_transition" // as the result of an order in a batch status update
+	CodeOrderInvoiced        = "order_invoiced"
+	CodeInvoiceNotAllowed    = "invoice_not_allowed"
+	CodeShipmentNotAllowed   = "shipment_not_allowed"
+	CodeShipmentNothingToAdd = "shipment_nothing_to_add"
+	CodeShipmentState        = "shipment_state"
+	CodeShipmentItem         = "shipment_item_invalid"
+	CodeReturnNotAllowed     = "return_not_allowed"
+	CodeReturnState          = "return_state"
+	CodeReturnItem           = "return_item_invalid"
+	CodeIdempotencyConflict  = "idempotency_key_conflict"
+	CodeIdempotencyMismatch  = "idempotency_key_mismatch"
+
+	// Payment errors
+	CodePaymentDeclined  = "payment_declined"
+	CodePaymentState     = "payment_state"
+	CodeInvalidSignature = "invalid_signature"
+	CodePaymentsDisabled = "payments_not_configured"
+
+	// Server errors
+	CodeInternal      = "internal_error"
+	CodeProviderError = "provider_error"
+)
+
+// sentinels maps errors of the models and payments packages to their status and code, so
+// every handler reports them alike. The first match wins. detail replaces the error message
+// where it is not meant for clients.
+var sentinels = []struct {
+	err    error
+	status int
+	code   string
+	detail string
+}{
+	{validate.ErrEmptyBody, http.StatusBadRequest, CodeInvalidBody, ""},
+	{validate.ErrInvalidBody, http.StatusBadRequest, CodeInvalidBody, ""},
+	{validate.ErrBodyTooLarge, http.StatusRequestEntityTooLarge, CodeBodyTooLarge, ""},
+
+	{models.ErrUserExists, http.StatusConflict, CodeUserExists, "User with this email already exists"},
+	{models.ErrInvalidLogin, http.StatusUnauthorized, CodeInvalidLogin, "Invalid email or password"},
+	{models.ErrAddressInUse, http.StatusConflict, CodeAddressInUse, ""},
+	{models.ErrAddressDefaultConflict, http.StatusConflict, CodeConflict, ""},
+	{models.ErrCouponExists, http.StatusConflict, CodeCouponExists, ""},
+
+	{models.ErrCouponNotFound, http.StatusBadRequest, CodeCouponInvalid, ""},
+	{models.ErrCouponInactive, http.StatusBadRequest, CodeCouponInvalid, ""},
+	{models.ErrCouponNotStarted, http.StatusBadRequest, CodeCouponInvalid, ""},
+	{models.ErrCouponExpired, http.StatusBadRequest, CodeCouponInvalid, ""},
+	{models.ErrCouponMinOrder, http.StatusBadRequest, CodeCouponInvalid, ""},
+	{models.ErrCouponUsageLimit, http.StatusBadRequest, CodeCouponInvalid, ""},
+	{models.ErrCouponUserLimit, http.StatusBadRequest, CodeCouponInvalid, ""},
+	{models.ErrCouponNotApplicable, http.StatusBadRequest, CodeCouponInvalid, ""},
+
+	{models.ErrIllegalTransition, http.StatusConflict, CodeIllegalTransition, ""},
+
+	{models.ErrInvoiceNotAllowed, http.StatusConflict, CodeInvoiceNotAllowed, ""},
+	{models.ErrOrderInvoiced, http.StatusConflict, CodeOrderInvoiced, ""},
+
+	{models.ErrShipmentNotFound, http.StatusNotFound, CodeNotFound, "Shipment not found"},
+	{models.ErrShipmentItem, http.StatusBadRequest, CodeShipmentItem, ""},
+	{models.ErrShipmentQuantity, http.StatusBadRequest, CodeShipmentItem, ""},
+	{models.ErrShipmentNotAllowed, http.StatusConflict, CodeShipmentNotAllowed, ""},
+	{models.ErrShipmentNothingToAdd, http.StatusConflict, CodeShipmentNothingToAdd, ""},
+	{models.ErrShipmentState, http.StatusConflict, CodeShipmentState, ""},
+
+	{models.ErrReturnNotFound, http.StatusNotFound, CodeNotFound, "Return not found"},
+	{models.ErrReturnNoItems, http.StatusBadRequest, CodeReturnItem, ""},
+	{models.ErrReturnItemNotInOrder, http.StatusBadRequest, CodeReturnItem, ""},
+	{models.ErrReturnQuantity, http.StatusBadRequest, CodeReturnItem, ""},
+	{models.ErrReturnNotAllowed, http.StatusConflict, CodeReturnNotAllowed, ""},
+	{models.ErrReturnState, http.StatusConflict, CodeReturnState, ""},
+	{models.ErrReturnRefunding, http.StatusConflict, CodeReturnState, ""},
+
+	{models.ErrPaymentNotFound, http.StatusNotFound, CodeNotFound, "Payment not found"},
+	{models.ErrOrderNotPayable, http.StatusConflict, CodeOrderState, ""},
+	{models.ErrOrderPaymentActive, http.StatusConflict, CodeOrderState, ""},
+	{payments.ErrDeclined, http.StatusPaymentRequired, CodePaymentDeclined, ""},
+	{payments.ErrInvalidState, http.StatusConflict, CodePaymentState, ""},
+	{payments.ErrAmountTooLarge, http.StatusConflict, CodePaymentState, ""},
+	{payments.ErrUnknownPayment, http.StatusNotFound, CodeNotFound, ""},
+	{payments.ErrInvalidSignature, http.StatusUnauthorized, CodeInvalidSignature, "Invalid signature"},
+	{payments.ErrUnknownProvider, http.StatusInternalServerError, CodePaymentsDisabled, "Payments are not configured"},
+
+	{sql.ErrNoRows, http.StatusNotFound, CodeNotFound, "Not found"},
+	{models.ErrNoRows, http.StatusNotFound, CodeNotFound, "Not found"},
+}
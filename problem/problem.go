@@ -0,0 +1,114 @@
+// Package problem writes API errors as RFC 7807 problem details (application/problem+json),
+// each with a stable machine-readable code and the ID of the request that failed.
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"go-crud/models"
+)
+
+// ContentType is the media type of problem documents
+const ContentType = "application/problem+json"
+
+// RequestIDHeader carries the ID of a request. The request ID middleware sets it on every
+// response before the handler runs, so problems can name the request that failed.
+const RequestIDHeader = "X-Request-ID"
+
+// typePrefix makes a problem's code into its type URI
+const typePrefix = "urn:go-crud:problem:"
+
+// Problem is an RFC 7807 problem document, extended with the error code, the request ID and
+// field-level validation errors
+type Problem struct {
+	Type      string              `json:"type"`
+	Title     string              `json:"title"`
+	Status    int                 `json:"status"`
+	Detail    string              `json:"detail,omitempty"`
+	Code      string              `json:"code"`
+	RequestID string              `json:"request_id,omitempty"`
+	Errors    []models.FieldError `json:"errors,omitempty"`
+}
+
+// Write replies with a problem of the given status and code. detail is shown to the client,
+// so it must not carry internal error messages; use Error for those.
+func Write(w http.ResponseWriter, status int, code, detail string) {
+	write(w, Problem{Status: status, Code: code, Detail: detail})
+}
+
+// Fields replies 422 with every invalid field of a request
+func Fields(w http.ResponseWriter, detail string, fields []models.FieldError) {
+	write(w, Problem{Status: http.StatusUnprocessableEntity, Code: CodeValidation, Detail: detail, Errors: fields})
+}
+
+// Error replies for err. A *models.ValidationError lists its fields, and the sentinel errors
+// in the table of codes get their status and code. Anything else is an internal error: it is
+// logged with the request ID and the client only sees a generic 500, so SQL and other
+// internal messages do not leak. Wrap err with context for the log, as in
+// problem.Error(w, fmt.Errorf("fetching order %d: %w", id, err)).
+func Error(w http.ResponseWriter, err error) {
+	var verr *models.ValidationError
+	if errors.As(err, &verr) {
+		Fields(w, "Validation failed", verr.Fields)
+		return
+	}
+
+	for _, s := range sentinels {
+		if errors.Is(err, s.err) {
+			detail := s.detail
+			if detail == "" {
+				detail = sentinelDetail(err, s.err)
+			}
+			if s.status >= http.StatusInternalServerError {
+				logError(w, err)
+			}
+			Write(w, s.status, s.code, detail)
+			return
+		}
+	}
+
+	Internal(w, err)
+}
+
+// Internal logs err with the request ID and replies with a generic 500
+func Internal(w http.ResponseWriter, err error) {
+	logError(w, err)
+	Write(w, http.StatusInternalServerError, CodeInternal, "An internal error occurred; quote the request ID when reporting it")
+}
+
+// Upstream logs err and replies 502 with detail, for failures of an external service such
+// as the payment provider
+func Upstream(w http.ResponseWriter, detail string, err error) {
+	logError(w, err)
+	Write(w, http.StatusBadGateway, CodeProviderError, detail)
+}
+
+// sentinelDetail returns the message of err from its sentinel on, leaving out the context
+// handlers wrap errors with for the log but keeping details models add after the sentinel,
+// as in "item does not belong to the order: 7"
+func sentinelDetail(err, sentinel error) string {
+	msg := err.Error()
+	if i := strings.Index(msg, sentinel.Error()); i >= 0 {
+		msg = msg[i:]
+	}
+	return strings.ToUpper(msg[:1]) + msg[1:]
+}
+
+func logError(w http.ResponseWriter, err error) {
+	log.Printf("Error in request %s: %v", w.Header().Get(RequestIDHeader), err)
+}
+
+func write(w http.ResponseWriter, p Problem) {
+	p.Type = typePrefix + p.Code
+	p.Title = http.StatusText(p.Status)
+	p.RequestID = w.Header().Get(RequestIDHeader)
+
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	json.NewEncoder(w).Encode(p)
+}
@@ -0,0 +1,155 @@
+package problem
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"go-crud/models"
+	"go-crud/payments"
+)
+
+// captureLog returns the log output written until the test ends
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+// respond runs write against a recorder carrying a request ID, as the request ID middleware
+// leaves it, and decodes the problem
+func respond(t *testing.T, requestID string, write func(w http.ResponseWriter)) (*httptest.ResponseRecorder, Problem) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if requestID != "" {
+		w.Header().Set(RequestIDHeader, requestID)
+	}
+	write(w)
+
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+	if got := w.Header().Get("Content-Type"); got != ContentType {
+		t.Errorf("Content-Type = %q, want %q", got, ContentType)
+	}
+	if p.Status != w.Code || p.Title != http.StatusText(w.Code) || p.Type != typePrefix+p.Code || p.RequestID != requestID {
+		t.Errorf("problem %+v for status %d and request %q", p, w.Code, requestID)
+	}
+	return w, p
+}
+
+func TestErrorMapsSentinels(t *testing.T) {
+	logged := captureLog(t)
+	for _, s := range sentinels {
+		t.Run(s.code+" "+s.err.Error(), func(t *testing.T) {
+			logged.Reset()
+			err := fmt.Errorf("handling request: %w", s.err)
+			w, p := respond(t, "req-1", func(w http.ResponseWriter) { Error(w, err) })
+
+			if w.Code != s.status || p.Code != s.code {
+				t.Errorf("got %d %s, want %d %s", w.Code, p.Code, s.status, s.code)
+			}
+			if strings.Contains(p.Detail, "handling request") {
+				t.Errorf("detail %q carries the handler's context", p.Detail)
+			}
+			if s.detail != "" && p.Detail != s.detail {
+				t.Errorf("detail = %q, want %q", p.Detail, s.detail)
+			}
+			if serverError := s.status >= 500; serverError != strings.Contains(logged.String(), "req-1") {
+				t.Errorf("status %d logged %q", s.status, logged)
+			}
+		})
+	}
+}
+
+func TestErrorKeepsSentinelDetails(t *testing.T) {
+	err := fmt.Errorf("creating shipment for order 3: %w", fmt.Errorf("%w: 7", models.ErrShipmentItem))
+	_, p := respond(t, "", func(w http.ResponseWriter) { Error(w, err) })
+	want := models.ErrShipmentItem.Error() + ": 7"
+	if p.Detail != strings.ToUpper(want[:1])+want[1:] {
+		t.Errorf("detail = %q, want %q capitalised", p.Detail, want)
+	}
+}
+
+func TestErrorListsInvalidFields(t *testing.T) {
+	err := fmt.Errorf("creating address: %w", &models.ValidationError{Fields: []models.FieldError{
+		{Field: "city", Code: models.FieldRequired, Message: "city is required"},
+		{Field: "country", Code: models.FieldUnknownCountry, Message: "unknown country"},
+	}})
+	w, p := respond(t, "req-2", func(w http.ResponseWriter) { Error(w, err) })
+	if w.Code != http.StatusUnprocessableEntity || p.Code != CodeValidation {
+		t.Errorf("got %d %s, want 422 %s", w.Code, p.Code, CodeValidation)
+	}
+	if len(p.Errors) != 2 || p.Errors[0].Field != "city" || p.Errors[1].Code != models.FieldUnknownCountry {
+		t.Errorf("errors = %+v", p.Errors)
+	}
+}
+
+func TestErrorMasksInternalErrors(t *testing.T) {
+	logged := captureLog(t)
+	err := errors.New(`pq: relation "orders" does not exist`)
+	w, p := respond(t, "req-3", func(w http.ResponseWriter) { Error(w, fmt.Errorf("fetching order 5: %w", err)) })
+
+	if w.Code != http.StatusInternalServerError || p.Code != CodeInternal {
+		t.Errorf("got %d %s, want 500 %s", w.Code, p.Code, CodeInternal)
+	}
+	if strings.Contains(w.Body.String(), "relation") || strings.Contains(w.Body.String(), "order 5") {
+		t.Errorf("response leaks the error: %s", w.Body)
+	}
+	if !strings.Contains(logged.String(), "req-3") || !strings.Contains(logged.String(), `fetching order 5: pq: relation "orders"`) {
+		t.Errorf("log = %q", logged)
+	}
+}
+
+func TestUpstream(t *testing.T) {
+	logged := captureLog(t)
+	w, p := respond(t, "req-4", func(w http.ResponseWriter) {
+		Upstream(w, "The payment provider is unavailable", errors.New("dial tcp: connection refused"))
+	})
+	if w.Code != http.StatusBadGateway || p.Code != CodeProviderError || p.Detail != "The payment provider is unavailable" {
+		t.Errorf("got %d %+v", w.Code, p)
+	}
+	if !strings.Contains(logged.String(), "req-4") || !strings.Contains(logged.String(), "connection refused") {
+		t.Errorf("log = %q", logged)
+	}
+}
+
+func TestRequestIDIsOptional(t *testing.T) {
+	w, p := respond(t, "", func(w http.ResponseWriter) { Write(w, http.StatusNotFound, CodeNotFound, "No such thing") })
+	if strings.Contains(w.Body.String(), "request_id") || p.Detail != "No such thing" {
+		t.Errorf("body = %s", w.Body)
+	}
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" {
+		t.Error("nosniff is not set")
+	}
+}
+
+func TestSentinelsPrecedeGenericMatches(t *testing.T) {
+	// An error wrapping both a specific sentinel and a generic one gets the first match
+	err := fmt.Errorf("%w: %w", payments.ErrUnknownPayment, models.ErrNoRows)
+	w, p := respond(t, "", func(w http.ResponseWriter) { Error(w, err) })
+	if w.Code != http.StatusNotFound || p.Detail == "Not found" {
+		t.Errorf("got %d %q, want the payment sentinel's detail", w.Code, p.Detail)
+	}
+
+	seen := map[error]bool{}
+	for _, s := range sentinels {
+		if seen[s.err] {
+			t.Errorf("%v is listed twice", s.err)
+		}
+		seen[s.err] = true
+		if s.code == "" || http.StatusText(s.status) == "" {
+			t.Errorf("%v maps to %d %q", s.err, s.status, s.code)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"go-crud/controllers"
+	"go-crud/middlewares"
+	"go-crud/openapi"
+	"go-crud/problem"
+)
+
+// registered lists the routes added by RegisterRoutes, for the OpenAPI document
+var registered []openapi.Route
+
+// endpoints documents the routes served by this package
+var endpoints = map[string]openapi.Endpoint{
+	"GET /{$}":          {Summary: "Says hello", Auth: openapi.AuthAdmin, ContentType: "text/plain"},
+	"GET /openapi.json": {Summary: "This document, for the requested API version", Tag: "Docs", Response: map[string]interface{}{}},
+	"GET /docs":         {Summary: "API reference page rendering /openapi.json", Tag: "Docs", ContentType: "text/html"},
+}
+
+// Spec returns the OpenAPI document of an API version, built from the routes registered by
+// RegisterRoutes and the request and response types in controllers.Endpoints. It fails if a
+// route is not documented.
+func Spec(version int) (*openapi.Document, error) {
+	all := make(map[string]openapi.Endpoint, len(controllers.Endpoints)+len(endpoints))
+	for pattern, endpoint := range controllers.Endpoints {
+		all[pattern] = endpoint
+	}
+	for pattern, endpoint := range endpoints {
+		all[pattern] = endpoint
+	}
+
+	info := openapi.Info{
+		Title:   "go-crud API",
+		Version: strconv.Itoa(version),
+		Description: "Versioned routes are served under /v1 and /v2, and unprefixed as version " +
+			strconv.Itoa(middlewares.DefaultAPIVersion) + " unless the Accept header asks for another.",
+	}
+	return openapi.Build(info, version, registered, all)
+}
+
+// CheckSpec reports routes registered by RegisterRoutes without an OpenAPI entry, and entries
+// whose route is gone
+func CheckSpec() error {
+	_, err := Spec(middlewares.DefaultAPIVersion)
+	return err
+}
+
+// openAPIHandler serves the document of the negotiated API version, so /v2/openapi.json
+// describes version 2
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	doc, err := Spec(middlewares.GetAPIVersion(r))
+	if err != nil {
+		problem.Error(w, fmt.Errorf("building OpenAPI document: %w", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+// docsHandler serves the API reference page
+func docsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(openapi.DocsPage)
+}
@@ -0,0 +1,124 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go-crud/config"
+	"go-crud/openapi"
+)
+
+// RegisterRoutes adds to http.DefaultServeMux, which panics on a second registration, so the
+// routes are registered once for every test
+func TestMain(m *testing.M) {
+	config.AppConfig.LegacyRoutesDeprecated = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	config.AppConfig.LegacyRoutesSunset = "2027-04-30"
+	RegisterRoutes()
+	os.Exit(m.Run())
+}
+
+func TestSpecCoversEveryRoute(t *testing.T) {
+	if err := CheckSpec(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCheckSpecFailsOnMissingAndExtraPaths(t *testing.T) {
+	prevRegistered := registered
+	t.Cleanup(func() { registered = prevRegistered })
+
+	registered = append(append([]openapi.Route(nil), prevRegistered...),
+		openapi.Route{Pattern: "GET /widgets", Versioned: true},
+		openapi.Route{Pattern: "GET /widgets/get", Successor: "GET /widgets/{id}"})
+	err := CheckSpec()
+	if err == nil || !strings.Contains(err.Error(), "routes without an OpenAPI endpoint: GET /widgets, GET /widgets/{id}") {
+		t.Errorf("CheckSpec with undocumented routes = %v", err)
+	}
+
+	registered = prevRegistered
+	endpoints["DELETE /gadgets/{id}"] = openapi.Endpoint{Summary: "Deletes a gadget"}
+	defer delete(endpoints, "DELETE /gadgets/{id}")
+	err = CheckSpec()
+	if err == nil || !strings.Contains(err.Error(), "OpenAPI endpoints without a route: DELETE /gadgets/{id}") {
+		t.Errorf("CheckSpec with an endpoint without a route = %v", err)
+	}
+}
+
+func TestSpecPaths(t *testing.T) {
+	doc, err := Spec(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if doc.OpenAPI != "3.1.0" || doc.Info.Version != "2" || doc.Servers[0].URL != "/v2" {
+		t.Errorf("document header %s %+v %+v", doc.OpenAPI, doc.Info, doc.Servers)
+	}
+
+	for _, route := range registered {
+		method, path, _ := strings.Cut(route.Pattern, " ")
+		path = strings.TrimSuffix(path, "{$}")
+		item := doc.Paths[path]
+		if item == nil {
+			t.Errorf("%s is not in the document", path)
+			continue
+		}
+		if !route.Versioned && len(item.Servers) == 0 {
+			t.Errorf("%s is not versioned but is listed under /v2", path)
+		}
+		if route.Successor != "" {
+			continue // aliases are listed under GET or POST only
+		}
+		if op := operation(item, method); op == nil || op.OperationID == "" || op.Responses == nil {
+			t.Errorf("%s has no operation", route.Pattern)
+		}
+	}
+
+	if op := doc.Paths["/orders/get"].Get; op == nil || !op.Deprecated || op.Parameters[0].Name != "id" {
+		t.Errorf("legacy alias /orders/get = %+v", op)
+	}
+	if op := doc.Paths["/orders/place"].Post; op == nil || !op.Deprecated || op.RequestBody == nil {
+		t.Errorf("legacy alias /orders/place = %+v", op)
+	}
+}
+
+func operation(item *openapi.PathItem, method string) *openapi.Operation {
+	switch method {
+	case http.MethodGet:
+		return item.Get
+	case http.MethodPut:
+		return item.Put
+	case http.MethodPost:
+		return item.Post
+	case http.MethodDelete:
+		return item.Delete
+	case http.MethodPatch:
+		return item.Patch
+	}
+	return nil
+}
+
+func TestServeSpecAndDocs(t *testing.T) {
+	for target, version := range map[string]string{"/openapi.json": "1", "/v1/openapi.json": "1", "/v2/openapi.json": "2"} {
+		w := httptest.NewRecorder()
+		Handler().ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		var doc openapi.Document
+		if w.Code != http.StatusOK || json.Unmarshal(w.Body.Bytes(), &doc) != nil {
+			t.Errorf("GET %s = %d %s", target, w.Code, w.Body)
+			continue
+		}
+		if doc.Info.Version != version || doc.Paths["/orders/{id}"] == nil {
+			t.Errorf("GET %s served version %s with %d paths", target, doc.Info.Version, len(doc.Paths))
+		}
+	}
+
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/docs", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") ||
+		!strings.Contains(w.Body.String(), "/openapi.json") {
+		t.Errorf("GET /docs = %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+}
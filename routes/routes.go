@@ -2,8 +2,12 @@ package routes
 
 import (
 	"net/http"
+	"strconv"
+	"strings"
 	"go-crud/controllers"
 	"go-crud/middlewares"
+	"go-crud/openapi"
+	"go-crud/problem"
 )
 
 func helloHandler(w http.ResponseWriter, r *http.Request) {
@@ -11,54 +15,270 @@ func helloHandler(w http.ResponseWriter, r *http.Request) {
     w.Write([]byte("hello"))
 }
 
+// Methods accepted by the legacy aliases. Reads were always GET; writes were documented
+// with POST, PUT or DELETE, so all of them keep working.
+var (
+	legacyRead  = []string{http.MethodGet}
+	legacyWrite = []string{http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+)
+
+// handle registers a resource route unprefixed and under each API version, e.g.
+// "GET /orders/{id}" also as "GET /v1/orders/{id}" and "GET /v2/orders/{id}"
+func handle(pattern string, handler http.HandlerFunc) {
+	method, path, _ := strings.Cut(pattern, " ")
+	registered = append(registered, openapi.Route{Pattern: pattern, Versioned: true})
+	http.HandleFunc(pattern, handler)
+	for _, version := range middlewares.APIVersions {
+		http.HandleFunc(method+" /v"+strconv.Itoa(version)+path, handler)
+	}
+}
+
+// legacy registers a deprecated alias of the resource route successor, e.g.
+// legacy("/orders/get", legacyRead, "GET /orders/{id}", handler)
+func legacy(path string, methods []string, successor string, handler http.HandlerFunc) {
+	deprecated := middlewares.DeprecatedMiddleware(successor, handler)
+	for _, method := range methods {
+		registered = append(registered, openapi.Route{Pattern: method + " " + path, Successor: successor})
+		http.HandleFunc(method+" "+path, deprecated)
+	}
+}
+
+// handleUnversioned registers a route that is served only without a version prefix
+func handleUnversioned(pattern string, handler http.HandlerFunc) {
+	registered = append(registered, openapi.Route{Pattern: pattern})
+	http.HandleFunc(pattern, handler)
+}
+
+// Handler returns the server's handler: the routes registered by RegisterRoutes, behind API
+// version negotiation, the request log and request IDs
+func Handler() http.Handler {
+	return middlewares.RequestIDMiddleware(
+		middlewares.RequestLogMiddleware(
+			middlewares.APIVersionMiddleware(serveMux)))
+}
+
+// serveMux serves the registered routes, answering paths and methods without a route with
+// problem documents rather than the ServeMux's plain text
+func serveMux(w http.ResponseWriter, r *http.Request) {
+	if _, pattern := http.DefaultServeMux.Handler(r); pattern == "" {
+		w = &unmatchedWriter{ResponseWriter: w}
+	}
+	// ServeHTTP rather than the handler found above, which would miss the path values
+	http.DefaultServeMux.ServeHTTP(w, r)
+}
+
+// unmatchedWriter replaces the ServeMux's 404 and 405 replies; the Allow header it sets on
+// 405 is kept
+type unmatchedWriter struct {
+	http.ResponseWriter
+	replaced bool
+}
+
+func (uw *unmatchedWriter) WriteHeader(status int) {
+	switch status {
+	case http.StatusNotFound:
+		problem.Write(uw.ResponseWriter, status, problem.CodeNotFound, "No route matches this path")
+	case http.StatusMethodNotAllowed:
+		problem.Write(uw.ResponseWriter, status, problem.CodeMethodNotAllowed,
+			"Method not allowed; see the Allow header")
+	default:
+		uw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	uw.replaced = true
+}
+
+func (uw *unmatchedWriter) Write(b []byte) (int, error) {
+	if uw.replaced {
+		return len(b), nil
+	}
+	return uw.ResponseWriter.Write(b)
+}
+
+// RegisterRoutes registers the resource routes, unprefixed and under /v1 and /v2, and their
+// unprefixed legacy aliases. Routes use method and path patterns, so a request with another
+// method gets 405 with an Allow header, and IDs are path segments such as /orders/{id}. The
+// legacy aliases, such as /orders/get?id=1, take the ID from the query string or JSON body
+// and answer with Deprecation and Sunset headers.
 func RegisterRoutes() {
+	admin := middlewares.AdminAuthMiddleware
+	idempotent := middlewares.IdempotencyMiddleware
+
 	// Auth routes - using AdminAuthMiddleware
-	http.HandleFunc("/auth/register", middlewares.AdminAuthMiddleware(controllers.RegisterUser))
-	http.HandleFunc("/auth/login", middlewares.AdminAuthMiddleware(controllers.LoginUser))
-	
+	handle("POST /auth/register", admin(controllers.RegisterUser))
+	handle("POST /auth/login", admin(controllers.LoginUser))
+
 	// Protected auth route - requires both admin auth and JWT/session auth
-	http.HandleFunc("/auth/me", middlewares.AdminAuthMiddleware(middlewares.AuthMiddleware(controllers.GetCurrentUser)))
+	handle("GET /auth/me", admin(middlewares.AuthMiddleware(controllers.GetCurrentUser)))
+
+	// Admin interface - protected by both admin auth and JWT auth; not versioned
+	handleUnversioned("GET /admin", admin(middlewares.AuthMiddleware(controllers.AdminDashboard)))
 
-	// Admin interface - protected by both admin auth and JWT auth
-	http.HandleFunc("/admin", middlewares.AdminAuthMiddleware(middlewares.AuthMiddleware(controllers.AdminDashboard)))
+	// Mutating routes below accept an Idempotency-Key header so clients can retry safely
 
 	// User routes - protected by admin auth
-	http.HandleFunc("/users", middlewares.AdminAuthMiddleware(controllers.GetUsers))
-	http.HandleFunc("/users/profile", middlewares.AdminAuthMiddleware(controllers.GetUserProfile))
-	http.HandleFunc("/users/create", middlewares.AdminAuthMiddleware(controllers.CreateUser))
-	http.HandleFunc("/users/update", middlewares.AdminAuthMiddleware(controllers.UpdateUser))
-	http.HandleFunc("/users/delete", middlewares.AdminAuthMiddleware(controllers.DeleteUser))
-	
+	getProfile := admin(controllers.GetUserProfile)
+	createUser := admin(idempotent(controllers.CreateUser))
+	updateUser := admin(idempotent(controllers.UpdateUser))
+	deleteUser := admin(idempotent(controllers.DeleteUser))
+	handle("GET /users", admin(controllers.GetUsers))
+	handle("POST /users", createUser)
+	handle("GET /users/me", getProfile)
+	handle("GET /users/me/orders", middlewares.AuthMiddleware(controllers.GetMyOrders))
+	handle("PUT /users/{id}", updateUser)
+	handle("PATCH /users/{id}", updateUser)
+	handle("DELETE /users/{id}", deleteUser)
+	legacy("/users/profile", legacyRead, "GET /users/me", getProfile)
+	legacy("/users/create", legacyWrite, "POST /users", createUser)
+	legacy("/users/update", legacyWrite, "PUT /users/{id}", updateUser)
+	legacy("/users/delete", legacyWrite, "DELETE /users/{id}", deleteUser)
+
 	// Product routes - protected by admin auth
-	http.HandleFunc("/products", middlewares.AdminAuthMiddleware(
+	handle("GET /products", admin(
 		middlewares.OptionalAuthMiddleware(
 			middlewares.ProductMiddleware(controllers.GetProducts))))
-	
+
 	// Role routes - protected by admin auth
-	http.HandleFunc("/roles", middlewares.AdminAuthMiddleware(controllers.GetRoles))
-	http.HandleFunc("/roles/get", middlewares.AdminAuthMiddleware(controllers.GetRoleByID))
-	http.HandleFunc("/roles/create", middlewares.AdminAuthMiddleware(controllers.CreateRole))
-	http.HandleFunc("/roles/update", middlewares.AdminAuthMiddleware(controllers.UpdateRole))
-	http.HandleFunc("/roles/delete", middlewares.AdminAuthMiddleware(controllers.DeleteRole))
+	getRole := admin(controllers.GetRoleByID)
+	createRole := admin(idempotent(controllers.CreateRole))
+	updateRole := admin(idempotent(controllers.UpdateRole))
+	deleteRole := admin(idempotent(controllers.DeleteRole))
+	handle("GET /roles", admin(controllers.GetRoles))
+	handle("POST /roles", createRole)
+	handle("GET /roles/{id}", getRole)
+	handle("PUT /roles/{id}", updateRole)
+	handle("DELETE /roles/{id}", deleteRole)
+	legacy("/roles/get", legacyRead, "GET /roles/{id}", getRole)
+	legacy("/roles/create", legacyWrite, "POST /roles", createRole)
+	legacy("/roles/update", legacyWrite, "PUT /roles/{id}", updateRole)
+	legacy("/roles/delete", legacyWrite, "DELETE /roles/{id}", deleteRole)
 
 	// Order routes - protected by admin auth
-	http.HandleFunc("/orders", middlewares.AdminAuthMiddleware(controllers.GetOrders))
-	http.HandleFunc("/orders/get", middlewares.AdminAuthMiddleware(controllers.GetOrderByID))
-	http.HandleFunc("/orders/place", middlewares.AdminAuthMiddleware(controllers.PlaceOrder))
-	http.HandleFunc("/orders/update-status", middlewares.AdminAuthMiddleware(controllers.UpdateOrderStatus))
-	http.HandleFunc("/orders/delete", middlewares.AdminAuthMiddleware(controllers.DeleteOrder))
-	
-	// Address routes - protected by admin auth
-	http.HandleFunc("/addresses", middlewares.AdminAuthMiddleware(controllers.GetAddresses))
-	http.HandleFunc("/addresses/get", middlewares.AdminAuthMiddleware(controllers.GetAddressByID))
-	http.HandleFunc("/addresses/create", middlewares.AdminAuthMiddleware(controllers.CreateAddress))
-	http.HandleFunc("/addresses/update", middlewares.AdminAuthMiddleware(controllers.UpdateAddress))
-	http.HandleFunc("/addresses/delete", middlewares.AdminAuthMiddleware(controllers.DeleteAddress))
-	http.HandleFunc("/addresses/assign-to-order", middlewares.AdminAuthMiddleware(controllers.AssignAddressToOrder))
-	
+	getOrder := admin(controllers.GetOrderByID)
+	getInvoice := admin(controllers.GetOrderInvoice)
+	placeOrder := admin(idempotent(controllers.PlaceOrder))
+	updateOrderStatus := admin(idempotent(controllers.UpdateOrderStatus))
+	batchOrderStatus := admin(idempotent(controllers.BatchUpdateOrderStatus))
+	deleteOrder := admin(idempotent(controllers.DeleteOrder))
+	payOrder := admin(idempotent(controllers.PayOrder))
+	handle("GET /orders", admin(controllers.GetOrders))
+	handle("POST /orders", placeOrder)
+	handle("PATCH /orders", batchOrderStatus)
+	handle("GET /orders/{id}", getOrder)
+	handle("PUT /orders/{id}", updateOrderStatus)
+	handle("PATCH /orders/{id}", updateOrderStatus)
+	handle("DELETE /orders/{id}", deleteOrder)
+	handle("GET /orders/{id}/invoice", getInvoice)
+	handle("POST /orders/{id}/pay", payOrder)
+	legacy("/orders/get", legacyRead, "GET /orders/{id}", getOrder)
+	legacy("/orders/invoice", legacyRead, "GET /orders/{id}/invoice", getInvoice)
+	legacy("/orders/place", legacyWrite, "POST /orders", placeOrder)
+	legacy("/orders/update-status", legacyWrite, "PATCH /orders/{id}", updateOrderStatus)
+	legacy("/orders/batch-status", legacyWrite, "PATCH /orders", batchOrderStatus)
+	legacy("/orders/delete", legacyWrite, "DELETE /orders/{id}", deleteOrder)
+	legacy("/orders/pay", []string{http.MethodPost}, "POST /orders/{id}/pay", payOrder)
+
+	// Address routes - users act on their own addresses, the admin on anyone's
+	getAddress := middlewares.AuthMiddleware(controllers.GetAddressByID)
+	createAddress := middlewares.AuthMiddleware(idempotent(controllers.CreateAddress))
+	updateAddress := middlewares.AuthMiddleware(idempotent(controllers.UpdateAddress))
+	deleteAddress := middlewares.AuthMiddleware(idempotent(controllers.DeleteAddress))
+	assignAddress := middlewares.AuthMiddleware(idempotent(controllers.AssignAddressToOrder))
+	handle("GET /addresses", middlewares.AuthMiddleware(controllers.GetAddresses))
+	handle("POST /addresses", createAddress)
+	handle("GET /addresses/{id}", getAddress)
+	handle("PUT /addresses/{id}", updateAddress)
+	handle("DELETE /addresses/{id}", deleteAddress)
+	handle("PUT /orders/{id}/address", assignAddress)
+	legacy("/addresses/get", legacyRead, "GET /addresses/{id}", getAddress)
+	legacy("/addresses/create", legacyWrite, "POST /addresses", createAddress)
+	legacy("/addresses/update", legacyWrite, "PUT /addresses/{id}", updateAddress)
+	legacy("/addresses/delete", legacyWrite, "DELETE /addresses/{id}", deleteAddress)
+	legacy("/addresses/assign-to-order", legacyWrite, "PUT /orders/{id}/address", assignAddress)
+
+	// Pricing routes - protected by admin auth
+	setTaxRate := admin(idempotent(controllers.SetTaxRate))
+	handle("GET /tax-rates", admin(controllers.GetTaxRates))
+	handle("PUT /tax-rates", setTaxRate)
+	legacy("/tax-rates/set", legacyWrite, "PUT /tax-rates", setTaxRate)
+
+	// Coupon routes - protected by admin auth
+	getCoupon := admin(controllers.GetCouponByID)
+	createCoupon := admin(idempotent(controllers.CreateCoupon))
+	updateCoupon := admin(idempotent(controllers.UpdateCoupon))
+	deleteCoupon := admin(idempotent(controllers.DeleteCoupon))
+	redemptions := admin(controllers.GetCouponRedemptions)
+	handle("GET /coupons", admin(controllers.GetCoupons))
+	handle("POST /coupons", createCoupon)
+	handle("GET /coupons/redemptions", redemptions)
+	handle("GET /coupons/{id}", getCoupon)
+	handle("PUT /coupons/{id}", updateCoupon)
+	handle("DELETE /coupons/{id}", deleteCoupon)
+	handle("GET /coupons/{id}/redemptions", redemptions)
+	legacy("/coupons/get", legacyRead, "GET /coupons/{id}", getCoupon)
+	legacy("/coupons/create", legacyWrite, "POST /coupons", createCoupon)
+	legacy("/coupons/update", legacyWrite, "PUT /coupons/{id}", updateCoupon)
+	legacy("/coupons/delete", legacyWrite, "DELETE /coupons/{id}", deleteCoupon)
+
+	// Payment routes - protected by admin auth
+	capturePayment := admin(idempotent(controllers.CapturePayment))
+	voidPayment := admin(idempotent(controllers.VoidPayment))
+	handle("GET /payments", admin(controllers.GetPayments))
+	handle("POST /payments/{id}/capture", capturePayment)
+	handle("POST /payments/{id}/void", voidPayment)
+	legacy("/payments/capture", legacyWrite, "POST /payments/{id}/capture", capturePayment)
+	legacy("/payments/void", legacyWrite, "POST /payments/{id}/void", voidPayment)
+
+	// Shipment routes - protected by admin auth
+	getShipment := admin(controllers.GetShipmentByID)
+	createShipment := admin(idempotent(controllers.CreateShipment))
+	shipShipment := admin(idempotent(controllers.ShipShipment))
+	deliverShipment := admin(idempotent(controllers.DeliverShipment))
+	handle("GET /shipments", admin(controllers.GetShipments))
+	handle("POST /shipments", createShipment)
+	handle("GET /shipments/{id}", getShipment)
+	handle("POST /shipments/{id}/ship", shipShipment)
+	handle("POST /shipments/{id}/deliver", deliverShipment)
+	legacy("/shipments/get", legacyRead, "GET /shipments/{id}", getShipment)
+	legacy("/shipments/create", legacyWrite, "POST /shipments", createShipment)
+	legacy("/shipments/ship", legacyWrite, "POST /shipments/{id}/ship", shipShipment)
+	legacy("/shipments/deliver", legacyWrite, "POST /shipments/{id}/deliver", deliverShipment)
+
+	// Return (RMA) routes - protected by admin auth
+	getReturn := admin(controllers.GetReturnByID)
+	createReturn := admin(idempotent(controllers.CreateReturn))
+	approveReturn := admin(idempotent(controllers.ApproveReturn))
+	rejectReturn := admin(idempotent(controllers.RejectReturn))
+	receiveReturn := admin(idempotent(controllers.ReceiveReturn))
+	handle("GET /returns", admin(controllers.GetReturns))
+	handle("POST /returns", createReturn)
+	handle("GET /returns/{id}", getReturn)
+	handle("POST /returns/{id}/approve", approveReturn)
+	handle("POST /returns/{id}/reject", rejectReturn)
+	handle("POST /returns/{id}/receive", receiveReturn)
+	legacy("/returns/get", legacyRead, "GET /returns/{id}", getReturn)
+	legacy("/returns/create", legacyWrite, "POST /returns", createReturn)
+	legacy("/returns/approve", legacyWrite, "POST /returns/{id}/approve", approveReturn)
+	legacy("/returns/reject", legacyWrite, "POST /returns/{id}/reject", rejectReturn)
+	legacy("/returns/receive", legacyWrite, "POST /returns/{id}/receive", receiveReturn)
+
+	// Background job routes - protected by admin auth
+	handle("GET /admin/jobs", admin(controllers.GetJobs))
+	handle("GET /admin/jobs/runs", admin(controllers.GetJobRuns))
+
+	// Payment provider webhooks - authenticated by their HMAC signature instead of admin auth;
+	// providers are configured with one URL, so it is not versioned
+	handleUnversioned("POST /payments/webhook", controllers.PaymentWebhook)
+
+	// The root answers "hello"; other unknown paths are 404 rather than falling through to it
+	handleUnversioned("GET /{$}", admin(helloHandler))
+
+	// The OpenAPI document of the requested API version, and a page that renders it
+	handle("GET /openapi.json", openAPIHandler)
+	handleUnversioned("GET /docs", docsHandler)
+
 	// For backward compatibility with the original API - deprecated but still protected
-	http.HandleFunc("/", middlewares.AdminAuthMiddleware(helloHandler))
-	http.HandleFunc("/post", middlewares.AdminAuthMiddleware(controllers.CreateUser))
-	http.HandleFunc("/update", middlewares.AdminAuthMiddleware(controllers.UpdateUser))
-	http.HandleFunc("/delete", middlewares.AdminAuthMiddleware(controllers.DeleteUser))
-}
\ No newline at end of file
+	legacy("/post", legacyWrite, "POST /users", admin(controllers.CreateUser))
+	legacy("/update", legacyWrite, "PUT /users/{id}", admin(controllers.UpdateUser))
+	legacy("/delete", legacyWrite, "DELETE /users/{id}", admin(controllers.DeleteUser))
+}
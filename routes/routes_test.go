@@ -0,0 +1,82 @@
+package routes
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-crud/problem"
+)
+
+// serveRoute sends a request through the server's handler
+func serveRoute(method, target string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest(method, target, nil))
+	return w
+}
+
+// problemCode returns the code of a problem response, or "" if it is not one
+func problemCode(w *httptest.ResponseRecorder) string {
+	var p struct {
+		Code string `json:"code"`
+	}
+	if w.Header().Get("Content-Type") != "application/problem+json" || json.Unmarshal(w.Body.Bytes(), &p) != nil {
+		return ""
+	}
+	return p.Code
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	for _, tt := range []struct {
+		method, target, allow string
+	}{
+		{"PATCH", "/addresses", "GET, HEAD, POST"},
+		{"POST", "/addresses/1", "DELETE, GET, HEAD, PUT"},
+		{"PATCH", "/v1/addresses", "GET, HEAD, POST"},
+		{"DELETE", "/v2/orders/1/pay", "POST"},
+		{"GET", "/orders/1/pay", "POST"},
+		// Legacy aliases also match the resource routes on /{id}, e.g. /orders/get
+		{"POST", "/orders/get", "DELETE, GET, HEAD, PATCH, PUT"},
+	} {
+		w := serveRoute(tt.method, tt.target)
+		if w.Code != http.StatusMethodNotAllowed || problemCode(w) != problem.CodeMethodNotAllowed {
+			t.Errorf("%s %s = %d %s", tt.method, tt.target, w.Code, w.Body)
+		}
+		if got := w.Header().Get("Allow"); got != tt.allow {
+			t.Errorf("%s %s: Allow %q, want %q", tt.method, tt.target, got, tt.allow)
+		}
+	}
+
+	w := serveRoute("GET", "/no/such/route")
+	if w.Code != http.StatusNotFound || problemCode(w) != problem.CodeNotFound || w.Header().Get("Allow") != "" {
+		t.Errorf("GET /no/such/route = %d %s", w.Code, w.Body)
+	}
+}
+
+func TestLegacyRoutesAreDeprecated(t *testing.T) {
+	for _, tt := range []struct {
+		method, target string
+		legacy         bool
+	}{
+		{"GET", "/orders/get?id=1", true},
+		{"DELETE", "/addresses/delete?id=1", true},
+		{"POST", "/orders/pay", true},
+		{"GET", "/orders/1", false},
+		{"GET", "/v1/orders/1", false},
+		{"DELETE", "/addresses/1", false},
+	} {
+		// The headers are set whether or not the request is then authorized
+		w := serveRoute(tt.method, tt.target)
+		deprecation, sunset := w.Header().Get("Deprecation"), w.Header().Get("Sunset")
+		if !tt.legacy {
+			if deprecation != "" || sunset != "" {
+				t.Errorf("%s %s: Deprecation %q, Sunset %q on a current route", tt.method, tt.target, deprecation, sunset)
+			}
+			continue
+		}
+		if deprecation != "@1792368000" || sunset != "Fri, 30 Apr 2027 00:00:00 GMT" {
+			t.Errorf("%s %s: Deprecation %q, Sunset %q", tt.method, tt.target, deprecation, sunset)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	for _, tt := range []struct {
+		spec  string
+		valid bool
+	}{
+		{"* * * * *", true},
+		{"*/15 * * * *", true},
+		{"0 3 * * 1-5", true},
+		{"0,30 8-18/2 1,15 */3 0", true},
+		{"0 0 * * 7", true},
+		{"0 0 * * 5-7", true},
+		{"5/10 * * * *", true},
+		{"@daily", true},
+		{"  @weekly  ", true},
+		{"@every 10m", true},
+		{"@every 1s", true},
+		{"", false},
+		{"* * * *", false},
+		{"* * * * * *", false},
+		{"60 * * * *", false},
+		{"* 24 * * *", false},
+		{"* * 0 * *", false},
+		{"* * 32 * *", false},
+		{"* * * 13 *", false},
+		{"* * * * 8", false},
+		{"5-1 * * * *", false},
+		{"*/0 * * * *", false},
+		{"*/x * * * *", false},
+		{"a * * * *", false},
+		{"1-x * * * *", false},
+		{"@fortnightly", false},
+		{"@every 500ms", false},
+		{"@every soon", false},
+	} {
+		_, err := Parse(tt.spec)
+		if got := err == nil; got != tt.valid {
+			t.Errorf("Parse(%q): err = %v, want valid %v", tt.spec, err, tt.valid)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// 2024-03-15 is a Friday
+	after := time.Date(2024, 3, 15, 10, 20, 30, 0, time.UTC)
+	at := func(month time.Month, day, hour, minute int) time.Time {
+		return time.Date(2024, month, day, hour, minute, 0, 0, time.UTC)
+	}
+
+	for _, tt := range []struct {
+		spec string
+		want time.Time
+	}{
+		{"* * * * *", at(3, 15, 10, 21)},
+		{"*/15 * * * *", at(3, 15, 10, 30)},
+		{"20 * * * *", at(3, 15, 11, 20)},
+		{"@hourly", at(3, 15, 11, 0)},
+		{"@daily", at(3, 16, 0, 0)},
+		{"0 3 * * 1-5", at(3, 18, 3, 0)}, // Monday
+		{"0 0 * * 0", at(3, 17, 0, 0)},
+		{"0 0 * * 7", at(3, 17, 0, 0)}, // 7 is Sunday too
+		{"@weekly", at(3, 17, 0, 0)},
+		{"0 9 1 * *", at(4, 1, 9, 0)},
+		{"@monthly", at(4, 1, 0, 0)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// A restricted day of month and day of week match when either does
+		{"0 0 20 * 6", at(3, 16, 0, 0)},
+		{"0 0 16 * 1", at(3, 16, 0, 0)},
+		{"0 0 30 2 *", time.Time{}}, // never
+		{"@every 90s", time.Date(2024, 3, 15, 10, 22, 0, 0, time.UTC)},
+	} {
+		schedule, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.spec, err)
+		}
+		if got := schedule.Next(after); !got.Equal(tt.want) {
+			t.Errorf("%q: next run after %s is %s, want %s", tt.spec, after, got, tt.want)
+		}
+	}
+}
+
+func TestNextUsesUTC(t *testing.T) {
+	schedule, err := Parse("0 12 * * *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	berlin := time.FixedZone("CET", 60*60)
+	after := time.Date(2024, 3, 15, 12, 30, 0, 0, berlin) // 11:30 UTC
+	if got, want := schedule.Next(after), time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC); !got.Equal(want) {
+		t.Errorf("next run %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,31 @@
+package scheduler
+
+import (
+	"context"
+	"fmt"
+
+	"go-crud/config"
+	"go-crud/models"
+)
+
+// RegisterJobs adds the application's jobs to the default scheduler
+func RegisterJobs() error {
+	return Default.Register(Job{
+		Name: "expire-pending-orders",
+		Spec: config.AppConfig.ExpireOrdersSchedule,
+		Run:  expirePendingOrders,
+	})
+}
+
+// expirePendingOrders cancels orders left pending for longer than the configured TTL
+func expirePendingOrders(ctx context.Context) (string, error) {
+	ttl := config.AppConfig.PendingOrderTTL
+	cancelled, err := models.CancelStaleOrders(ttl)
+	if err != nil {
+		return "", err
+	}
+	if len(cancelled) == 0 {
+		return fmt.Sprintf("no pending orders older than %s", ttl), nil
+	}
+	return fmt.Sprintf("cancelled %d pending order(s) older than %s: %v", len(cancelled), ttl, cancelled), nil
+}
@@ -0,0 +1,200 @@
+// Package scheduler runs background jobs in-process on cron-like schedules.
+//
+// Before each run a job takes a lock in the database, so when several servers share a database
+// only one of them runs it. Every run is recorded in the job_runs table.
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"go-crud/models"
+)
+
+// Job is a named task run on a schedule. Run returns a short summary of what it did.
+type Job struct {
+	Name     string
+	Spec     string        // schedule as given to Parse
+	Timeout  time.Duration // how long a run may hold the lock; defaults to 10 minutes
+	Run      func(ctx context.Context) (string, error)
+	schedule Schedule
+	next     time.Time
+	running  bool
+}
+
+// JobInfo describes a registered job
+type JobInfo struct {
+	Name     string         `json:"name"`
+	Schedule string         `json:"schedule"`
+	NextRun  *time.Time     `json:"next_run,omitempty"`
+	Running  bool           `json:"running"`
+	LastRun  *models.JobRun `json:"last_run,omitempty"`
+}
+
+// Scheduler holds registered jobs and runs them when they are due
+type Scheduler struct {
+	mu       sync.Mutex
+	jobs     map[string]*Job
+	instance string
+	tick     time.Duration
+	wg       sync.WaitGroup
+}
+
+// Default is the scheduler used by the server
+var Default = New()
+
+// New returns an empty scheduler. Its instance name identifies this process in locks and run history.
+func New() *Scheduler {
+	host, _ := os.Hostname()
+	return &Scheduler{
+		jobs:     make(map[string]*Job),
+		instance: fmt.Sprintf("%s:%d", host, os.Getpid()),
+		tick:     time.Second,
+	}
+}
+
+// Register adds a job. It fails if the schedule is invalid or the name is taken.
+func (s *Scheduler) Register(job Job) error {
+	schedule, err := Parse(job.Spec)
+	if err != nil {
+		return err
+	}
+	if job.Timeout <= 0 {
+		job.Timeout = 10 * time.Minute
+	}
+	job.schedule = schedule
+	job.next = schedule.Next(time.Now())
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.jobs[job.Name]; exists {
+		return fmt.Errorf("job %q is already registered", job.Name)
+	}
+	s.jobs[job.Name] = &job
+	return nil
+}
+
+// Start runs due jobs in the background until ctx is cancelled
+func (s *Scheduler) Start(ctx context.Context) {
+	s.mu.Lock()
+	log.Printf("Scheduler started with %d job(s) as %s", len(s.jobs), s.instance)
+	s.mu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(s.tick)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				s.runDue(ctx, now)
+			}
+		}
+	}()
+}
+
+// Wait blocks until running jobs have finished, e.g. after cancelling the context given to Start
+func (s *Scheduler) Wait() {
+	s.wg.Wait()
+}
+
+// runDue starts every job whose next run time has passed. A job still running from its
+// previous run is skipped.
+func (s *Scheduler) runDue(ctx context.Context, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, job := range s.jobs {
+		if job.running || job.next.IsZero() || now.Before(job.next) {
+			continue
+		}
+		job.next = job.schedule.Next(now)
+		job.running = true
+		s.wg.Add(1)
+		go func(job *Job) {
+			defer s.wg.Done()
+			s.execute(ctx, job)
+			s.mu.Lock()
+			job.running = false
+			s.mu.Unlock()
+		}(job)
+	}
+}
+
+// execute runs a job once if this instance gets its lock, recording the run
+func (s *Scheduler) execute(ctx context.Context, job *Job) {
+	locked, err := models.AcquireJobLock(job.Name, s.instance, time.Now().Add(job.Timeout))
+	if err != nil {
+		log.Printf("Job %s: acquiring lock: %v", job.Name, err)
+		return
+	}
+	if !locked {
+		return // another instance is running it
+	}
+	defer func() {
+		if err := models.ReleaseJobLock(job.Name, s.instance); err != nil {
+			log.Printf("Job %s: releasing lock: %v", job.Name, err)
+		}
+	}()
+
+	runID, err := models.StartJobRun(job.Name, s.instance)
+	if err != nil {
+		log.Printf("Job %s: recording run: %v", job.Name, err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, job.Timeout)
+	defer cancel()
+
+	message, err := runJob(ctx, job)
+	status := models.JobRunSucceeded
+	if err != nil {
+		status, message = models.JobRunFailed, err.Error()
+		log.Printf("Job %s failed: %v", job.Name, err)
+	}
+	if err := models.FinishJobRun(runID, status, message); err != nil {
+		log.Printf("Job %s: recording result: %v", job.Name, err)
+	}
+}
+
+// runJob calls the job, turning a panic into an error so one bad run doesn't stop the server
+func runJob(ctx context.Context, job *Job) (message string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return job.Run(ctx)
+}
+
+// Jobs describes the registered jobs with their last recorded run, sorted by name
+func (s *Scheduler) Jobs() ([]JobInfo, error) {
+	s.mu.Lock()
+	infos := make([]JobInfo, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		info := JobInfo{Name: job.Name, Schedule: job.Spec, Running: job.running}
+		if !job.next.IsZero() {
+			next := job.next
+			info.NextRun = &next
+		}
+		infos = append(infos, info)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	for i := range infos {
+		run, err := models.GetLastJobRun(infos[i].Name)
+		if err == nil {
+			infos[i].LastRun = &run
+		} else if err != sql.ErrNoRows {
+			return nil, err
+		}
+	}
+	return infos, nil
+}
@@ -0,0 +1,113 @@
+package scheduler
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go-crud/models"
+)
+
+// useTestDatabase points models.DB at a migrated SQLite database for the test
+func useTestDatabase(t *testing.T) {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	prevDB, prevDriver := models.DB, models.Driver
+	db, err := models.Open(models.DriverSQLite, filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	models.DB = db
+	t.Cleanup(func() {
+		db.Close()
+		models.DB, models.Driver = prevDB, prevDriver
+		log.SetOutput(os.Stderr)
+	})
+	if _, err := models.MigrateUp(0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSchedulersSharingADatabaseRunAJobOnce(t *testing.T) {
+	useTestDatabase(t)
+
+	var runs atomic.Int32
+	job := Job{Name: "report", Spec: "@every 1m", Run: func(ctx context.Context) (string, error) {
+		runs.Add(1)
+		time.Sleep(50 * time.Millisecond) // holds the lock while the other server tries
+		return "done", nil
+	}}
+
+	// Two servers, as New would name them in two processes
+	servers := []*Scheduler{New(), New()}
+	for i, s := range servers {
+		s.instance = []string{"web-1", "web-2"}[i]
+		if err := s.Register(job); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	due := time.Now().Add(2 * time.Minute)
+	var wg sync.WaitGroup
+	for _, s := range servers {
+		wg.Add(1)
+		go func(s *Scheduler) {
+			defer wg.Done()
+			s.runDue(context.Background(), due)
+			s.Wait()
+		}(s)
+	}
+	wg.Wait()
+
+	if n := runs.Load(); n != 1 {
+		t.Fatalf("the job ran %d times, want 1", n)
+	}
+	run, err := models.GetLastJobRun("report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != models.JobRunSucceeded || run.Message != "done" {
+		t.Errorf("last run %s: %q", run.Status, run.Message)
+	}
+
+	// The lock is released after the run, so the next one can go to either server
+	servers[1].runDue(context.Background(), due.Add(2*time.Minute))
+	servers[1].Wait()
+	if n := runs.Load(); n != 2 {
+		t.Errorf("the job ran %d times after its next run, want 2", n)
+	}
+}
+
+func TestSchedulerRecordsFailures(t *testing.T) {
+	useTestDatabase(t)
+
+	s := New()
+	err := s.Register(Job{Name: "broken", Spec: "@every 1m", Run: func(ctx context.Context) (string, error) {
+		panic("boom")
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Register(Job{Name: "broken", Spec: "@hourly"}); err == nil {
+		t.Error("registered a second job with the same name")
+	}
+	if err := s.Register(Job{Name: "invalid", Spec: "every minute"}); err == nil {
+		t.Error("registered a job with an invalid schedule")
+	}
+
+	s.runDue(context.Background(), time.Now().Add(2*time.Minute))
+	s.Wait()
+	run, err := models.GetLastJobRun("broken")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != models.JobRunFailed || run.Message != "panic: boom" {
+		t.Errorf("last run %s: %q", run.Status, run.Message)
+	}
+}
@@ -2,8 +2,14 @@
 
 echo "Testing Order CRUD API..."
 
+# Every route must be in the OpenAPI document
+go run ./cmd/go-crud openapi -check || exit 1
+
+# Add the sample data the requests below use; this is skipped if the database already has users
+go run ./cmd/go-crud migrate up && go run ./cmd/go-crud seed
+
 # Start the server in the background (comment this out if your server is already running)
-go run main.go &
+go run ./cmd/go-crud serve &
 SERVER_PID=$!
 
 # Give the server a moment to start
@@ -35,7 +41,7 @@ echo -e "\n\n=== Testing Order Endpoints ==="
 make_request "GET" "/orders"
 
 # Place a new order
-make_request "POST" "/orders/place" '{
+make_request "POST" "/orders" '{
   "user_id": 1,
   "items": [
     {"product_id": 1, "quantity": 2},
@@ -47,16 +53,15 @@ make_request "POST" "/orders/place" '{
 make_request "GET" "/orders"
 
 # Get a specific order (adjust ID as needed based on your database)
-make_request "GET" "/orders/get?id=1"
+make_request "GET" "/orders/1"
 
 # Update order status
-make_request "PUT" "/orders/update-status" '{
-  "id": 1,
+make_request "PATCH" "/orders/1" '{
   "status": "shipped"
 }'
 
 # Get the updated order
-make_request "GET" "/orders/get?id=1"
+make_request "GET" "/orders/1"
 
 # Visit the admin dashboard to see all data
 echo -e "\n\n=== Admin Dashboard ==="
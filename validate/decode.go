@@ -0,0 +1,122 @@
+package validate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"go-crud/models"
+)
+
+// MaxBodyBytes bounds the size of request bodies
+const MaxBodyBytes = 1 << 20
+
+var (
+	ErrEmptyBody    = errors.New("request body is empty")
+	ErrInvalidBody  = errors.New("invalid request body")
+	ErrBodyTooLarge = errors.New("request body is too large")
+)
+
+// ReadBody reads the request body, failing with ErrBodyTooLarge past MaxBodyBytes
+func ReadBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, MaxBodyBytes))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return nil, fmt.Errorf("%w: the limit is %d bytes", ErrBodyTooLarge, tooLarge.Limit)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBody, err)
+	}
+	return body, nil
+}
+
+// Decode reads a JSON request body into v. Unlike json.Decoder it rejects fields v does not
+// have, bodies over MaxBodyBytes and anything after the JSON value. A field of the wrong type
+// or an unknown field is returned as a *models.ValidationError; other failures wrap
+// ErrEmptyBody, ErrInvalidBody or ErrBodyTooLarge. Decode does not check the validate tags of
+// v; call Struct once the request is complete.
+func Decode(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	body, err := ReadBody(w, r)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		return ErrEmptyBody
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return decodeError(err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("%w: unexpected data after the JSON value", ErrInvalidBody)
+	}
+	return nil
+}
+
+// decodeError turns an encoding/json error into a message for the client
+func decodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		if typeErr.Field == "" {
+			return fmt.Errorf("%w: the body must be %s", ErrInvalidBody, jsonType(typeErr.Type))
+		}
+		return &models.ValidationError{Fields: []models.FieldError{{
+			Field:   typeErr.Field,
+			Code:    models.FieldInvalid,
+			Message: fmt.Sprintf("%s must be %s, not %s", typeErr.Field, jsonType(typeErr.Type), typeErr.Value),
+		}}}
+	}
+
+	// encoding/json has no error type for unknown fields
+	if name, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		name = strings.Trim(name, `"`)
+		return &models.ValidationError{Fields: []models.FieldError{{
+			Field:   name,
+			Code:    models.FieldUnknown,
+			Message: name + " is not a known field",
+		}}}
+	}
+
+	var timeErr *time.ParseError
+	if errors.As(err, &timeErr) {
+		return fmt.Errorf("%w: %q is not an RFC 3339 time such as 2006-01-02T15:04:05Z", ErrInvalidBody, timeErr.Value)
+	}
+
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return fmt.Errorf("%w: %v at offset %d", ErrInvalidBody, err, syntaxErr.Offset)
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		return fmt.Errorf("%w: unexpected end of JSON", ErrInvalidBody)
+	}
+	return fmt.Errorf("%w: %v", ErrInvalidBody, err)
+}
+
+// jsonType names the JSON type a Go type decodes from, with its article
+func jsonType(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	}
+	return "an object"
+}
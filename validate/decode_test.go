@@ -0,0 +1,82 @@
+package validate
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-crud/models"
+)
+
+type decodeRequest struct {
+	Name     string    `json:"name"`
+	Quantity int       `json:"quantity"`
+	Tags     []string  `json:"tags"`
+	At       time.Time `json:"at"`
+}
+
+func decode(body string) (decodeRequest, error) {
+	var req decodeRequest
+	r := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	err := Decode(httptest.NewRecorder(), r, &req)
+	return req, err
+}
+
+func TestDecode(t *testing.T) {
+	req, err := decode(` {"name": "lamp", "quantity": 2, "tags": ["home"], "at": "2026-10-01T12:00:00Z"} ` + "\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Name != "lamp" || req.Quantity != 2 || len(req.Tags) != 1 || req.At.Day() != 1 {
+		t.Errorf("decoded %+v", req)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		name, body string
+		want       error
+		detail     string
+	}{
+		{"empty", "", ErrEmptyBody, ""},
+		{"blank", " \n\t", ErrEmptyBody, ""},
+		{"syntax", `{"name": }`, ErrInvalidBody, "at offset"},
+		{"truncated", `{"name": "lamp"`, ErrInvalidBody, "unexpected end of JSON"},
+		{"trailing data", `{"name": "lamp"} {}`, ErrInvalidBody, "after the JSON value"},
+		{"not an object", `[1, 2]`, ErrInvalidBody, "must be an object"},
+		{"time", `{"at": "yesterday"}`, ErrInvalidBody, "RFC 3339"},
+		{"too large", `{"name": "` + strings.Repeat("x", MaxBodyBytes) + `"}`, ErrBodyTooLarge, "1048576 bytes"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := decode(tt.body)
+			if !errors.Is(err, tt.want) || !strings.Contains(err.Error(), tt.detail) {
+				t.Errorf("Decode = %v, want %v with %q", err, tt.want, tt.detail)
+			}
+		})
+	}
+}
+
+func TestDecodeFieldErrors(t *testing.T) {
+	tests := []struct {
+		body, field, code, message string
+	}{
+		{`{"name": "lamp", "colour": "red"}`, "colour", models.FieldUnknown, "colour is not a known field"},
+		{`{"quantity": "two"}`, "quantity", models.FieldInvalid, "quantity must be an integer, not string"},
+		{`{"tags": "home"}`, "tags", models.FieldInvalid, "tags must be an array, not string"},
+	}
+	for _, tt := range tests {
+		_, err := decode(tt.body)
+		var verr *models.ValidationError
+		if !errors.As(err, &verr) {
+			t.Errorf("Decode(%s) = %v, want a *models.ValidationError", tt.body, err)
+			continue
+		}
+		want := models.FieldError{Field: tt.field, Code: tt.code, Message: tt.message}
+		if len(verr.Fields) != 1 || verr.Fields[0] != want {
+			t.Errorf("Decode(%s) fields = %+v, want %+v", tt.body, verr.Fields, want)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+// Package validate checks request structs against rules declared in their validate tags and
+// reports every invalid field at once, as a *models.ValidationError:
+//
+//	type itemRequest struct {
+//		ProductID int    `json:"product_id" validate:"required"`
+//		Quantity  int    `json:"quantity" validate:"min=1,max=1000"`
+//		Note      string `json:"note" validate:"omitempty,max=200"`
+//	}
+//
+// Rules are applied in order and the first failing rule of a field is reported:
+//
+//	required      the value is not zero: not empty or blank, not 0, not nil
+//	omitempty     skip the remaining rules when the value is zero
+//	min=n, max=n  the bounds of a number, the length of a string in characters, or the
+//	              number of entries of a slice or map
+//	gt=n, lt=n    exclusive bounds of a number
+//	oneof=a b c   a string is one of the listed values; on a slice, every entry is
+//	email         a single email address without a display name
+//	country       an ISO 3166 country code, name or alias known to the geo package
+//
+// Fields are named by their json tags. Nested structs, pointers to structs and slices of structs
+// are checked too, with paths such as "items[2].quantity". Checks that tags cannot express,
+// such as those across fields, go in a Validate method (see Validator).
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go-crud/geo"
+	"go-crud/models"
+)
+
+// Validator is implemented by requests with rules tags cannot express. Validate runs after the
+// tag rules, even if some failed, so it must not assume the other fields are valid. Its errors
+// name fields relative to the struct, and are dropped for fields the tags already reported.
+type Validator interface {
+	Validate() []models.FieldError
+}
+
+// Rule is one rule of a validate tag, such as {Name: "min", Param: "1"}
+type Rule struct {
+	Name  string
+	Param string
+}
+
+// Parse splits a validate tag into its rules
+func Parse(tag string) []Rule {
+	var rules []Rule
+	for _, part := range strings.Split(tag, ",") {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		name, param, _ := strings.Cut(part, "=")
+		rules = append(rules, Rule{Name: name, Param: param})
+	}
+	return rules
+}
+
+// Struct checks v, a struct or a pointer to one, and returns a *models.ValidationError listing
+// every invalid field, or nil
+func Struct(v interface{}) error {
+	if fields := Fields(v); len(fields) > 0 {
+		return &models.ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// Fields checks v like Struct and returns the invalid fields
+func Fields(v interface{}) []models.FieldError {
+	var c checker
+	c.value(reflect.ValueOf(v), "")
+	return c.fields
+}
+
+// FieldName returns the JSON name of a struct field, or "" if encoding/json leaves it out
+func FieldName(f reflect.StructField) string {
+	tag := f.Tag.Get("json")
+	if tag == "-" || !f.IsExported() {
+		return ""
+	}
+	name, _, _ := strings.Cut(tag, ",")
+	if name == "" {
+		name = f.Name
+	}
+	return name
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	validatorType = reflect.TypeOf((*Validator)(nil)).Elem()
+)
+
+type checker struct {
+	fields []models.FieldError
+}
+
+func (c *checker) add(field, code, format string, args ...interface{}) {
+	c.fields = append(c.fields, models.FieldError{Field: field, Code: code, Message: field + " " + fmt.Sprintf(format, args...)})
+}
+
+// value descends into structs, pointers and slices, checking the fields of every struct it finds
+func (c *checker) value(v reflect.Value, path string) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		if v.Type() != timeType {
+			c.structFields(v, path)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			c.value(v.Index(i), fmt.Sprintf("%s[%d]", path, i))
+		}
+	}
+}
+
+func (c *checker) structFields(v reflect.Value, path string) {
+	before := len(c.fields)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Tag.Get("json") == "" {
+			c.value(v.Field(i), path) // embedded structs are flattened, as in encoding/json
+			continue
+		}
+		name := FieldName(f)
+		if name == "" {
+			continue
+		}
+		if path != "" {
+			name = path + "." + name
+		}
+		if c.field(v.Field(i), name, Parse(f.Tag.Get("validate"))) {
+			c.value(v.Field(i), name)
+		}
+	}
+
+	if !reflect.PointerTo(t).Implements(validatorType) {
+		return
+	}
+	reported := map[string]bool{}
+	for _, fe := range c.fields[before:] {
+		reported[fe.Field] = true
+	}
+	p := reflect.New(t)
+	p.Elem().Set(v)
+	for _, fe := range p.Interface().(Validator).Validate() {
+		if path != "" {
+			fe.Field = path + "." + fe.Field
+		}
+		if !reported[fe.Field] {
+			c.fields = append(c.fields, fe)
+		}
+	}
+}
+
+// field applies the rules of one field and reports whether they all passed
+func (c *checker) field(v reflect.Value, name string, rules []Rule) bool {
+	zero := isZero(v)
+	for v.Kind() == reflect.Ptr && !v.IsNil() {
+		v = v.Elem()
+	}
+
+	for _, rule := range rules {
+		switch rule.Name {
+		case "required":
+			if zero {
+				c.add(name, models.FieldRequired, "is required")
+				return false
+			}
+		case "omitempty":
+			if zero {
+				return true
+			}
+		case "min", "max", "gt", "lt":
+			if !c.bound(v, name, rule) {
+				return false
+			}
+		case "oneof":
+			if !c.oneOf(v, name, strings.Fields(rule.Param)) {
+				return false
+			}
+		case "email":
+			if addr, err := mail.ParseAddress(v.String()); err != nil || addr.Address != v.String() {
+				c.add(name, models.FieldInvalid, "must be a valid email address")
+				return false
+			}
+		case "country":
+			if _, ok := geo.LookupCountry(v.String()); !ok {
+				c.add(name, models.FieldUnknownCountry, "must be an ISO 3166 country code or name, not %q", v.String())
+				return false
+			}
+		default:
+			panic(fmt.Sprintf("validate: unknown rule %q on %s", rule.Name, name))
+		}
+	}
+	return true
+}
+
+// bound checks a min, max, gt or lt rule against a number, or the length of a string, slice or map
+func (c *checker) bound(v reflect.Value, name string, rule Rule) bool {
+	limit, err := strconv.ParseFloat(rule.Param, 64)
+	if err != nil {
+		panic(fmt.Sprintf("validate: invalid %s=%s on %s", rule.Name, rule.Param, name))
+	}
+
+	var n float64
+	unit := ""
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n = float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		n = v.Float()
+	case reflect.String:
+		n, unit = float64(utf8.RuneCountInString(v.String())), " characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		n, unit = float64(v.Len()), " entries"
+	default:
+		return true // a nil pointer: only required applies
+	}
+
+	switch {
+	case rule.Name == "min" && n < limit:
+		c.add(name, models.FieldInvalid, "must be at least %s%s", rule.Param, unit)
+	case rule.Name == "max" && n > limit:
+		c.add(name, models.FieldInvalid, "must be at most %s%s", rule.Param, unit)
+	case rule.Name == "gt" && n <= limit:
+		c.add(name, models.FieldInvalid, "must be greater than %s%s", rule.Param, unit)
+	case rule.Name == "lt" && n >= limit:
+		c.add(name, models.FieldInvalid, "must be less than %s%s", rule.Param, unit)
+	default:
+		return true
+	}
+	return false
+}
+
+// oneOf checks that a string, or every string of a slice, is one of options
+func (c *checker) oneOf(v reflect.Value, name string, options []string) bool {
+	ok := true
+	check := func(s, field string) {
+		for _, option := range options {
+			if s == option {
+				return
+			}
+		}
+		c.add(field, models.FieldInvalid, "must be one of %s", strings.Join(options, ", "))
+		ok = false
+	}
+
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		for i := 0; i < v.Len(); i++ {
+			check(v.Index(i).String(), fmt.Sprintf("%s[%d]", name, i))
+		}
+	} else {
+		check(v.String(), name)
+	}
+	return ok
+}
+
+// isZero reports whether a value counts as missing: blank strings, empty slices and maps,
+// nil pointers and zero numbers
+func isZero(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.String:
+		return strings.TrimSpace(v.String()) == ""
+	case reflect.Slice, reflect.Map:
+		return v.Len() == 0
+	}
+	return v.IsZero()
+}
@@ -0,0 +1,176 @@
+package validate
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"go-crud/models"
+)
+
+type itemRequest struct {
+	ProductID int `json:"product_id" validate:"required"`
+	Quantity  int `json:"quantity" validate:"min=1,max=1000"`
+}
+
+type shippingRequest struct {
+	Country string `json:"country" validate:"required,country"`
+	City    string `json:"city" validate:"required,max=10"`
+}
+
+type orderRequest struct {
+	Email    string           `json:"email" validate:"required,email"`
+	Status   string           `json:"status" validate:"omitempty,oneof=pending paid"`
+	Tags     []string         `json:"tags" validate:"max=2,oneof=gift rush"`
+	Discount float64          `json:"discount" validate:"gt=0,lt=100"`
+	Note     *string          `json:"note" validate:"omitempty,max=5"`
+	Items    []itemRequest    `json:"items" validate:"required"`
+	Shipping *shippingRequest `json:"shipping"`
+	Internal string           `json:"-" validate:"required"`
+}
+
+// rangeRequest checks across fields in Validate
+type rangeRequest struct {
+	From int `json:"from" validate:"min=0"`
+	To   int `json:"to"`
+}
+
+func (r *rangeRequest) Validate() []models.FieldError {
+	var fields []models.FieldError
+	if r.To < r.From {
+		fields = append(fields, models.FieldError{Field: "to", Code: models.FieldInvalid, Message: "to must not be before from"})
+	}
+	if r.From < 0 {
+		fields = append(fields, models.FieldError{Field: "from", Code: models.FieldInvalid, Message: "from is reported by its tag"})
+	}
+	return fields
+}
+
+func validOrder() orderRequest {
+	return orderRequest{
+		Email:    "buyer@example.com",
+		Tags:     []string{"gift"},
+		Discount: 10,
+		Items:    []itemRequest{{ProductID: 1, Quantity: 2}},
+		Shipping: &shippingRequest{Country: "Germany", City: "Berlin"},
+	}
+}
+
+// codes returns the code of each invalid field by its path
+func codes(t *testing.T, v interface{}) map[string]string {
+	t.Helper()
+	got := map[string]string{}
+	for _, f := range Fields(v) {
+		got[f.Field] = f.Code
+	}
+	return got
+}
+
+func TestStructAcceptsValidRequests(t *testing.T) {
+	o := validOrder()
+	if err := Struct(&o); err != nil {
+		t.Errorf("Struct(%+v) = %v", o, err)
+	}
+	if err := Struct(o); err != nil {
+		t.Errorf("Struct of a value = %v", err)
+	}
+}
+
+func TestRules(t *testing.T) {
+	note := "too long"
+	tests := []struct {
+		name   string
+		change func(o *orderRequest)
+		want   map[string]string
+	}{
+		{"required", func(o *orderRequest) { o.Email, o.Items = "  ", nil }, map[string]string{"email": "required", "items": "required"}},
+		{"email", func(o *orderRequest) { o.Email = "Buyer <buyer@example.com>" }, map[string]string{"email": "invalid"}},
+		{"not an email", func(o *orderRequest) { o.Email = "buyer" }, map[string]string{"email": "invalid"}},
+		{"oneof", func(o *orderRequest) { o.Status = "lost" }, map[string]string{"status": "invalid"}},
+		{"oneof on a slice", func(o *orderRequest) { o.Tags = []string{"gift", "fragile"} }, map[string]string{"tags[1]": "invalid"}},
+		{"max entries", func(o *orderRequest) { o.Tags = []string{"gift", "rush", "gift"} }, map[string]string{"tags": "invalid"}},
+		{"gt", func(o *orderRequest) { o.Discount = 0 }, map[string]string{"discount": "invalid"}},
+		{"lt", func(o *orderRequest) { o.Discount = 100 }, map[string]string{"discount": "invalid"}},
+		{"pointer", func(o *orderRequest) { o.Note = &note }, map[string]string{"note": "invalid"}},
+		{"nested min", func(o *orderRequest) { o.Items = append(o.Items, itemRequest{ProductID: 2}) }, map[string]string{"items[1].quantity": "invalid"}},
+		{"nested max", func(o *orderRequest) { o.Items[0].Quantity = 1001 }, map[string]string{"items[0].quantity": "invalid"}},
+		{"nested required", func(o *orderRequest) { o.Items[0].ProductID = 0 }, map[string]string{"items[0].product_id": "required"}},
+		{"country", func(o *orderRequest) { o.Shipping.Country = "Narnia" }, map[string]string{"shipping.country": models.FieldUnknownCountry}},
+		{"max characters", func(o *orderRequest) { o.Shipping.City = "Zürich-Städtli" }, map[string]string{"shipping.city": "invalid"}},
+		{"characters not bytes", func(o *orderRequest) { o.Shipping.City = "Zürichsee" }, map[string]string{}},
+		{"nil nested struct", func(o *orderRequest) { o.Shipping = nil }, map[string]string{}},
+		{"omitempty", func(o *orderRequest) { o.Status, o.Note = "", nil }, map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := validOrder()
+			tt.change(&o)
+			if got := codes(t, &o); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("invalid fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFirstFailingRuleIsReported(t *testing.T) {
+	o := validOrder()
+	o.Email = ""
+	fields := Fields(&o)
+	if len(fields) != 1 || fields[0].Message != "email is required" {
+		t.Errorf("fields = %+v", fields)
+	}
+}
+
+func TestStructReturnsValidationError(t *testing.T) {
+	err := Struct(&orderRequest{})
+	var verr *models.ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Struct = %v, want a *models.ValidationError", err)
+	}
+	// Discount has no required rule but fails gt=0; Internal is not part of the JSON
+	var names []string
+	for _, f := range verr.Fields {
+		names = append(names, f.Field)
+	}
+	if want := []string{"email", "discount", "items"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("fields = %v, want %v", names, want)
+	}
+}
+
+func TestValidator(t *testing.T) {
+	if got := codes(t, &rangeRequest{From: 5, To: 3}); !reflect.DeepEqual(got, map[string]string{"to": "invalid"}) {
+		t.Errorf("invalid fields = %v", got)
+	}
+
+	// Fields the tags reported are not reported twice
+	fields := Fields(&rangeRequest{From: -1, To: 3})
+	if len(fields) != 1 || fields[0].Message != "from must be at least 0" {
+		t.Errorf("fields = %+v", fields)
+	}
+
+	// Nested, Validate names fields from the outer struct
+	type report struct {
+		Ranges []rangeRequest `json:"ranges"`
+	}
+	if got := codes(t, report{Ranges: []rangeRequest{{}, {From: 2, To: 1}}}); !reflect.DeepEqual(got, map[string]string{"ranges[1].to": "invalid"}) {
+		t.Errorf("invalid fields = %v", got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	want := []Rule{{"omitempty", ""}, {"oneof", "a b"}, {"max", "3"}}
+	if got := Parse(" omitempty, oneof=a b,,max=3 "); !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse = %v, want %v", got, want)
+	}
+}
+
+func TestUnknownRulePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("an unknown rule did not panic")
+		}
+	}()
+	Fields(struct {
+		Name string `json:"name" validate:"uppercase"`
+	}{})
+}